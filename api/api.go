@@ -0,0 +1,9 @@
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI description of the REST API, embedded so that it is served wherever the node
+// is started from
+//
+//go:embed openapi.json
+var OpenAPI []byte
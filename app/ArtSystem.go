@@ -3,6 +3,7 @@ package app
 import (
 	"Peerster/fail"
 	"Peerster/messages"
+	"sort"
 	"sync"
 )
 
@@ -115,3 +116,22 @@ func (art *ArtSystem) Subscribe(signature string) ([]*Artwork, *Artist) {
 
 	return nil, nil
 }
+
+/*GetArtists returns the known artists sorted by name, and whether we are subscribed to each of them.*/
+func (art *ArtSystem) GetArtists() ([]messages.ArtistInfo, []bool) {
+	// Grab the mutex
+	art.mux.Lock()
+	defer art.mux.Unlock()
+
+	artists := make([]messages.ArtistInfo, 0, len(art.artists))
+	for _, artist := range art.artists {
+		artists = append(artists, *artist.Info)
+	}
+	sort.Slice(artists, func(i, j int) bool { return artists[i].Name < artists[j].Name })
+
+	subscribed := make([]bool, len(artists))
+	for i, artist := range artists {
+		_, subscribed[i] = art.subscriptions[artist.Signature]
+	}
+	return artists, subscribed
+}
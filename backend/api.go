@@ -0,0 +1,65 @@
+package backend
+
+import (
+	"Peerster/api"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// APIPrefix is the path prefix of the current version of the REST API
+	APIPrefix = "/api/v1"
+	// MaxRequestBytes is the maximum size of the body of an API request
+	MaxRequestBytes = 1 << 20
+)
+
+// APIError - An error returned by the REST API, with its HTTP status
+type APIError struct {
+	Status  int    `json:"status"` // The HTTP status code
+	Message string `json:"error"`  // A description of the error
+}
+
+// newAPIError - Creates a new APIError
+func newAPIError(status int, format string, a ...interface{}) *APIError {
+	return &APIError{Status: status, Message: fmt.Sprintf(format, a...)}
+}
+
+// Error - Returns the description of the error
+func (err *APIError) Error() string {
+	return err.Message
+}
+
+// writeJSON - Sends a JSON response with a given status
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		status, data = http.StatusInternalServerError, []byte(`{"status":500,"error":"cannot encode response"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// writeError - Sends an APIError as a JSON response
+func writeError(w http.ResponseWriter, err *APIError) {
+	writeJSON(w, err.Status, err)
+}
+
+// decodeRequest - Parses the JSON body of an API request into a typed structure. Unknown fields are
+// rejected so that typos don't go unnoticed.
+func decodeRequest(r *http.Request, request interface{}) *APIError {
+	decoder := json.NewDecoder(io.LimitReader(r.Body, MaxRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(request); err != nil {
+		return newAPIError(http.StatusBadRequest, "invalid request body: %s", err.Error())
+	}
+	return nil
+}
+
+// getOpenAPIHandler - Serves the OpenAPI description of the REST API (embedded in the binary)
+func getOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.OpenAPI)
+}
@@ -0,0 +1,556 @@
+package backend
+
+import (
+	"Peerster/channels"
+	"Peerster/files"
+	"Peerster/logger"
+	"Peerster/messages"
+	"Peerster/network"
+	"Peerster/peers"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxAPISearches is the number of searches started through the API whose results can still be queried
+const MaxAPISearches = 100
+
+/* ================ REQUESTS AND RESPONSES ================ */
+
+// NodeResponse - The identity and protocol features of the node
+type NodeResponse struct {
+	Name         string   `json:"name"`         // The node's name
+	Address      string   `json:"address"`      // The node's gossip address
+	Version      uint32   `json:"version"`      // The node's protocol version
+	Capabilities []string `json:"capabilities"` // The node's protocol features
+}
+
+// PeerRequest - A neighbor to add
+type PeerRequest struct {
+	Address string `json:"address"`          // The neighbor's <ip:port>
+	Secure  *bool  `json:"secure,omitempty"` // Whether the link is secure (the node's default if absent)
+}
+
+// PeerResponse - A neighbor
+type PeerResponse struct {
+	Address string `json:"address"` // The neighbor's <ip:port>
+	Added   bool   `json:"added"`   // Whether the neighbor is in the index (false if it is full)
+}
+
+// RumorRequest - A message to post
+type RumorRequest struct {
+	Text    string `json:"text"`              // The message's content
+	Channel string `json:"channel,omitempty"` // A joined channel ("" for the global feed)
+}
+
+// RumorResponse - A posted message
+type RumorResponse struct {
+	Origin  string `json:"origin"`            // The message's origin (the node's name)
+	ID      uint32 `json:"id"`                // The message's ID
+	Channel string `json:"channel,omitempty"` // The message's channel
+}
+
+// PrivateRequest - A private message to send
+type PrivateRequest struct {
+	Destination string `json:"destination"` // The message's destination
+	Text        string `json:"text"`        // The message's content
+}
+
+// PrivateResponse - A sent private message
+type PrivateResponse struct {
+	Origin      string `json:"origin"`      // The message's origin (the node's name)
+	Destination string `json:"destination"` // The message's destination
+}
+
+// ChannelRequest - A channel to join
+type ChannelRequest struct {
+	Name      string `json:"name"`      // The channel's name
+	Encrypted bool   `json:"encrypted"` // Whether messages are encrypted (new channels only)
+}
+
+// InviteRequest - A peer to invite to a channel
+type InviteRequest struct {
+	Destination string `json:"destination"` // The peer's name
+}
+
+// FileRequest - A file of the shared folder to index
+type FileRequest struct {
+	Filename string `json:"filename"` // The file's name in the shared folder
+}
+
+// FileResponse - A file known by the node
+type FileResponse struct {
+	Filename string `json:"filename"`          // The file's name
+	Metahash string `json:"metahash"`          // The file's metahash (hex)
+	Status   string `json:"status"`            // The file's status
+	Size     int64  `json:"size,omitempty"`    // The file's size in bytes (indexed files only)
+	Artwork  bool   `json:"artwork,omitempty"` // Whether the file is an artwork
+}
+
+// DownloadRequest - A file to download
+type DownloadRequest struct {
+	Filename string `json:"filename"`         // The name under which the file is saved
+	Metahash string `json:"metahash"`         // The file's metahash (hex)
+	Source   string `json:"source,omitempty"` // The peer to download from ("" for a file found by a search)
+}
+
+// DownloadResponse - A started download. Its ID is the file's metahash.
+type DownloadResponse struct {
+	ID       string `json:"id"`               // The download's ID
+	Filename string `json:"filename"`         // The name under which the file is saved
+	Source   string `json:"source,omitempty"` // The peer to download from
+}
+
+// SearchRequest - A file search to start
+type SearchRequest struct {
+	Keywords []string `json:"keywords"`         // The keywords to look for in filenames
+	Budget   uint64   `json:"budget,omitempty"` // The search's budget (0 for an expanding ring)
+}
+
+// SearchResponse - A file search and its results so far
+type SearchResponse struct {
+	ID       uint64         `json:"id"`                // The search's ID
+	Keywords []string       `json:"keywords"`          // The keywords looked for
+	Done     bool           `json:"done"`              // Whether the search is over
+	Results  []FileResponse `json:"results,omitempty"` // The matching files found so far
+}
+
+// SubscriptionRequest - An artist to subscribe to
+type SubscriptionRequest struct {
+	Signature string `json:"signature"` // The artist's signature
+}
+
+// LogLevels - The levels of the logs: the default one and those of the subsystems, by tag (error, info, debug
+// or trace). In a request, only the levels given are changed.
+type LogLevels struct {
+	Level string            `json:"level,omitempty"` // Level of the subsystems without their own
+	Tags  map[string]string `json:"tags,omitempty"`  // Levels of the subsystems, by tag
+}
+
+/* ================ SEARCHES ================ */
+
+// apiSearch - A file search started through the API
+type apiSearch struct {
+	keywords []string // The keywords looked for
+	matchID  uint64   // The search's ID in the gossiper's SearchMatches
+	done     bool     // Whether the search is over
+}
+
+// apiSearches - The searches started through the API
+var apiSearches = struct {
+	searches map[uint64]*apiSearch // A mapping from search ID to search
+	nextID   uint64                // The ID of the next search
+	mux      sync.Mutex            // Mutex to manipulate the structure from different threads
+}{searches: make(map[uint64]*apiSearch), nextID: 1}
+
+// startSearch - Registers a new search and starts it in the background, returns its ID
+func startSearch(keywords []string, budget uint64) uint64 {
+	apiSearches.mux.Lock()
+	id := apiSearches.nextID
+	apiSearches.nextID++
+	search := &apiSearch{keywords: keywords, matchID: gossiper.SearchMatches.Register(keywords)}
+	apiSearches.searches[id] = search
+	if id > MaxAPISearches { // Forget the oldest one
+		if oldest, ok := apiSearches.searches[id-MaxAPISearches]; ok {
+			gossiper.SearchMatches.Forget(oldest.matchID)
+		}
+		delete(apiSearches.searches, id-MaxAPISearches)
+	}
+	apiSearches.mux.Unlock()
+
+	go func() {
+		network.OnInitiateFileSearch(gossiper, budget, keywords)
+		gossiper.SearchMatches.Finish(search.matchID)
+
+		apiSearches.mux.Lock()
+		search.done = true
+		apiSearches.mux.Unlock()
+	}()
+	return id
+}
+
+/* ================ ROUTES ================ */
+
+// registerAPIv1 - Registers the routes of the REST API
+func registerAPIv1(r *mux.Router) {
+	api := r.PathPrefix(APIPrefix).Subrouter()
+
+	api.HandleFunc("/openapi.json", getOpenAPIHandler).Methods("GET")
+	api.HandleFunc("/node", apiGetNode).Methods("GET")
+	api.HandleFunc("/peers", apiGetPeers).Methods("GET")
+	api.HandleFunc("/peers", apiPostPeer).Methods("POST")
+	api.HandleFunc("/routes", apiGetRoutes).Methods("GET")
+	api.HandleFunc("/rumors", apiGetRumors).Methods("GET")
+	api.HandleFunc("/rumors", apiPostRumor).Methods("POST")
+	api.HandleFunc("/private", apiPostPrivate).Methods("POST")
+	api.HandleFunc("/channels", apiGetChannels).Methods("GET")
+	api.HandleFunc("/channels", apiPostChannel).Methods("POST")
+	api.HandleFunc("/channels/{name}", apiDeleteChannel).Methods("DELETE")
+	api.HandleFunc("/channels/{name}/invites", apiPostInvite).Methods("POST")
+	api.HandleFunc("/files", apiGetFiles).Methods("GET")
+	api.HandleFunc("/files", apiPostFile).Methods("POST")
+	api.HandleFunc("/files/{filename}", apiPutFile).Methods("PUT")
+	api.HandleFunc("/downloads", apiPostDownload).Methods("POST")
+	api.HandleFunc("/downloads/{id}", apiGetDownload).Methods("GET")
+	api.HandleFunc("/searches", apiPostSearch).Methods("POST")
+	api.HandleFunc("/searches/{id}", apiGetSearch).Methods("GET")
+	api.HandleFunc("/subscriptions", apiPostSubscription).Methods("POST")
+	api.HandleFunc("/logs/levels", apiGetLogLevels).Methods("GET")
+	api.HandleFunc("/logs/levels", apiPutLogLevels).Methods("PUT")
+}
+
+/* ================ HANDLERS ================ */
+
+func apiGetNode(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, NodeResponse{
+		Name:         gossiper.Args.Name,
+		Address:      gossiper.Args.GossipAddr,
+		Version:      messages.ProtocolVersion,
+		Capabilities: messages.LocalCapabilities(!gossiper.Args.Insecure && !gossiper.Args.SimpleMode),
+	})
+}
+
+func apiGetPeers(w http.ResponseWriter, r *http.Request) {
+	addrs := make([]string, 0)
+	for _, addr := range gossiper.PeerIndex.GetAllPeers() {
+		addrs = append(addrs, peers.UDPAddressToString(addr))
+	}
+	sort.Strings(addrs)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"peers": addrs})
+}
+
+func apiPostPeer(w http.ResponseWriter, r *http.Request) {
+	var request PeerRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp4", request.Address)
+	if err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid address %q", request.Address))
+		return
+	}
+
+	if request.Secure != nil {
+		gossiper.SecureLinks.SetPeerMode(udpAddr.String(), *request.Secure)
+	}
+	added := gossiper.PeerIndex.AddPeerIfAbsent(udpAddr)
+	writeJSON(w, http.StatusCreated, PeerResponse{Address: peers.UDPAddressToString(udpAddr), Added: added})
+}
+
+func apiGetRoutes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"routes": gossiper.Router.GetRoutes()})
+}
+
+func apiGetRumors(w http.ResponseWriter, r *http.Request) {
+	page, err := getHistoryPage(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func apiPostRumor(w http.ResponseWriter, r *http.Request) {
+	var request RumorRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if request.Text == "" {
+		writeError(w, newAPIError(http.StatusBadRequest, "empty text"))
+		return
+	}
+	if request.Channel != "" && !gossiper.Channels.IsJoined(request.Channel) {
+		writeError(w, newAPIError(http.StatusNotFound, "channel %s not joined", request.Channel))
+		return
+	}
+
+	rumor := &messages.RumorMessage{Text: request.Text, Channel: request.Channel}
+	if err := network.PostClientRumor(gossiper, rumor); err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "%s", err.Error()))
+		return
+	}
+	go network.SpreadClientRumor(gossiper, rumor, <-(*idChannel))
+	writeJSON(w, http.StatusCreated, RumorResponse{Origin: rumor.Origin, ID: rumor.ID, Channel: rumor.Channel})
+}
+
+func apiPostPrivate(w http.ResponseWriter, r *http.Request) {
+	var request PrivateRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if request.Text == "" || request.Destination == "" {
+		writeError(w, newAPIError(http.StatusBadRequest, "missing text or destination"))
+		return
+	}
+	if gossiper.Router.GetTarget(request.Destination) == nil {
+		writeError(w, newAPIError(http.StatusNotFound, "no route to %s", request.Destination))
+		return
+	}
+
+	network.OnReceiveClientPrivate(gossiper, &messages.PrivateMessage{Destination: request.Destination, Text: request.Text})
+	writeJSON(w, http.StatusCreated, PrivateResponse{Origin: gossiper.Args.Name, Destination: request.Destination})
+}
+
+func apiGetChannels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"channels": gossiper.Channels.GetChannels(), "invites": gossiper.Channels.GetInvites()})
+}
+
+func apiPostChannel(w http.ResponseWriter, r *http.Request) {
+	var request ChannelRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if !channels.IsValidName(request.Name) {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid channel name %q", request.Name))
+		return
+	}
+	if err := network.OnJoinChannel(gossiper, request.Name, request.Encrypted); err != nil {
+		writeError(w, newAPIError(http.StatusConflict, "%s", err.Error()))
+		return
+	}
+	if !gossiper.Channels.IsJoined(request.Name) {
+		// Accepted invitation to an encrypted channel: joined once the inviter sent its key
+		writeJSON(w, http.StatusAccepted, channels.ChannelInfo{Name: request.Name, Encrypted: true, Members: []string{}, Pending: true})
+		return
+	}
+	info := channels.ChannelInfo{Name: request.Name, Encrypted: request.Encrypted, Members: []string{gossiper.Args.Name}}
+	for _, channel := range gossiper.Channels.GetChannels() {
+		if channel.Name == request.Name {
+			info = channel
+		}
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+func apiDeleteChannel(w http.ResponseWriter, r *http.Request) {
+	if err := network.OnLeaveChannel(gossiper, mux.Vars(r)["name"]); err != nil {
+		writeError(w, newAPIError(http.StatusNotFound, "%s", err.Error()))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func apiPostInvite(w http.ResponseWriter, r *http.Request) {
+	var request InviteRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if !gossiper.Channels.IsJoined(name) {
+		writeError(w, newAPIError(http.StatusNotFound, "channel %s not joined", name))
+		return
+	}
+	if err := network.OnInviteChannel(gossiper, name, request.Destination); err != nil {
+		writeError(w, newAPIError(http.StatusNotFound, "%s", err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"channel": name, "destination": request.Destination})
+}
+
+// toFileResponse - Converts a file summary to a FileResponse
+func toFileResponse(file *files.FileSummary) FileResponse {
+	return FileResponse{Filename: file.Filename, Metahash: file.Metahash, Status: file.Status.String(), Artwork: file.IsArtwork}
+}
+
+func apiGetFiles(w http.ResponseWriter, r *http.Request) {
+	response := make([]FileResponse, 0)
+	for _, file := range gossiper.FileIndex.GetFiles() {
+		response = append(response, toFileResponse(&file))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"files": response})
+}
+
+func apiPostFile(w http.ResponseWriter, r *http.Request) {
+	var request FileRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if !files.IsValidFilename(request.Filename) {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid filename %q", request.Filename))
+		return
+	}
+	if _, err := os.Stat(filepath.Join(files.SharedFilesDir, request.Filename)); err != nil {
+		writeError(w, newAPIError(http.StatusNotFound, "no file %s in the shared folder", request.Filename))
+		return
+	}
+
+	file := network.OnIndexLocalFile(gossiper, request.Filename, gossiper.Args.TxHopLimit+1)
+	if file == nil {
+		writeError(w, newAPIError(http.StatusConflict, "cannot index %s (already indexed or too big)", request.Filename))
+		return
+	}
+	writeJSON(w, http.StatusCreated, fileResponse(file))
+}
+
+func apiPostDownload(w http.ResponseWriter, r *http.Request) {
+	var request DownloadRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if !files.IsValidFilename(request.Filename) {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid filename %q", request.Filename))
+		return
+	}
+	metahash, err := hex.DecodeString(request.Metahash)
+	if err != nil || len(metahash) != files.HashSizeBytes {
+		writeError(w, newAPIError(http.StatusBadRequest, "metahash must be %d hex-encoded bytes", files.HashSizeBytes))
+		return
+	}
+
+	// From a given peer, or from the peers found by a search
+	if request.Source != "" {
+		if gossiper.Router.GetTarget(request.Source) == nil {
+			writeError(w, newAPIError(http.StatusNotFound, "no route to %s", request.Source))
+			return
+		}
+		err = network.OnRemoteMetafileRequestMonosource(gossiper, metahash, request.Filename, request.Source)
+	} else {
+		err = network.OnRemoteMetafileRequestMultisource(gossiper, metahash, request.Filename)
+	}
+	if err != nil {
+		writeError(w, newAPIError(http.StatusConflict, "%s", err.Error()))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, DownloadResponse{ID: files.ToHex(metahash), Filename: request.Filename, Source: request.Source})
+}
+
+func apiGetDownload(w http.ResponseWriter, r *http.Request) {
+	id := strings.ToLower(mux.Vars(r)["id"])
+	if file, ok := gossiper.FileIndex.GetFile(id); ok {
+		writeJSON(w, http.StatusOK, toFileResponse(&file))
+		return
+	}
+	writeError(w, newAPIError(http.StatusNotFound, "unknown download %s", id))
+}
+
+func apiPostSearch(w http.ResponseWriter, r *http.Request) {
+	var request SearchRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(request.Keywords) == 0 {
+		writeError(w, newAPIError(http.StatusBadRequest, "missing keywords"))
+		return
+	}
+	for _, keyword := range request.Keywords {
+		if keyword == "" || strings.Contains(keyword, ",") {
+			writeError(w, newAPIError(http.StatusBadRequest, "invalid keyword %q", keyword))
+			return
+		}
+	}
+
+	id := startSearch(request.Keywords, request.Budget)
+	writeJSON(w, http.StatusAccepted, SearchResponse{ID: id, Keywords: request.Keywords})
+}
+
+func apiGetSearch(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid search ID"))
+		return
+	}
+	apiSearches.mux.Lock()
+	search, ok := apiSearches.searches[id]
+	var response SearchResponse
+	if ok {
+		response = SearchResponse{ID: id, Keywords: search.keywords, Done: search.done}
+	}
+	apiSearches.mux.Unlock()
+	if !ok {
+		writeError(w, newAPIError(http.StatusNotFound, "unknown search %d", id))
+		return
+	}
+
+	// Results are the files found on the network by this search
+	matches, _ := gossiper.SearchMatches.GetMatches(search.matchID)
+	for _, metahash := range matches {
+		if file, ok := gossiper.FileIndex.GetFile(metahash); ok {
+			response.Results = append(response.Results, toFileResponse(&file))
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func apiPostSubscription(w http.ResponseWriter, r *http.Request) {
+	var request SubscriptionRequest
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+	if request.Signature == "" {
+		writeError(w, newAPIError(http.StatusBadRequest, "missing signature"))
+		return
+	}
+	if err := network.OnSubscribe(gossiper, request.Signature); err != nil {
+		writeError(w, newAPIError(http.StatusNotFound, "unknown artist %s", request.Signature))
+		return
+	}
+	writeJSON(w, http.StatusCreated, request)
+}
+
+func apiGetLogLevels(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentLogLevels())
+}
+
+func apiPutLogLevels(w http.ResponseWriter, r *http.Request) {
+	var request LogLevels
+	if err := decodeRequest(r, &request); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Every level is checked before any is changed
+	levels := make(map[string]logger.Level)
+	for tag, name := range request.Tags {
+		if !logger.IsTag(tag) {
+			writeError(w, newAPIError(http.StatusBadRequest, "unknown tag %s (%s)", tag, strings.Join(logger.Tags, ", ")))
+			return
+		}
+		level, err := logger.ParseLevel(name)
+		if err != nil {
+			writeError(w, newAPIError(http.StatusBadRequest, "%s: %s", tag, err.Error()))
+			return
+		}
+		levels[tag] = level
+	}
+	if request.Level != "" {
+		level, err := logger.ParseLevel(request.Level)
+		if err != nil {
+			writeError(w, newAPIError(http.StatusBadRequest, "%s", err.Error()))
+			return
+		}
+		levels[""] = level
+	}
+	for tag, level := range levels {
+		logger.SetLevel(tag, level)
+	}
+	logger.Web.Info("apiPutLogLevels", "LOG LEVELS %s", logger.FormatLevels(logger.GetLevels()))
+	writeJSON(w, http.StatusOK, currentLogLevels())
+}
+
+// currentLogLevels - Returns the levels of the logs
+func currentLogLevels() LogLevels {
+	level, tags := logger.GetLevels()
+	response := LogLevels{Level: level.String(), Tags: make(map[string]string)}
+	for tag, tagLevel := range tags {
+		response.Tags[tag] = tagLevel.String()
+	}
+	return response
+}
@@ -1,11 +1,11 @@
 package backend
 
 import (
+	"Peerster/files"
 	"Peerster/network"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
-	"os"
 	"path/filepath"
 )
 
@@ -42,7 +42,10 @@ func postDownloadHandler(w http.ResponseWriter, r *http.Request) {
 		return // Ignore
 	}
 
-	// Serve the file
-	dir, _ := filepath.Abs(filepath.Dir(os.Args[0]))
-	http.ServeFile(w, r, dir+"\\_Downloads\\"+filename)
+	// Serve the file (it must stay in the downloads folder)
+	if !files.IsValidFilename(filename) {
+		writeError(w, newAPIError(http.StatusForbidden, "invalid filename %q", filename))
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(files.DownloadedFilesDir, filename))
 }
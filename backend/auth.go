@@ -0,0 +1,189 @@
+package backend
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// TokenFile is the name of the file holding the API token in the node's data folder
+	TokenFile = "api_token"
+	// TokenHeader is the header carrying the API token (an "Authorization: Bearer" header also works)
+	TokenHeader = "X-Peerster-Token"
+	// TokenCookie is the cookie carrying the API token for the GUI
+	TokenCookie = "peerster_token"
+	// TokenBytes is the number of random bytes of an API token
+	TokenBytes = 32
+)
+
+// Types of the GUI's files that are served without a token (they contain no data of the node)
+var publicExtensions = map[string]bool{
+	".html": true,
+	".js":   true,
+	".css":  true,
+	".png":  true,
+	".jpg":  true,
+	".ico":  true,
+}
+
+// NewAPIToken - Generates a new random API token and stores it in dataDir, readable by the user only,
+// so that local scripts can authenticate to the webserver
+func NewAPIToken(dataDir string) (string, error) {
+	raw := make([]byte, TokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dataDir, TokenFile)
+	if err := ioutil.WriteFile(file, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+
+	// The file may already exist with wider permissions
+	if err := os.Chmod(file, 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// LoopbackHosts - Returns the values of the Host header accepted by a server listening on the loopback
+// interface, anything else being a DNS rebinding attempt
+func LoopbackHosts(port string) []string {
+	return []string{
+		net.JoinHostPort("127.0.0.1", port),
+		net.JoinHostPort("localhost", port),
+		net.JoinHostPort("::1", port),
+	}
+}
+
+// Guard - Returns a middleware that rejects requests coming from other origins than the GUI and requests
+// without the API token. If hosts isn't empty, only requests addressed to one of them are accepted. The
+// GUI's files (in guiDir) are public.
+func Guard(token string, hosts []string, guiDir string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			// Check the host and the origin
+			if len(hosts) > 0 && !containsHost(hosts, r.Host) {
+				writeError(w, newAPIError(http.StatusForbidden, "unknown host %s", r.Host))
+				return
+			}
+			if !isSameOrigin(r) {
+				writeError(w, newAPIError(http.StatusForbidden, "cross-origin request"))
+				return
+			}
+
+			// The GUI's files are public, the token is given to the GUI with its index page
+			if isPublicFile(r, guiDir) {
+				if isIndexPage(r.URL.Path) && (isLoopback(r.RemoteAddr) || hasToken(r.URL.Query().Get("token"), token)) {
+					http.SetCookie(w, &http.Cookie{
+						Name:     TokenCookie,
+						Value:    token,
+						Path:     "/",
+						HttpOnly: true,
+						Secure:   r.TLS != nil,
+						SameSite: http.SameSiteStrictMode,
+					})
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !hasToken(requestToken(r), token) {
+				writeError(w, newAPIError(http.StatusUnauthorized, "missing or invalid API token"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestToken - Returns the token carried by a request, from its headers or its cookie
+func requestToken(r *http.Request) string {
+	if token := r.Header.Get(TokenHeader); token != "" {
+		return token
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if cookie, err := r.Cookie(TokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// hasToken - Compares a received token with the API token in constant time
+func hasToken(received, token string) bool {
+	return received != "" && subtle.ConstantTimeCompare([]byte(received), []byte(token)) == 1
+}
+
+// isSameOrigin - Checks that a request sent by a browser comes from a page served by the webserver
+func isSameOrigin(r *http.Request) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Not a cross-origin browser request (or a script)
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(parsed.Host, r.Host)
+}
+
+// isPublicFile - Checks whether a request asks for one of the GUI's files
+func isPublicFile(r *http.Request, guiDir string) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+	if r.URL.Path == "/" || r.URL.Path == APIPrefix+"/openapi.json" {
+		return true
+	}
+	if !publicExtensions[strings.ToLower(path.Ext(r.URL.Path))] {
+		return false
+	}
+
+	// Only files that are actually in the GUI's folder
+	info, err := os.Stat(filepath.Join(guiDir, filepath.FromSlash(path.Clean(r.URL.Path))))
+	return err == nil && !info.IsDir()
+}
+
+// isIndexPage - Checks whether a path is the GUI's index page
+func isIndexPage(p string) bool {
+	return p == "/" || p == "/index.html"
+}
+
+// isLoopback - Checks whether a remote address is on the local machine
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// containsHost - Checks whether a host is in a list (case-insensitive)
+func containsHost(hosts []string, host string) bool {
+	for _, h := range hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
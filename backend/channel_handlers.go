@@ -0,0 +1,54 @@
+package backend
+
+import (
+	"Peerster/messages"
+	"Peerster/network"
+	"encoding/json"
+	"net/http"
+)
+
+func postChannelHandler(w http.ResponseWriter, r *http.Request) {
+
+	recJSON := ConfirmAndParse(w, r)
+	if recJSON == nil {
+		return // Ignore
+	}
+
+	// Typecheck
+	action, ok1 := (*recJSON)["action"].(string)
+	channel, ok2 := (*recJSON)["channel"].(string)
+	if !ok1 || !ok2 {
+		return // Ignore
+	}
+
+	encrypted, _ := (*recJSON)["encrypted"].(bool)       // Optional
+	destination, _ := (*recJSON)["destination"].(string) // Optional
+
+	// Perform the operation
+	command := &messages.ChannelCommand{Channel: channel, Encrypted: encrypted, Destination: destination}
+	switch action {
+	case "join":
+		command.Action = messages.ChannelJoin
+	case "leave":
+		command.Action = messages.ChannelLeave
+	case "invite":
+		command.Action = messages.ChannelInvite
+	default:
+		return // Ignore
+	}
+	network.OnReceiveChannelCommand(gossiper, command)
+
+}
+
+func getChannelsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Send JSON data
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	data, _ := json.Marshal(map[string]interface{}{
+		"channels": gossiper.Channels.GetChannels(),
+		"invites":  gossiper.Channels.GetInvites(),
+	})
+	w.Write(data)
+
+}
@@ -2,12 +2,16 @@ package backend
 
 import (
 	"Peerster/files"
-	"Peerster/messages"
 	"Peerster/network"
 	"encoding/hex"
+	"mime"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+
+	"github.com/gorilla/mux"
 )
 
 func postFileIndexHandler(w http.ResponseWriter, r *http.Request) {
@@ -24,27 +28,76 @@ func postFileIndexHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Index the new file
-	if file := gossiper.FileIndex.AddLocalFile(filename); file != nil {
-		// Broadcast the transaction and publish to the blockchain
-		network.OnReceiveTransaction(gossiper, &messages.TxPublish{
-			File:     file,
-			HopLimit: network.TransactionHopLimit + 1,
-		}, nil)
+	network.OnIndexLocalFile(gossiper, filename, gossiper.Args.TxHopLimit+1)
+
+}
+
+// getFileHandler - Streams a complete file from the FileIndex given its metahash. Range requests and
+// conditional requests are supported, the ETag being the metahash.
+func getFileHandler(w http.ResponseWriter, r *http.Request) {
+
+	metahash := strings.ToLower(mux.Vars(r)["metahash"])
+	if raw, err := hex.DecodeString(metahash); err != nil || len(raw) != files.HashSizeBytes {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid metahash %q", metahash))
+		return
+	}
+
+	// Only complete files whose name stays in their folder
+	path, filename, status, ok := gossiper.FileIndex.GetLocalFile(metahash)
+	if !ok {
+		writeError(w, newAPIError(http.StatusNotFound, "unknown file %s", metahash))
+		return
+	}
+	if status != files.Reconstructed {
+		writeError(w, newAPIError(http.StatusConflict, "file %s is not complete (%s)", metahash, status))
+		return
+	}
+	if path == "" {
+		writeError(w, newAPIError(http.StatusForbidden, "invalid filename %q", filename))
+		return
 	}
 
+	f, err := os.Open(path)
+	if err != nil {
+		writeError(w, newAPIError(http.StatusNotFound, "file %s is no longer available", metahash))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		writeError(w, newAPIError(http.StatusNotFound, "file %s is no longer available", metahash))
+		return
+	}
+
+	// The content type comes from the extension, otherwise it is sniffed by ServeContent
+	if contentType := mime.TypeByExtension(filepath.Ext(filename)); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.Header().Set("ETag", `"`+metahash+`"`)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+
+	// Files come from other peers, they must not run scripts on the GUI's origin
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, filename, info.ModTime(), f)
 }
 
 func postFileRequestMonoSourceHandler(w http.ResponseWriter, r *http.Request) {
 
-	recJSON := ConfirmAndParse(w, r)
-	if recJSON == nil {
-		return // Ignore
-	}
+	recJSON := parseJSON(r)
 
 	// Typecheck
-	filename, ok1 := (*recJSON)["filename"].(string)
-	metahash, ok2 := (*recJSON)["metahash"].(string)
-	destination, ok3 := (*recJSON)["destination"].(string)
+	filename, ok1 := recJSON["filename"].(string)
+	metahash, ok2 := recJSON["metahash"].(string)
+	destination, ok3 := recJSON["destination"].(string)
+
+	// The file is written in the downloads folder: its name must stay in it
+	if ok1 && !files.IsValidFilename(filename) {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid filename %q", filename))
+		return
+	}
+	confirm(w)
 	if !ok1 || !ok2 || !ok3 {
 		return // Ignore
 	}
@@ -57,14 +110,18 @@ func postFileRequestMonoSourceHandler(w http.ResponseWriter, r *http.Request) {
 
 func postFileRequestMultiSourceHandler(w http.ResponseWriter, r *http.Request) {
 
-	recJSON := ConfirmAndParse(w, r)
-	if recJSON == nil {
-		return // Ignore
-	}
+	recJSON := parseJSON(r)
 
 	// Typecheck
-	filename, ok1 := (*recJSON)["filename"].(string)
-	metahash, ok2 := (*recJSON)["metahash"].(string)
+	filename, ok1 := recJSON["filename"].(string)
+	metahash, ok2 := recJSON["metahash"].(string)
+
+	// The file is written in the downloads folder: its name must stay in it
+	if ok1 && !files.IsValidFilename(filename) {
+		writeError(w, newAPIError(http.StatusBadRequest, "invalid filename %q", filename))
+		return
+	}
+	confirm(w)
 	if !ok1 || !ok2 {
 		return // Ignore
 	}
@@ -3,7 +3,18 @@ package backend
 import (
 	"Peerster/messages"
 	"Peerster/network"
+	"Peerster/peers"
+	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// DefaultHistoryLimit is the default number of messages in a page of history
+	DefaultHistoryLimit = 50
+	// MaxHistoryLimit is the maximum number of messages in a page of history
+	MaxHistoryLimit = 500
 )
 
 func postRumorHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,9 +29,10 @@ func postRumorHandler(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return // Ignore
 	}
+	channel, _ := (*recJSON)["channel"].(string) // Optional
 
 	// Accept the new message
-	rumor := &messages.RumorMessage{Text: msg}
+	rumor := &messages.RumorMessage{Text: msg, Channel: channel}
 	network.OnReceiveClientRumor(gossiper, rumor, <-(*idChannel))
 
 }
@@ -43,3 +55,67 @@ func postPrivateHandler(w http.ResponseWriter, r *http.Request) {
 	privateMessage := &messages.PrivateMessage{Destination: dst, Text: msg}
 	network.OnReceiveClientPrivate(gossiper, privateMessage)
 }
+
+// HistoryPage - A page of the history of an origin's messages in a feed
+type HistoryPage struct {
+	Origin string              `json:"origin"` // The messages' origin
+	Rumors []peers.StoredRumor `json:"rumors"` // The messages, most recent first
+	Before uint32              `json:"before"` // The before parameter of the next page (0 if there is none)
+}
+
+func getRumorsHandler(w http.ResponseWriter, r *http.Request) {
+
+	page, apiErr := getHistoryPage(r.URL.Query())
+	if apiErr != nil {
+		http.Error(w, apiErr.Message, apiErr.Status)
+		return
+	}
+
+	// Send JSON data
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(page)
+	w.Write(data)
+
+}
+
+// getHistoryPage - Returns the page of history described by a query (origin, before, limit and channel)
+func getHistoryPage(query url.Values) (*HistoryPage, *APIError) {
+
+	// Parse the query
+	origin := query.Get("origin")
+	if origin == "" {
+		return nil, newAPIError(http.StatusBadRequest, "missing origin")
+	}
+	before, limit := uint64(0), uint64(DefaultHistoryLimit)
+	var err error
+	if value := query.Get("before"); value != "" {
+		if before, err = strconv.ParseUint(value, 10, 32); err != nil {
+			return nil, newAPIError(http.StatusBadRequest, "invalid before")
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.ParseUint(value, 10, 32); err != nil || limit == 0 {
+			return nil, newAPIError(http.StatusBadRequest, "invalid limit")
+		}
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	// Only the global feed or a joined channel can be browsed
+	channel := query.Get("channel")
+	key, joined := gossiper.Channels.GetKey(channel)
+	if channel != "" && !joined {
+		return nil, newAPIError(http.StatusNotFound, "channel not joined")
+	}
+	inFeed := func(stored *peers.StoredRumor) bool { return stored.Channel == channel }
+
+	rumors, next := gossiper.NameIndex.GetHistory(origin, uint32(before), int(limit), inFeed)
+	for i := range rumors {
+		if text, err := network.OpenChannelText(key, channel, origin, rumors[i].Text, rumors[i].Sealed); err == nil {
+			rumors[i].Text, rumors[i].Sealed = text, false
+		}
+	}
+	return &HistoryPage{Origin: origin, Rumors: rumors, Before: next}, nil
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"Peerster/messages"
 	"encoding/json"
 	"io/ioutil"
 	"net"
@@ -35,6 +36,50 @@ func postNodeHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return // Ignore
 	}
+
+	// The link is secure unless specified otherwise
+	if secure, ok := newPeer["secure"].(bool); ok {
+		gossiper.SecureLinks.SetPeerMode(udpAddr.String(), secure)
+	}
 	gossiper.PeerIndex.AddPeerIfAbsent(udpAddr)
 
 }
+
+func getRoutesHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Send JSON data
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	data, _ := json.Marshal(map[string]interface{}{
+		"routes": gossiper.Router.GetRoutes(),
+	})
+	w.Write(data)
+
+}
+
+func getDropsHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Send JSON data
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	data, _ := json.Marshal(map[string]interface{}{
+		"drops":       gossiper.Drops.Snapshot(),
+		"blacklisted": gossiper.Blacklist.GetBlacklisted(),
+	})
+	w.Write(data)
+
+}
+
+func getCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Send JSON data
+	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	data, _ := json.Marshal(map[string]interface{}{
+		"version":      messages.ProtocolVersion,
+		"capabilities": messages.LocalCapabilities(!gossiper.Args.Insecure && !gossiper.Args.SimpleMode),
+		"peers":        gossiper.Capabilities.GetAll(),
+	})
+	w.Write(data)
+
+}
@@ -0,0 +1,217 @@
+package backend
+
+import (
+	"Peerster/files"
+	"Peerster/frontend"
+	"Peerster/messages"
+	"Peerster/network"
+	"Peerster/peers"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxStateMessages is the maximum number of recent messages of each feed in a snapshot
+const MaxStateMessages = 500
+
+// FrontendFiles - The files of the snapshot, by category
+type FrontendFiles struct {
+	Indexed      []frontend.FrontendIndexedFile      // Files available locally
+	Constructing []frontend.FrontendConstructingFile // Files being downloaded
+	Available    []frontend.FrontendAvailableFile    // Files found by a search, not requested yet
+}
+
+// FrontendArtistState - An artist of the snapshot
+type FrontendArtistState struct {
+	Info       messages.ArtistInfo // A set of information about the artist
+	Subscribed bool                // Indicates whether we subscribed to the artist
+}
+
+// stateSections - Builders of the sections of the snapshot of the gossiper's state, by name. Each section
+// is made of the same objects as the corresponding updates.
+var stateSections = map[string]func() interface{}{
+	"Peers":           getPeersState,
+	"Contacts":        getContactsState,
+	"Channels":        getChannelsState,
+	"Rumors":          getRumorsState,
+	"ChannelMessages": getChannelMessagesState,
+	"PrivateMessages": getPrivateMessagesState,
+	"Files":           getFilesState,
+	"Artists":         getArtistsState,
+	"Artworks":        getArtworksState,
+}
+
+// getStateHandler - Returns a snapshot of the whole state of the gossiper. Epoch and Seq are the cursor of
+// the last update reflected in it: the frontend should then follow the updates from there (some of the
+// following ones may already be reflected as well).
+func getStateHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Get the cursor first so that no update can be missed
+	state := map[string]interface{}{"Epoch": frontend.FBuffer.GetEpoch(), "Seq": frontend.FBuffer.GetLastSeq()}
+	for name, build := range stateSections {
+		state[name] = build()
+	}
+
+	// Send JSON data
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(state)
+	w.Write(data)
+
+}
+
+// getStateSectionHandler - Returns a single section of the snapshot (e.g. /state/peers)
+func getStateSectionHandler(w http.ResponseWriter, r *http.Request) {
+
+	// Sections are case-insensitive in the URL
+	var build func() interface{}
+	for name, builder := range stateSections {
+		if strings.EqualFold(name, mux.Vars(r)["section"]) {
+			build = builder
+		}
+	}
+	if build == nil {
+		http.Error(w, "unknown section", http.StatusNotFound)
+		return
+	}
+
+	// Send JSON data
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(build())
+	w.Write(data)
+
+}
+
+func getPeersState() interface{} {
+	addrs := make([]string, 0)
+	for _, addr := range gossiper.PeerIndex.GetAllPeers() {
+		addrs = append(addrs, peers.UDPAddressToString(addr))
+	}
+	sort.Strings(addrs)
+
+	state := make([]frontend.FrontendPeer, 0, len(addrs))
+	for _, addr := range addrs {
+		slices := strings.Split(addr, ":")
+		state = append(state, frontend.FrontendPeer{IP: slices[0], Port: slices[1]})
+	}
+	return state
+}
+
+func getContactsState() interface{} {
+	state := make([]frontend.FrontendPrivateContact, 0)
+	for _, route := range gossiper.Router.GetRoutes() {
+		state = append(state, frontend.FrontendPrivateContact{Name: route.Destination})
+	}
+	return state
+}
+
+func getChannelsState() interface{} {
+	state := make([]frontend.FrontendChannel, 0)
+	for _, channel := range gossiper.Channels.GetChannels() {
+		state = append(state, frontend.FrontendChannel{Name: channel.Name, Encrypted: channel.Encrypted, Joined: true})
+	}
+	return state
+}
+
+func getRumorsState() interface{} {
+	inFeed := func(stored *peers.StoredRumor) bool { return stored.Channel == "" }
+
+	state := make([]frontend.FrontendRumor, 0)
+	for _, stored := range gossiper.NameIndex.GetRecentRumors(MaxStateMessages, inFeed) {
+		state = append(state, frontend.FrontendRumor{
+			Name: frontend.EscapeHTML(stored.Origin),
+			Msg:  frontend.EscapeHTML(stored.Text),
+		})
+	}
+	return state
+}
+
+func getChannelMessagesState() interface{} {
+	inJoined := func(stored *peers.StoredRumor) bool { return gossiper.Channels.IsJoined(stored.Channel) }
+
+	state := make([]frontend.FrontendChannelMessage, 0)
+	for _, stored := range gossiper.NameIndex.GetRecentRumors(MaxStateMessages, inJoined) {
+		key, _ := gossiper.Channels.GetKey(stored.Channel)
+		text, err := network.OpenChannelText(key, stored.Channel, stored.Origin, stored.Text, stored.Sealed)
+		if err != nil {
+			continue
+		}
+		state = append(state, frontend.FrontendChannelMessage{
+			Channel: stored.Channel,
+			Origin:  frontend.EscapeHTML(stored.Origin),
+			Msg:     frontend.EscapeHTML(text),
+		})
+	}
+	return state
+}
+
+func getPrivateMessagesState() interface{} {
+	conversations := gossiper.NameIndex.GetConversations(gossiper.Args.Name)
+	contacts := make([]string, 0, len(conversations))
+	for contact := range conversations {
+		contacts = append(contacts, contact)
+	}
+	sort.Strings(contacts)
+
+	state := make([]frontend.FrontendPrivateMessage, 0)
+	for _, contact := range contacts {
+		for _, stored := range conversations[contact] {
+			state = append(state, frontend.FrontendPrivateMessage{
+				Origin:      frontend.EscapeHTML(stored.Origin),
+				Destination: stored.Destination,
+				Msg:         frontend.EscapeHTML(stored.Text),
+			})
+		}
+	}
+	return state
+}
+
+func getFilesState() interface{} {
+	state := FrontendFiles{
+		Indexed:      make([]frontend.FrontendIndexedFile, 0),
+		Constructing: make([]frontend.FrontendConstructingFile, 0),
+		Available:    make([]frontend.FrontendAvailableFile, 0),
+	}
+	for _, file := range gossiper.FileIndex.GetFiles() {
+		if file.IsArtwork {
+			continue // Displayed in the artists' showrooms
+		}
+		switch file.Status {
+		case files.Reconstructed:
+			state.Indexed = append(state.Indexed, frontend.FrontendIndexedFile{Filename: file.Filename, Metahash: file.Metahash})
+		case files.CompleteMatch:
+			state.Available = append(state.Available, frontend.FrontendAvailableFile{Filename: file.Filename, Metahash: file.Metahash})
+		case files.NoMetafileMonoSource, files.NoMetafileMultiSource, files.MissingChunks:
+			state.Constructing = append(state.Constructing, frontend.FrontendConstructingFile{Filename: file.Filename, Metahash: file.Metahash})
+		}
+	}
+	return state
+}
+
+func getArtistsState() interface{} {
+	artists, subscribed := gossiper.ArtSystem.GetArtists()
+
+	state := make([]FrontendArtistState, 0, len(artists))
+	for i := range artists {
+		state = append(state, FrontendArtistState{Info: artists[i], Subscribed: subscribed[i]})
+	}
+	return state
+}
+
+func getArtworksState() interface{} {
+	state := make([]frontend.FrontendAvailableArtowrk, 0)
+	for _, file := range gossiper.FileIndex.GetFiles() {
+		if file.IsArtwork && file.Status == files.Reconstructed && file.ArtTx != nil {
+			state = append(state, frontend.FrontendAvailableArtowrk{
+				Filename:    file.Filename,
+				ArtistInfo:  *file.ArtTx.Artist,
+				ArtworkInfo: *file.ArtTx.Artwork,
+			})
+		}
+	}
+	return state
+}
@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"Peerster/frontend"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// EventKeepAliveSec is the interval between two keep-alive comments on an idle event stream
+const EventKeepAliveSec = 15
+
+// parseCursor - Returns the epoch and sequence number of the last update a subscriber got, taken from the
+// Last-Event-ID header (set by browsers when an event stream reconnects) or from the since parameter
+func parseCursor(r *http.Request) (string, uint64, error) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("since")
+	}
+	if value == "" {
+		return "", 0, nil
+	}
+	return frontend.ParseCursor(value)
+}
+
+// getUpdatesHandler - Returns the updates following a cursor (for clients that can't keep a stream open)
+func getUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+
+	epoch, cursor, err := parseCursor(r)
+	if err != nil {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	updates, reset := frontend.FBuffer.GetUpdatesSince(epoch, cursor)
+	if reset {
+		cursor = 0
+	}
+	if len(updates) > 0 {
+		cursor = updates[len(updates)-1].Seq
+	}
+
+	// Send JSON data
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	data, _ := json.Marshal(map[string]interface{}{
+		"updates": updates,
+		"last":    frontend.FormatCursor(frontend.FBuffer.GetEpoch(), cursor),
+		"reset":   reset,
+	})
+	w.Write(data)
+
+}
+
+// getEventsHandler - Pushes the updates following a cursor as Server-Sent Events, then every new update
+// as soon as it is added. Each event's ID is the update's cursor (epoch and sequence number).
+func getEventsHandler(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	epoch, cursor, err := parseCursor(r)
+	if err != nil {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(EventKeepAliveSec * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		// Get the notification channel first so that no update can be missed
+		wait := frontend.FBuffer.Wait()
+
+		updates, reset := frontend.FBuffer.GetUpdatesSince(epoch, cursor)
+		if reset {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+			cursor = 0
+		}
+		for _, update := range updates {
+			data, _ := json.Marshal(update)
+			fmt.Fprintf(w, "id: %s\ndata: %s\n\n", frontend.FormatCursor(update.Epoch, update.Seq), data)
+			epoch, cursor = update.Epoch, update.Seq
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return // The subscriber left
+		case <-wait:
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+	}
+
+}
@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"Peerster/files"
+	"Peerster/messages"
+	"Peerster/network"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxUploadOverheadBytes is the room left for the multipart headers around an uploaded file
+const MaxUploadOverheadBytes = 64 << 10
+
+// uploadFile - Streams an uploaded file into the shared folder, then indexes and publishes it. The file
+// is written under a temporary name first so that a failed upload leaves nothing behind, then linked
+// under its name, which fails rather than replacing a file created in the meantime.
+func uploadFile(filename string, body io.Reader) (*messages.File, *APIError) {
+	if !files.IsValidFilename(filename) {
+		return nil, newAPIError(http.StatusBadRequest, "invalid filename %q", filename)
+	}
+	path := filepath.Join(files.SharedFilesDir, filename)
+	if _, err := os.Stat(path); err == nil { // Early rejection, before receiving the file
+		return nil, newAPIError(http.StatusConflict, "a file %s is already shared", filename)
+	}
+
+	// Write the file
+	if err := os.MkdirAll(files.SharedFilesDir, 0755); err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "cannot create the shared folder")
+	}
+	tmp, err := ioutil.TempFile(files.SharedFilesDir, ".upload-")
+	if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "cannot store the file")
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := io.Copy(tmp, io.LimitReader(body, files.MaxFileSize+1))
+	tmp.Close()
+	if err != nil {
+		return nil, newAPIError(http.StatusBadRequest, "upload interrupted: %s", err.Error())
+	}
+	if size > files.MaxFileSize {
+		return nil, newAPIError(http.StatusRequestEntityTooLarge, "files are limited to %d bytes", files.MaxFileSize)
+	}
+	if size == 0 {
+		return nil, newAPIError(http.StatusBadRequest, "empty file")
+	}
+	if err := os.Link(tmp.Name(), path); os.IsExist(err) {
+		return nil, newAPIError(http.StatusConflict, "a file %s is already shared", filename)
+	} else if err != nil {
+		return nil, newAPIError(http.StatusInternalServerError, "cannot store the file")
+	}
+
+	// Index and publish it
+	file := network.OnIndexLocalFile(gossiper, filename, gossiper.Args.TxHopLimit+1)
+	if file == nil {
+		os.Remove(path)
+		return nil, newAPIError(http.StatusConflict, "cannot index %s (the same content is already indexed)", filename)
+	}
+	return file, nil
+}
+
+// postUploadHandler - Receives a file from the GUI as a multipart form (field "file"). The parts are read
+// as a stream, the file is never held in memory.
+func postUploadHandler(w http.ResponseWriter, r *http.Request) {
+
+	r.Body = http.MaxBytesReader(w, r.Body, files.MaxFileSize+MaxUploadOverheadBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, newAPIError(http.StatusBadRequest, "expected a multipart/form-data body"))
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			writeError(w, newAPIError(http.StatusBadRequest, "invalid multipart body: %s", err.Error()))
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		file, apiErr := uploadFile(part.FileName(), part)
+		if apiErr != nil {
+			writeError(w, apiErr)
+			return
+		}
+		writeJSON(w, http.StatusCreated, fileResponse(file))
+		return
+	}
+
+	writeError(w, newAPIError(http.StatusBadRequest, "missing field \"file\""))
+}
+
+// apiPutFile - Receives the raw content of a file to share as the request's body
+func apiPutFile(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, files.MaxFileSize+1)
+	file, err := uploadFile(mux.Vars(r)["filename"], r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, fileResponse(file))
+}
+
+// fileResponse - Describes a file that has just been indexed
+func fileResponse(file *messages.File) FileResponse {
+	return FileResponse{
+		Filename: file.Name,
+		Metahash: files.ToHex(file.MetafileHash),
+		Status:   files.Reconstructed.String(),
+		Size:     file.Size,
+	}
+}
@@ -2,10 +2,12 @@ package backend
 
 import (
 	"Peerster/entities"
-	"Peerster/frontend"
+	"Peerster/logger"
 	"encoding/json"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"path/filepath"
 
 	"github.com/gorilla/mux"
 )
@@ -16,12 +18,45 @@ var gossiper *entities.Gossiper
 // Used to make the TID channel from everywhere in the file
 var idChannel *chan uint32
 
-// Webserver - Lauch a webserver on port 8080
+// Webserver - Lauch a webserver on port 8080 (loopback only, unless TLS is enabled)
 func Webserver(g *entities.Gossiper, chanID chan uint32) {
 
-	// Make the gossiper and channel visible
-	gossiper = g
+	// Make the channel visible
 	idChannel = &chanID
+	r := NewRouter(g)
+
+	// Only the GUI and the holders of the token may use the server
+	dataDir := filepath.Join(g.Args.DataDir, g.Args.Name)
+	token, err := NewAPIToken(dataDir)
+	if err != nil {
+		logger.Web.Error("Webserver", "Cannot create the API token, the webserver is disabled: %s", err.Error())
+		return
+	}
+	var hosts []string
+	if net.ParseIP(g.Args.GUIAddr).IsLoopback() {
+		hosts = LoopbackHosts(g.Args.ServerPort)
+	}
+
+	srv := &http.Server{
+		Handler: Guard(token, hosts, g.Args.FrontendDir)(r),
+		Addr:    net.JoinHostPort(g.Args.GUIAddr, g.Args.ServerPort),
+	}
+
+	// Launch the server
+	if g.Args.TLSCert != "" {
+		logger.Web.Info("Webserver", "GUI on https://%s (API token in %s)", srv.Addr, filepath.Join(dataDir, TokenFile))
+		err = srv.ListenAndServeTLS(g.Args.TLSCert, g.Args.TLSKey)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	logger.Web.Error("Webserver", "Webserver stopped: %s", err.Error())
+}
+
+// NewRouter - Creates the router serving the GUI and the API of a gossiper (without the access guard)
+func NewRouter(g *entities.Gossiper) *mux.Router {
+
+	// Make the gossiper visible
+	gossiper = g
 
 	r := mux.NewRouter()
 
@@ -30,42 +65,77 @@ func Webserver(g *entities.Gossiper, chanID chan uint32) {
 	r.HandleFunc("/private", postPrivateHandler).Methods("POST")
 	r.HandleFunc("/node", postNodeHandler).Methods("POST")
 	r.HandleFunc("/fileIndex", postFileIndexHandler).Methods("POST")
+	r.HandleFunc("/upload", postUploadHandler).Methods("POST")
 	r.HandleFunc("/fileRequest", postFileRequestMonoSourceHandler).Methods("POST")
 	r.HandleFunc("/fileRequestNetwork", postFileRequestMultiSourceHandler).Methods("POST")
 	r.HandleFunc("/fileSearch", postFileSearchHandler).Methods("POST")
 	r.HandleFunc("/private", postPrivateHandler).Methods("POST")
+	r.HandleFunc("/channel", postChannelHandler).Methods("POST")
 
 	// ArtSystem
 	r.HandleFunc("/subscribe", postSubscribeHandler).Methods("POST")
 	r.HandleFunc("/download", postDownloadHandler).Methods("POST")
 
+	// Complete files
+	r.HandleFunc("/files/{metahash}", getFileHandler).Methods("GET", "HEAD")
+
 	// Updates
 	r.HandleFunc("/updates", getUpdatesHandler).Methods("GET")
+	r.HandleFunc("/events", getEventsHandler).Methods("GET")
+
+	// Snapshot of the whole state (to hydrate the frontend before following the updates)
+	r.HandleFunc("/state", getStateHandler).Methods("GET")
+	r.HandleFunc("/state/{section}", getStateSectionHandler).Methods("GET")
+
+	// Joined channels
+	r.HandleFunc("/channels", getChannelsHandler).Methods("GET")
+
+	// Message history
+	r.HandleFunc("/rumors", getRumorsHandler).Methods("GET")
 
 	// ID
 	r.HandleFunc("/id", getIDHandler).Methods("GET")
 
-	// Root page
-	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./frontend/")))
+	// Routing table
+	r.HandleFunc("/routes", getRoutesHandler).Methods("GET")
 
-	srv := &http.Server{
-		Handler: r,
-		Addr:    "127.0.0.1:" + g.Args.ServerPort,
-	}
+	// Dropped packets
+	r.HandleFunc("/drops", getDropsHandler).Methods("GET")
 
-	// Launch the server
-	srv.ListenAndServe()
+	// Protocol version and features of the node and its neighbors
+	r.HandleFunc("/capabilities", getCapabilitiesHandler).Methods("GET")
+
+	// Versioned REST API
+	registerAPIv1(r)
+
+	// Root page
+	r.PathPrefix("/").Handler(http.FileServer(http.Dir(g.Args.FrontendDir)))
+	return r
 }
 
 // ConfirmAndParse - Parses the received JSON and confirms reception to the frotnend
 func ConfirmAndParse(w http.ResponseWriter, r *http.Request) *map[string]interface{} {
 
 	// Confirm POST to frontend
+	confirm(w)
+
+	// Parse received JSON
+	recJSON := parseJSON(r)
+	if recJSON == nil {
+		return nil
+	}
+	return &recJSON
+}
+
+// confirm - Confirms a POST to the frontend
+func confirm(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte("{}"))
+}
 
-	// Parse received JSON
+// parseJSON - Parses the JSON object of a request (nil if it isn't one)
+func parseJSON(r *http.Request) map[string]interface{} {
 	var recJSON map[string]interface{}
 	if data, err := ioutil.ReadAll(r.Body); err == nil {
 		if err := json.Unmarshal(data, &recJSON); err != nil {
@@ -74,8 +144,7 @@ func ConfirmAndParse(w http.ResponseWriter, r *http.Request) *map[string]interfa
 	} else {
 		return nil
 	}
-
-	return &recJSON
+	return recJSON
 }
 
 func getIDHandler(w http.ResponseWriter, r *http.Request) {
@@ -90,15 +159,3 @@ func getIDHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 
 }
-
-func getUpdatesHandler(w http.ResponseWriter, r *http.Request) {
-
-	// Get data
-	data := frontend.FBuffer.GetDataAndEmpty()
-
-	// Send JSON data
-	w.WriteHeader(http.StatusOK)
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(*data)
-
-}
@@ -81,7 +81,7 @@ func (bcf *BCF) MineOnce() bool {
 	bcf.Head.SetNonce(nonce)
 	fb, err := bcf.Head.Build()
 	if err == nil {
-		logger.Printlnf("FOUND-BLOCK %s", utils.HashToHex(fb.Hash[:])) //hw03 print
+		logger.Chain.Protocol("FOUND-BLOCK %s", utils.HashToHex(fb.Hash[:])) //hw03 print
 		if bcf.addFileBlock(fb) {
 			bcf.MineChan.Push(fb)
 			return true
@@ -131,7 +131,7 @@ func (bcf *BCF) addBlock(block *messages.Block, genesis bool) bool {
 		// new fork, cannot be longest head (previous is part of the chain)
 		previousBlock = singleBlock
 	} else if utils.AllZero(block.PrevHash[:]) {
-		logger.Printlnf("forking from the genesis block")
+		logger.Chain.Info("BCF.addBlock", "forking from the genesis block")
 		// new fork from the genesis block
 		previousBlock = nil
 	} else {
@@ -161,17 +161,17 @@ func (bcf *BCF) addPendingBlocks() {
 }
 
 func (bcf *BCF) addFileBlock(fb *FileBlock) bool {
-	//logger.Printlnf("adding file block %s", fb.String())
+	//logger.Chain.Debug("BCF.addFileBlock", "adding file block %s", fb.String())
 	if fb.Previous == nil {
 		bcf.allBlocks[fb.id] = fb
 		bcf.forks[fb.id] = fb
 		if bcf.ChainLength == 0 {
-			logger.Printlnf(fb.ChainString()) // hw03 print
+			logger.Chain.Protocol("%s", fb.ChainString()) // hw03 print
 			bcf.ChainLength = fb.Length
 			bcf.Head = NewFileBlockBuilder(fb)
 		} else {
 			_, hashString, _ := findMergure(fb, bcf.Head.Previous)
-			logger.Printlnf("FORK-SHORTER %s", hashString)
+			logger.Chain.Protocol("FORK-SHORTER %s", hashString)
 		}
 		return true
 	} else if _, ok := bcf.forks[fb.Previous.id]; ok {
@@ -192,21 +192,21 @@ func (bcf *BCF) addFileBlock(fb *FileBlock) bool {
 				for _, tx := range rewindTransactions {
 					newHead.AddTxIfValid(tx)
 				}
-				logger.Printlnf("FORK-LONGER rewind %d blocks", rewind)
+				logger.Chain.Protocol("FORK-LONGER rewind %d blocks", rewind)
 			}
-			logger.Printlnf(fb.ChainString()) // hw03 print
+			logger.Chain.Protocol("%s", fb.ChainString()) // hw03 print
 			bcf.ChainLength = fb.Length       //not new head which is 1 greater
 			bcf.Head = newHead
 		} else {
 			_, hashString, _ := findMergure(fb, bcf.Head.Previous)
-			logger.Printlnf("FORK-SHORTER %s", hashString)
+			logger.Chain.Protocol("FORK-SHORTER %s", hashString)
 		}
 		return true
 	} else if _, ok := bcf.allBlocks[fb.Previous.id]; ok {
 		bcf.allBlocks[fb.id] = fb
 		bcf.forks[fb.id] = fb
 		_, hashString, _ := findMergure(fb, bcf.Head.Previous)
-		logger.Printlnf("FORK-SHORTER %s", hashString)
+		logger.Chain.Protocol("FORK-SHORTER %s", hashString)
 		return true
 	}
 	fail.HandleError(fmt.Errorf("file-block comes out of nowhere"))
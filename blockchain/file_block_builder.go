@@ -26,6 +26,7 @@ type FileBlockBuilder struct {
 	Transactions []*Tx
 	Filenames    map[string]bool
 	Hashes       map[string]*Tx
+	Claims       map[string]*Tx // latest tx for each filename
 
 	sync.RWMutex
 }
@@ -41,6 +42,7 @@ func NewFileBlockBuilder(previousBlock *FileBlock) *FileBlockBuilder {
 		Transactions: []*Tx{},
 		Filenames:    map[string]bool{},
 		Hashes:       map[string]*Tx{},
+		Claims:       map[string]*Tx{},
 	}
 	if previousBlock != nil {
 		fbb.Length = previousBlock.Length + 1
@@ -142,6 +144,13 @@ func (fbb *FileBlockBuilder) readPreviousTx() {
 				fbb.Hashes[fileHashString] = tx
 			}
 		}
+		// adding latest claims (the last tx of a block is the latest)
+		for i := len(previousBlock.Transactions) - 1; i >= 0; i-- {
+			tx := previousBlock.Transactions[i]
+			if _, ok := fbb.Claims[tx.File.Name]; !ok {
+				fbb.Claims[tx.File.Name] = tx
+			}
+		}
 		previousBlock = previousBlock.Previous
 	}
 }
@@ -150,26 +159,44 @@ func (fbb *FileBlockBuilder) addTxIfValid(newTx *Tx) bool {
 	fileHashString := newTx.File.HashString()
 	prevTx, ok := fbb.Hashes[fileHashString]
 
+	updated := false
 	if !ok {
-		// if new hash (file), we check if filename is not already used
+		// if new hash (file), we check if filename is not already used, unless its owner updates it
 		if _, ok := fbb.Filenames[newTx.File.Name]; ok {
-			logger.Printlnf("IGNORING TX: filename <%s> already used", newTx.File.Name)
-			return false
+			if !fbb.isOwnerUpdate(newTx) {
+				logger.Chain.Info("FileBlockBuilder.addTxIfValid", "IGNORING TX: filename <%s> already used", newTx.File.Name)
+				return false
+			}
+			updated = true
 		}
 	} else if crypto_rsa.Verify(prevTx.Signature[:], newTx.Signature, prevTx.PublicKey) != nil {
 		// check if changing ownership is legal here (i.e. if owner is the one starting the change)
-		logger.Printlnf("IGNORING TX: there is already an owner of file <%s>", newTx.File.String())
+		logger.Chain.Info("FileBlockBuilder.addTxIfValid", "IGNORING TX: there is already an owner of file <%s>", newTx.File.String())
 		return false
 	}
 	// printing the transaction result
-	if !ok {
-		logger.Printlnf("ADDING TX: new owner of file <%s>", newTx.File.String())
+	if updated {
+		logger.Chain.Info("FileBlockBuilder.addTxIfValid", "ADDING TX: owner of filename <%s> updated it to <%s>", newTx.File.Name, newTx.File.String())
+	} else if !ok {
+		logger.Chain.Info("FileBlockBuilder.addTxIfValid", "ADDING TX: new owner of file <%s>", newTx.File.String())
 	} else {
-		logger.Printlnf("ADDING TX: owner of file <%s> changed", newTx.File.String())
+		logger.Chain.Info("FileBlockBuilder.addTxIfValid", "ADDING TX: owner of file <%s> changed", newTx.File.String())
 	}
 
 	fbb.Filenames[newTx.File.Name] = true
 	fbb.Hashes[fileHashString] = newTx
+	fbb.Claims[newTx.File.Name] = newTx
 	fbb.Transactions = append(fbb.Transactions, newTx)
 	return true
 }
+
+// isOwnerUpdate checks if a tx claiming a new hash under a used filename is signed by the owner of the filename's
+// latest claim (e.g. the file was modified and indexed again)
+func (fbb *FileBlockBuilder) isOwnerUpdate(newTx *Tx) bool {
+	claim, ok := fbb.Claims[newTx.File.Name]
+	if !ok || claim.PublicKey.E != newTx.PublicKey.E || claim.PublicKey.N.Cmp(newTx.PublicKey.N) != 0 {
+		return false
+	}
+	fileHash := newTx.File.Hash()
+	return crypto_rsa.Verify(fileHash[:], newTx.Signature, claim.PublicKey) == nil
+}
@@ -0,0 +1,231 @@
+package channels
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// GlobalChannel is the name under which the global feed is displayed (reserved)
+	GlobalChannel = "Global"
+	// MaxNameLength is the maximum length of a channel name
+	MaxNameLength = 32
+	// MaxPendingInvites is the maximum number of invitations waiting for the user to accept them
+	MaxPendingInvites = 64
+)
+
+// ChannelIndex - Represents the channels joined by the gossiper. Messages of other channels are relayed
+// and stored like any rumor, but not surfaced.
+type ChannelIndex struct {
+	joined  map[string]*Channel // A mapping from channel name to joined channel
+	invites map[string]*Invite  // A mapping from channel name to the invitation received to join it
+	mux     sync.Mutex          // Mutex to manipulate the structure from different threads
+}
+
+// Channel - Represents a joined channel
+type Channel struct {
+	key     []byte          // The shared key of an encrypted channel (nil for a plain channel)
+	members map[string]bool // The peers known to be in the channel (posters and invitees)
+	invited map[string]bool // The peers invited to the channel that didn't accept yet
+}
+
+// Invite - Represents an invitation to a channel, pending until the user accepts it by joining the channel
+type Invite struct {
+	Channel   string `json:"channel"`   // The channel's name
+	From      string `json:"from"`      // The inviting peer
+	Encrypted bool   `json:"encrypted"` // Indicates whether the channel is encrypted
+	Accepted  bool   `json:"accepted"`  // Indicates whether the user accepted it (the key is awaited)
+}
+
+// ChannelInfo - Represents a joined channel for the API
+type ChannelInfo struct {
+	Name      string   `json:"name"`              // The channel's name
+	Encrypted bool     `json:"encrypted"`         // Indicates whether the channel's messages are encrypted
+	Members   []string `json:"members"`           // The peers known to be in the channel
+	Pending   bool     `json:"pending,omitempty"` // Indicates that the channel is joined once the inviter sent its key
+}
+
+// NewChannelIndex - Creates a new instance of ChannelIndex
+func NewChannelIndex() *ChannelIndex {
+	var channelIndex ChannelIndex
+	channelIndex.joined = make(map[string]*Channel)
+	channelIndex.invites = make(map[string]*Invite)
+	return &channelIndex
+}
+
+// IsValidName - Checks whether a name can be used for a channel
+func IsValidName(name string) bool {
+	if name == "" || len(name) > MaxNameLength || strings.EqualFold(name, GlobalChannel) {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Join - Joins a channel (key is nil for a plain channel). Returns false if the channel was already joined,
+// in which case it is left untouched.
+func (channelIndex *ChannelIndex) Join(name string, key []byte, self string) bool {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	if _, ok := channelIndex.joined[name]; ok {
+		return false
+	}
+	channelIndex.joined[name] = &Channel{key: key, members: map[string]bool{self: true}, invited: make(map[string]bool)}
+	delete(channelIndex.invites, name)
+	return true
+}
+
+// Leave - Leaves a channel, returns false if it wasn't joined
+func (channelIndex *ChannelIndex) Leave(name string) bool {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	if _, ok := channelIndex.joined[name]; !ok {
+		return false
+	}
+	delete(channelIndex.joined, name)
+	return true
+}
+
+// IsJoined - Checks whether a channel is joined
+func (channelIndex *ChannelIndex) IsJoined(name string) bool {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	_, ok := channelIndex.joined[name]
+	return ok
+}
+
+// GetKey - Returns the key of a joined channel (nil for a plain channel), and whether it is joined
+func (channelIndex *ChannelIndex) GetKey(name string) ([]byte, bool) {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	if channel, ok := channelIndex.joined[name]; ok {
+		return channel.key, true
+	}
+	return nil, false
+}
+
+// AddMember - Records that a peer is in a joined channel
+func (channelIndex *ChannelIndex) AddMember(name string, member string) {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	if channel, ok := channelIndex.joined[name]; ok {
+		channel.members[member] = true
+	}
+}
+
+// AddInvited - Records that a peer was invited to a joined channel (its acceptance is awaited)
+func (channelIndex *ChannelIndex) AddInvited(name string, peer string) {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	if channel, ok := channelIndex.joined[name]; ok {
+		channel.invited[peer] = true
+	}
+}
+
+// TakeInvited - Checks whether a peer was invited to a joined channel, forgetting the invitation
+func (channelIndex *ChannelIndex) TakeInvited(name string, peer string) bool {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	channel, ok := channelIndex.joined[name]
+	if !ok || !channel.invited[peer] {
+		return false
+	}
+	delete(channel.invited, peer)
+	return true
+}
+
+// AddInvite - Records an invitation to a channel. Returns false if the channel is joined, if an accepted
+// invitation is already pending for it, or if there are too many pending invitations.
+func (channelIndex *ChannelIndex) AddInvite(invite Invite) bool {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	if _, ok := channelIndex.joined[invite.Channel]; ok {
+		return false
+	}
+	previous, ok := channelIndex.invites[invite.Channel]
+	if ok && previous.Accepted || !ok && len(channelIndex.invites) >= MaxPendingInvites {
+		return false
+	}
+	invite.Accepted = false
+	channelIndex.invites[invite.Channel] = &invite
+	return true
+}
+
+// AcceptInvite - Marks the invitation to a channel as accepted and returns it, along with whether there is one
+func (channelIndex *ChannelIndex) AcceptInvite(name string) (Invite, bool) {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	invite, ok := channelIndex.invites[name]
+	if !ok {
+		return Invite{}, false
+	}
+	invite.Accepted = true
+	return *invite, true
+}
+
+// TakeAcceptedInvite - Checks whether the invitation to a channel from a peer was accepted, forgetting it
+func (channelIndex *ChannelIndex) TakeAcceptedInvite(name string, from string) bool {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	invite, ok := channelIndex.invites[name]
+	if !ok || !invite.Accepted || invite.From != from {
+		return false
+	}
+	delete(channelIndex.invites, name)
+	return true
+}
+
+// HasInvite - Checks whether an invitation to a channel is pending
+func (channelIndex *ChannelIndex) HasInvite(name string) bool {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	_, ok := channelIndex.invites[name]
+	return ok
+}
+
+// GetInvites - Returns the pending invitations, sorted by channel name
+func (channelIndex *ChannelIndex) GetInvites() []Invite {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	invites := make([]Invite, 0, len(channelIndex.invites))
+	for _, invite := range channelIndex.invites {
+		invites = append(invites, *invite)
+	}
+	sort.Slice(invites, func(i, j int) bool { return invites[i].Channel < invites[j].Channel })
+	return invites
+}
+
+// GetChannels - Returns the joined channels, sorted by name
+func (channelIndex *ChannelIndex) GetChannels() []ChannelInfo {
+	channelIndex.mux.Lock()
+	defer channelIndex.mux.Unlock()
+
+	channels := make([]ChannelInfo, 0, len(channelIndex.joined))
+	for name, channel := range channelIndex.joined {
+		members := make([]string, 0, len(channel.members))
+		for member := range channel.members {
+			members = append(members, member)
+		}
+		sort.Strings(members)
+		channels = append(channels, ChannelInfo{Name: name, Encrypted: channel.key != nil, Members: members})
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels
+}
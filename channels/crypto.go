@@ -0,0 +1,95 @@
+package channels
+
+import (
+	"Peerster/fail"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// KeySize is the size of the shared key of an encrypted channel (AES-256)
+const KeySize = 32
+
+// NewKey - Generates a new shared key for an encrypted channel
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, &fail.CustomError{Fun: "NewKey", Desc: "cannot generate channel key"}
+	}
+	return key, nil
+}
+
+// newAEAD - Creates the AEAD of a channel key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, &fail.CustomError{Fun: "newAEAD", Desc: "invalid channel key size"}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "newAEAD", Desc: "cannot create AES cipher"}
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "newAEAD", Desc: "cannot create GCM"}
+	}
+	return aead, nil
+}
+
+// additionalData - Binds a ciphertext to its channel and origin (a member can't replay it elsewhere)
+func additionalData(channel, origin string) []byte {
+	return []byte(channel + "\x00" + origin)
+}
+
+// Seal - Encrypts a message for an encrypted channel, the result is a printable string
+func Seal(key []byte, channel, origin, text string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", &fail.CustomError{Fun: "Seal", Desc: "cannot generate nonce"}
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(text), additionalData(channel, origin))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open - Decrypts a message of an encrypted channel
+func Open(key []byte, channel, origin, sealed string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	buf, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(buf) < aead.NonceSize() {
+		return "", &fail.CustomError{Fun: "Open", Desc: "malformed sealed message"}
+	}
+	text, err := aead.Open(nil, buf[:aead.NonceSize()], buf[aead.NonceSize():], additionalData(channel, origin))
+	if err != nil {
+		return "", &fail.CustomError{Fun: "Open", Desc: "cannot decrypt message"}
+	}
+	return string(text), nil
+}
+
+// SealKey - Encrypts the key of a channel for an invitee, with its RSA public key
+func SealKey(key []byte, channel string, publicKey *rsa.PublicKey) ([]byte, error) {
+	sealed, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, key, []byte(channel))
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "SealKey", Desc: "cannot encrypt channel key"}
+	}
+	return sealed, nil
+}
+
+// OpenKey - Decrypts the key of a channel we were invited to, with our RSA private key
+func OpenKey(sealed []byte, channel string, privateKey *rsa.PrivateKey) ([]byte, error) {
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, sealed, []byte(channel))
+	if err != nil || len(key) != KeySize {
+		return nil, &fail.CustomError{Fun: "OpenKey", Desc: "cannot decrypt channel key"}
+	}
+	return key, nil
+}
@@ -5,6 +5,8 @@ import (
 	"Peerster/parsing"
 	"fmt"
 	"net"
+	"os"
+	"time"
 
 	"github.com/dedis/protobuf"
 )
@@ -14,16 +16,18 @@ func main() {
 	// Initialize the client
 	client, err := parsing.ParseArgumentsClient()
 	if err != nil {
-		fmt.Println(err)
+		if !parsing.IsHelp(err) {
+			exit(err)
+		}
 		return
 	}
 
 	// Create the packet
 	var pkt messages.GossipPacket
 
-	switch {
+	switch client.Command {
 	// File search
-	case client.Keywords != nil:
+	case "search":
 		search := messages.SearchRequest{
 			Origin:   "",
 			Budget:   client.Budget,
@@ -32,7 +36,7 @@ func main() {
 		pkt = messages.GossipPacket{SearchRequest: &search}
 
 	// Art publish
-	case client.Filename != "" && client.ArtName != "" && client.ArtDesc != "":
+	case "publish-art":
 		artTx := messages.ArtTx{
 			HopLimit: 0,
 			Artist:   &messages.ArtistInfo{},
@@ -43,8 +47,11 @@ func main() {
 			},
 		}
 		pkt = messages.GossipPacket{ArtTx: &artTx}
+	// Subscription to an artist
+	case "subscribe":
+		pkt = messages.GossipPacket{Subscribe: &messages.ArtistInfo{Signature: client.Signature}}
 	// File request for someone else
-	case client.Filename != "" && client.Request != nil:
+	case "download":
 
 		fileRequest := messages.DataRequest{
 			HopLimit:    1,
@@ -54,45 +61,68 @@ func main() {
 		}
 		pkt = messages.GossipPacket{DataRequest: &fileRequest}
 	// File index
-	case client.Filename != "":
+	case "index":
 		fileRequest := messages.DataRequest{
 			HopLimit: 0,
 			Origin:   client.Filename,
 		}
 		pkt = messages.GossipPacket{DataRequest: &fileRequest}
+	// Channel operations
+	case "join":
+		command := messages.ChannelCommand{
+			Action:    messages.ChannelJoin,
+			Channel:   client.Join,
+			Encrypted: client.Encrypted,
+		}
+		pkt = messages.GossipPacket{Channel: &command}
+	case "leave":
+		command := messages.ChannelCommand{Action: messages.ChannelLeave, Channel: client.Leave}
+		pkt = messages.GossipPacket{Channel: &command}
+	case "invite":
+		command := messages.ChannelCommand{
+			Action:      messages.ChannelInvite,
+			Channel:     client.Channel,
+			Destination: client.Dst,
+		}
+		pkt = messages.GossipPacket{Channel: &command}
 	// Private message
-	case client.Dst != "" && client.Msg != "":
+	case "private":
 		privateMsg := messages.PrivateMessage{
 			Text:        client.Msg,
 			Destination: client.Dst,
 		}
 		pkt = messages.GossipPacket{Private: &privateMsg}
-	// Simple rumor
-	case client.Msg != "":
-		simpleMsg := messages.SimpleMessage{Contents: client.Msg}
+	// Simple rumor, or channel message
+	case "msg":
+		simpleMsg := messages.SimpleMessage{Contents: client.Msg, Channel: client.Channel}
 		pkt = messages.GossipPacket{SimpleMsg: &simpleMsg}
 	default:
-		fmt.Println("main(): Invalid arguments to main")
-		return
+		exit(fmt.Errorf("main(): Invalid arguments to main"))
+	}
+
+	// Wrap the command in a request unless its outcome doesn't matter
+	var id uint64
+	if !client.NoWait {
+		if id, err = newRequestID(); err != nil {
+			exit(err)
+		}
+		pkt = messages.GossipPacket{Request: &messages.ClientRequest{ID: id, Packet: &pkt}}
 	}
 
 	// Encode the packet
 	buf, err := protobuf.Encode(&pkt)
 	if err != nil {
-		fmt.Println(err)
-		return
+		exit(err)
 	}
 
 	// Establish a UDP connection
 	udpAddr, err := net.ResolveUDPAddr("udp4", "localhost:0")
 	if err != nil {
-		fmt.Println(err)
-		return
+		exit(err)
 	}
 	udpConn, err := net.ListenUDP("udp4", udpAddr)
 	if err != nil {
-		fmt.Println(err)
-		return
+		exit(err)
 	}
 
 	// Program a call to close the channel when we are done
@@ -100,8 +130,20 @@ func main() {
 
 	// Send to local gossiper
 	if _, err = udpConn.WriteToUDP(buf, client.Addr); err != nil {
-		fmt.Println(err)
-		return
+		exit(err)
+	}
+
+	// Print the replies until the outcome of the command
+	if !client.NoWait {
+		if err := waitReplies(udpConn, id, time.Duration(client.Timeout)*time.Second); err != nil {
+			exit(err)
+		}
 	}
 
 }
+
+// exit - Prints an error and exits with a failure status
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
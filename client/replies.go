@@ -0,0 +1,65 @@
+package main
+
+import (
+	"Peerster/messages"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+// BufSize is the size of the buffer receiving the replies of the gossiper
+const BufSize = 8192
+
+// newRequestID - Picks a random ID for a request, so that replies to other clients are told apart
+func newRequestID() (uint64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// waitReplies - Prints the replies of the gossiper to a request until the last one. Progress replies are
+// only printed when they change. Returns an error if the command failed or if the gossiper stays silent
+// for longer than the timeout.
+func waitReplies(conn *net.UDPConn, id uint64, timeout time.Duration) error {
+
+	lastProgress := ""
+	buf := make([]byte, BufSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return fmt.Errorf("no reply from the node for %s (is it running, and recent enough?)", timeout)
+			}
+			return err
+		}
+
+		// Ignore what isn't a reply to this request
+		var pkt messages.GossipPacket
+		if err := protobuf.Decode(buf[:n], &pkt); err != nil || pkt.Reply == nil || pkt.Reply.ID != id {
+			continue
+		}
+
+		reply := pkt.Reply
+		switch reply.Kind {
+		case messages.ReplyProgress:
+			if reply.Text != lastProgress {
+				lastProgress = reply.Text
+				fmt.Println(reply.Text)
+			}
+		case messages.ReplyError:
+			return fmt.Errorf("%s", reply.Text)
+		default:
+			fmt.Println(reply.Text)
+		}
+		if reply.IsFinal() {
+			return nil
+		}
+	}
+}
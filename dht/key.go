@@ -0,0 +1,98 @@
+package dht
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// KeySizeBytes is the size of a DHT key in bytes
+const KeySizeBytes = 32
+
+// KeySizeBits is the size of a DHT key in bits (also the number of k-buckets)
+const KeySizeBits = KeySizeBytes * 8
+
+// Key represents a position in the DHT's keyspace (node IDs, metahashes and keyword hashes)
+type Key [KeySizeBytes]byte
+
+// NameToKey returns the node ID associated to a peer name
+func NameToKey(name string) Key {
+	return Key(sha256.Sum256([]byte("node:" + name)))
+}
+
+// KeywordToKey returns the key under which providers for a keyword are stored
+func KeywordToKey(keyword string) Key {
+	return Key(sha256.Sum256([]byte("keyword:" + strings.ToLower(keyword))))
+}
+
+// BytesToKey returns the key corresponding to a raw hash (e.g. a metahash), or false
+// if the slice doesn't have the correct length
+func BytesToKey(hash []byte) (Key, bool) {
+	var key Key
+	if len(hash) != KeySizeBytes {
+		return key, false
+	}
+	copy(key[:], hash)
+	return key, true
+}
+
+// FilenameToKeywords splits a filename into the lowercase keywords under which it is published
+func FilenameToKeywords(filename string) []string {
+	tokens := strings.FieldsFunc(strings.ToLower(filename), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	// Remove duplicates
+	seen := make(map[string]bool)
+	keywords := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			keywords = append(keywords, token)
+		}
+	}
+	return keywords
+}
+
+// Distance returns the XOR distance between two keys
+func (key Key) Distance(other Key) Key {
+	var dist Key
+	for i := range key {
+		dist[i] = key[i] ^ other[i]
+	}
+	return dist
+}
+
+// Less returns true if key is strictly smaller than other (big-endian comparison)
+func (key Key) Less(other Key) bool {
+	for i := range key {
+		if key[i] != other[i] {
+			return key[i] < other[i]
+		}
+	}
+	return false
+}
+
+// CloserTo returns true if key is strictly closer to target than other
+func (key Key) CloserTo(target, other Key) bool {
+	return key.Distance(target).Less(other.Distance(target))
+}
+
+// BucketIndex returns the index of the k-bucket in which other should be stored relatively to key,
+// i.e. the length of their common prefix. The function returns -1 if both keys are equal.
+func (key Key) BucketIndex(other Key) int {
+	dist := key.Distance(other)
+	for i, b := range dist {
+		if b != 0 {
+			return i*8 + bits.LeadingZeros8(b)
+		}
+	}
+	return -1
+}
+
+// ToHex returns the hexadecimal representation of a key
+func (key Key) ToHex() string {
+	return hex.EncodeToString(key[:])
+}
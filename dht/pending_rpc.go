@@ -0,0 +1,58 @@
+package dht
+
+import (
+	"Peerster/messages"
+	"math/rand"
+	"sync"
+)
+
+// PendingRPCs represents the set of DHT requests waiting for a reply
+type PendingRPCs struct {
+	pending map[uint64]chan *messages.DHTMessage // A mapping from RPC ID to the channel of the waiting thread
+	mux     sync.Mutex                           // Mutex to manipulate the structure from different threads
+}
+
+// NewPendingRPCs creates a new instance of PendingRPCs
+func NewPendingRPCs() *PendingRPCs {
+	var rpcs PendingRPCs
+	rpcs.pending = make(map[uint64]chan *messages.DHTMessage)
+	return &rpcs
+}
+
+// Register allocates a fresh RPC ID and the channel on which its reply will be forwarded
+func (rpcs *PendingRPCs) Register() (uint64, chan *messages.DHTMessage) {
+	rpcs.mux.Lock()
+	defer rpcs.mux.Unlock()
+
+	for {
+		id := rand.Uint64()
+		if _, ok := rpcs.pending[id]; id != 0 && !ok {
+			com := make(chan *messages.DHTMessage, 1)
+			rpcs.pending[id] = com
+			return id, com
+		}
+	}
+}
+
+// Unregister forgets about an RPC (either answered or timed out)
+func (rpcs *PendingRPCs) Unregister(id uint64) {
+	rpcs.mux.Lock()
+	defer rpcs.mux.Unlock()
+
+	delete(rpcs.pending, id)
+}
+
+// Forward hands a reply to the thread waiting for it. The function returns false if no thread
+// was waiting for this reply.
+func (rpcs *PendingRPCs) Forward(reply *messages.DHTMessage) bool {
+	rpcs.mux.Lock()
+	defer rpcs.mux.Unlock()
+
+	com, ok := rpcs.pending[reply.RPCID]
+	if !ok {
+		return false
+	}
+	delete(rpcs.pending, reply.RPCID)
+	com <- reply
+	return true
+}
@@ -0,0 +1,127 @@
+package dht
+
+import (
+	"Peerster/messages"
+	"sync"
+	"time"
+)
+
+// Limits of the provider records, so that a peer can't fill our memory with stores
+const (
+	ProviderTTLSec     = 180  // Time after which a provider record expires if it isn't republished
+	MaxProvidersPerKey = 20   // Maximum number of providers stored under a key
+	MaxKeysPerSender   = 256  // Maximum number of keys under which a sender may store providers
+	MaxStoredKeys      = 4096 // Maximum number of keys stored
+)
+
+// ProviderStore represents the set of provider records stored by this node, indexed by key
+type ProviderStore struct {
+	records map[Key]map[string]*providerRecord // A mapping from key to (provider name + metahash) to record
+	mux     sync.Mutex                         // Mutex to manipulate the structure from different threads
+}
+
+// providerRecord represents a provider record with an expiry date
+type providerRecord struct {
+	provider *messages.DHTProvider // The advertised provider
+	expiry   time.Time             // The time after which the record is discarded
+	from     string                // Who stored the record (<ip:port> of the sender, "" for ourselves)
+}
+
+// NewProviderStore creates a new instance of ProviderStore
+func NewProviderStore() *ProviderStore {
+	var store ProviderStore
+	store.records = make(map[Key]map[string]*providerRecord)
+	return &store
+}
+
+// AddProviders stores (or refreshes) a list of provider records under key, on behalf of a sender ("" for
+// records we publish ourselves). Records beyond MaxProvidersPerKey, or under a new key beyond MaxKeysPerSender
+// for that sender or beyond MaxStoredKeys overall, are dropped. Returns the number of records stored.
+func (store *ProviderStore) AddProviders(key Key, providers []*messages.DHTProvider, from string) int {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	now := time.Now()
+	records, ok := store.records[key]
+	if !ok {
+		if len(store.records) >= MaxStoredKeys {
+			store.dropExpiredUnsafe(now)
+		}
+		if len(store.records) >= MaxStoredKeys || (from != "" && store.keysFromUnsafe(from) >= MaxKeysPerSender) {
+			return 0
+		}
+		records = make(map[string]*providerRecord)
+		store.records[key] = records
+	}
+
+	stored := 0
+	expiry := now.Add(ProviderTTLSec * time.Second)
+	for _, provider := range providers {
+		if provider == nil || provider.Origin == "" {
+			continue
+		}
+		id := provider.Origin + ":" + string(provider.MetafileHash)
+		if _, ok := records[id]; !ok && len(records) >= MaxProvidersPerKey {
+			continue
+		}
+		records[id] = &providerRecord{provider: provider, expiry: expiry, from: from}
+		stored++
+	}
+	if len(records) == 0 {
+		delete(store.records, key)
+	}
+	return stored
+}
+
+// keysFromUnsafe returns the number of keys under which a sender stored records (the mutex must be held)
+func (store *ProviderStore) keysFromUnsafe(from string) int {
+	count := 0
+	for _, records := range store.records {
+		for _, record := range records {
+			if record.from == from {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// dropExpiredUnsafe removes the expired records (the mutex must be held)
+func (store *ProviderStore) dropExpiredUnsafe(now time.Time) {
+	for key, records := range store.records {
+		for id, record := range records {
+			if now.After(record.expiry) {
+				delete(records, id)
+			}
+		}
+		if len(records) == 0 {
+			delete(store.records, key)
+		}
+	}
+}
+
+// GetProviders returns the non-expired provider records stored under key
+func (store *ProviderStore) GetProviders(key Key) []*messages.DHTProvider {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	records, ok := store.records[key]
+	if !ok {
+		return nil
+	}
+
+	providers := make([]*messages.DHTProvider, 0, len(records))
+	now := time.Now()
+	for id, record := range records {
+		if now.After(record.expiry) { // Lazily drop expired records
+			delete(records, id)
+			continue
+		}
+		providers = append(providers, record.provider)
+	}
+	if len(records) == 0 {
+		delete(store.records, key)
+	}
+	return providers
+}
@@ -0,0 +1,144 @@
+package dht
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// BucketSize is the maximum number of contacts in a k-bucket (Kademlia's k)
+	BucketSize = 8
+	// ContactStaleSec is the time after which a silent contact may be replaced by a new one in a full bucket
+	ContactStaleSec = 60
+)
+
+// Contact represents a DHT node reachable at a given <ip:port>
+type Contact struct {
+	Name     string    // The node's name
+	Addr     string    // The node's <ip:port>
+	ID       Key       // The node's ID (derived from its name)
+	lastSeen time.Time // The last time we heard from the node
+}
+
+// RoutingTable represents a Kademlia routing table made of k-buckets
+type RoutingTable struct {
+	self    Key                     // Our own node ID
+	name    string                  // Our own name
+	buckets [KeySizeBits][]*Contact // k-buckets, contacts ordered from least to most recently seen
+	mux     sync.Mutex              // Mutex to manipulate the structure from different threads
+}
+
+// NewContact creates a new instance of Contact
+func NewContact(name, addr string) *Contact {
+	return &Contact{Name: name, Addr: addr, ID: NameToKey(name), lastSeen: time.Now()}
+}
+
+// NewRoutingTable creates a new instance of RoutingTable for the node called name
+func NewRoutingTable(name string) *RoutingTable {
+	var table RoutingTable
+	table.self = NameToKey(name)
+	table.name = name
+	return &table
+}
+
+// Self returns our own node ID
+func (table *RoutingTable) Self() Key {
+	return table.self
+}
+
+// Update inserts a contact in the table or marks it as most recently seen. If the corresponding
+// bucket is full the least recently seen contact is evicted only if it became stale. The function
+// returns true if the contact is present in the table after the call.
+func (table *RoutingTable) Update(name, addr string) bool {
+	if name == "" || name == table.name || addr == "" {
+		return false
+	}
+
+	table.mux.Lock()
+	defer table.mux.Unlock()
+
+	contact := NewContact(name, addr)
+	index := table.self.BucketIndex(contact.ID)
+	bucket := table.buckets[index]
+
+	// Move an existing contact to the tail of its bucket
+	for i, c := range bucket {
+		if c.Name == name {
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			table.buckets[index] = append(bucket, contact)
+			return true
+		}
+	}
+
+	// Room left in the bucket
+	if len(bucket) < BucketSize {
+		table.buckets[index] = append(bucket, contact)
+		return true
+	}
+
+	// Replace the least recently seen contact if it is stale
+	if time.Since(bucket[0].lastSeen) > ContactStaleSec*time.Second {
+		table.buckets[index] = append(bucket[1:], contact)
+		return true
+	}
+
+	return false
+}
+
+// Remove deletes a contact from the table (e.g. when it failed to answer)
+func (table *RoutingTable) Remove(name string) {
+	table.mux.Lock()
+	defer table.mux.Unlock()
+
+	index := table.self.BucketIndex(NameToKey(name))
+	if index < 0 {
+		return
+	}
+	bucket := table.buckets[index]
+	for i, c := range bucket {
+		if c.Name == name {
+			table.buckets[index] = append(bucket[:i], bucket[i+1:]...)
+			return
+		}
+	}
+}
+
+// ClosestContacts returns at most nb contacts ordered by increasing distance to target
+func (table *RoutingTable) ClosestContacts(target Key, nb int) []*Contact {
+	table.mux.Lock()
+	defer table.mux.Unlock()
+
+	contacts := make([]*Contact, 0)
+	for _, bucket := range table.buckets {
+		for _, c := range bucket {
+			copied := *c
+			contacts = append(contacts, &copied)
+		}
+	}
+
+	SortByDistance(contacts, target)
+	if len(contacts) > nb {
+		contacts = contacts[:nb]
+	}
+	return contacts
+}
+
+// Size returns the number of contacts in the table
+func (table *RoutingTable) Size() int {
+	table.mux.Lock()
+	defer table.mux.Unlock()
+
+	size := 0
+	for _, bucket := range table.buckets {
+		size += len(bucket)
+	}
+	return size
+}
+
+// SortByDistance sorts a list of contacts by increasing distance to target
+func SortByDistance(contacts []*Contact, target Key) {
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].ID.CloserTo(target, contacts[j].ID)
+	})
+}
@@ -7,6 +7,7 @@ import (
 // Client - Represents a client
 type Client struct {
 	Addr     *net.UDPAddr // Address on which to send
+	Command  string       // The operation (msg, private, index, download, search, publish-art, subscribe, join, leave or invite)
 	Msg      string       // Message to send
 	Dst      string       // A private message's destination
 	Filename string       // A file to index
@@ -14,6 +15,24 @@ type Client struct {
 	Keywords []string     // A list of keyword
 	Budget   uint64       // A budget
 
-	ArtName string
-	ArtDesc string
+	ArtName   string // An artwork's name
+	ArtDesc   string // An artwork's description
+	Signature string // An artist's signature (subscribe)
+
+	Channel   string // A channel to post to or invite to
+	Join      string // A channel to join
+	Leave     string // A channel to leave
+	Encrypted bool   // Whether a joined channel is encrypted
+
+	NoWait  bool // Whether to exit without waiting for the gossiper's replies
+	Timeout uint // Seconds without reply after which the client gives up
+}
+
+// TUIClient - Represents the interactive terminal client, which talks to the gossiper's webserver
+type TUIClient struct {
+	ServerAddr string // IP/Port of the gossiper's webserver
+	Name       string // The gossiper's name (locates its API token)
+	DataDir    string // Folder of the gossiper's private data
+	Token      string // The API token (read from the gossiper's data folder if empty)
+	TLSCert    string // Certificate of the webserver to trust (enables HTTPS)
 }
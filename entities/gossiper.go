@@ -3,18 +3,39 @@ package entities
 import (
 	"Peerster/app"
 	"Peerster/blockchain"
+	"Peerster/channels"
+	"Peerster/dht"
 	"Peerster/files"
+	"Peerster/guard"
+	"Peerster/logger"
 	"Peerster/peers"
+	"Peerster/transport"
 	"crypto/rsa"
 	"fmt"
 	"net"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// PathToData is the default path to the folder where the node's private data is stored
+	PathToData = "_Data/"
+	// PathToFrontend is the default path to the folder holding the GUI's files
+	PathToFrontend = "./frontend/"
 )
 
 // Gossiper - Represents a gossiper
 type Gossiper struct {
-	Args          *CLArgsGossiper // CL arguments for the Gossiper (RO)
-	ClientChannel *net.UDPConn    // UDP channel to communicate with the client (Shared, thread-safe)
-	GossipChannel *net.UDPConn    // UDP channel to communicate with the network (Shared, thread-safe)
+	Args          *CLArgsGossiper            // CL arguments for the Gossiper (RO)
+	ClientChannel *net.UDPConn               // UDP channel to communicate with the client (Shared, thread-safe)
+	GossipChannel transport.Transport        // Transport (UDP, and streams for large messages) to communicate with the network (Shared, thread-safe)
+	SecureLinks   *transport.SecureTransport // Secure channel settings, also the top layer of GossipChannel (Shared, thread-safe)
+
+	/* Abuse protection */
+	Workers   *guard.WorkerPool   // Workers handling the packets received from the network (Shared, thread-safe)
+	Limiter   *guard.RateLimiter  // Per-source and per-type rate limits (Shared, thread-safe)
+	Blacklist *guard.Blacklist    // Sources ignored for sending invalid packets (Shared, thread-safe)
+	Drops     *guard.DropCounters // Number of dropped packets for each reason (Shared, thread-safe)
 
 	/* Rumors and private messages */
 	NameIndex *peers.NameIndex               // A dictionnary between peer names and received messages (Shared, thread-safe)
@@ -22,11 +43,26 @@ type Gossiper struct {
 	Router    *peers.RoutingTable            // A routing table associating names with next hop address (Shared, thread-safe)
 	Timeouts  *peers.StatusResponseForwarder // Timeouts for RumorMessage's answer (Shared, thread-safe)
 
+	/* Channels */
+	Channels *channels.ChannelIndex // The channels joined by the gossiper (Shared, thread-safe)
+
+	/* Protocol negotiation */
+	Capabilities *peers.PeerCapabilities // The protocol version and features of the neighbors (Shared, thread-safe)
+
+	/* NAT traversal */
+	DirectLinks *peers.DirectLinks // Direct connections established with distant peers (Shared, thread-safe)
+
 	/* File transfer */
 	FileIndex       *files.FileIndex       // A file index containing all indexed files (Shared, thread-safe)
 	TODataRequest   *files.TODataRequest   // Timeouts for DataReplies (Shared, thread-safe)
 	SReqTotalMatch  *files.SReqTotalMatch  // Keeps track of how many total matches were received for each SeachRequest (Shared, thread-safe)
 	TOSearchRequest *files.TOSearchRequest // Timeouts for received SearchRequest's (Shared, thread-safe)
+	SearchMatches   *files.SearchMatches   // The files found by each search of the user (Shared, thread-safe)
+
+	/* Distributed hash table */
+	DHTTable     *dht.RoutingTable  // Kademlia k-buckets (Shared, thread-safe)
+	DHTProviders *dht.ProviderStore // Provider records stored on this node (Shared, thread-safe)
+	DHTRPCs      *dht.PendingRPCs   // DHT requests waiting for a reply (Shared, thread-safe)
 
 	/* Blockchain */
 	Blockchain *blockchain.BCF // A blockchain for filename-to-metahash claiming (Shared, thread-safe)
@@ -36,13 +72,42 @@ type Gossiper struct {
 
 // CLArgsGossiper - Command line arguments for the gossiper
 type CLArgsGossiper struct {
-	ClientAddr string   // IP/Port on which the client talks
-	GossipAddr string   // IP/Port on which to listen to other gossips
-	Name       string   // Name of that gossiper
-	ServerPort string   // Port to launch the server on
-	SimpleMode bool     // Indicates whether the gossiper operates in simple broadcast mode
-	RTimer     uint     // Timer for RouteRumor messages
-	Peers      []string // Original list of peers
+	ClientAddr    string   // IP/Port on which the client talks
+	GossipAddr    string   // IP/Port on which to listen to other gossips
+	Name          string   // Name of that gossiper
+	ServerPort    string   // Port to launch the server on
+	SimpleMode    bool     // Indicates whether the gossiper operates in simple broadcast mode
+	RTimer        uint     // Timer for RouteRumor messages
+	AntiEntropy   uint     // Interval between anti-entropy exchanges, in seconds (0 to disable)
+	MaxRumors     uint     // Maximum number of messages kept in memory per origin (0 for unlimited)
+	RumorAge      uint     // Maximum age of the messages kept in memory, in seconds (0 for unlimited)
+	ArchiveDir    string   // Folder where messages dropped from memory are archived ("" to discard them)
+	WatchInterval uint     // Interval between two scans of the shared folder, in seconds (0 to disable)
+	DataDir       string   // Folder where the node's private data (e.g. the API token) is stored
+	SharedDir     string   // Folder of the shared files
+	DownloadDir   string   // Folder where the downloaded files are written
+	FrontendDir   string   // Folder of the GUI's files
+	MaxFileSize   int64    // Maximum size of the shared files, in bytes
+	GUIAddr       string   // IP on which the server listens (loopback unless TLS is enabled)
+	TLSCert       string   // Certificate of the server ("" for plain HTTP)
+	TLSKey        string   // Private key of the server's certificate
+	MaxPeers      uint     // Maximum number of neighbors (0 for unlimited)
+	PeerSelection string   // Strategy used to pick neighbors (uniform, rtt or lrc)
+	Insecure      bool     // Indicates whether links with neighbors are in plaintext by default
+	PlainPeers    []string // Neighbors with which links are in plaintext
+	Peers         []string // Original list of peers
+
+	/* Timers and hop limits */
+	DataRequestInterval uint   // Interval after which an unanswered DataRequest is resent, in seconds
+	SearchInterval      uint   // Interval between two rounds of a SearchRequest, in seconds
+	HopLimit            uint32 // Hop limit of the messages routed to a single peer
+	SearchHopLimit      uint32 // Hop limit of the SearchReply's
+	TxHopLimit          uint32 // Hop limit of the TxPublish's
+	BlockHopLimit       uint32 // Hop limit of the BlockPublish's and BlockReply's
+	ArtHopLimit         uint32 // Hop limit of the ArtTx's
+
+	/* Logs */
+	Log logger.Config // Levels, format and file of the logs
 }
 
 // NewGossiper - Creates a new instance of Gossiper
@@ -50,12 +115,32 @@ func NewGossiper(args *CLArgsGossiper) *Gossiper {
 	var gossip Gossiper
 	gossip.Args = args
 
+	/* Abuse protection */
+	gossip.Workers = guard.NewWorkerPool(guard.DefaultWorkers, guard.DefaultQueueSize)
+	gossip.Limiter = guard.NewRateLimiter(guard.Quota{Rate: guard.DefaultSourceRate, Burst: guard.DefaultSourceBurst},
+		guard.DefaultTypeQuotas)
+	gossip.Blacklist = guard.NewBlacklist()
+	gossip.Drops = guard.NewDropCounters()
+
 	/* Rumors and private messages */
 	gossip.NameIndex = peers.NewNameIndex()
-	gossip.PeerIndex = peers.NewPeerIndex()
-	gossip.Router = peers.NewRoutingTable()
+	gossip.NameIndex.SetRetention(newRetentionPolicy(args))
+	gossip.PeerIndex = peers.NewPeerIndex(int(args.MaxPeers))
+	if selector := peers.NewPeerSelector(args.PeerSelection); selector != nil {
+		gossip.PeerIndex.SetSelector(selector)
+	}
+	gossip.Router = peers.NewRoutingTable(peers.RouteExpiry(args.RTimer))
 	gossip.Timeouts = peers.NewStatusResponseForwarder()
 
+	/* Channels */
+	gossip.Channels = channels.NewChannelIndex()
+
+	/* Protocol negotiation */
+	gossip.Capabilities = peers.NewPeerCapabilities()
+
+	/* NAT traversal */
+	gossip.DirectLinks = peers.NewDirectLinks()
+
 	// Copy all the peers from the CLArgs to the PeerIndex
 	for _, peer := range args.Peers {
 		gossip.PeerIndex.AddPeerIfAbsent(peers.StringToUDPAddress(peer))
@@ -66,6 +151,12 @@ func NewGossiper(args *CLArgsGossiper) *Gossiper {
 	gossip.TODataRequest = files.NewTODataRequest()
 	gossip.SReqTotalMatch = files.NewSReqTotalMatch()
 	gossip.TOSearchRequest = files.NewTOSearchRequest()
+	gossip.SearchMatches = files.NewSearchMatches()
+
+	/* Distributed hash table */
+	gossip.DHTTable = dht.NewRoutingTable(args.Name)
+	gossip.DHTProviders = dht.NewProviderStore()
+	gossip.DHTRPCs = dht.NewPendingRPCs()
 
 	/* Blockchain */
 	gossip.Blockchain = blockchain.NewBCF()
@@ -79,3 +170,20 @@ func (gossip *Gossiper) GossiperToString() string {
 	return fmt.Sprintf("ClienAddr: %s\nGossipAddr: %s\nName: %s\nSimpleMode: %v\n",
 		gossip.Args.ClientAddr, gossip.Args.GossipAddr, gossip.Args.Name, gossip.Args.SimpleMode)
 }
+
+// newRetentionPolicy - Creates the retention policy of the messages described by the CL arguments
+func newRetentionPolicy(args *CLArgsGossiper) peers.RetentionPolicy {
+	retention := peers.RetentionPolicy{
+		MaxMessages: int(args.MaxRumors),
+		MaxAge:      time.Duration(args.RumorAge) * time.Second,
+	}
+	if args.ArchiveDir != "" {
+		archive, err := peers.NewRumorArchive(filepath.Join(args.ArchiveDir, args.Name))
+		if err != nil {
+			logger.Gossip.Error("newRetentionPolicy", "%s", err.Error())
+		} else {
+			retention.Archive = archive
+		}
+	}
+	return retention
+}
@@ -7,7 +7,7 @@ import (
 
 func HandleError(e error) {
 	if e != nil {
-		logger.Printlnf("ERROR: %s", e)
+		logger.Chain.Error("", "%s", e)
 	}
 }
 func HandleAbort(msg string, e error) {
@@ -15,5 +15,5 @@ func HandleAbort(msg string, e error) {
 	if e != nil {
 		errorString = fmt.Sprintf(":\n\t->ERROR: %s", e)
 	}
-	logger.Printlnf("ABORT: %s%s", msg, errorString)
+	logger.Chain.Error("", "ABORT: %s%s", msg, errorString)
 }
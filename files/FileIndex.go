@@ -1,8 +1,10 @@
 package files
 
 import (
+	"Peerster/frontend"
+	"Peerster/logger"
 	"Peerster/messages"
-	"fmt"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -14,6 +16,17 @@ const (
 	PathToDownloadedFiles = "_Downloads/"
 )
 
+// Folders and limit of the node, set once at startup before any file is indexed (the defaults are
+// PathToSharedFiles, PathToDownloadedFiles and MaxFileSizeBytes)
+var (
+	// SharedFilesDir is the folder where shared files are stored.
+	SharedFilesDir = PathToSharedFiles
+	// DownloadedFilesDir is the folder where downloaded files are stored.
+	DownloadedFilesDir = PathToDownloadedFiles
+	// MaxFileSize is the maximum size of a shared file in bytes (at most MaxFileSizeBytes).
+	MaxFileSize int64 = MaxFileSizeBytes
+)
+
 /*FileIndex represents the set of files indexed or known by the gossiper. The object contains an index
 mapping each known metahash to its corresponding `SharedFile` (`index`). The object also contains a mapping
 from every known hash (metahash or chunk hash) to its corresponding `SharedFile` (`hashes`).
@@ -73,7 +86,7 @@ func (fileIndex *FileIndex) AddMonoSourceFile(filename string, metahash []byte,
 }
 
 /*AddLocalFile adds a locally stored file to the `FileIndex`. This file must be stored in the
-`PathToSharedFiles` directory. All of the hashes (metahash and chunk hashes) generated from this
+`SharedFilesDir` directory. All of the hashes (metahash and chunk hashes) generated from this
 file are stored in the `FileIndex`'s `hashes` map.
 
 `filename` The file to index's filename.
@@ -93,7 +106,7 @@ func (fileIndex *FileIndex) AddLocalFile(filename string) *messages.File {
 
 	// Check if a file with the same metahash already exists in the database
 	if _, ok := fileIndex.index[ToHex32(shared.Metahash)]; ok { // We already have a file with the same metahash
-		fmt.Printf("b\n")
+		logger.Files.Debug("FileIndex.AddLocalFile", "%s is already indexed", filename)
 		return nil
 	}
 
@@ -122,6 +135,62 @@ func (fileIndex *FileIndex) AddLocalFile(filename string) *messages.File {
 	}
 }
 
+/*GetIndexedLocalFile looks up a file indexed from the `SharedFilesDir` folder by its name.
+
+`filename` The name of the file in the folder.
+
+The function returns the file's metahash (hex), and `false` if no such file is indexed.*/
+func (fileIndex *FileIndex) GetIndexedLocalFile(filename string) (string, bool) {
+	// Grab the mutex
+	fileIndex.mux.Lock()
+	defer fileIndex.mux.Unlock()
+
+	metahash, _ := fileIndex.findLocalFile(filename)
+	return metahash, metahash != ""
+}
+
+/*RemoveLocalFile unindexes a file indexed from the `SharedFilesDir` folder (e.g. because it was
+deleted), so that its chunks are no longer served.
+
+`filename` The name of the file in the folder.
+
+The function returns the metahash (hex) of the removed file, and `false` if no such file was indexed.*/
+func (fileIndex *FileIndex) RemoveLocalFile(filename string) (string, bool) {
+	// Grab the mutex
+	fileIndex.mux.Lock()
+	defer fileIndex.mux.Unlock()
+
+	metahash, shared := fileIndex.findLocalFile(filename)
+	if shared == nil {
+		return "", false
+	}
+
+	// Forget the file and all of its hashes
+	delete(fileIndex.index, metahash)
+	for hash, ref := range fileIndex.hashes {
+		if ref.File == shared {
+			delete(fileIndex.hashes, hash)
+		}
+	}
+
+	frontend.FBuffer.AddFrontendRemovedFile(filename, metahash)
+	return metahash, true
+}
+
+// findLocalFile returns the metahash and the `SharedFile` of a file indexed from the `PathToSharedFiles`
+// folder, or ("", nil) if there is none (the mutex must be held).
+func (fileIndex *FileIndex) findLocalFile(filename string) (string, *SharedFile) {
+	for metahash, shared := range fileIndex.index {
+		shared.mux.Lock()
+		found := !shared.IsDownloaded && shared.Filename == filename
+		shared.mux.Unlock()
+		if found {
+			return metahash, shared
+		}
+	}
+	return "", nil
+}
+
 /*GetDataFromHash reads the bytes corresponding to a provided hash (metafile or file chunk).
 The `hash` is looked for in the `FileIndex`'s `hashes` map.
 
@@ -291,3 +360,100 @@ func (fileIndex *FileIndex) addHashRef(hash string, ref *HashRef) {
 
 	fileIndex.hashes[hash] = ref
 }
+
+/*GetProvidedFiles returns a `SearchResult` for every file that is completely available locally
+(indexed or reconstructed). This is used to publish provider records in the DHT.
+
+The function returns a (possibly empty) slice of `SearchResult`'s.*/
+func (fileIndex *FileIndex) GetProvidedFiles() []*messages.SearchResult {
+	// Grab the mutex
+	fileIndex.mux.Lock()
+	defer fileIndex.mux.Unlock()
+
+	results := make([]*messages.SearchResult, 0)
+	for _, shared := range fileIndex.index {
+		if shared.IsReconstructed() {
+			if ret := shared.GetFileSearchInfo(); ret != nil {
+				results = append(results, ret)
+			}
+		}
+	}
+	return results
+}
+
+/*GetLocalFile looks up a file by its metahash in order to read its local copy.
+
+`metahash` The file's metahash (hex).
+
+The function returns the path to the file (empty if its name would escape the folder it is stored in),
+its name and status, and `false` if the metahash is unknown. The file is complete only if its status is
+`Reconstructed`.*/
+func (fileIndex *FileIndex) GetLocalFile(metahash string) (string, string, FileStatus, bool) {
+	// Grab the mutex
+	fileIndex.mux.Lock()
+	defer fileIndex.mux.Unlock()
+
+	shared, ok := fileIndex.index[strings.ToLower(metahash)]
+	if !ok {
+		return "", "", UncompleteMatch, false
+	}
+
+	shared.mux.Lock()
+	defer shared.mux.Unlock()
+	if !IsValidFilename(shared.Filename) {
+		return "", shared.Filename, shared.Status, true
+	}
+	return shared.localPath(), shared.Filename, shared.Status, true
+}
+
+/*FileSummary is a snapshot of the state of a file in the `FileIndex`.*/
+type FileSummary struct {
+	Filename         string          // The filename
+	Metahash         string          // The file's metahash (hex)
+	Status           FileStatus      // The file status
+	IsArtwork        bool            // Indicates whether the file is an artwork
+	ArtTx            *messages.ArtTx // The artwork's transaction (artworks only)
+	DownloadedChunks uint64          // Number of chunks present locally
+	ChunkCount       uint64          // Number of chunks of the file (0 while the metafile is unknown)
+}
+
+/*GetFiles returns a snapshot of every file in the `FileIndex`, sorted by filename. Files whose metafile
+is unknown yet are given the metahash they were requested with.
+
+The function returns a (possibly empty) slice of `FileSummary`'s.*/
+func (fileIndex *FileIndex) GetFiles() []FileSummary {
+	// Grab the mutex
+	fileIndex.mux.Lock()
+	defer fileIndex.mux.Unlock()
+
+	summaries := make([]FileSummary, 0, len(fileIndex.index))
+	for metahash, shared := range fileIndex.index {
+		shared.mux.Lock()
+		summaries = append(summaries, shared.summary(metahash))
+		shared.mux.Unlock()
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Filename < summaries[j].Filename })
+	return summaries
+}
+
+/*GetFile returns a snapshot of the state of a file in the `FileIndex`.
+
+`metahash` The file's metahash (hex).
+
+The function returns `false` if the metahash is unknown.*/
+func (fileIndex *FileIndex) GetFile(metahash string) (FileSummary, bool) {
+	// Grab the mutex
+	fileIndex.mux.Lock()
+	defer fileIndex.mux.Unlock()
+
+	metahash = strings.ToLower(metahash)
+	shared, ok := fileIndex.index[metahash]
+	if !ok {
+		return FileSummary{}, false
+	}
+
+	shared.mux.Lock()
+	defer shared.mux.Unlock()
+	return shared.summary(metahash), true
+}
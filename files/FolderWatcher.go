@@ -0,0 +1,124 @@
+package files
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWatchIntervalSec is the default interval between two scans of the shared folder.
+const DefaultWatchIntervalSec = 2
+
+// FolderEventKind represents the kind of change of a file in a watched folder (acts as an enumeration).
+type FolderEventKind int
+
+const (
+	// FileAdded is used when a new file appears in the folder.
+	FileAdded FolderEventKind = 0
+	// FileModified is used when the content of a known file changes.
+	FileModified FolderEventKind = 1
+	// FileRemoved is used when a known file disappears from the folder.
+	FileRemoved FolderEventKind = 2
+)
+
+func (kind FolderEventKind) String() string {
+	switch kind {
+	case FileAdded:
+		return "ADDED"
+	case FileModified:
+		return "MODIFIED"
+	case FileRemoved:
+		return "REMOVED"
+	}
+	return "UNKNOWN"
+}
+
+/*FolderEvent is a change of a file in a watched folder.*/
+type FolderEvent struct {
+	Kind     FolderEventKind // The kind of change
+	Filename string          // The name of the file in the folder
+}
+
+// fileStamp identifies a version of a file (a change of size or of modification time is a new version).
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+/*FolderWatcher detects the files added, modified or removed in a folder by polling it. A new version of
+a file is only reported once it has stayed the same for two consecutive scans, so that files are not
+reported while they are being written. Hidden files and sub-folders are ignored.
+
+A FolderWatcher object should be created by calling `NewFolderWatcher()`. Once created, the object is
+thread-safe.*/
+type FolderWatcher struct {
+	dir     string               // The watched folder
+	known   map[string]fileStamp // The reported version of each file
+	pending map[string]fileStamp // The versions seen during the last scan that are not reported yet
+	mux     sync.Mutex           // Mutex to manipulate the structure from different threads
+}
+
+/*NewFolderWatcher creates a new instance of FolderWatcher.
+
+`dir` The folder to watch.*/
+func NewFolderWatcher(dir string) *FolderWatcher {
+	var watcher FolderWatcher
+	watcher.dir = dir
+	watcher.known = make(map[string]fileStamp)
+	watcher.pending = make(map[string]fileStamp)
+	return &watcher
+}
+
+/*Scan lists the folder and compares it with the previous scans. A missing folder is considered empty.
+
+The function returns the (possibly empty) list of changes, sorted by filename.*/
+func (watcher *FolderWatcher) Scan() []FolderEvent {
+	// Grab the mutex
+	watcher.mux.Lock()
+	defer watcher.mux.Unlock()
+
+	// List the folder
+	current := make(map[string]fileStamp)
+	if infos, err := ioutil.ReadDir(watcher.dir); err == nil {
+		for _, info := range infos {
+			if info.Mode().IsRegular() && !strings.HasPrefix(info.Name(), ".") && IsValidFilename(info.Name()) {
+				current[info.Name()] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+			}
+		}
+	}
+
+	events := make([]FolderEvent, 0)
+
+	// New versions are reported once they are stable
+	pending := make(map[string]fileStamp)
+	for name, stamp := range current {
+		if known, ok := watcher.known[name]; ok && known == stamp {
+			continue
+		}
+		if previous, ok := watcher.pending[name]; !ok || previous != stamp {
+			pending[name] = stamp
+			continue
+		}
+
+		kind := FileAdded
+		if _, ok := watcher.known[name]; ok {
+			kind = FileModified
+		}
+		events = append(events, FolderEvent{Kind: kind, Filename: name})
+		watcher.known[name] = stamp
+	}
+	watcher.pending = pending
+
+	// Removed files
+	for name := range watcher.known {
+		if _, ok := current[name]; !ok {
+			events = append(events, FolderEvent{Kind: FileRemoved, Filename: name})
+			delete(watcher.known, name)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Filename < events[j].Filename })
+	return events
+}
@@ -0,0 +1,109 @@
+package files
+
+import (
+	"strings"
+	"sync"
+)
+
+// MaxMatchesPerSearch is the maximum number of files recorded for a search
+const MaxMatchesPerSearch = 1000
+
+/*SearchMatches records the files found by each search started by this gossiper, so that each search
+only reports its own results. A `SearchResult` received while a search is running is recorded for it
+if the file's name contains one of the search's keywords (case-insensitive).
+
+A SearchMatches object should be created by calling `NewSearchMatches()`. Once created, the object is
+thread-safe, meaning that several threads may manipulate the object through its API simultaneously.*/
+type SearchMatches struct {
+	searches map[uint64]*trackedSearch // An index associating a search ID to its matches
+	nextID   uint64                    // The ID of the next search
+	mux      sync.Mutex                // Mutex to manipulate the structure from different threads
+}
+
+/*trackedSearch represents a search and the files it found.*/
+type trackedSearch struct {
+	keywords   []string        // The lowercase keywords looked for
+	running    bool            // Whether results are still recorded
+	metahashes []string        // The metahashes of the files found, in order of discovery
+	found      map[string]bool // The set of metahashes found
+}
+
+/*NewSearchMatches creates a new instance of SearchMatches.*/
+func NewSearchMatches() *SearchMatches {
+	var searchMatches SearchMatches
+	searchMatches.searches = make(map[uint64]*trackedSearch)
+	searchMatches.nextID = 1
+	return &searchMatches
+}
+
+/*Register starts recording the matches of a new search. The caller must call `Finish` once the search
+is over and `Forget` once its matches aren't needed anymore.
+
+`keywords` The keywords looked for.
+
+The function returns the ID of the search.*/
+func (searchMatches *SearchMatches) Register(keywords []string) uint64 {
+	searchMatches.mux.Lock()
+	defer searchMatches.mux.Unlock()
+
+	lower := make([]string, len(keywords))
+	for i, keyword := range keywords {
+		lower[i] = strings.ToLower(keyword)
+	}
+
+	id := searchMatches.nextID
+	searchMatches.nextID++
+	searchMatches.searches[id] = &trackedSearch{keywords: lower, running: true, found: make(map[string]bool)}
+	return id
+}
+
+/*AddResult records a file found on the network for every running search whose keywords match its name.*/
+func (searchMatches *SearchMatches) AddResult(filename, metahash string) {
+	searchMatches.mux.Lock()
+	defer searchMatches.mux.Unlock()
+
+	lower := strings.ToLower(filename)
+	for _, search := range searchMatches.searches {
+		if !search.running || search.found[metahash] || len(search.metahashes) >= MaxMatchesPerSearch {
+			continue
+		}
+		for _, keyword := range search.keywords {
+			if strings.Contains(lower, keyword) {
+				search.found[metahash] = true
+				search.metahashes = append(search.metahashes, metahash)
+				break
+			}
+		}
+	}
+}
+
+/*Finish stops recording the matches of a search (they can still be read).*/
+func (searchMatches *SearchMatches) Finish(id uint64) {
+	searchMatches.mux.Lock()
+	defer searchMatches.mux.Unlock()
+
+	if search, ok := searchMatches.searches[id]; ok {
+		search.running = false
+	}
+}
+
+/*Forget deletes a search and its matches.*/
+func (searchMatches *SearchMatches) Forget(id uint64) {
+	searchMatches.mux.Lock()
+	defer searchMatches.mux.Unlock()
+
+	delete(searchMatches.searches, id)
+}
+
+/*GetMatches returns the metahashes of the files found by a search, in order of discovery, and whether
+the search is known.*/
+func (searchMatches *SearchMatches) GetMatches(id uint64) ([]string, bool) {
+	searchMatches.mux.Lock()
+	defer searchMatches.mux.Unlock()
+
+	search, ok := searchMatches.searches[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]string{}, search.metahashes...), true
+}
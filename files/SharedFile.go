@@ -6,6 +6,7 @@ import (
 	"Peerster/frontend"
 	"Peerster/messages"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -29,6 +30,23 @@ const (
 	Reconstructed FileStatus = 5
 )
 
+/*String returns the name of a file status, as shown by the API.*/
+func (status FileStatus) String() string {
+	switch status {
+	case UncompleteMatch:
+		return "partial-match"
+	case CompleteMatch:
+		return "complete-match"
+	case NoMetafileMultiSource, NoMetafileMonoSource:
+		return "requesting-metafile"
+	case MissingChunks:
+		return "downloading"
+	case Reconstructed:
+		return "complete"
+	}
+	return "unknown"
+}
+
 const (
 	// ChunkSizeBytes is the size of a chunk in bytes.
 	ChunkSizeBytes = 8192
@@ -67,7 +85,7 @@ type SharedFile struct {
 In particular, the memory is already allocated for all fields since the number of chunks is known at creation.
 The metahash should be set by the caller after the object is returned.
 
-`filename` The file to index (must be stored in the PathToSharedFiles folder).
+`filename` The file to index (must be stored in the SharedFilesDir folder).
 
 `chunkCount` The number of chunks for this file.
 
@@ -187,7 +205,7 @@ func (shared *SharedFile) SetMetafile(reply *messages.DataReply) bool {
 		shared.AcknowledgeFileReconstructed()
 
 		// Create an empty file
-		f, err := os.OpenFile(PathToDownloadedFiles+shared.Filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		f, err := os.OpenFile(filepath.Join(DownloadedFilesDir, shared.Filename), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 		if err != nil {
 			fail.CustomPanic("SharedFile.SetMetafile", "Failed to open file %s", shared.Filename)
 		}
@@ -222,12 +240,7 @@ func (shared *SharedFile) GetChunk(chunkID uint64) []byte {
 	// Return one of the file's chunk
 
 	// Compute the filepath
-	path := shared.Filename
-	if shared.IsDownloaded {
-		path = PathToDownloadedFiles + path
-	} else {
-		path = PathToSharedFiles + path
-	}
+	path := shared.localPath()
 
 	// Open the file
 	var f *os.File
@@ -269,7 +282,7 @@ func (shared *SharedFile) WriteChunk(chunkID uint64, data []byte) bool {
 	}
 
 	// Open the file in write mode
-	f, err := os.OpenFile(PathToDownloadedFiles+shared.Filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	f, err := os.OpenFile(filepath.Join(DownloadedFilesDir, shared.Filename), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
 		fail.CustomPanic("SharedFile.WriteChunk", `Failed to open file %s`, shared.Filename)
 	}
@@ -432,6 +445,14 @@ func (shared *SharedFile) SwitchMultiToMonoSource(newName string) bool {
 	return false
 }
 
+// localPath returns the path to the local copy of the file (the mutex must be held).
+func (shared *SharedFile) localPath() string {
+	if shared.IsDownloaded {
+		return filepath.Join(DownloadedFilesDir, shared.Filename)
+	}
+	return filepath.Join(SharedFilesDir, shared.Filename)
+}
+
 // AcknowledgeFileReconstructed should be called when a file has been completely reconstructed.
 func (shared *SharedFile) AcknowledgeFileReconstructed() {
 	// Send update to frontend
@@ -447,3 +468,25 @@ func (shared *SharedFile) AcknowledgeCompleteMatch() {
 	// Send update to frontend
 	frontend.FBuffer.AddFrontendAvailableFile(shared.Filename, ToHex32(shared.Metahash))
 }
+
+// IsReconstructed returns true if all of the file's chunks are available locally.
+func (shared *SharedFile) IsReconstructed() bool {
+	// Grab the mutex
+	shared.mux.Lock()
+	defer shared.mux.Unlock()
+
+	return shared.Status == Reconstructed
+}
+
+/*summary returns a snapshot of the state of the file (its mutex must be held).*/
+func (shared *SharedFile) summary(metahash string) FileSummary {
+	return FileSummary{
+		Filename:         shared.Filename,
+		Metahash:         metahash,
+		Status:           shared.Status,
+		IsArtwork:        shared.IsArtwork,
+		ArtTx:            shared.ArtTx,
+		DownloadedChunks: uint64(len(shared.DownloadedChunks)),
+		ChunkCount:       shared.ChunkCount,
+	}
+}
@@ -2,6 +2,7 @@ package files
 
 import (
 	"Peerster/fail"
+	"Peerster/logger"
 	"Peerster/messages"
 	"sync"
 )
@@ -81,14 +82,14 @@ func (forwarder *TODataRequest) SearchHashAndAcknowledge(reply *messages.DataRep
 	defer forwarder.mux.Unlock()
 
 	if match, ok := forwarder.responses[ToHex(reply.HashValue[:])]; ok { // We were waiting for this hash
-		fail.LeveledPrint(2, "TODataRequest.SearchHashAndAcknowledge", "Expected origin %s, reply's origin %s", match.Origin, reply.Origin)
+		logger.Files.Debug("TODataRequest.SearchHashAndAcknowledge", "Expected origin %s, reply's origin %s", match.Origin, reply.Origin)
 		if !match.Done && match.Origin == reply.Origin { // Check that data was sent from the correct peer
 			// Acknowledges to the sender thread and return
 			match.Done = true
-			fail.LeveledPrint(2, "TODataRequest.SearchHashAndAcknowledge", "Found valid handler with hash %s", ToHex(reply.HashValue[:]))
+			logger.Files.Debug("TODataRequest.SearchHashAndAcknowledge", "Found valid handler with hash %s", ToHex(reply.HashValue[:]))
 			return match.Hash
 		}
-		fail.LeveledPrint(2, "TODataRequest.SearchHashAndAcknowledge", "Handler with %s already used", ToHex(reply.HashValue[:]))
+		logger.Files.Debug("TODataRequest.SearchHashAndAcknowledge", "Handler with %s already used", ToHex(reply.HashValue[:]))
 	}
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 // ToHex returns the hexadecimal string representation of a hash
@@ -17,6 +19,12 @@ func ToHex32(hash [32]byte) string {
 	return fmt.Sprintf("%x", hash[:])
 }
 
+// IsValidFilename returns true if a filename doesn't leave the folder it is looked up in
+func IsValidFilename(filename string) bool {
+	return filename != "" && filename != "." && filename != ".." && filepath.Base(filename) == filename &&
+		!strings.ContainsAny(filename, `/\`)
+}
+
 // GetChunksNumberFromRawFile returns the number of chunks from the filesize
 func GetChunksNumberFromRawFile(fileSize int) uint64 {
 	nbChunks := uint64(fileSize / ChunkSizeBytes)
@@ -26,20 +34,20 @@ func GetChunksNumberFromRawFile(fileSize int) uint64 {
 	return nbChunks
 }
 
-// IndexLocalFile indexes a new file named filename stored in the PathToSharedFiles folder.
+// IndexLocalFile indexes a new file named filename stored in the SharedFilesDir folder.
 func IndexLocalFile(filename string) (*SharedFile, int64) {
 
 	// Open the file
 	var f *os.File
 	var err error
-	if f, err = os.Open(PathToSharedFiles + filename); err != nil {
+	if f, err = os.Open(filepath.Join(SharedFilesDir, filename)); err != nil {
 		return nil, 0
 	}
 	defer f.Close()
 
 	// Check the filesize (must not be too large)
 	fi, err := f.Stat()
-	if err != nil || fi.Size() > MaxFileSizeBytes {
+	if err != nil || fi.Size() > MaxFileSize {
 		return nil, 0
 	}
 
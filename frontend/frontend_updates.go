@@ -1,18 +1,30 @@
 package frontend
 
 import (
+	"Peerster/fail"
 	"Peerster/messages"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
 	"strings"
 	"sync"
 )
 
+// MaxFrontendUpdates is the maximum number of updates kept in the log (the oldest ones are dropped, older
+// messages can still be fetched through the history)
+const MaxFrontendUpdates = 10000
+
 // FBuffer - A buffer of updates for the frontend
 var FBuffer = NewFrontendBuffer()
 
-// FrontendBuffer - A buffer of updates for the frontend
+// FrontendBuffer - A log of updates for the frontend. Updates are numbered from 1 and are never consumed:
+// each subscriber keeps its own cursor (the epoch of the log and the sequence number of the last update it
+// got). The epoch changes with each run of the gossiper, as the numbering restarts.
 type FrontendBuffer struct {
-	updates []*FrontendUpdate // An array of FrontendUpdate
+	epoch   string            // Identifies this run's log
+	updates []*FrontendUpdate // An array of FrontendUpdate, the oldest first
+	nextSeq uint64            // Sequence number of the next update
+	notify  chan struct{}     // Closed (and replaced) when an update is added
 	mux     sync.Mutex        // Mutex to manipulate the structure from different threads
 }
 
@@ -35,6 +47,20 @@ type FrontendPrivateMessage struct {
 	Msg         string // Peer's message
 }
 
+// FrontendChannel - A joined (or left) channel for the frontend
+type FrontendChannel struct {
+	Name      string // Channel's name
+	Encrypted bool   // Indicates whether the channel is encrypted
+	Joined    bool   // Indicates whether the channel was joined or left
+}
+
+// FrontendChannelMessage - A (decrypted) channel message for the frontend
+type FrontendChannelMessage struct {
+	Channel string // Channel's name
+	Origin  string // Message's origin
+	Msg     string // Peer's message
+}
+
 // FrontendPrivateContact - A private contact for the frontend
 type FrontendPrivateContact struct {
 	Name string // Peer's name
@@ -71,13 +97,20 @@ type FrontendAvailableArtowrk struct {
 	Filename    string               // The filename corresponding to this artwork
 }
 
-// FrontendUpdate - An update for the
+// FrontendUpdate - An update for the frontend
 type FrontendUpdate struct {
+	Epoch string // Epoch of the log
+	Seq   uint64 // Update's sequence number in the log
+
 	Rumor            *FrontendRumor            // A rumor
 	Peer             *FrontendPeer             // A peer
+	RemovedPeer      *FrontendPeer             // A peer that was evicted
 	PrivateMessage   *FrontendPrivateMessage   // A private message
 	PrivateContact   *FrontendPrivateContact   // A private contact
+	Channel          *FrontendChannel          // A joined or left channel
+	ChannelMessage   *FrontendChannelMessage   // A channel message
 	IndexedFile      *FrontendIndexedFile      // An indexed file
+	RemovedFile      *FrontendIndexedFile      // An indexed file that was removed from the shared folder
 	ConstructingFile *FrontendConstructingFile // A constructing file
 	AvailableFile    *FrontendAvailableFile    // An available file
 
@@ -86,18 +119,62 @@ type FrontendUpdate struct {
 
 }
 
+// EscapeHTML - Neutralizes the HTML tags in a string displayed by the frontend (prevents Javascript
+// injection)
+func EscapeHTML(s string) string {
+	s = strings.Replace(s, "<", " &lt ", -1)
+	return strings.Replace(s, ">", " &gt ", -1)
+}
+
 // NewFrontendBuffer - Creates a new instance of FrontendBuffer
 func NewFrontendBuffer() *FrontendBuffer {
 	var buffer FrontendBuffer
+	buffer.epoch = newEpoch()
 	buffer.updates = nil
+	buffer.nextSeq = 1
+	buffer.notify = make(chan struct{})
 	return &buffer
 }
 
-// EmptyBuffer - Empty the buffer
-func (buffer *FrontendBuffer) EmptyBuffer() {
-	buffer.mux.Lock()
-	defer buffer.mux.Unlock()
-	buffer.updates = nil
+// newEpoch - Returns a random identifier for the log of a run
+func newEpoch() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// FormatCursor - Returns the cursor of a subscriber which got the updates up to a sequence number of a log
+func FormatCursor(epoch string, seq uint64) string {
+	return epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// ParseCursor - Returns the epoch and sequence number of a cursor. A bare sequence number (from a client
+// unaware of epochs) has an empty epoch.
+func ParseCursor(cursor string) (string, uint64, error) {
+	epoch, seq := "", cursor
+	if i := strings.LastIndex(cursor, "-"); i >= 0 {
+		epoch, seq = cursor[:i], cursor[i+1:]
+	}
+	value, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return "", 0, &fail.CustomError{Fun: "ParseCursor", Desc: "invalid cursor " + cursor}
+	}
+	return epoch, value, nil
+}
+
+// appendUnsafe - Numbers an update and adds it to the log, dropping the oldest one if it is full, then
+// wakes up the subscribers
+func (buffer *FrontendBuffer) appendUnsafe(update *FrontendUpdate) {
+	if len(buffer.updates) >= MaxFrontendUpdates {
+		buffer.updates = buffer.updates[1:]
+	}
+	update.Epoch = buffer.epoch
+	update.Seq = buffer.nextSeq
+	buffer.nextSeq++
+	buffer.updates = append(buffer.updates, update)
+
+	close(buffer.notify)
+	buffer.notify = make(chan struct{})
 }
 
 // AddFrontendRumor - Adds a rumor to the buffer
@@ -106,15 +183,13 @@ func (buffer *FrontendBuffer) AddFrontendRumor(name, msg string) {
 	defer buffer.mux.Unlock()
 
 	// Prevent Javascript injection
-	name = strings.Replace(name, "<", " &lt ", -1)
-	name = strings.Replace(name, ">", " &gt ", -1)
-	msg = strings.Replace(msg, "<", " &lt ", -1)
-	msg = strings.Replace(msg, ">", " &gt ", -1)
+	name = EscapeHTML(name)
+	msg = EscapeHTML(msg)
 
 	// Create update
 	newRumor := &FrontendRumor{Name: name, Msg: msg}
 	newUpdate := &FrontendUpdate{Rumor: newRumor}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendPeer - Adds a peer to the buffer
@@ -125,7 +200,18 @@ func (buffer *FrontendBuffer) AddFrontendPeer(ip, port string) {
 	// Create update
 	newPeer := &FrontendPeer{IP: ip, Port: port}
 	newUpdate := &FrontendUpdate{Peer: newPeer}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
+}
+
+// AddFrontendRemovedPeer - Adds an evicted peer to the buffer
+func (buffer *FrontendBuffer) AddFrontendRemovedPeer(ip, port string) {
+	buffer.mux.Lock()
+	defer buffer.mux.Unlock()
+
+	// Create update
+	removedPeer := &FrontendPeer{IP: ip, Port: port}
+	newUpdate := &FrontendUpdate{RemovedPeer: removedPeer}
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendPrivateMessage - Adds a private message to the buffer
@@ -134,15 +220,39 @@ func (buffer *FrontendBuffer) AddFrontendPrivateMessage(origin, destination, msg
 	defer buffer.mux.Unlock()
 
 	// Prevent Javascript injection
-	origin = strings.Replace(origin, "<", " &lt ", -1)
-	origin = strings.Replace(origin, ">", " &gt ", -1)
-	msg = strings.Replace(msg, "<", " &lt ", -1)
-	msg = strings.Replace(msg, ">", " &gt ", -1)
+	origin = EscapeHTML(origin)
+	msg = EscapeHTML(msg)
 
 	// Create update
 	newPrivateMessage := &FrontendPrivateMessage{Origin: origin, Destination: destination, Msg: msg}
 	newUpdate := &FrontendUpdate{PrivateMessage: newPrivateMessage}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
+}
+
+// AddFrontendChannel - Adds a joined or left channel to the buffer
+func (buffer *FrontendBuffer) AddFrontendChannel(name string, encrypted, joined bool) {
+	buffer.mux.Lock()
+	defer buffer.mux.Unlock()
+
+	// Create update
+	newChannel := &FrontendChannel{Name: name, Encrypted: encrypted, Joined: joined}
+	newUpdate := &FrontendUpdate{Channel: newChannel}
+	buffer.appendUnsafe(newUpdate)
+}
+
+// AddFrontendChannelMessage - Adds a channel message to the buffer
+func (buffer *FrontendBuffer) AddFrontendChannelMessage(channel, origin, msg string) {
+	buffer.mux.Lock()
+	defer buffer.mux.Unlock()
+
+	// Prevent Javascript injection
+	origin = EscapeHTML(origin)
+	msg = EscapeHTML(msg)
+
+	// Create update
+	newChannelMessage := &FrontendChannelMessage{Channel: channel, Origin: origin, Msg: msg}
+	newUpdate := &FrontendUpdate{ChannelMessage: newChannelMessage}
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendPrivateContact - Adds a private contact to the buffer
@@ -153,7 +263,7 @@ func (buffer *FrontendBuffer) AddFrontendPrivateContact(name string) {
 	// Create update
 	newPrivateContact := &FrontendPrivateContact{Name: name}
 	newUpdate := &FrontendUpdate{PrivateContact: newPrivateContact}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendIndexedFile - Adds an indexed file to the buffer
@@ -164,7 +274,18 @@ func (buffer *FrontendBuffer) AddFrontendIndexedFile(filename, metahash string)
 	// Create update
 	newIndexedFile := &FrontendIndexedFile{Filename: filename, Metahash: metahash}
 	newUpdate := &FrontendUpdate{IndexedFile: newIndexedFile}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
+}
+
+// AddFrontendRemovedFile - Adds an unindexed file to the buffer
+func (buffer *FrontendBuffer) AddFrontendRemovedFile(filename, metahash string) {
+	buffer.mux.Lock()
+	defer buffer.mux.Unlock()
+
+	// Create update
+	newRemovedFile := &FrontendIndexedFile{Filename: filename, Metahash: metahash}
+	newUpdate := &FrontendUpdate{RemovedFile: newRemovedFile}
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendConstructingFile - Adds a constructing file to the buffer
@@ -175,7 +296,7 @@ func (buffer *FrontendBuffer) AddFrontendConstructingFile(filename, metahash, or
 	// Create update
 	newConstructingFile := &FrontendConstructingFile{Filename: filename, Metahash: metahash, Origin: origin}
 	newUpdate := &FrontendUpdate{ConstructingFile: newConstructingFile}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendAvailableFile - Adds an available file to the buffer
@@ -186,7 +307,7 @@ func (buffer *FrontendBuffer) AddFrontendAvailableFile(filename, metahash string
 	// Create update
 	newIndexedFile := &FrontendAvailableFile{Filename: filename, Metahash: metahash}
 	newUpdate := &FrontendUpdate{AvailableFile: newIndexedFile}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendArtist - Adds an artist to the buffer
@@ -199,7 +320,7 @@ func (buffer *FrontendBuffer) AddFrontendArtist(info *messages.ArtistInfo) {
 		Info: *info,
 	}
 	newUpdate := &FrontendUpdate{Artist: newArtist}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
 }
 
 // AddFrontendAvailableArtwork - Adds an available artwork to the buffer
@@ -214,28 +335,40 @@ func (buffer *FrontendBuffer) AddFrontendAvailableArtwork(filename string, artTx
 		ArtworkInfo: *artTx.Artwork,
 	}
 	newUpdate := &FrontendUpdate{AvailableArtwork: newAvailableArtwork}
-	buffer.updates = append(buffer.updates, newUpdate)
+	buffer.appendUnsafe(newUpdate)
 }
 
-// GetDataAndEmpty - Empty the buffer and returns all its data as a byte slice
-func (buffer *FrontendBuffer) GetDataAndEmpty() *[]byte {
+// GetUpdatesSince - Returns the updates with a sequence number greater than cursor, the oldest first. The
+// boolean indicates whether the subscriber must reset its state: some of them were already dropped from the
+// log, or the cursor comes from another epoch.
+func (buffer *FrontendBuffer) GetUpdatesSince(epoch string, cursor uint64) ([]*FrontendUpdate, bool) {
 	buffer.mux.Lock()
 	defer buffer.mux.Unlock()
 
-	data := []byte("{}")
-
-	// Check if the buffer isn't empty
-	if buffer.updates == nil {
-		return &data
+	// A new subscriber (cursor 0) gets the whole log. A subscriber which is too far behind, or whose
+	// cursor comes from a previous run of the gossiper, also gets it but must reset its state.
+	firstSeq := buffer.nextSeq - uint64(len(buffer.updates))
+	if cursor != 0 && epoch != buffer.epoch || cursor+1 < firstSeq || cursor >= buffer.nextSeq {
+		return append([]*FrontendUpdate{}, buffer.updates...), cursor != 0
 	}
+	return append([]*FrontendUpdate{}, buffer.updates[cursor+1-firstSeq:]...), false
+}
 
-	// Collect last updates
-	data, _ = json.Marshal(map[string][]*FrontendUpdate{
-		"updates": buffer.updates,
-	})
+// GetEpoch - Returns the epoch of the log
+func (buffer *FrontendBuffer) GetEpoch() string {
+	return buffer.epoch
+}
 
-	// Erase the buffer
-	buffer.updates = nil
+// GetLastSeq - Returns the sequence number of the last update (0 if there is none)
+func (buffer *FrontendBuffer) GetLastSeq() uint64 {
+	buffer.mux.Lock()
+	defer buffer.mux.Unlock()
+	return buffer.nextSeq - 1
+}
 
-	return &data
+// Wait - Returns a channel which is closed when the next update is added
+func (buffer *FrontendBuffer) Wait() <-chan struct{} {
+	buffer.mux.Lock()
+	defer buffer.mux.Unlock()
+	return buffer.notify
 }
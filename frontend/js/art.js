@@ -29,13 +29,18 @@ function addArtist(name, signature) {
     document.getElementById('chat_scrollable_wrap').appendChild(newChat);
 }
 
+function markSubscribed(button) {
+    // Change button style
+    button.style.backgroundColor = 'rgb(' + 114 + ',' + 255 + ',' + 109 + ')';
+    button.style.borderColor = 'rgb(' + 114 + ',' + 255 + ',' + 109 + ')';
+    button.innerHTML = "Subscribed!";
+    button.onclick = null;
+    contactAttachListeners(button.parentElement)
+}
+
 function onSubscribe(signature) {
     return function() {
-        // Change button style
-        this.style.backgroundColor = 'rgb(' + 114 + ',' + 255 + ',' + 109 + ')';
-        this.style.borderColor = 'rgb(' + 114 + ',' + 255 + ',' + 109 + ')';
-        this.innerHTML = "Subscribed!";
-        contactAttachListeners(this.parentElement)
+        markSubscribed(this)
 
         // POST data
         let xhr = new XMLHttpRequest();
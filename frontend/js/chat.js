@@ -18,12 +18,16 @@ function sendMessage(e) {
 
         // Send message
         let newMsg = document.getElementById("send_message").value;
-        if (curr_contact.innerHTML === "Global Channel") {
+        if (curr_contact.id.startsWith("group_")) {
+            // The global channel is the plain rumor feed
+            let data = {"message": newMsg};
+            if (curr_contact.id !== "group_Global") {
+                data["channel"] = curr_contact.innerHTML;
+            }
             let xhr = new XMLHttpRequest();
             xhr.open("POST", "/rumor", true);
             xhr.setRequestHeader("Content-Type", "application/json");
-            let data = JSON.stringify({"message": newMsg});
-            xhr.send(data);      
+            xhr.send(JSON.stringify(data));
         } else {
             let xhr = new XMLHttpRequest();
             xhr.open("POST", "/private", true);
@@ -48,15 +52,20 @@ function suppressEnter(e) {
     }
 }
 
-function appendMessage(channel, sender, msg_content) {
+function appendMessage(channel, sender, msg_content, is_group) {
 
     /* The function assumes that the channel already exists */
 
     let idChat = "chat_private_" + channel;
-    if (channel === "Global") {
+    if (channel === "Global" || is_group) {
         idChat = "chat_group_" + channel;
     }
 
+    // The channel may be unknown if the update creating it was dropped from the log
+    if (document.getElementById(idChat) === null) {
+        return
+    }
+
     // Check who was the last to talk on the channel
     let childs_conv = document.getElementById(idChat).children;
     let last_monologue = null;
@@ -1,53 +1,143 @@
+/* The page is first hydrated from a snapshot of the gossiper's state, then updates are pushed by the
+   gossiper as Server-Sent Events. Each event's ID is the update's sequence number, which the browser
+   sends back when it reconnects so that no update is lost. */
+
+let last_update = 0
+
+function hydrate() {
+
+    let xhr = new XMLHttpRequest();
+    xhr.open("GET", "/state", true);
+    xhr.setRequestHeader("Content-Type", "application/json");
+    xhr.onreadystatechange = function () {
+        if (xhr.readyState === 4) {
+            if (xhr.status !== 200) {
+                subscribe(0) // Rebuild the page from the updates only
+                return
+            }
+
+            let state = JSON.parse(xhr.responseText);
+            state.Peers.forEach(p => addPeer(p.IP + ":" + p.Port));
+            state.Contacts.forEach(c => addContact(c.Name));
+            state.Channels.forEach(c => addGroup(c.Name));
+            state.Rumors.forEach(r => appendMessage("Global", r.Name, r.Msg));
+            state.ChannelMessages.forEach(m => appendMessage(m.Channel, m.Origin, m.Msg, true));
+            state.PrivateMessages.forEach(function (m) {
+                let contact = (m.Origin === document.getElementById("my_name").innerHTML) ? m.Destination : m.Origin;
+                addContact(contact);
+                appendMessage(contact, m.Origin, m.Msg);
+            });
+            state.Files.Indexed.forEach(f => addIndexedFile(f.Filename, f.Metahash));
+            state.Files.Constructing.forEach(f => addConstructingFile(f.Filename, f.Metahash, ""));
+            state.Files.Available.forEach(f => addAvailableFile(f.Filename, f.Metahash));
+            state.Artists.forEach(function (a) {
+                addArtist(a.Info.Name, a.Info.Signature);
+                if (a.Subscribed) {
+                    markSubscribed(document.getElementById(a.Info.Signature));
+                }
+            });
+            state.Artworks.forEach(a => downloadArtwork(a.ArtistInfo.Name, a.ArtworkInfo.Metahash,
+                a.ArtworkInfo.Name, a.ArtworkInfo.Description, a.ArtworkInfo.Filename));
+
+            subscribe(state.Epoch + "-" + state.Seq)
+        }
+    };
+
+    xhr.send();
+}
+
+function handleUpdate(update) {
+    last_update = update.Epoch + "-" + update.Seq
+    if (update.Rumor !== null) {
+        // This is a rumor
+        appendMessage("Global", update.Rumor.Name, update.Rumor.Msg)
+    } else if (update.Peer !== null) {
+        // This is a peer
+        addPeer(update.Peer.IP + ":" + update.Peer.Port)
+    } else if (update.RemovedPeer !== null) {
+        // This is an evicted peer
+        removePeer(update.RemovedPeer.IP + ":" + update.RemovedPeer.Port)
+    } else if (update.PrivateMessage !== null) {
+        // This is a private message
+        if (update.PrivateMessage.Origin === document.getElementById("my_name").innerHTML) {
+            appendMessage(update.PrivateMessage.Destination, update.PrivateMessage.Origin, update.PrivateMessage.Msg)                                
+        } else {
+            appendMessage(update.PrivateMessage.Origin, update.PrivateMessage.Origin, update.PrivateMessage.Msg)
+        }
+    } else if (update.Channel !== null) {
+        // This is a joined or left channel
+        if (update.Channel.Joined) {
+            addGroup(update.Channel.Name)
+        } else {
+            removeGroup(update.Channel.Name)
+        }
+    } else if (update.ChannelMessage !== null) {
+        // This is a channel message
+        appendMessage(update.ChannelMessage.Channel, update.ChannelMessage.Origin, update.ChannelMessage.Msg, true)
+    } else if (update.PrivateContact !== null) {
+        // This is a private contact
+        addContact(update.PrivateContact.Name)
+    } else if (update.IndexedFile !== null) {
+        // This is a new indexed file
+        addIndexedFile(update.IndexedFile.Filename, update.IndexedFile.Metahash)
+        removeFile(update.IndexedFile.Metahash, "reconstructing_files")
+        removeFile(update.IndexedFile.Metahash, "available_files")
+    } else if (update.RemovedFile !== null) {
+        // This file was removed from the shared folder
+        removeFile(update.RemovedFile.Metahash, "indexed_files")
+    } else if (update.ConstructingFile !== null) {
+        // This is a new file in construction
+        addConstructingFile(update.ConstructingFile.Filename, update.ConstructingFile.Metahash, update.ConstructingFile.Origin)
+    } else if (update.AvailableFile !== null) {
+        // This is a new availble file
+        addAvailableFile(update.AvailableFile.Filename, update.AvailableFile.Metahash)
+    } else if (update.Artist !== null) {
+        addArtist(update.Artist.Info.Name, update.Artist.Info.Signature)
+    } else if (update.AvailableArtwork !== null) {
+        downloadArtwork(update.AvailableArtwork.ArtistInfo.Name,
+            update.AvailableArtwork.ArtworkInfo.Metahash,
+            update.AvailableArtwork.ArtworkInfo.Name,
+            update.AvailableArtwork.ArtworkInfo.Description,
+            update.AvailableArtwork.ArtworkInfo.Filename)
+    }
+}
+
+function subscribe(since) {
+
+    // Fall back to polling on browsers without EventSource
+    last_update = since
+    if (typeof(EventSource) === "undefined") {
+        refresh()
+        return
+    }
+
+    let source = new EventSource("/events?since=" + since);
+    source.onmessage = function (e) {
+        handleUpdate(JSON.parse(e.data))
+    };
+    source.addEventListener("reset", function () {
+        // Some updates were lost (or the gossiper restarted): rebuild the page from the log
+        source.close()
+        location.reload()
+    });
+}
+
 function getUpdates() {
 
     let xhr = new XMLHttpRequest();
-    xhr.open("GET", "/updates", true);
+    xhr.open("GET", "/updates?since=" + last_update, true);
     xhr.setRequestHeader("Content-Type", "application/json");
     xhr.onreadystatechange = function () {
         if (xhr.readyState === 4 && xhr.status === 200) {
             if (xhr.responseText !== "") {
                 let json = JSON.parse(xhr.responseText); // Parse JSON
-                if(json.hasOwnProperty("updates")){ // Check that the key exists
-                    for (let i = 0; i < json.updates.length; i++) {
-                        let update = json.updates[i]; // Get update
-                        if (update.Rumor !== null) {
-                            // This is a rumor
-                            appendMessage("Global", update.Rumor.Name, update.Rumor.Msg)
-                        } else if (update.Peer !== null) {
-                            // This is a peer
-                            addPeer(update.Peer.IP + ":" + update.Peer.Port)
-                        } else if (update.PrivateMessage !== null) {
-                            // This is a private message
-                            if (update.PrivateMessage.Origin === document.getElementById("my_name").innerHTML) {
-                                appendMessage(update.PrivateMessage.Destination, update.PrivateMessage.Origin, update.PrivateMessage.Msg)                                
-                            } else {
-                                appendMessage(update.PrivateMessage.Origin, update.PrivateMessage.Origin, update.PrivateMessage.Msg)
-                            }
-                        } else if (update.PrivateContact !== null) {
-                            // This is a private contact
-                            addContact(update.PrivateContact.Name)
-                        } else if (update.IndexedFile !== null) {
-                            // This is a new indexed file
-                            addIndexedFile(update.IndexedFile.Filename, update.IndexedFile.Metahash)
-                            removeFile(update.IndexedFile.Metahash, "reconstructing_files")
-                            removeFile(update.IndexedFile.Metahash, "available_files")
-                        } else if (update.ConstructingFile !== null) {
-                            // This is a new file in construction
-                            addConstructingFile(update.ConstructingFile.Filename, update.ConstructingFile.Metahash, update.ConstructingFile.Origin)
-                        } else if (update.AvailableFile !== null) {
-                            // This is a new availble file
-                            addAvailableFile(update.AvailableFile.Filename, update.AvailableFile.Metahash)
-                        } else if (update.Artist !== null) {
-                            addArtist(update.Artist.Info.Name, update.Artist.Info.Signature)
-                        } else if (update.AvailableArtwork !== null) {
-                            downloadArtwork(update.AvailableArtwork.ArtistInfo.Name,
-                                update.AvailableArtwork.ArtworkInfo.Metahash,
-                                update.AvailableArtwork.ArtworkInfo.Name,
-                                update.AvailableArtwork.ArtworkInfo.Description,
-                                update.AvailableArtwork.ArtworkInfo.Filename)
-                        }
-                    }
-                }            
+                if (json.reset) {
+                    location.reload()
+                    return
+                }
+                for (let i = 0; i < json.updates.length; i++) {
+                    handleUpdate(json.updates[i])
+                }
             }
         }
     };
@@ -26,10 +26,19 @@ function switchContact() {
     if (!this.id.startsWith("artist_")) {
         changeMessageBoxText(this.innerHTML)
     } else {
+        document.getElementById("channel_wrap").style.display = "none";
         document.getElementById("send_message_wrap").style.display = "none";
         document.getElementById("request_file_wrap").style.display = "none";
     }
 
+    // Joined channels (except the global one) can be left and shared
+    if (this.id.startsWith("group_") && this.id !== "group_Global") {
+        document.getElementById("request_file_wrap").style.display = "none";
+        document.getElementById("channel_wrap").style.display = "block";
+    } else {
+        document.getElementById("channel_wrap").style.display = "none";
+    }
+
     // Update current contact
     curr_contact = this
 }
@@ -52,6 +61,11 @@ function contactMouseLeave() {
 
 function addGroup(name) {
 
+    // The group may already exist (e.g. the channel was left and joined again)
+    if (document.getElementById("group_" + name) !== null) {
+        return;
+    }
+
     // Create new contact tab
     let newGroup = document.createElement("div");
     newGroup.className = "private_wrap";
@@ -70,8 +84,82 @@ function addGroup(name) {
     document.getElementById('chat_scrollable_wrap').appendChild(newChat);
 }
 
+function removeGroup(name) {
+
+    let group = document.getElementById("group_" + name);
+    if (group === null) {
+        return;
+    }
+
+    // Unselect the group if it was selected
+    if (curr_contact === group) {
+        document.getElementById("chat_group_" + name).style.display = "none";
+        document.getElementById("send_message_wrap").style.display = "none";
+        document.getElementById("channel_wrap").style.display = "none";
+        curr_contact = null;
+    }
+
+    // Remove the tab and the history
+    group.remove();
+    document.getElementById("chat_group_" + name).remove();
+}
+
+function joinChannel(e) {
+
+    let code = (e.keyCode ? e.keyCode : e.which);
+    if (code == 13) {
+        // Don't create a newline
+        e.preventDefault();
+
+        let name = document.getElementById("join_channel").value;
+        let encrypted = document.getElementById("join_encrypted").checked;
+        if (name !== "") {
+            postChannel({"action": "join", "channel": name, "encrypted": encrypted});
+        }
+
+        // Reset inputs
+        document.getElementById("join_channel").value = "";
+        document.getElementById("join_encrypted").checked = false;
+    }
+}
+
+function inviteToChannel(e) {
+
+    let code = (e.keyCode ? e.keyCode : e.which);
+    if (code == 13) {
+        // Don't create a newline
+        e.preventDefault();
+
+        let destination = document.getElementById("invite_peer").value;
+        if (destination !== "" && curr_contact !== null) {
+            postChannel({"action": "invite", "channel": curr_contact.innerHTML, "destination": destination});
+        }
+
+        // Reset textarea
+        document.getElementById("invite_peer").value = "";
+    }
+}
+
+function leaveChannel() {
+    if (curr_contact !== null && curr_contact.id.startsWith("group_")) {
+        postChannel({"action": "leave", "channel": curr_contact.innerHTML});
+    }
+}
+
+function postChannel(command) {
+    let xhr = new XMLHttpRequest();
+    xhr.open("POST", "/channel", true);
+    xhr.setRequestHeader("Content-Type", "application/json");
+    xhr.send(JSON.stringify(command));
+}
+
 function addContact(name) {
 
+    // The contact may already exist (e.g. its route expired and was learned again)
+    if (document.getElementById("private_" + name) !== null) {
+        return;
+    }
+
     // Create new contact tab
     let newContact = document.createElement("div");
     newContact.className = "private_wrap";
@@ -90,7 +178,7 @@ function addContact(name) {
     document.getElementById('chat_scrollable_wrap').appendChild(newChat);
 }
 
-function whoAmI() {
+function whoAmI(then) {
      
     // POST data
     let xhr = new XMLHttpRequest();
@@ -106,6 +194,9 @@ function whoAmI() {
                     document.getElementById("my_address").innerHTML = json.addr                
                 }
             }
+            if (then !== undefined) {
+                then()
+            }
         }
     };
     
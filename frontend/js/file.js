@@ -2,17 +2,24 @@ function indexNewFile() {
     document.getElementById('file-input').click();
 }
 
-function getFilename() {
-    // Get filename
-    let input = document.getElementById("file-input").value.replace(/\\/g, "/");
-    let filename = input.substring(input.lastIndexOf("/") + 1);
+function uploadSelectedFile() {
+    let input = document.getElementById("file-input");
+    if (input.files.length === 0) {
+        return
+    }
 
-    // Send file index request
+    // Upload the file, the node indexes it once it is in its shared folder
+    let data = new FormData();
+    data.append("file", input.files[0]);
     let xhr = new XMLHttpRequest();
-    xhr.open("POST", "/fileIndex", true);
-    xhr.setRequestHeader("Content-Type", "application/json");
-    let data = JSON.stringify({"filename": filename});
-    xhr.send(data); 
+    xhr.open("POST", "/upload", true);
+    xhr.onload = function() {
+        if (xhr.status !== 201) {
+            alert("Cannot share " + input.files[0].name + ": " + JSON.parse(xhr.responseText).error);
+        }
+        input.value = "";
+    };
+    xhr.send(data);
 }
 
 function remoteFileRequest() {
@@ -40,7 +47,7 @@ function addIndexedFile(filename, metahash) {
     // Create new indexed file
     let newFile = document.createElement("div");
     newFile.className = "file_wrap";
-    newFile.innerHTML = '<div class="filename">' + filename + '</div>\
+    newFile.innerHTML = '<div class="filename"><a href="/files/' + metahash + '" target="_blank">' + filename + '</a></div>\
                         <div class="metahash">' + metahash + '</div>'
 
     document.getElementById('indexed_files').appendChild(newFile);
@@ -52,7 +59,8 @@ function addConstructingFile(filename, metahash, origin) {
     // Create new indexed file
     let newFile = document.createElement("div");
     newFile.className = "file_wrap";
-    newFile.innerHTML = '<div class="filename">' + filename + ' <em>from ' + origin + '</em></div>\
+    let from = (origin !== "") ? ' <em>from ' + origin + '</em>' : ''
+    newFile.innerHTML = '<div class="filename">' + filename + from + '</div>\
                         <div class="metahash">' + metahash + '</div>'
 
     document.getElementById('reconstructing_files').appendChild(newFile);
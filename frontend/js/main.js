@@ -10,10 +10,11 @@ window.onload = function(){
     // Create the global channel
     addGroup("Global")
 
-    // Get my own name and IP:PORT address
-    whoAmI()
+    // Get my own name and IP:PORT address, then load the current state and follow the updates (the
+    // name is needed to sort the private messages)
+    whoAmI(hydrate)
 
-    // Initial call to refresh the page
-    refresh()  
+    // Initial call to refresh the routing table
+    refreshRoutes()
 
 };
\ No newline at end of file
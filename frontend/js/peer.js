@@ -30,8 +30,19 @@ function addPeer(address) {
 
     // Create new contact tab
     let new_peer = document.createElement("div");
+    new_peer.id = "peer_" + address;
     new_peer.className = "peer_wrap";
     new_peer.innerHTML = '<span>' + address + '</span>'
     document.getElementById('peers_scrollable_wrap').appendChild(new_peer);
 
+}
+
+function removePeer(address) {
+
+    // Remove the peer's tab if it exists
+    let peer = document.getElementById("peer_" + address);
+    if (peer !== null) {
+        peer.parentNode.removeChild(peer);
+    }
+
 }
\ No newline at end of file
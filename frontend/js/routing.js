@@ -0,0 +1,41 @@
+function getRoutes() {
+
+    let xhr = new XMLHttpRequest();
+    xhr.open("GET", "/routes", true);
+    xhr.setRequestHeader("Content-Type", "application/json");
+    xhr.onreadystatechange = function () {
+        if (xhr.readyState === 4 && xhr.status === 200) {
+            let json = JSON.parse(xhr.responseText); // Parse JSON
+            if (json.hasOwnProperty("routes")) { // Check that the key exists
+                displayRoutes(json.routes)
+            }
+        }
+    };
+
+    xhr.send();
+}
+
+function displayRoutes(routes) {
+
+    // Rebuild the whole table
+    let table = document.getElementById("routes_scrollable_wrap");
+    table.innerHTML = "";
+
+    for (let i = 0; i < routes.length; i++) {
+        let route = routes[i];
+        let hops = (route.hopCount < 0) ? "?" : route.hopCount;
+
+        let entry = document.createElement("div");
+        entry.className = "route_wrap";
+        entry.title = "seq " + route.sequenceID + ", refreshed " + route.ageSec + "s ago";
+        entry.innerHTML = '<span class="route_dest">' + route.destination + '</span>' +
+            '<span> via ' + route.nextHop + ' (' + hops + ')</span>';
+        table.appendChild(entry);
+    }
+
+}
+
+function refreshRoutes() {
+    getRoutes()
+    setTimeout(refreshRoutes, 2000);
+}
@@ -0,0 +1,106 @@
+package guard
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// BlacklistStrikes is the number of invalid packets after which a source is blacklisted
+	BlacklistStrikes = 10
+	// StrikeWindowSec is the duration over which invalid packets are counted
+	StrikeWindowSec = 60
+	// BlacklistDurationSec is the duration a source stays blacklisted
+	BlacklistDurationSec = 300
+	// BlacklistExpirySec is the interval between two removals of the sources that no longer need tracking
+	BlacklistExpirySec = 10
+)
+
+// Blacklist represents the sources ignored for sending too many invalid packets
+type Blacklist struct {
+	offenders map[string]*offender // Sources that sent invalid packets, indexed by <ip:port>
+	mux       sync.Mutex           // Mutex to manipulate the structure from different threads
+}
+
+// offender represents a source that sent invalid packets
+type offender struct {
+	strikes     int       // The number of invalid packets in the current window
+	windowStart time.Time // The start of the current window
+	until       time.Time // The end of the blacklisting (zero if not blacklisted)
+}
+
+// NewBlacklist creates a new instance of Blacklist
+func NewBlacklist() *Blacklist {
+	return &Blacklist{offenders: make(map[string]*offender)}
+}
+
+// Strike records an invalid packet from a source, and returns true if the source just got blacklisted
+func (blacklist *Blacklist) Strike(source string) bool {
+	blacklist.mux.Lock()
+	defer blacklist.mux.Unlock()
+
+	now := time.Now()
+	off, ok := blacklist.offenders[source]
+	if !ok || now.Sub(off.windowStart) > StrikeWindowSec*time.Second {
+		if ok && now.Before(off.until) { // Still blacklisted
+			return false
+		}
+		off = &offender{windowStart: now}
+		blacklist.offenders[source] = off
+	}
+
+	off.strikes++
+	if off.strikes == BlacklistStrikes {
+		off.until = now.Add(BlacklistDurationSec * time.Second)
+		return true
+	}
+	return false
+}
+
+// IsBlacklisted checks whether a source is currently blacklisted
+func (blacklist *Blacklist) IsBlacklisted(source string) bool {
+	blacklist.mux.Lock()
+	defer blacklist.mux.Unlock()
+
+	off, ok := blacklist.offenders[source]
+	if !ok {
+		return false
+	}
+	if !off.until.IsZero() && time.Now().After(off.until) { // The sentence is over
+		delete(blacklist.offenders, source)
+		return false
+	}
+	return !off.until.IsZero()
+}
+
+// GetBlacklisted returns the sources currently blacklisted
+func (blacklist *Blacklist) GetBlacklisted() []string {
+	blacklist.mux.Lock()
+	defer blacklist.mux.Unlock()
+
+	now := time.Now()
+	sources := make([]string, 0)
+	for source, off := range blacklist.offenders {
+		if now.Before(off.until) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// Expire forgets the sources whose blacklisting is over and those whose window ended without them being
+// blacklisted, so that spoofed sources don't accumulate. Returns the number of sources forgotten.
+func (blacklist *Blacklist) Expire(now time.Time) int {
+	blacklist.mux.Lock()
+	defer blacklist.mux.Unlock()
+
+	forgotten := 0
+	for source, off := range blacklist.offenders {
+		if (off.until.IsZero() && now.Sub(off.windowStart) > StrikeWindowSec*time.Second) ||
+			(!off.until.IsZero() && now.After(off.until)) {
+			delete(blacklist.offenders, source)
+			forgotten++
+		}
+	}
+	return forgotten
+}
@@ -0,0 +1,36 @@
+package guard
+
+import (
+	"sync"
+)
+
+// DropCounters represents the number of packets dropped for each reason
+type DropCounters struct {
+	counts map[string]uint64 // Number of dropped packets, indexed by reason
+	mux    sync.Mutex        // Mutex to manipulate the structure from different threads
+}
+
+// NewDropCounters creates a new instance of DropCounters
+func NewDropCounters() *DropCounters {
+	return &DropCounters{counts: make(map[string]uint64)}
+}
+
+// Increment records a dropped packet
+func (drops *DropCounters) Increment(reason string) {
+	drops.mux.Lock()
+	defer drops.mux.Unlock()
+
+	drops.counts[reason]++
+}
+
+// Snapshot returns a copy of the counters
+func (drops *DropCounters) Snapshot() map[string]uint64 {
+	drops.mux.Lock()
+	defer drops.mux.Unlock()
+
+	snapshot := make(map[string]uint64, len(drops.counts))
+	for reason, count := range drops.counts {
+		snapshot[reason] = count
+	}
+	return snapshot
+}
@@ -0,0 +1,117 @@
+package guard
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSourceRate is the number of packets per second accepted from a single source
+	DefaultSourceRate = 200
+	// DefaultSourceBurst is the number of packets a single source can send in a burst
+	DefaultSourceBurst = 400
+	// MaxTrackedSources is the number of sources above which idle sources are forgotten
+	MaxTrackedSources = 4096
+	// SourceIdleSec is the inactivity duration after which a source can be forgotten
+	SourceIdleSec = 60
+)
+
+// Quota represents the rate and burst of a token bucket
+type Quota struct {
+	Rate  float64 // Packets per second
+	Burst float64 // Packets in a burst
+}
+
+// DefaultTypeQuotas are the per-source quotas for each type of packet (see GossipPacket.PacketType)
+var DefaultTypeQuotas = map[string]Quota{
+	"simple":        {Rate: 50, Burst: 100},
+	"rumor":         {Rate: 50, Burst: 100},
+	"status":        {Rate: 50, Burst: 100},
+	"private":       {Rate: 50, Burst: 100},
+	"datarequest":   {Rate: 100, Burst: 200},
+	"datareply":     {Rate: 100, Burst: 200},
+	"searchrequest": {Rate: 10, Burst: 20},
+	"searchreply":   {Rate: 20, Burst: 40},
+	"tx":            {Rate: 20, Burst: 40},
+	"block":         {Rate: 20, Burst: 40},
+	"blockrequest":  {Rate: 10, Burst: 20},
+	"blockreply":    {Rate: 10, Burst: 20},
+	"art":           {Rate: 20, Burst: 40},
+	"dht":           {Rate: 50, Burst: 100},
+	"punch":         {Rate: 10, Burst: 20},
+	"batch":         {Rate: 10, Burst: 20},
+}
+
+// RateLimiter represents per-source token buckets, with an overall limit and a quota per type of packet
+type RateLimiter struct {
+	sources    map[string]*sourceLimits // Limits of each source <ip:port>
+	sourceRate Quota                    // Overall limit of a source
+	typeQuotas map[string]Quota         // Limit of a source for each type of packet
+	mux        sync.Mutex               // Mutex to manipulate the structure from different threads
+}
+
+// sourceLimits represents the token buckets of a single source
+type sourceLimits struct {
+	overall  *TokenBucket            // Overall limit
+	types    map[string]*TokenBucket // Limit for each type of packet
+	lastSeen time.Time               // The last time a packet was received from the source
+}
+
+// NewRateLimiter creates a new instance of RateLimiter (types without quota are only subject to the
+// overall limit)
+func NewRateLimiter(sourceRate Quota, typeQuotas map[string]Quota) *RateLimiter {
+	return &RateLimiter{
+		sources:    make(map[string]*sourceLimits),
+		sourceRate: sourceRate,
+		typeQuotas: typeQuotas,
+	}
+}
+
+// Allow checks whether a packet of a given type from a given source is within the limits. If not,
+// the function also returns the reason ("rate" or "quota:<type>").
+func (limiter *RateLimiter) Allow(source, packetType string) (bool, string) {
+	limiter.mux.Lock()
+	defer limiter.mux.Unlock()
+
+	now := time.Now()
+	limits, ok := limiter.sources[source]
+	if !ok {
+		limiter.forgetIdleUnsafe(now)
+		limits = &sourceLimits{
+			overall: NewTokenBucket(limiter.sourceRate.Rate, limiter.sourceRate.Burst),
+			types:   make(map[string]*TokenBucket),
+		}
+		limiter.sources[source] = limits
+	}
+	limits.lastSeen = now
+
+	if !limits.overall.Allow(now) {
+		return false, "rate"
+	}
+
+	quota, ok := limiter.typeQuotas[packetType]
+	if !ok {
+		return true, ""
+	}
+	bucket, ok := limits.types[packetType]
+	if !ok {
+		bucket = NewTokenBucket(quota.Rate, quota.Burst)
+		limits.types[packetType] = bucket
+	}
+	if !bucket.Allow(now) {
+		return false, "quota:" + packetType
+	}
+	return true, ""
+}
+
+// forgetIdleUnsafe bounds the memory used by the limiter by forgetting idle sources
+func (limiter *RateLimiter) forgetIdleUnsafe(now time.Time) {
+	if len(limiter.sources) < MaxTrackedSources {
+		return
+	}
+	for source, limits := range limiter.sources {
+		if now.Sub(limits.lastSeen) > SourceIdleSec*time.Second {
+			delete(limiter.sources, source)
+		}
+	}
+}
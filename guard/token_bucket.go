@@ -0,0 +1,36 @@
+package guard
+
+import (
+	"time"
+)
+
+// TokenBucket represents a token bucket: tokens are refilled at a constant rate up to a maximum (burst),
+// and each allowed event consumes one token (not thread-safe)
+type TokenBucket struct {
+	rate   float64   // Tokens refilled per second
+	burst  float64   // Maximum number of tokens
+	tokens float64   // Tokens currently available
+	last   time.Time // The last time the bucket was refilled
+}
+
+// NewTokenBucket creates a new (full) instance of TokenBucket
+func NewTokenBucket(rate, burst float64) *TokenBucket {
+	return &TokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Allow refills the bucket and consumes a token if one is available
+func (bucket *TokenBucket) Allow(now time.Time) bool {
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens += elapsed * bucket.rate
+		if bucket.tokens > bucket.burst {
+			bucket.tokens = bucket.burst
+		}
+		bucket.last = now
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
@@ -0,0 +1,40 @@
+package guard
+
+const (
+	// DefaultWorkers is the number of goroutines handling incoming packets
+	DefaultWorkers = 128
+	// DefaultQueueSize is the number of packets waiting for a worker above which packets are dropped
+	DefaultQueueSize = 1024
+)
+
+// WorkerPool represents a bounded set of goroutines executing tasks from a bounded queue. The tasks must be
+// short (decode and route): waits for acknowledgements or retransmissions belong to their own timers.
+type WorkerPool struct {
+	tasks chan func() // Tasks waiting for a worker
+}
+
+// NewWorkerPool creates a new instance of WorkerPool and starts its workers
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	pool := &WorkerPool{tasks: make(chan func(), queueSize)}
+	for i := 0; i < workers; i++ {
+		go pool.workerRoutine()
+	}
+	return pool
+}
+
+// Submit queues a task, and returns false if the queue is full (the task is dropped)
+func (pool *WorkerPool) Submit(task func()) bool {
+	select {
+	case pool.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// workerRoutine executes tasks forever
+func (pool *WorkerPool) workerRoutine() {
+	for task := range pool.tasks {
+		task()
+	}
+}
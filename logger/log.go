@@ -2,53 +2,254 @@ package logger
 
 import (
 	"fmt"
-	"log"
 	"os"
-	"sync"
+	"sort"
+	"strings"
+	"time"
 )
 
-type _logger struct {
-	isEnabled bool
-	isSetup   bool
-	sync.RWMutex
+// Level - Importance of a log record
+type Level int
+
+// Levels of the records, from the most to the least important
+const (
+	LevelError Level = iota // Failures
+	LevelInfo               // Notable events (e.g. a peer evicted, a route removed)
+	LevelDebug              // Details of the protocols
+	LevelTrace              // Every step
+)
+
+// levelNames - Names of the levels, as written in the records and in the options
+var levelNames = []string{"error", "info", "debug", "trace"}
+
+// String - Returns the name of a level
+func (level Level) String() string {
+	if level < LevelError || level > LevelTrace {
+		return fmt.Sprintf("level%d", int(level))
+	}
+	return levelNames[level]
+}
+
+// ParseLevel - Parses the name of a level
+func ParseLevel(name string) (Level, error) {
+	for i, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(i), nil
+		}
+	}
+	return LevelError, fmt.Errorf("unknown log level %q (error, info, debug or trace)", name)
+}
+
+// Tags of the subsystems, whose levels can be set separately
+const (
+	TagGossip    = "gossip"    // Rumors, status, private messages and channels
+	TagRouting   = "routing"   // Neighbors and routes (DSDV)
+	TagFiles     = "files"     // Indexing and downloads
+	TagSearch    = "search"    // File searches and the DHT
+	TagChain     = "chain"     // Blockchains
+	TagArt       = "art"       // Artists and artworks
+	TagTransport = "transport" // Links with the neighbors
+	TagWeb       = "web"       // Webserver and API
+)
+
+// Tags - All the tags
+var Tags = []string{TagGossip, TagRouting, TagFiles, TagSearch, TagChain, TagArt, TagTransport, TagWeb}
+
+// The loggers of the subsystems
+var (
+	Gossip    = Logger{TagGossip}
+	Routing   = Logger{TagRouting}
+	Files     = Logger{TagFiles}
+	Search    = Logger{TagSearch}
+	Chain     = Logger{TagChain}
+	Art       = Logger{TagArt}
+	Transport = Logger{TagTransport}
+	Web       = Logger{TagWeb}
+)
+
+// Logger - Writes the records of a subsystem
+type Logger struct {
+	tag string // Tag of the subsystem
+}
+
+// Protocol - Writes a mandatory protocol line (e.g. "DSDV", "FOUND match", "CHAIN"). Protocol lines are
+// printed as they are on the standard output whatever the levels, and also recorded in the log file if any.
+func (l Logger) Protocol(format string, a ...interface{}) {
+	l.write(levelProtocol, "", fmt.Sprintf(format, a...))
+}
+
+// Error - Writes a failure
+func (l Logger) Error(fun, format string, a ...interface{}) {
+	l.log(LevelError, fun, format, a...)
+}
+
+// Info - Writes a notable event
+func (l Logger) Info(fun, format string, a ...interface{}) {
+	l.log(LevelInfo, fun, format, a...)
+}
+
+// Debug - Writes a detail of a protocol
+func (l Logger) Debug(fun, format string, a ...interface{}) {
+	l.log(LevelDebug, fun, format, a...)
+}
+
+// Trace - Writes a step
+func (l Logger) Trace(fun, format string, a ...interface{}) {
+	l.log(LevelTrace, fun, format, a...)
 }
 
-var logger = _logger{
-	isEnabled: true,
-	isSetup:   false,
+// Enabled - Checks whether the records of a level are written for the subsystem
+func (l Logger) Enabled(level Level) bool {
+	config.mux.RLock()
+	defer config.mux.RUnlock()
+	return level <= config.levelUnsafe(l.tag)
 }
 
-func isEnabledAndSetup() bool {
-	logger.RLock()
-	if logger.isSetup {
-		logger.RUnlock()
-		return logger.isEnabled
+// log - Writes a record if its level is enabled
+func (l Logger) log(level Level, fun, format string, a ...interface{}) {
+	if l.Enabled(level) {
+		l.write(level, fun, fmt.Sprintf(format, a...))
 	}
-	logger.RUnlock()
+}
+
+// write - Sends a record to the outputs
+func (l Logger) write(level Level, fun, msg string) {
+	config.mux.Lock()
+	defer config.mux.Unlock()
+	config.writeUnsafe(&record{Time: time.Now(), Level: level, Tag: l.tag, Fun: fun, Msg: msg})
+}
+
+/* ================ CONFIGURATION ================ */
+
+// Config - How the records are written
+type Config struct {
+	Level    Level            // Level of the subsystems without their own
+	Tags     map[string]Level // Levels of some subsystems, by tag
+	Format   string           // FormatText or FormatJSON
+	File     string           // File receiving the records ("" for the standard output)
+	MaxSize  int64            // Size of the file after which it is rotated, in bytes
+	MaxFiles int              // Number of rotated files kept
+	Protocol bool             // Whether the protocol lines are printed on the standard output
+}
+
+// Default configuration
+const (
+	DefaultLevel    = LevelInfo
+	DefaultMaxSize  = 10 * 1024 * 1024
+	DefaultMaxFiles = 3
+)
+
+// config - The current configuration and outputs
+var config = outputs{
+	level:    DefaultLevel,
+	tags:     make(map[string]Level),
+	format:   FormatText,
+	protocol: true,
+	stdout:   os.Stdout,
+}
+
+// Configure - Replaces the configuration, opening the log file if any
+func Configure(c Config) error {
+	if c.Format != FormatText && c.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q (text or json)", c.Format)
+	}
+	for tag := range c.Tags {
+		if !IsTag(tag) {
+			return fmt.Errorf("unknown log tag %q (%s)", tag, strings.Join(Tags, ", "))
+		}
+	}
+	var file *rotatingFile
+	if c.File != "" {
+		var err error
+		if file, err = openRotatingFile(c.File, c.MaxSize, c.MaxFiles); err != nil {
+			return err
+		}
+	}
+
+	config.mux.Lock()
+	defer config.mux.Unlock()
+	if config.file != nil {
+		config.file.Close()
+	}
+	config.level, config.format, config.protocol, config.file = c.Level, c.Format, c.Protocol, file
+	config.tags = make(map[string]Level)
+	for tag, level := range c.Tags {
+		config.tags[tag] = level
+	}
+	return nil
+}
 
-	logger.Lock()
-	defer logger.Unlock()
+// SetLevel - Changes the level of a subsystem, or the default level if the tag is empty
+func SetLevel(tag string, level Level) error {
+	if tag != "" && !IsTag(tag) {
+		return fmt.Errorf("unknown log tag %q (%s)", tag, strings.Join(Tags, ", "))
+	}
+	config.mux.Lock()
+	defer config.mux.Unlock()
+	if tag == "" {
+		config.level = level
+	} else {
+		config.tags[tag] = level
+	}
+	return nil
+}
 
-	if logger.isSetup {
-		return logger.isEnabled
+// GetLevels - Returns the default level and the level of every subsystem
+func GetLevels() (Level, map[string]Level) {
+	config.mux.RLock()
+	defer config.mux.RUnlock()
+	levels := make(map[string]Level)
+	for _, tag := range Tags {
+		levels[tag] = config.levelUnsafe(tag)
 	}
+	return config.level, levels
+}
 
-	log.SetFlags(0)
-	log.SetPrefix("")
-	log.SetOutput(os.Stdout)
-	logger.isSetup = true
-	return logger.isEnabled
+// ParseLevels - Parses a list of levels such as "info,files=debug,chain=trace": the default level, then the
+// levels of some subsystems
+func ParseLevels(spec string) (Level, map[string]Level, error) {
+	level, tags := DefaultLevel, make(map[string]Level)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		tag, name := "", item
+		if i := strings.Index(item, "="); i >= 0 {
+			tag, name = item[:i], item[i+1:]
+			if !IsTag(tag) {
+				return level, nil, fmt.Errorf("unknown log tag %q (%s)", tag, strings.Join(Tags, ", "))
+			}
+		}
+		parsed, err := ParseLevel(name)
+		if err != nil {
+			return level, nil, err
+		}
+		if tag == "" {
+			level = parsed
+		} else {
+			tags[tag] = parsed
+		}
+	}
+	return level, tags, nil
 }
 
-func Set(enabled bool) {
-	logger.Lock()
-	defer logger.Unlock()
-	logger.isEnabled = enabled
+// FormatLevels - Writes levels in the form read by ParseLevels
+func FormatLevels(level Level, tags map[string]Level) string {
+	items := []string{level.String()}
+	for tag, tagLevel := range tags {
+		items = append(items, tag+"="+tagLevel.String())
+	}
+	sort.Strings(items[1:])
+	return strings.Join(items, ",")
 }
 
-func Printlnf(s string, v ...interface{}) {
-	if isEnabledAndSetup() {
-		text := fmt.Sprintf(s, v...)
-		log.Printf("%s\n", text)
+// IsTag - Checks whether a tag is known
+func IsTag(tag string) bool {
+	for _, known := range Tags {
+		if tag == known {
+			return true
+		}
 	}
+	return false
 }
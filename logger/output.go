@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Formats of the records
+const (
+	FormatText = "text" // One line per record: time, level, tag, function and message
+	FormatJSON = "json" // One JSON object per line
+)
+
+// levelProtocol - Level of the protocol lines in the records (they are always written)
+const levelProtocol Level = -1
+
+// record - A log record
+type record struct {
+	Time  time.Time // When it was written
+	Level Level     // Its importance
+	Tag   string    // The subsystem that wrote it
+	Fun   string    // The function that wrote it ("" for protocol lines)
+	Msg   string    // The message
+}
+
+// jsonRecord - A record in the JSON format
+type jsonRecord struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Tag   string `json:"tag"`
+	Fun   string `json:"func,omitempty"`
+	Msg   string `json:"msg"`
+}
+
+// outputs - Where and how the records are written
+type outputs struct {
+	level    Level            // Level of the subsystems without their own
+	tags     map[string]Level // Levels of some subsystems
+	format   string           // FormatText or FormatJSON
+	protocol bool             // Whether the protocol lines are printed on the standard output
+	stdout   io.Writer        // The standard output
+	file     *rotatingFile    // The log file (nil for the standard output)
+	mux      sync.RWMutex     // Mutex to manipulate the structure from different threads
+}
+
+// levelUnsafe - Returns the level of a subsystem (the mutex must be held)
+func (o *outputs) levelUnsafe(tag string) Level {
+	if level, ok := o.tags[tag]; ok {
+		return level
+	}
+	return o.level
+}
+
+// writeUnsafe - Writes a record (the mutex must be held). Protocol lines are printed as they are on the
+// standard output (the compatibility sink), the other records are formatted for the log file, or for the
+// standard output without one.
+func (o *outputs) writeUnsafe(r *record) {
+	if r.Level == levelProtocol {
+		if o.protocol {
+			fmt.Fprintln(o.stdout, r.Msg)
+		}
+		if o.file == nil {
+			return
+		}
+	}
+
+	out := o.stdout
+	if o.file != nil {
+		out = o.file
+	}
+	out.Write(o.formatUnsafe(r))
+}
+
+// formatUnsafe - Formats a record (the mutex must be held)
+func (o *outputs) formatUnsafe(r *record) []byte {
+	level := r.Level.String()
+	if r.Level == levelProtocol {
+		level = "protocol"
+	}
+	if o.format == FormatJSON {
+		data, err := json.Marshal(jsonRecord{r.Time.Format(time.RFC3339Nano), level, r.Tag, r.Fun, r.Msg})
+		if err == nil {
+			return append(data, '\n')
+		}
+	}
+	if r.Fun == "" {
+		return []byte(fmt.Sprintf("%s %-8s [%s] %s\n", r.Time.Format("15:04:05.000"), level, r.Tag, r.Msg))
+	}
+	return []byte(fmt.Sprintf("%s %-8s [%s] %s() : %s\n", r.Time.Format("15:04:05.000"), level, r.Tag, r.Fun, r.Msg))
+}
+
+/* ================ ROTATION ================ */
+
+// rotatingFile - A log file that is renamed when it grows too big (file.1, file.2... the oldest being dropped)
+type rotatingFile struct {
+	path     string   // Path of the current file
+	maxSize  int64    // Size after which the file is rotated, in bytes
+	maxFiles int      // Number of rotated files kept
+	file     *os.File // The current file
+	size     int64    // Size of the current file
+}
+
+// openRotatingFile - Opens a log file, appending to it if it exists
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxFiles < 0 {
+		maxFiles = 0
+	}
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open - Opens the current file
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file, rf.size = file, info.Size()
+	return nil
+}
+
+// Write - Writes to the current file, rotating it first if it would grow too big
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate - Renames the current file to file.1 (and file.1 to file.2...) and starts a new one
+func (rf *rotatingFile) rotate() error {
+	rf.file.Close()
+	if rf.maxFiles == 0 {
+		os.Remove(rf.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxFiles))
+		for i := rf.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		os.Rename(rf.path, rf.path+".1")
+	}
+	return rf.open()
+}
+
+// Close - Closes the current file
+func (rf *rotatingFile) Close() error {
+	return rf.file.Close()
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"Peerster/backend"
-	"Peerster/blockchain"
 	"Peerster/crypto_rsa"
 	"Peerster/entities"
 	"Peerster/fail"
+	"Peerster/files"
+	"Peerster/guard"
+	"Peerster/logger"
 	"Peerster/messages"
 	"Peerster/network"
 	"Peerster/parsing"
+	"Peerster/peers"
+	"Peerster/transport"
 	"fmt"
 	"net"
 	"os"
@@ -19,7 +23,7 @@ import (
 	"github.com/dedis/protobuf"
 )
 
-// BufSize - Size of the UDP buffer
+// BufSize - Size of the UDP buffer for the client channel
 const BufSize = 16384
 
 func threadIDGenerator(chanID chan uint32) {
@@ -89,13 +93,45 @@ func isPacketValid(pkt *messages.GossipPacket, isClientSide bool, isSimpleMode b
 	if pkt.ArtTx != nil {
 		counter++
 	}
+	if pkt.DHT != nil {
+		counter++
+	}
+	if pkt.Punch != nil {
+		counter++
+	}
+	if pkt.Batch != nil {
+		counter++
+	}
+	if pkt.Channel != nil {
+		counter++
+	}
+	if pkt.Subscribe != nil {
+		counter++
+	}
+	if pkt.Request != nil {
+		counter++
+	}
+	if pkt.Reply != nil {
+		counter++
+	}
 	if counter != 1 {
 		return false
 	}
 
+	// A request wraps one of the other packets of the client
+	if pkt.Request != nil {
+		inner := pkt.Request.Packet
+		return isClientSide && inner != nil && inner.Request == nil && isPacketValid(inner, true, isSimpleMode)
+	}
+
 	// The client only sends certain packets
 	if isClientSide && (pkt.SimpleMsg == nil && pkt.Private == nil &&
-		pkt.DataRequest == nil && pkt.SearchRequest == nil && pkt.ArtTx == nil) {
+		pkt.DataRequest == nil && pkt.SearchRequest == nil && pkt.ArtTx == nil && pkt.Channel == nil &&
+		pkt.Subscribe == nil) {
+		return false
+	}
+	// ... some of which are never sent by peers
+	if !isClientSide && (pkt.Channel != nil || pkt.Subscribe != nil || pkt.Reply != nil) {
 		return false
 	}
 	// In simple mode only accept simple messages
@@ -108,17 +144,85 @@ func isPacketValid(pkt *messages.GossipPacket, isClientSide bool, isSimpleMode b
 
 func antiEntropy(g *entities.Gossiper) {
 
+	// Create a timeout timer
+	timer := time.NewTicker(time.Duration(g.Args.AntiEntropy) * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			// Pick a random target and send the digest of our vector clock
+			if target := g.PeerIndex.GetRandomPeer(nil); target != nil {
+				network.OnSendDigest(g, target)
+			}
+		}
+	}
+}
+
+func retentionRoutine(g *entities.Gossiper) {
+
+	// Create a timeout timer
+	timer := time.NewTicker(peers.RetentionCheckSec * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if dropped := g.NameIndex.ApplyRetention(); dropped > 0 {
+				logger.Gossip.Info("retentionRoutine", "DROPPED %d old messages", dropped)
+			}
+		}
+	}
+}
+
+func sharedFolderRoutine(g *entities.Gossiper) {
+
+	// Index the files already in the folder, then follow its changes
+	watcher := files.NewFolderWatcher(files.SharedFilesDir)
+	timer := time.NewTicker(time.Duration(g.Args.WatchInterval) * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if events := watcher.Scan(); len(events) > 0 {
+				network.OnSharedFolderEvents(g, events)
+			}
+		}
+	}
+}
+
+func membershipRoutine(g *entities.Gossiper) {
+
 	// Create a timeout timer
 	timer := time.NewTicker(time.Second)
 	defer timer.Stop()
 	for {
 		select {
 		case <-timer.C:
-			// Pick a random target and send a StatusPacket
-			target := g.PeerIndex.GetRandomPeer(nil)
-			vectorClock := g.NameIndex.GetVectorClock()
-			if target != nil {
-				network.OnSendStatus(vectorClock, g.GossipChannel, target)
+			// Increment our heartbeat
+			g.PeerIndex.IncrementHeartbeat()
+
+			suspects, evicted := g.PeerIndex.CheckLiveness()
+
+			// Give suspected peers a chance to prove they are alive
+			for _, target := range suspects {
+				logger.Routing.Info("membershipRoutine", "SUSPECT %s", peers.UDPAddressToString(target))
+				network.OnProbePeer(g, target)
+			}
+			for _, addr := range evicted {
+				logger.Routing.Info("membershipRoutine", "EVICTED %s", addr)
+
+				// Forget its keys and features, they change when it restarts
+				g.SecureLinks.Forget(addr)
+				g.Capabilities.Forget(addr)
+
+				// Routes through a dead neighbor are broken
+				for _, name := range g.Router.RemoveRoutesVia(addr) {
+					logger.Routing.Info("membershipRoutine", "ROUTE REMOVED %s via %s", name, addr)
+				}
+			}
+
+			// Forget the routes that weren't refreshed for too long
+			for _, name := range g.Router.ExpireRoutes() {
+				logger.Routing.Info("membershipRoutine", "ROUTE EXPIRED %s", name)
 			}
 		}
 	}
@@ -140,32 +244,99 @@ func rumorEntropy(g *entities.Gossiper, chanID chan uint32) {
 
 }
 
-func udpDispatcherGossip(g *entities.Gossiper, chanID chan uint32) {
+func dhtRoutine(g *entities.Gossiper) {
+
+	// Give the other routines some time to start, then join the DHT
+	time.Sleep(1000 * time.Millisecond)
+	network.OnBootstrapDHT(g)
+
+	// Create a republish timer
+	timer := time.NewTicker(network.DHTRepublishIntervalSec * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			network.OnRepublishDHT(g)
+		}
+	}
+}
+
+func blacklistRoutine(g *entities.Gossiper) {
 
+	// Create a timeout timer
+	timer := time.NewTicker(guard.BlacklistExpirySec * time.Second)
+	defer timer.Stop()
 	for {
+		select {
+		case <-timer.C:
+			if forgotten := g.Blacklist.Expire(time.Now()); forgotten > 0 {
+				logger.Transport.Debug("blacklistRoutine", "FORGOT %d offending sources", forgotten)
+			}
+		}
+	}
+}
 
-		// Create a buffer to store arriving data
-		buf := make([]byte, BufSize)
+// dropInvalidPacket - Counts an invalid packet and blacklists its source if it sends too many of them
+func dropInvalidPacket(g *entities.Gossiper, source string) {
+	g.Drops.Increment("invalid")
+	if g.Blacklist.Strike(source) {
+		logger.Transport.Info("dropInvalidPacket", "BLACKLISTED %s", source)
+	}
+}
 
-		var sender *net.UDPAddr
-		var n int
-		var err error
+// dispatch - Hands a packet's callback to the worker pool, dropping the packet if the pool is overloaded
+func dispatch(g *entities.Gossiper, callback func()) {
+	if !g.Workers.Submit(callback) {
+		g.Drops.Increment("overload")
+	}
+}
+
+func udpDispatcherGossip(g *entities.Gossiper, chanID chan uint32) {
 
-		if n, sender, err = g.GossipChannel.ReadFromUDP(buf); err != nil {
+	for {
+
+		// Wait for a complete message (datagram or stream)
+		buf, sender, err := g.GossipChannel.Receive()
+		if err != nil {
+			if transport.IsClosed(err) {
+				return
+			}
 			// Error: ignore the packet
 			continue
 		}
 
+		source := peers.UDPAddressToString(sender)
+
+		// Ignore abusive peers
+		if g.Blacklist.IsBlacklisted(source) {
+			g.Drops.Increment("blacklisted")
+			continue
+		}
+
 		// Decode the packet
 		var pkt messages.GossipPacket
-		if err := protobuf.Decode(buf[:n], &pkt); err != nil {
+		if err := protobuf.Decode(buf, &pkt); err != nil {
 			// Error: ignore the packet
+			dropInvalidPacket(g, source)
+			continue
+		}
+
+		// Packets only made of fields we don't know come from newer nodes: they aren't an abuse
+		if pkt.PacketType() == "unknown" {
+			g.Drops.Increment("unsupported")
 			continue
 		}
 
 		// Check the packet's validity
 		if !isPacketValid(&pkt, false, g.Args.SimpleMode) {
 			// Error: ignore the packet
+			dropInvalidPacket(g, source)
+			continue
+		}
+
+		// Enforce the per-source and per-type limits
+		if ok, reason := g.Limiter.Allow(source, pkt.PacketType()); !ok {
+			g.Drops.Increment(reason)
 			continue
 		}
 
@@ -178,36 +349,58 @@ func udpDispatcherGossip(g *entities.Gossiper, chanID chan uint32) {
 			// Make sure the client isn't talking on the network port
 			if pkt.SimpleMsg.RelayPeerAddr == "" {
 				// Error: ignore the packet
+				dropInvalidPacket(g, source)
 				continue
 			}
 			network.OnBroadcastNetwork(g, pkt.SimpleMsg)
 		case pkt.Rumor != nil:
-			go network.OnReceiveRumor(g, pkt.Rumor, sender, <-chanID)
+			threadID := <-chanID
+			dispatch(g, func() { network.OnReceiveRumor(g, pkt.Rumor, sender, threadID) })
 		case pkt.Status != nil:
-			isPacketHandled := g.Timeouts.SearchAndForward(sender, pkt.Status)
+			// Take the piggybacked membership information into account
+			for _, addr := range g.PeerIndex.HandleMembership(sender, pkt.Status, g.Args.GossipAddr) {
+				logger.Routing.Info("udpDispatcherGossip", "LEARNED PEER %s", addr)
+			}
+			// Learn which features our neighbor supports
+			if features := g.Capabilities.Record(sender, pkt.Status.Version, pkt.Status.Capabilities); features != nil {
+				logger.Routing.Info("udpDispatcherGossip", "%s", features.FeaturesToString())
+			}
+			// Learn our public address as seen by our neighbor
+			if pkt.Status.Observed != "" {
+				g.DirectLinks.SetObservedSelf(source, pkt.Status.Observed)
+			}
+			// Digests aren't answers to rumors
+			isPacketHandled := !pkt.Status.IsDigestOnly() && g.Timeouts.SearchAndForward(sender, pkt.Status)
 			if !isPacketHandled {
-				go network.OnReceiveStatus(g, pkt.Status, sender, <-chanID)
+				threadID := <-chanID
+				dispatch(g, func() { network.OnReceiveStatus(g, pkt.Status, sender, threadID) })
 			}
 		case pkt.Private != nil:
-			go network.OnReceivePrivate(g, pkt.Private, sender)
+			dispatch(g, func() { network.OnReceivePrivate(g, pkt.Private, sender) })
 		case pkt.DataRequest != nil:
-			go network.OnReceiveDataRequest(g, pkt.DataRequest, sender)
+			dispatch(g, func() { network.OnReceiveDataRequest(g, pkt.DataRequest, sender) })
 		case pkt.DataReply != nil:
-			go network.OnReceiveDataReply(g, pkt.DataReply, sender)
+			dispatch(g, func() { network.OnReceiveDataReply(g, pkt.DataReply, sender) })
 		case pkt.SearchRequest != nil:
-			go network.OnReceiveSearchRequest(g, pkt.SearchRequest, sender)
+			dispatch(g, func() { network.OnReceiveSearchRequest(g, pkt.SearchRequest, sender) })
 		case pkt.SearchReply != nil:
-			go network.OnReceiveSearchReply(g, pkt.SearchReply, sender)
+			dispatch(g, func() { network.OnReceiveSearchReply(g, pkt.SearchReply, sender) })
 		case pkt.TxPublish != nil:
-			go network.OnReceiveTransaction(g, pkt.TxPublish, sender)
+			dispatch(g, func() { network.OnReceiveTransaction(g, pkt.TxPublish, sender) })
 		case pkt.BlockPublish != nil:
-			go network.OnReceiveBlock(g, pkt.BlockPublish, sender)
+			dispatch(g, func() { network.OnReceiveBlock(g, pkt.BlockPublish, sender) })
 		case pkt.BlockRequest != nil:
-			go network.OnReceiveBlockRequest(g, pkt.BlockRequest, sender)
+			dispatch(g, func() { network.OnReceiveBlockRequest(g, pkt.BlockRequest, sender) })
 		case pkt.BlockReply != nil:
-			go network.OnReceiveBlockReply(g, pkt.BlockReply, sender)
+			dispatch(g, func() { network.OnReceiveBlockReply(g, pkt.BlockReply, sender) })
 		case pkt.ArtTx != nil:
-			go network.OnReceiveArtTx(g, pkt.ArtTx, sender)
+			dispatch(g, func() { network.OnReceiveArtTx(g, pkt.ArtTx, sender) })
+		case pkt.DHT != nil:
+			dispatch(g, func() { network.OnReceiveDHTMessage(g, pkt.DHT, sender) })
+		case pkt.Punch != nil:
+			dispatch(g, func() { network.OnReceivePunch(g, pkt.Punch, sender) })
+		case pkt.Batch != nil:
+			dispatch(g, func() { network.OnReceiveRumorBatch(g, pkt.Batch, sender) })
 		default:
 			// Should never happen
 		}
@@ -222,9 +415,8 @@ func udpDispatcherClient(g *entities.Gossiper, chanID chan uint32) {
 		// Create a buffer to store arriving data
 		buf := make([]byte, BufSize)
 
-		var n int
-		var err error
-		if n, _, err = g.ClientChannel.ReadFromUDP(buf); err != nil {
+		n, sender, err := g.ClientChannel.ReadFromUDP(buf)
+		if err != nil {
 			// Error: ignore the packet
 			continue
 		}
@@ -243,13 +435,16 @@ func udpDispatcherClient(g *entities.Gossiper, chanID chan uint32) {
 		}
 
 		switch {
+		case pkt.Request != nil:
+			// The client waits for the outcome of the command
+			go network.OnReceiveClientRequest(g, pkt.Request, sender, <-chanID)
 		case pkt.SimpleMsg != nil:
 
 			if g.Args.SimpleMode { // Simple mode
 				go network.OnBroadcastClient(g, pkt.SimpleMsg)
 			} else {
 				// Promote SimpleMessage to RumorMessage
-				rumor := messages.RumorMessage{Text: pkt.SimpleMsg.Contents}
+				rumor := messages.RumorMessage{Text: pkt.SimpleMsg.Contents, Channel: pkt.SimpleMsg.Channel}
 				go network.OnReceiveClientRumor(g, &rumor, <-chanID)
 			}
 
@@ -258,11 +453,8 @@ func udpDispatcherClient(g *entities.Gossiper, chanID chan uint32) {
 		case pkt.DataRequest != nil:
 
 			if pkt.DataRequest.HopLimit == 0 {
-				// File index
-				if file := g.FileIndex.AddLocalFile(pkt.DataRequest.Origin); file != nil {
-					// Broadcast the transaction and publish to the blockchain
-					network.OnReceiveTransaction(g, blockchain.FileToNewTx(file, g.Keys).ToTxPublish(network.BlockHopLimit), nil)
-				}
+				// File index (claim and DHT advertisement)
+				network.OnIndexLocalFile(g, pkt.DataRequest.Origin, g.Args.BlockHopLimit)
 			} else {
 				// Remote file request
 				if pkt.DataRequest.Destination == "" {
@@ -278,6 +470,10 @@ func udpDispatcherClient(g *entities.Gossiper, chanID chan uint32) {
 			go network.OnInitiateFileSearch(g, pkt.SearchRequest.Budget, pkt.SearchRequest.Keywords)
 		case pkt.ArtTx != nil:
 			go network.OnPublishArtwork(g, pkt.ArtTx)
+		case pkt.Channel != nil:
+			go network.OnReceiveChannelCommand(g, pkt.Channel)
+		case pkt.Subscribe != nil:
+			go network.OnSubscribe(g, pkt.Subscribe.Signature)
 		default:
 			// Should never happen
 		}
@@ -291,10 +487,28 @@ func main() {
 	// Argument parsing
 	args, err := parsing.ParseArgumentsGossiper()
 	if err != nil {
+		if !parsing.IsHelp(err) {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	// Logs
+	if err := logger.Configure(args.Log); err != nil {
 		fmt.Println(err)
 		return
 	}
 
+	// Folders and size limit of the files
+	files.SharedFilesDir, files.DownloadedFilesDir = args.SharedDir, args.DownloadDir
+	files.MaxFileSize = args.MaxFileSize
+	for _, dir := range []string{args.SharedDir, args.DownloadDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.Files.Error("main", "Cannot create folder %s: %s", dir, err.Error())
+			return
+		}
+	}
+
 	// Create the gossiper
 	gossiper := entities.NewGossiper(args)
 
@@ -308,10 +522,23 @@ func main() {
 	if gossiper.ClientChannel, err = openUDPChannel(gossiper.Args.ClientAddr); err != nil {
 		return
 	}
-	if gossiper.GossipChannel, err = openUDPChannel(gossiper.Args.GossipAddr); err != nil {
+	inner, err := transport.NewHybridTransport(gossiper.Args.GossipAddr)
+	if err != nil {
 		return
 	}
 
+	// Authenticate and encrypt the links with our neighbors (except in simple mode)
+	defaultSecure := !gossiper.Args.Insecure && !gossiper.Args.SimpleMode
+	gossiper.SecureLinks = transport.NewSecureTransport(inner, gossiper.Keys, defaultSecure)
+
+	// Streams, fragments and the secure channel are only used with the neighbors advertising them
+	inner.SetSupports(gossiper.Capabilities.SupportsAddr)
+	gossiper.SecureLinks.SetSupports(gossiper.Capabilities.SupportsAddr)
+	for _, peer := range gossiper.Args.PlainPeers {
+		gossiper.SecureLinks.SetPeerMode(peer, false)
+	}
+	gossiper.GossipChannel = gossiper.SecureLinks
+
 	// Program a call to close the channels
 	defer gossiper.ClientChannel.Close()
 	defer gossiper.GossipChannel.Close()
@@ -323,9 +550,17 @@ func main() {
 	// Launch a thread for the gossiper dispatcher
 	go udpDispatcherGossip(gossiper, chanID)
 
+	// Forget the ended blacklistings and strikes
+	go blacklistRoutine(gossiper)
+
 	// Launch a thread for the client dispatcher
 	go udpDispatcherClient(gossiper, chanID)
 
+	// Watch the shared folder
+	if gossiper.Args.WatchInterval != 0 {
+		go sharedFolderRoutine(gossiper)
+	}
+
 	// Launch the webserver if the ports do not clash
 	if strings.Split(gossiper.Args.ClientAddr, ":")[1] != gossiper.Args.ServerPort {
 		go backend.Webserver(gossiper, chanID)
@@ -333,12 +568,25 @@ func main() {
 
 	if !gossiper.Args.SimpleMode {
 		// Anti Entropy
-		go antiEntropy(gossiper)
+		if gossiper.Args.AntiEntropy != 0 {
+			go antiEntropy(gossiper)
+		}
+
+		// Age limit of the stored messages
+		if gossiper.Args.RumorAge != 0 {
+			go retentionRoutine(gossiper)
+		}
+
+		// Liveness detection
+		go membershipRoutine(gossiper)
 
 		// RouteRumor
 		if gossiper.Args.RTimer != 0 {
 			go rumorEntropy(gossiper, chanID)
 		}
+
+		// DHT bootstrap and provider records republication
+		go dhtRoutine(gossiper)
 	}
 
 	// Initiate block lookup: create a block request and broadcast it
@@ -0,0 +1,31 @@
+package messages
+
+import "fmt"
+
+// Channel operations requested by the client
+const (
+	ChannelJoin   = 1 // Join (or create) a channel
+	ChannelLeave  = 2 // Leave a channel
+	ChannelInvite = 3 // Invite a peer to a joined channel
+)
+
+// Steps of an invitation to a channel, exchanged in private messages
+const (
+	InviteOffer  = 1 // The inviter offers the destination to join a channel
+	InviteAccept = 2 // The invitee accepted (joined the channel), with its RSA public key if it is encrypted
+	InviteKey    = 3 // The inviter sends the channel's key, encrypted with the invitee's RSA public key
+)
+
+// ChannelCommand represents a channel operation requested by the client (never sent to other peers)
+type ChannelCommand struct {
+	Action      uint32 // The operation (see above)
+	Channel     string // The channel's name
+	Encrypted   bool   // Join: create an encrypted channel if it isn't joined yet
+	Destination string // Invite: the invited peer
+}
+
+// ChannelRumorToString returns a textual representation of a (decrypted) channel message
+func (pkt *RumorMessage) ChannelRumorToString(relayAddr string, text string) string {
+	return fmt.Sprintf("CHANNEL %s RUMOR origin %s from %s ID %d contents %s",
+		pkt.Channel, pkt.Origin, relayAddr, pkt.ID, text)
+}
@@ -0,0 +1,28 @@
+package messages
+
+// Kinds of replies to a client request
+const (
+	ReplyEvent    = 1 // Something happened (e.g. a search found a match)
+	ReplyProgress = 2 // State of an operation that takes time (e.g. chunks downloaded so far)
+	ReplyDone     = 3 // The command succeeded (last reply)
+	ReplyError    = 4 // The command failed (last reply)
+)
+
+// ClientRequest represents a command of the client that the gossiper answers with ClientReply packets
+// (never sent to other peers)
+type ClientRequest struct {
+	ID     uint64        // Chosen by the client to recognize the replies
+	Packet *GossipPacket // The command, one of the packets the client can send alone
+}
+
+// ClientReply represents an answer of the gossiper to a client request (never sent to other peers)
+type ClientReply struct {
+	ID   uint64 // The request's ID
+	Kind uint32 // The kind of reply (see above)
+	Text string // What to show to the user
+}
+
+// IsFinal returns true if no other reply follows this one
+func (reply *ClientReply) IsFinal() bool {
+	return reply.Kind == ReplyDone || reply.Kind == ReplyError
+}
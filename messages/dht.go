@@ -0,0 +1,61 @@
+package messages
+
+import (
+	"fmt"
+)
+
+const (
+	// DHTFindNode asks for the contacts closest to a key
+	DHTFindNode = uint32(1)
+	// DHTFindValue asks for the providers stored under a key (or the closest contacts if there are none)
+	DHTFindValue = uint32(2)
+	// DHTStore asks the receiver to store provider records under a key
+	DHTStore = uint32(3)
+	// DHTReply answers a DHTFindNode or DHTFindValue request
+	DHTReply = uint32(4)
+)
+
+// DHTContact represents a DHT node as exchanged between gossipers
+type DHTContact struct {
+	Name string // The node's name
+	Addr string // The node's <ip:port>
+}
+
+// DHTProvider represents a provider record: a node that has a complete copy of a file
+type DHTProvider struct {
+	Origin       string // The name of the node providing the file
+	Addr         string // The <ip:port> of the node providing the file
+	Filename     string // The file's name
+	MetafileHash []byte // The file's metahash
+	ChunkCount   uint64 // Number of chunks for this file
+}
+
+// DHTMessage represents a Kademlia-style RPC (request or reply) sent directly between two nodes
+type DHTMessage struct {
+	Origin    string         // The sender's name
+	RPCID     uint64         // Identifier matching a reply with its request
+	Kind      uint32         // One of DHTFindNode, DHTFindValue, DHTStore or DHTReply
+	Key       []byte         // The key concerned by the RPC
+	Contacts  []*DHTContact  // Closest known contacts (replies)
+	Providers []*DHTProvider // Provider records (DHTStore requests and DHTFindValue replies)
+}
+
+// DHTMessageToString returns a textual representation of a DHTMessage
+func (pkt *DHTMessage) DHTMessageToString(relayAddr string) string {
+	return fmt.Sprintf("DHT kind %d origin %s from %s key %x contacts %d providers %d",
+		pkt.Kind, pkt.Origin, relayAddr, pkt.Key, len(pkt.Contacts), len(pkt.Providers))
+}
+
+// ToSearchResult converts a provider record into a SearchResult advertising all of the file's chunks
+func (provider *DHTProvider) ToSearchResult() *SearchResult {
+	result := &SearchResult{
+		Filename:     provider.Filename,
+		MetafileHash: provider.MetafileHash,
+		ChunkMap:     make([]uint64, provider.ChunkCount),
+		ChunkCount:   provider.ChunkCount,
+	}
+	for i := uint64(0); i < provider.ChunkCount; i++ {
+		result.ChunkMap[i] = i + 1
+	}
+	return result
+}
@@ -1,7 +1,10 @@
 package messages
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
+	"sort"
 )
 
 // SimpleMessage represents a simple message
@@ -9,13 +12,17 @@ type SimpleMessage struct {
 	OriginalName  string // Name of original sender
 	RelayPeerAddr string // Address of last relayer
 	Contents      string // Message content
+	Channel       string // The channel to post the message in (client only, "" for the global feed)
 }
 
 // RumorMessage represents a rumor message
 type RumorMessage struct {
-	Origin string // Name of original sender
-	ID     uint32 // Message id (sequential)
-	Text   string // Message content
+	Origin   string // Name of original sender
+	ID       uint32 // Message id (sequential), also used as DSDV sequence number
+	Text     string // Message content
+	HopCount uint32 // The relayer's distance to the origin, in hops (DSDV route advertisement)
+	Channel  string // The channel the message was posted in ("" for the global feed)
+	Sealed   bool   // Indicates whether Text is encrypted with the channel's key
 }
 
 // PeerStatus represent the status of a particular peer for a given gossiper
@@ -24,9 +31,28 @@ type PeerStatus struct {
 	NextID     uint32 // Next expected message ID for this sender
 }
 
+// PeerHeartbeat represents a neighbor and the highest heartbeat counter known for it
+type PeerHeartbeat struct {
+	Addr      string // The neighbor's <ip:port>
+	Heartbeat uint64 // The neighbor's heartbeat counter
+}
+
 // StatusPacket represents the status of all known peers of a given gossiper (vector clock)
 type StatusPacket struct {
-	Want []PeerStatus // Vector clock
+	Want      []PeerStatus    // Vector clock
+	Heartbeat uint64          // The sender's heartbeat counter
+	Probe     bool            // Asks the receiver to answer with its own StatusPacket (liveness probe)
+	Peers     []PeerHeartbeat // A sample of the sender's live neighbors (peer exchange)
+	Observed  string          // The receiver's <ip:port> as seen by the sender (NAT traversal)
+
+	Version      uint32   // The sender's protocol version (0 for nodes predating versioning)
+	Capabilities []string // The features supported by the sender (see version.go)
+	Digest       []byte   // A digest of the vector clock (the packet only carries the digest if Want is empty)
+}
+
+// RumorBatch represents several rumors sent in a single exchange (anti-entropy catch-up)
+type RumorBatch struct {
+	Rumors []*RumorMessage // The rumors, in increasing ID order for each origin
 }
 
 // PrivateMessage represents a private message between 2 peers
@@ -36,6 +62,11 @@ type PrivateMessage struct {
 	Text        string // The message's content
 	Destination string // The destination's name
 	HopLimit    uint32 // The maximum number of hops the message is allowed to go through
+	Channel     string // The channel of an invitation ("" for a plain private message)
+	ChannelKey  []byte // Key step: the channel's shared key, encrypted with the invitee's RSA public key
+	Invite      uint32 // The step of the invitation (see channel.go)
+	Encrypted   bool   // Offer step: indicates whether the channel is encrypted
+	PublicKey   []byte // Accept step: the invitee's RSA public key (encrypted channels only)
 }
 
 // DataRequest represents a data request
@@ -128,6 +159,61 @@ type GossipPacket struct {
 	BlockPublish  *BlockPublish   // A block for the blockchain
 	BlockRequest  *BlockRequest   // A request for missing blocks
 	BlockReply    *BlockReply     // A reply for missing blocks
+	DHT           *DHTMessage     // A DHT request or reply
+	Punch         *PunchMessage   // A NAT traversal message
+	Batch         *RumorBatch     // Several rumors at once
+	Channel       *ChannelCommand // A channel operation (client only)
+	Subscribe     *ArtistInfo     // A subscription to an artist (client only)
+	Request       *ClientRequest  // A command expecting replies (client only)
+	Reply         *ClientReply    // A reply to a command (to the client only)
+}
+
+// PacketType returns the name of the type of the (first) non-nil field of the packet
+func (pkt *GossipPacket) PacketType() string {
+	switch {
+	case pkt.SimpleMsg != nil:
+		return "simple"
+	case pkt.Rumor != nil:
+		return "rumor"
+	case pkt.Status != nil:
+		return "status"
+	case pkt.Private != nil:
+		return "private"
+	case pkt.DataRequest != nil:
+		return "datarequest"
+	case pkt.DataReply != nil:
+		return "datareply"
+	case pkt.SearchRequest != nil:
+		return "searchrequest"
+	case pkt.SearchReply != nil:
+		return "searchreply"
+	case pkt.TxPublish != nil:
+		return "tx"
+	case pkt.BlockPublish != nil:
+		return "block"
+	case pkt.BlockRequest != nil:
+		return "blockrequest"
+	case pkt.BlockReply != nil:
+		return "blockreply"
+	case pkt.ArtTx != nil:
+		return "art"
+	case pkt.DHT != nil:
+		return "dht"
+	case pkt.Punch != nil:
+		return "punch"
+	case pkt.Batch != nil:
+		return "batch"
+	case pkt.Channel != nil:
+		return "channel"
+	case pkt.Subscribe != nil:
+		return "subscribe"
+	case pkt.Request != nil:
+		return "request"
+	case pkt.Reply != nil:
+		return "reply"
+	default:
+		return "unknown"
+	}
 }
 
 // SimpleMessageToString returns a textual representation of a SimpleMessage
@@ -151,6 +237,32 @@ func (pkt *StatusPacket) StatusPacketToString(relayAddr string) string {
 	return s
 }
 
+// IsDigestOnly checks whether a StatusPacket only carries the digest of the sender's vector clock
+func (pkt *StatusPacket) IsDigestOnly() bool {
+	return len(pkt.Want) == 0 && len(pkt.Digest) != 0
+}
+
+// VectorClockDigest returns a digest of a vector clock, independent of the order of its entries
+func VectorClockDigest(want []PeerStatus) []byte {
+	sorted := append([]PeerStatus(nil), want...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Identifier < sorted[j].Identifier })
+
+	h := sha256.New()
+	buf := make([]byte, 4)
+	for _, peer := range sorted {
+		// Empty entries are implicit
+		if peer.NextID <= 1 {
+			continue
+		}
+		binary.BigEndian.PutUint32(buf, uint32(len(peer.Identifier)))
+		h.Write(buf)
+		h.Write([]byte(peer.Identifier))
+		binary.BigEndian.PutUint32(buf, peer.NextID)
+		h.Write(buf)
+	}
+	return h.Sum(nil)[:16]
+}
+
 // PrivateMessageToString returns a textual representation of a PrivateMessage
 func (pkt *PrivateMessage) PrivateMessageToString() string {
 	return fmt.Sprintf("PRIVATE origin %s hop_limit %d contents %s",
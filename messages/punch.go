@@ -0,0 +1,32 @@
+package messages
+
+import (
+	"fmt"
+)
+
+const (
+	// PunchRequest asks the destination (routed) to open a direct connection with the origin
+	PunchRequest = uint32(1)
+	// PunchReply accepts a PunchRequest (routed) and advertises the destination's public address
+	PunchReply = uint32(2)
+	// PunchPing is sent directly to a candidate address to open the NAT mapping and test the path
+	PunchPing = uint32(3)
+	// PunchPong answers a PunchPing directly, proving the path works both ways
+	PunchPong = uint32(4)
+)
+
+// PunchMessage represents a NAT traversal (hole punching) message between two distant peers
+type PunchMessage struct {
+	Origin      string // The sender's name
+	Destination string // The destination's name
+	HopLimit    uint32 // The maximum number of hops the message is allowed to go through (routed kinds)
+	Kind        uint32 // One of PunchRequest, PunchReply, PunchPing or PunchPong
+	Addr        string // The origin's public <ip:port> as observed by its neighbors (routed kinds)
+	Nonce       uint64 // Random value of a ping, echoed by its pong (direct kinds)
+}
+
+// PunchMessageToString returns a textual representation of a PunchMessage
+func (pkt *PunchMessage) PunchMessageToString(relayAddr string) string {
+	return fmt.Sprintf("PUNCH kind %d origin %s destination %s from %s addr %s",
+		pkt.Kind, pkt.Origin, pkt.Destination, relayAddr, pkt.Addr)
+}
@@ -0,0 +1,29 @@
+package messages
+
+// ProtocolVersion is the version of the gossip protocol spoken by this node. Nodes that don't advertise a
+// version (0) predate capability negotiation.
+const ProtocolVersion = 2
+
+// Capabilities advertised in StatusPackets. A node only relies on a feature with a neighbor that
+// advertised it, and falls back to the legacy behavior otherwise.
+const (
+	CapHopCount   = "hopcount"   // RumorMessages carry the relayer's hop count (DSDV)
+	CapFragments  = "fragments"  // Oversized messages are sent in fragments
+	CapStream     = "stream"     // Oversized messages are sent over a TCP stream
+	CapSecure     = "secure"     // Links are authenticated and encrypted
+	CapDHT        = "dht"        // DHT messages
+	CapPunch      = "punch"      // NAT traversal messages
+	CapBlockchain = "blockchain" // Transactions and blocks
+	CapDigest     = "digest"     // StatusPackets may only carry a digest of the vector clock
+	CapBatch      = "batch"      // Missing rumors are sent in batches
+)
+
+// LocalCapabilities returns the capabilities supported by this node
+func LocalCapabilities(secure bool) []string {
+	capabilities := []string{CapHopCount, CapFragments, CapStream, CapDHT, CapPunch, CapBlockchain,
+		CapDigest, CapBatch}
+	if secure {
+		capabilities = append(capabilities, CapSecure)
+	}
+	return capabilities
+}
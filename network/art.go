@@ -6,6 +6,7 @@ import (
 	"Peerster/fail"
 	"Peerster/files"
 	"Peerster/frontend"
+	"Peerster/logger"
 	"Peerster/messages"
 	"Peerster/utils"
 	"net"
@@ -13,11 +14,14 @@ import (
 	"github.com/dedis/protobuf"
 )
 
-/*OnPublishArtwork allows the client to publish an artwork.*/
-func OnPublishArtwork(gossiper *entities.Gossiper, artTx *messages.ArtTx) {
+/*ArtHopLimit is the default hop limit of the ArtTx's*/
+const ArtHopLimit = 8
+
+/*OnPublishArtwork allows the client to publish an artwork. It fails if the file can't be indexed.*/
+func OnPublishArtwork(gossiper *entities.Gossiper, artTx *messages.ArtTx) error {
 
 	// Fill up transaction
-	artTx.HopLimit = 8
+	artTx.HopLimit = gossiper.Args.ArtHopLimit
 	artTx.Artist.Name = gossiper.Args.Name
 	artTx.Artist.Signature = "sig_" + gossiper.Args.Name
 	artTx.Artwork.AuthorSignature = artTx.Artist.Signature
@@ -26,9 +30,10 @@ func OnPublishArtwork(gossiper *entities.Gossiper, artTx *messages.ArtTx) {
 		// Broadcast the artwork
 		artTx.Artwork.Metahash = utils.HashToHex(file.MetafileHash[:])
 		OnBroadcastArtTx(gossiper, artTx)
-	} else {
+		return nil
 	}
-
+	return &fail.CustomError{Fun: "OnPublishArtwork", Desc: "cannot index " + artTx.Artwork.Filename +
+		" (missing, already indexed or too big)"}
 }
 
 /*OnBroadcastArtTx broadcats an ArtTx to all neighbors.*/
@@ -80,8 +85,17 @@ func OnInvalidateArtTx(gossiper *entities.Gossiper, artTx *messages.ArtTx) {
 	gossiper.ArtSystem.InvalidateArtwork(artTx.Artwork)
 }
 
-/*OnSubscribe subscribes the user to an artist.*/
-func OnSubscribe(gossiper *entities.Gossiper, signature string) {
+/*OnSubscribe subscribes the user to an artist. It fails if the artist is unknown.*/
+func OnSubscribe(gossiper *entities.Gossiper, signature string) error {
+
+	known := false
+	artists, _ := gossiper.ArtSystem.GetArtists()
+	for _, info := range artists {
+		known = known || info.Signature == signature
+	}
+	if !known {
+		return &fail.CustomError{Fun: "OnSubscribe", Desc: "unknown artist " + signature}
+	}
 
 	if toDownload, artist := gossiper.ArtSystem.Subscribe(signature); toDownload != nil {
 		for _, artwork := range toDownload {
@@ -92,6 +106,7 @@ func OnSubscribe(gossiper *entities.Gossiper, signature string) {
 		}
 	}
 
+	return nil
 }
 
 /*OnDownloadArtwork downloads an artwork from the network.*/
@@ -113,13 +128,13 @@ func OnDownloadArtwork(gossiper *entities.Gossiper, artwork *app.Artwork, artTx
 	// Create metafile request
 	request := &messages.DataRequest{Origin: gossiper.Args.Name,
 		Destination: artTx.Artist.Name,
-		HopLimit:    16,
+		HopLimit:    gossiper.Args.HopLimit,
 		HashValue:   utils.HexToHash(artwork.Info.Metahash[:]),
 	}
 
 	// Send with timeout
 	ref := files.NewHashRef(shared, 0)
-	fail.LeveledPrint(0, "", "DOWNLOADING metafile of %s from %s", artwork.Info.Name, artTx.Artist.Name)
-	OnSendTimedDataRequest(gossiper, request, ref, target)
+	logger.Art.Protocol("DOWNLOADING metafile of %s from %s", artwork.Info.Name, artTx.Artist.Name)
+	go OnSendTimedDataRequest(gossiper, request, ref, target)
 
 }
@@ -2,7 +2,7 @@ package network
 
 import (
 	"Peerster/entities"
-	"Peerster/fail"
+	"Peerster/logger"
 	"Peerster/messages"
 
 	"github.com/dedis/protobuf"
@@ -12,8 +12,8 @@ import (
 func OnBroadcastClient(g *entities.Gossiper, simpleMsg *messages.SimpleMessage) {
 
 	// Print to the console
-	fail.LeveledPrint(0, "", "CLIENT MESSAGE %s", simpleMsg.Contents)
-	fail.LeveledPrint(0, "", g.PeerIndex.PeersToString())
+	logger.Gossip.Protocol("CLIENT MESSAGE %s", simpleMsg.Contents)
+	logger.Gossip.Protocol("%s", g.PeerIndex.PeersToString())
 
 	// Modify the packet
 	simpleMsg.OriginalName = g.Args.Name
@@ -35,8 +35,8 @@ func OnBroadcastClient(g *entities.Gossiper, simpleMsg *messages.SimpleMessage)
 func OnBroadcastNetwork(g *entities.Gossiper, simpleMsg *messages.SimpleMessage) {
 
 	// Print to the console
-	fail.LeveledPrint(0, "", simpleMsg.SimpleMessageToString())
-	fail.LeveledPrint(0, "", g.PeerIndex.PeersToString())
+	logger.Gossip.Protocol("%s", simpleMsg.SimpleMessageToString())
+	logger.Gossip.Protocol("%s", g.PeerIndex.PeersToString())
 
 	// Modify the structure
 	sender := simpleMsg.RelayPeerAddr
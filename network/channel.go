@@ -0,0 +1,258 @@
+package network
+
+import (
+	"Peerster/channels"
+	"Peerster/crypto_rsa"
+	"Peerster/entities"
+	"Peerster/fail"
+	"Peerster/frontend"
+	"Peerster/logger"
+	"Peerster/messages"
+	"Peerster/peers"
+	"fmt"
+	"net"
+)
+
+// OnReceiveChannelCommand - Called when a channel operation is received from the client
+func OnReceiveChannelCommand(g *entities.Gossiper, command *messages.ChannelCommand) {
+	if err := runChannelCommand(g, command); err != nil {
+		logger.Gossip.Error("OnReceiveChannelCommand", "%s", err.Error())
+	}
+}
+
+// runChannelCommand - Executes a channel operation of the client
+func runChannelCommand(g *entities.Gossiper, command *messages.ChannelCommand) error {
+	switch command.Action {
+	case messages.ChannelJoin:
+		return OnJoinChannel(g, command.Channel, command.Encrypted)
+	case messages.ChannelLeave:
+		return OnLeaveChannel(g, command.Channel)
+	case messages.ChannelInvite:
+		return OnInviteChannel(g, command.Channel, command.Destination)
+	}
+	return &fail.CustomError{Fun: "runChannelCommand", Desc: "unknown channel operation"}
+}
+
+// OnJoinChannel - Joins (or creates) a channel. A new key is generated for encrypted channels: other
+// members must be invited to get it. Joining a channel we are invited to accepts the invitation: an
+// encrypted channel is only joined once the inviter sent its key.
+func OnJoinChannel(g *entities.Gossiper, name string, encrypted bool) error {
+	if !channels.IsValidName(name) {
+		return &fail.CustomError{Fun: "OnJoinChannel", Desc: "invalid channel name " + name}
+	}
+	if invite, ok := g.Channels.AcceptInvite(name); ok {
+		return acceptChannelInvite(g, &invite)
+	}
+
+	var key []byte
+	if encrypted {
+		var err error
+		if key, err = channels.NewKey(); err != nil {
+			return err
+		}
+	}
+	return joinChannel(g, name, key)
+}
+
+// joinChannel - Joins a channel with a given key (nil for a plain channel)
+func joinChannel(g *entities.Gossiper, name string, key []byte) error {
+	if !g.Channels.Join(name, key, g.Args.Name) {
+		return &fail.CustomError{Fun: "joinChannel", Desc: "channel " + name + " already joined"}
+	}
+
+	logger.Gossip.Protocol("JOINED CHANNEL %s", name)
+	frontend.FBuffer.AddFrontendChannel(name, key != nil, true)
+	return nil
+}
+
+// OnLeaveChannel - Leaves a channel (its messages are still relayed)
+func OnLeaveChannel(g *entities.Gossiper, name string) error {
+	if !g.Channels.Leave(name) {
+		return &fail.CustomError{Fun: "OnLeaveChannel", Desc: "channel " + name + " isn't joined"}
+	}
+
+	logger.Gossip.Protocol("LEFT CHANNEL %s", name)
+	frontend.FBuffer.AddFrontendChannel(name, false, false)
+	return nil
+}
+
+// OnInviteChannel - Invites a peer to a joined channel. The channel's key is only sent once the peer accepts.
+func OnInviteChannel(g *entities.Gossiper, name string, destination string) error {
+	key, joined := g.Channels.GetKey(name)
+	if !joined {
+		return &fail.CustomError{Fun: "OnInviteChannel", Desc: "channel " + name + " isn't joined"}
+	}
+	if g.Router.GetTarget(destination) == nil {
+		return &fail.CustomError{Fun: "OnInviteChannel", Desc: "no route to " + destination}
+	}
+
+	g.Channels.AddInvited(name, destination)
+	OnReceiveClientPrivate(g, &messages.PrivateMessage{
+		Text:        fmt.Sprintf("Invitation to channel %s", name),
+		Destination: destination,
+		Channel:     name,
+		Invite:      messages.InviteOffer,
+		Encrypted:   key != nil,
+	})
+	return nil
+}
+
+// acceptChannelInvite - Accepts an invitation to a channel. A plain channel is joined right away, while
+// our RSA public key is sent to the inviter of an encrypted channel to receive its key.
+func acceptChannelInvite(g *entities.Gossiper, invite *channels.Invite) error {
+	if g.Router.GetTarget(invite.From) == nil {
+		return &fail.CustomError{Fun: "acceptChannelInvite", Desc: "no route to " + invite.From}
+	}
+
+	accept := &messages.PrivateMessage{
+		Text:        fmt.Sprintf("Accepted invitation to channel %s", invite.Channel),
+		Destination: invite.From,
+		Channel:     invite.Channel,
+		Invite:      messages.InviteAccept,
+	}
+	if invite.Encrypted {
+		publicKey, err := crypto_rsa.PublicKeyToBytes(&g.Keys.PublicKey)
+		if err != nil {
+			return &fail.CustomError{Fun: "acceptChannelInvite", Desc: "cannot encode public key"}
+		}
+		accept.PublicKey = publicKey
+	} else if err := joinChannel(g, invite.Channel, nil); err != nil {
+		return err
+	} else {
+		g.Channels.AddMember(invite.Channel, invite.From)
+	}
+
+	OnReceiveClientPrivate(g, accept)
+	return nil
+}
+
+// onReceiveChannelInvite - Called when a step of an invitation to a channel is received
+func onReceiveChannelInvite(g *entities.Gossiper, private *messages.PrivateMessage) {
+	if !channels.IsValidName(private.Channel) {
+		return
+	}
+
+	switch private.Invite {
+	case messages.InviteOffer:
+		onReceiveInviteOffer(g, private)
+	case messages.InviteAccept:
+		onReceiveInviteAccept(g, private)
+	case messages.InviteKey:
+		onReceiveInviteKey(g, private)
+	}
+}
+
+// onReceiveInviteOffer - Called when we are invited to a channel: the invitation is kept until the user
+// accepts it by joining the channel
+func onReceiveInviteOffer(g *entities.Gossiper, private *messages.PrivateMessage) {
+	invite := channels.Invite{Channel: private.Channel, From: private.Origin, Encrypted: private.Encrypted}
+	if !g.Channels.AddInvite(invite) {
+		logger.Gossip.Info("onReceiveInviteOffer", "ignoring invitation to channel %s", private.Channel)
+		return
+	}
+
+	logger.Gossip.Protocol("INVITED to channel %s by %s", private.Channel, private.Origin)
+}
+
+// onReceiveInviteAccept - Called when a peer we invited accepted: the key of an encrypted channel is sent
+// to it, encrypted with its RSA public key
+func onReceiveInviteAccept(g *entities.Gossiper, private *messages.PrivateMessage) {
+	if !g.Channels.TakeInvited(private.Channel, private.Origin) {
+		logger.Gossip.Info("onReceiveInviteAccept", "%s wasn't invited to channel %s", private.Origin, private.Channel)
+		return
+	}
+
+	g.Channels.AddMember(private.Channel, private.Origin)
+	key, joined := g.Channels.GetKey(private.Channel)
+	if !joined || key == nil {
+		return
+	}
+
+	publicKey, err := crypto_rsa.BytesToPublicKey(private.PublicKey)
+	if err != nil || publicKey.N == nil {
+		logger.Gossip.Info("onReceiveInviteAccept", "invalid public key from %s", private.Origin)
+		return
+	}
+	sealed, err := channels.SealKey(key, private.Channel, publicKey)
+	if err != nil {
+		logger.Gossip.Error("onReceiveInviteAccept", "%s", err.Error())
+		return
+	}
+
+	OnReceiveClientPrivate(g, &messages.PrivateMessage{
+		Text:        fmt.Sprintf("Key of channel %s", private.Channel),
+		Destination: private.Origin,
+		Channel:     private.Channel,
+		Invite:      messages.InviteKey,
+		ChannelKey:  sealed,
+	})
+}
+
+// onReceiveInviteKey - Called when the inviter of an encrypted channel sent its key: the channel is joined
+func onReceiveInviteKey(g *entities.Gossiper, private *messages.PrivateMessage) {
+	if !g.Channels.TakeAcceptedInvite(private.Channel, private.Origin) {
+		logger.Gossip.Info("onReceiveInviteKey", "no accepted invitation to channel %s from %s", private.Channel, private.Origin)
+		return
+	}
+
+	key, err := channels.OpenKey(private.ChannelKey, private.Channel, g.Keys)
+	if err != nil {
+		logger.Gossip.Error("onReceiveInviteKey", "%s", err.Error())
+		return
+	}
+	if err := joinChannel(g, private.Channel, key); err != nil {
+		logger.Gossip.Error("onReceiveInviteKey", "%s", err.Error())
+		return
+	}
+	g.Channels.AddMember(private.Channel, private.Origin)
+}
+
+// sealChannelRumor - Prepares a message posted by the client in a channel, encrypting it if needed
+func sealChannelRumor(g *entities.Gossiper, rumor *messages.RumorMessage) error {
+	key, joined := g.Channels.GetKey(rumor.Channel)
+	if !joined {
+		return &fail.CustomError{Fun: "sealChannelRumor", Desc: "channel " + rumor.Channel + " isn't joined"}
+	}
+	if rumor.Text == "" {
+		return &fail.CustomError{Fun: "sealChannelRumor", Desc: "empty channel message"}
+	}
+
+	if key != nil {
+		sealed, err := channels.Seal(key, rumor.Channel, g.Args.Name, rumor.Text)
+		if err != nil {
+			return err
+		}
+		rumor.Text = sealed
+		rumor.Sealed = true
+	}
+	return nil
+}
+
+// surfaceChannelRumor - Displays a new channel message if the channel is joined, decrypting it if needed
+func surfaceChannelRumor(g *entities.Gossiper, rumor *messages.RumorMessage, sender *net.UDPAddr) {
+	key, joined := g.Channels.GetKey(rumor.Channel)
+	if !joined {
+		return
+	}
+
+	text, err := OpenChannelText(key, rumor.Channel, rumor.Origin, rumor.Text, rumor.Sealed)
+	if err != nil {
+		logger.Gossip.Error("surfaceChannelRumor", "%s", err.Error())
+		return
+	}
+
+	g.Channels.AddMember(rumor.Channel, rumor.Origin)
+	logger.Gossip.Protocol("%s", rumor.ChannelRumorToString(peers.UDPAddressToString(sender), text))
+	frontend.FBuffer.AddFrontendChannelMessage(rumor.Channel, rumor.Origin, text)
+}
+
+// OpenChannelText - Returns the plaintext of a channel message (key is nil for a plain channel)
+func OpenChannelText(key []byte, channel, origin, text string, sealed bool) (string, error) {
+	if !sealed {
+		return text, nil
+	}
+	if key == nil {
+		return "", &fail.CustomError{Fun: "OpenChannelText", Desc: "no key for encrypted channel " + channel}
+	}
+	return channels.Open(key, channel, origin, text)
+}
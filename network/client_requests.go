@@ -0,0 +1,240 @@
+package network
+
+import (
+	"Peerster/entities"
+	"Peerster/fail"
+	"Peerster/files"
+	"Peerster/logger"
+	"Peerster/messages"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+const (
+	// ClientProgressIntervalSec is the interval between two progress replies to a command that takes time
+	// (they also tell the client that the gossiper is still working on it)
+	ClientProgressIntervalSec = 1
+	// ClientStallTimeoutSec is the time without progress after which a download stops being reported to
+	// the client (it goes on in the background)
+	ClientStallTimeoutSec = 60
+)
+
+// clientReplier - Sends the replies to a request of the client
+type clientReplier struct {
+	g      *entities.Gossiper // The gossiper
+	id     uint64             // The request's ID
+	target *net.UDPAddr       // The client's address
+}
+
+// send - Sends a reply to the client
+func (replier *clientReplier) send(kind uint32, format string, a ...interface{}) {
+	reply := &messages.ClientReply{ID: replier.id, Kind: kind, Text: fmt.Sprintf(format, a...)}
+	buf, err := protobuf.Encode(&messages.GossipPacket{Reply: reply})
+	if err != nil {
+		return
+	}
+	if _, err := replier.g.ClientChannel.WriteToUDP(buf, replier.target); err != nil {
+		logger.Gossip.Error("clientReplier.send", "cannot reply to the client: %s", err.Error())
+	}
+}
+
+// sendError - Tells the client that its command failed
+func (replier *clientReplier) sendError(err error) {
+	if custom, ok := err.(*fail.CustomError); ok {
+		replier.send(messages.ReplyError, "%s", custom.Desc)
+	} else {
+		replier.send(messages.ReplyError, "%s", err.Error())
+	}
+}
+
+// OnReceiveClientRequest - Called when a command expecting replies is received from the client: the
+// command is executed and its outcome (and progress, for searches and downloads) sent back to the client
+func OnReceiveClientRequest(g *entities.Gossiper, request *messages.ClientRequest, sender *net.UDPAddr, threadID uint32) {
+	replier := &clientReplier{g: g, id: request.ID, target: sender}
+	if err := runClientCommand(g, request.Packet, replier, threadID); err != nil {
+		replier.sendError(err)
+	}
+}
+
+// runClientCommand - Executes a command of the client, the final reply is sent unless an error is returned
+func runClientCommand(g *entities.Gossiper, pkt *messages.GossipPacket, replier *clientReplier, threadID uint32) error {
+	switch {
+	case pkt.SimpleMsg != nil:
+		if pkt.SimpleMsg.Contents == "" {
+			// An empty rumor would be taken for a route rumor
+			return &fail.CustomError{Fun: "runClientCommand", Desc: "empty message"}
+		}
+		if g.Args.SimpleMode {
+			OnBroadcastClient(g, pkt.SimpleMsg)
+			replier.send(messages.ReplyDone, "BROADCAST %s", pkt.SimpleMsg.Contents)
+			return nil
+		}
+		rumor := &messages.RumorMessage{Text: pkt.SimpleMsg.Contents, Channel: pkt.SimpleMsg.Channel}
+		if err := PostClientRumor(g, rumor); err != nil {
+			return err
+		}
+		go SpreadClientRumor(g, rumor, threadID)
+		replier.send(messages.ReplyDone, "RUMOR origin %s ID %d", rumor.Origin, rumor.ID)
+
+	case pkt.Private != nil:
+		if pkt.Private.Text == "" {
+			return &fail.CustomError{Fun: "runClientCommand", Desc: "empty private message"}
+		}
+		if g.Router.GetTarget(pkt.Private.Destination) == nil {
+			return &fail.CustomError{Fun: "runClientCommand", Desc: "no route to " + pkt.Private.Destination}
+		}
+		OnReceiveClientPrivate(g, pkt.Private)
+		replier.send(messages.ReplyDone, "PRIVATE sent to %s", pkt.Private.Destination)
+
+	case pkt.DataRequest != nil && pkt.DataRequest.HopLimit == 0:
+		return runClientIndex(g, pkt.DataRequest.Origin, replier)
+
+	case pkt.DataRequest != nil:
+		return runClientDownload(g, pkt.DataRequest, replier)
+
+	case pkt.SearchRequest != nil:
+		runClientSearch(g, pkt.SearchRequest, replier)
+
+	case pkt.ArtTx != nil:
+		if err := OnPublishArtwork(g, pkt.ArtTx); err != nil {
+			return err
+		}
+		replier.send(messages.ReplyDone, "PUBLISHED artwork %s metahash=%s", pkt.ArtTx.Artwork.Name, pkt.ArtTx.Artwork.Metahash)
+
+	case pkt.Channel != nil:
+		if err := runChannelCommand(g, pkt.Channel); err != nil {
+			return err
+		}
+		switch pkt.Channel.Action {
+		case messages.ChannelJoin:
+			if !g.Channels.IsJoined(pkt.Channel.Channel) {
+				replier.send(messages.ReplyDone, "ACCEPTED invitation to channel %s, waiting for its key", pkt.Channel.Channel)
+				break
+			}
+			replier.send(messages.ReplyDone, "JOINED channel %s", pkt.Channel.Channel)
+		case messages.ChannelLeave:
+			replier.send(messages.ReplyDone, "LEFT channel %s", pkt.Channel.Channel)
+		default:
+			replier.send(messages.ReplyDone, "INVITED %s to channel %s", pkt.Channel.Destination, pkt.Channel.Channel)
+		}
+
+	case pkt.Subscribe != nil:
+		if err := OnSubscribe(g, pkt.Subscribe.Signature); err != nil {
+			return err
+		}
+		replier.send(messages.ReplyDone, "SUBSCRIBED to %s", pkt.Subscribe.Signature)
+
+	default:
+		return &fail.CustomError{Fun: "runClientCommand", Desc: "unsupported command"}
+	}
+	return nil
+}
+
+// runClientIndex - Indexes a file of the shared folder for the client
+func runClientIndex(g *entities.Gossiper, filename string, replier *clientReplier) error {
+	if !files.IsValidFilename(filename) {
+		return &fail.CustomError{Fun: "runClientIndex", Desc: fmt.Sprintf("invalid filename %q", filename)}
+	}
+	if _, err := os.Stat(filepath.Join(files.SharedFilesDir, filename)); err != nil {
+		return &fail.CustomError{Fun: "runClientIndex", Desc: "no file " + filename + " in the shared folder"}
+	}
+	file := OnIndexLocalFile(g, filename, g.Args.BlockHopLimit)
+	if file == nil {
+		return &fail.CustomError{Fun: "runClientIndex", Desc: "cannot index " + filename + " (already indexed or too big)"}
+	}
+	replier.send(messages.ReplyDone, "INDEXED %s metahash=%s size=%d", file.Name, files.ToHex(file.MetafileHash), file.Size)
+	return nil
+}
+
+// runClientDownload - Downloads a file for the client, reporting the chunks received until it is
+// reconstructed
+func runClientDownload(g *entities.Gossiper, request *messages.DataRequest, replier *clientReplier) error {
+	filename, metahash := request.Origin, files.ToHex(request.HashValue)
+	if !files.IsValidFilename(filename) {
+		return &fail.CustomError{Fun: "runClientDownload", Desc: fmt.Sprintf("invalid filename %q", filename)}
+	}
+
+	// From a given peer, or from the peers found by a search
+	var err error
+	if request.Destination != "" {
+		err = OnRemoteMetafileRequestMonosource(g, request.HashValue, filename, request.Destination)
+	} else {
+		err = OnRemoteMetafileRequestMultisource(g, request.HashValue, filename)
+	}
+	if err != nil {
+		return err
+	}
+	replier.send(messages.ReplyEvent, "DOWNLOADING %s metahash=%s", filename, metahash)
+
+	lastProgress, lastChange := "", time.Now()
+	for {
+		time.Sleep(ClientProgressIntervalSec * time.Second)
+
+		file, ok := g.FileIndex.GetFile(metahash)
+		if !ok {
+			return &fail.CustomError{Fun: "runClientDownload", Desc: "the download of " + filename + " was cancelled"}
+		}
+		if file.Status == files.Reconstructed {
+			replier.send(messages.ReplyDone, "RECONSTRUCTED file %s (%d chunks)", file.Filename, file.ChunkCount)
+			return nil
+		}
+
+		progress := fmt.Sprintf("%d/%d chunks", file.DownloadedChunks, file.ChunkCount)
+		if file.Status == files.NoMetafileMonoSource || file.Status == files.NoMetafileMultiSource {
+			progress = "requesting metafile"
+		}
+		if progress != lastProgress {
+			lastProgress, lastChange = progress, time.Now()
+		} else if time.Since(lastChange) > ClientStallTimeoutSec*time.Second {
+			return &fail.CustomError{Fun: "runClientDownload", Desc: fmt.Sprintf(
+				"no progress for %d seconds (%s), the download goes on in the background", ClientStallTimeoutSec, progress)}
+		}
+		replier.send(messages.ReplyProgress, "DOWNLOADING %s %s", file.Filename, progress)
+	}
+}
+
+// runClientSearch - Searches files for the client, reporting the matches of this search as they are found
+func runClientSearch(g *entities.Gossiper, search *messages.SearchRequest, replier *clientReplier) {
+
+	matchID := g.SearchMatches.Register(search.Keywords)
+	defer g.SearchMatches.Forget(matchID)
+	done := make(chan bool)
+	go func() {
+		OnInitiateFileSearch(g, search.Budget, search.Keywords)
+		g.SearchMatches.Finish(matchID)
+		close(done)
+	}()
+
+	// A match is reported again when it becomes complete
+	reported := make(map[string]bool)
+	report := func() int {
+		matches, _ := g.SearchMatches.GetMatches(matchID)
+		for _, metahash := range matches {
+			match, ok := g.FileIndex.GetFile(metahash)
+			if key := metahash + match.Status.String(); ok && !reported[key] {
+				reported[key] = true
+				replier.send(messages.ReplyEvent, "FOUND %s metahash=%s %s", match.Filename, match.Metahash, match.Status)
+			}
+		}
+		return len(matches)
+	}
+
+	ticker := time.NewTicker(ClientProgressIntervalSec * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			replier.send(messages.ReplyDone, "SEARCH FINISHED with %d matches", report())
+			return
+		case <-ticker.C:
+			report()
+			replier.send(messages.ReplyProgress, "SEARCHING %s", strings.Join(search.Keywords, ","))
+		}
+	}
+}
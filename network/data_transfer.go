@@ -5,6 +5,7 @@ import (
 	"Peerster/fail"
 	"Peerster/files"
 	"Peerster/frontend"
+	"Peerster/logger"
 	"Peerster/messages"
 	"crypto/sha256"
 	"net"
@@ -13,7 +14,7 @@ import (
 	"github.com/dedis/protobuf"
 )
 
-// DataRequestRepeatIntervalSec represents the amount of time after which a DataRequest is resent if it wasn't answered
+// DataRequestRepeatIntervalSec represents the default amount of time after which a DataRequest is resent if it wasn't answered
 const DataRequestRepeatIntervalSec = 5
 
 // OnSendDataRequest - Sends a data request
@@ -27,7 +28,7 @@ func OnSendDataRequest(g *entities.Gossiper, request *messages.DataRequest, targ
 	}
 
 	// Send the packet
-	if _, err := g.GossipChannel.WriteToUDP(buf, target); err != nil {
+	if err := g.GossipChannel.Send(buf, target); err != nil {
 		return &fail.CustomError{Fun: "OnSendDataRequest", Desc: "failed to send DataRequest"}
 	}
 
@@ -56,12 +57,21 @@ func OnSendTimedDataRequest(g *entities.Gossiper, request *messages.DataRequest,
 		}
 
 		// Wait for some time
-		time.Sleep(DataRequestRepeatIntervalSec * time.Second)
+		time.Sleep(time.Duration(g.Args.DataRequestInterval) * time.Second)
 
 		// Check if the response was received
 		if g.TODataRequest.CheckResponseAndDelete(request.HashValue) {
 			return
 		}
+
+		// The direct link seems broken: fall back to routed delivery
+		if g.DirectLinks.IsDirectTarget(request.Destination, target) {
+			logger.Files.Info("OnSendTimedDataRequest", "DIRECT LINK %s broken, falling back to routing", request.Destination)
+			g.DirectLinks.Invalidate(request.Destination)
+			if target = g.Router.GetTarget(request.Destination); target == nil {
+				return
+			}
+		}
 	}
 
 }
@@ -77,7 +87,7 @@ func OnSendDataReply(g *entities.Gossiper, reply *messages.DataReply, target *ne
 	}
 
 	// Send the packet
-	g.GossipChannel.WriteToUDP(buf, target)
+	g.GossipChannel.Send(buf, target)
 }
 
 // OnReceiveDataRequest - Called when a data request is received
@@ -86,6 +96,7 @@ func OnReceiveDataRequest(g *entities.Gossiper, request *messages.DataRequest, s
 	// Add the contact to our routing table
 	if g.Args.Name != request.Origin {
 		g.Router.AddContactIfAbsent(request.Origin, sender)
+		g.DirectLinks.Touch(request.Origin, sender)
 	}
 
 	// Allow snooping
@@ -97,13 +108,13 @@ func OnReceiveDataRequest(g *entities.Gossiper, request *messages.DataRequest, s
 		// Craft DataReply
 		reply := &messages.DataReply{Origin: g.Args.Name,
 			Destination: request.Origin,
-			HopLimit:    16,
+			HopLimit:    g.Args.HopLimit,
 			HashValue:   request.HashValue,
 			Data:        data,
 		}
 
-		// Pick the target (should exist) and send
-		if target := g.Router.GetTarget(request.Origin); target != nil {
+		// Pick the target (direct link or next hop) and send
+		if target := getTransferTarget(g, request.Origin); target != nil {
 			OnSendDataReply(g, reply, target)
 		}
 
@@ -131,6 +142,7 @@ func OnReceiveDataReply(g *entities.Gossiper, reply *messages.DataReply, sender
 	// Add the contact to our routing table
 	if g.Args.Name != reply.Origin {
 		g.Router.AddContactIfAbsent(reply.Origin, sender)
+		g.DirectLinks.Touch(reply.Origin, sender)
 	}
 
 	if g.Args.Name == reply.Destination { // Message is for me
@@ -147,7 +159,7 @@ func OnReceiveDataReply(g *entities.Gossiper, reply *messages.DataReply, sender
 			if nextChunk, target := g.FileIndex.HandleDataReply(ref, reply); nextChunk != 0 {
 				OnRemoteChunkRequest(g, ref.File, nextChunk, target)
 			} else {
-				fail.LeveledPrint(0, "", "RECONSTRUTED file %s", ref.File.Filename)
+				logger.Files.Protocol("RECONSTRUTED file %s", ref.File.Filename)
 			}
 		}
 
@@ -168,11 +180,11 @@ func OnReceiveDataReply(g *entities.Gossiper, reply *messages.DataReply, sender
 
 }
 
-// OnRemoteChunkRequest - Request the chunks of a remote file
+// OnRemoteChunkRequest - Request the chunks of a remote file (the request is resent in the background)
 func OnRemoteChunkRequest(g *entities.Gossiper, file *files.SharedFile, chunkIndex uint64, remotePeer string) {
 
 	// Check that the remote peer exists
-	target := g.Router.GetTarget(remotePeer)
+	target := getTransferTarget(g, remotePeer)
 	if target == nil {
 		return
 	}
@@ -184,73 +196,88 @@ func OnRemoteChunkRequest(g *entities.Gossiper, file *files.SharedFile, chunkInd
 	// Create chunk request
 	request := &messages.DataRequest{Origin: g.Args.Name,
 		Destination: remotePeer,
-		HopLimit:    16,
+		HopLimit:    g.Args.HopLimit,
 		HashValue:   hash,
 	}
 
+	// Try to download the next chunks through a direct connection
+	go OnInitiateDirectConnection(g, remotePeer)
+
 	// Send with timeout
 	ref := files.NewHashRef(file, chunkIndex)
-	fail.LeveledPrint(0, "", "DOWNLOADING %s chunk %d from %s", file.Filename, chunkIndex, remotePeer)
-	OnSendTimedDataRequest(g, request, ref, target)
+	logger.Files.Protocol("DOWNLOADING %s chunk %d from %s", file.Filename, chunkIndex, remotePeer)
+	go OnSendTimedDataRequest(g, request, ref, target)
 }
 
-// OnRemoteMetafileRequestMonosource - Request the metafile of a remote file
-func OnRemoteMetafileRequestMonosource(g *entities.Gossiper, metahash []byte, localFilename, remotePeer string) {
+// OnRemoteMetafileRequestMonosource - Request the metafile of a remote file (the download goes on in the
+// background)
+func OnRemoteMetafileRequestMonosource(g *entities.Gossiper, metahash []byte, localFilename, remotePeer string) error {
 
 	// Check that the remote peer exists
-	target := g.Router.GetTarget(remotePeer)
+	target := getTransferTarget(g, remotePeer)
 	if target == nil {
-		return
+		return &fail.CustomError{Fun: "OnRemoteMetafileRequestMonosource", Desc: "no route to " + remotePeer}
 	}
 
 	// Create a shared file
 	shared := g.FileIndex.AddMonoSourceFile(localFilename, metahash, false, nil)
 	if shared == nil {
-		// Error: filename already exists
-		return
+		return &fail.CustomError{Fun: "OnRemoteMetafileRequestMonosource", Desc: "file already known"}
 	}
 
 	// Create metafile request
 	request := &messages.DataRequest{Origin: g.Args.Name,
 		Destination: remotePeer,
-		HopLimit:    16,
+		HopLimit:    g.Args.HopLimit,
 		HashValue:   metahash,
 	}
 
 	// Send update to frontend
 	frontend.FBuffer.AddFrontendConstructingFile(localFilename, files.ToHex(metahash[:]), remotePeer)
 
+	// Try to download the chunks through a direct connection
+	go OnInitiateDirectConnection(g, remotePeer)
+
 	// Send with timeout
 	ref := files.NewHashRef(shared, 0)
-	fail.LeveledPrint(0, "", "DOWNLOADING metafile of %s from %s", localFilename, remotePeer)
-	OnSendTimedDataRequest(g, request, ref, target)
+	logger.Files.Protocol("DOWNLOADING metafile of %s from %s", localFilename, remotePeer)
+	go OnSendTimedDataRequest(g, request, ref, target)
+	return nil
 }
 
-// OnRemoteMetafileRequestMultisource - Request the metafile of a remometahashte file
-func OnRemoteMetafileRequestMultisource(g *entities.Gossiper, metahash []byte, localFilename string) {
+// OnRemoteMetafileRequestMultisource - Request the metafile of a remote file found by a search (the download
+// goes on in the background)
+func OnRemoteMetafileRequestMultisource(g *entities.Gossiper, metahash []byte, localFilename string) error {
 
 	// Check if we have a valid target to send the message to
-	if metafileQueryPeer, shared := g.FileIndex.GetMetafileTargetMultisource(metahash); metafileQueryPeer != "" {
-		if target := g.Router.GetTarget(metafileQueryPeer); target != nil {
+	metafileQueryPeer, shared := g.FileIndex.GetMetafileTargetMultisource(metahash)
+	if metafileQueryPeer == "" {
+		return &fail.CustomError{Fun: "OnRemoteMetafileRequestMultisource", Desc: "no complete match for this metahash"}
+	}
+	target := getTransferTarget(g, metafileQueryPeer)
+	if target == nil {
+		return &fail.CustomError{Fun: "OnRemoteMetafileRequestMultisource", Desc: "no route to " + metafileQueryPeer}
+	}
 
-			// Change filename
-			shared.ChangeName(localFilename)
+	// Change filename
+	shared.ChangeName(localFilename)
 
-			// Create metafile request
-			request := &messages.DataRequest{Origin: g.Args.Name,
-				Destination: metafileQueryPeer,
-				HopLimit:    16,
-				HashValue:   metahash,
-			}
+	// Create metafile request
+	request := &messages.DataRequest{Origin: g.Args.Name,
+		Destination: metafileQueryPeer,
+		HopLimit:    g.Args.HopLimit,
+		HashValue:   metahash,
+	}
 
-			// Send update to frontend
-			frontend.FBuffer.AddFrontendConstructingFile(localFilename, files.ToHex(metahash), "network")
+	// Send update to frontend
+	frontend.FBuffer.AddFrontendConstructingFile(localFilename, files.ToHex(metahash), "network")
 
-			// Send with timeout
-			ref := files.NewHashRef(shared, 0)
-			fail.LeveledPrint(0, "", "DOWNLOADING metafile of %s from %s", localFilename, metafileQueryPeer)
-			OnSendTimedDataRequest(g, request, ref, target)
-		}
-	}
+	// Try to download the chunks through a direct connection
+	go OnInitiateDirectConnection(g, metafileQueryPeer)
 
+	// Send with timeout
+	ref := files.NewHashRef(shared, 0)
+	logger.Files.Protocol("DOWNLOADING metafile of %s from %s", localFilename, metafileQueryPeer)
+	go OnSendTimedDataRequest(g, request, ref, target)
+	return nil
 }
@@ -0,0 +1,304 @@
+package network
+
+import (
+	"Peerster/dht"
+	"Peerster/entities"
+	"Peerster/fail"
+	"Peerster/files"
+	"Peerster/logger"
+	"Peerster/messages"
+	"Peerster/peers"
+	"Peerster/transport"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+const (
+	// DHTAlpha is the number of concurrent requests sent at each step of a lookup
+	DHTAlpha = 3
+	// DHTRPCTimeoutMs is the time after which an unanswered DHT request is considered lost
+	DHTRPCTimeoutMs = 500
+	// DHTRepublishIntervalSec is the interval of time between two publications of our provider records
+	DHTRepublishIntervalSec = 60
+)
+
+/* ================ DHT RPCs ================ */
+
+// OnSendDHTMessage sends a DHTMessage directly to a node.
+func OnSendDHTMessage(channel transport.Transport, msg *messages.DHTMessage, target *net.UDPAddr) error {
+
+	// Create the packet
+	pkt := messages.GossipPacket{DHT: msg}
+	buf, err := protobuf.Encode(&pkt)
+	if err != nil {
+		return &fail.CustomError{Fun: "OnSendDHTMessage", Desc: "failed to encode DHTMessage"}
+	}
+
+	// Send the packet
+	if err = channel.Send(buf, target); err != nil {
+		return &fail.CustomError{Fun: "OnSendDHTMessage", Desc: "failed to send DHTMessage"}
+	}
+	return nil
+}
+
+// dhtCall sends a DHT request to target and waits for the reply. The function returns nil on timeout.
+func dhtCall(gossiper *entities.Gossiper, kind uint32, key dht.Key, target *net.UDPAddr) *messages.DHTMessage {
+
+	// Register the RPC so that the dispatcher can forward us the reply
+	rpcID, com := gossiper.DHTRPCs.Register()
+	defer gossiper.DHTRPCs.Unregister(rpcID)
+
+	request := &messages.DHTMessage{
+		Origin: gossiper.Args.Name,
+		RPCID:  rpcID,
+		Kind:   kind,
+		Key:    key[:],
+	}
+	if err := OnSendDHTMessage(gossiper.GossipChannel, request, target); err != nil {
+		return nil
+	}
+
+	// Wait for the reply
+	select {
+	case reply := <-com:
+		return reply
+	case <-time.After(DHTRPCTimeoutMs * time.Millisecond):
+		return nil
+	}
+}
+
+// OnReceiveDHTMessage handles an incoming DHTMessage.
+func OnReceiveDHTMessage(gossiper *entities.Gossiper, msg *messages.DHTMessage, sender *net.UDPAddr) {
+
+	logger.Search.Info("OnReceiveDHTMessage", "%s", msg.DHTMessageToString(peers.UDPAddressToString(sender)))
+
+	// The sender is alive: add it to our k-buckets
+	gossiper.DHTTable.Update(msg.Origin, peers.UDPAddressToString(sender))
+
+	key, ok := dht.BytesToKey(msg.Key)
+	if !ok {
+		// Error: ignore the packet
+		return
+	}
+
+	switch msg.Kind {
+	case messages.DHTFindNode, messages.DHTFindValue:
+		reply := &messages.DHTMessage{
+			Origin:   gossiper.Args.Name,
+			RPCID:    msg.RPCID,
+			Kind:     messages.DHTReply,
+			Key:      msg.Key,
+			Contacts: contactsToMessage(gossiper.DHTTable.ClosestContacts(key, dht.BucketSize)),
+		}
+		if msg.Kind == messages.DHTFindValue {
+			reply.Providers = gossiper.DHTProviders.GetProviders(key)
+		}
+		OnSendDHTMessage(gossiper.GossipChannel, reply, sender)
+	case messages.DHTStore:
+		gossiper.DHTProviders.AddProviders(key, msg.Providers, peers.UDPAddressToString(sender))
+	case messages.DHTReply:
+		gossiper.DHTRPCs.Forward(msg)
+	default:
+		// Error: ignore the packet
+	}
+}
+
+// contactsToMessage converts a list of contacts to their wire representation.
+func contactsToMessage(contacts []*dht.Contact) []*messages.DHTContact {
+	ret := make([]*messages.DHTContact, len(contacts))
+	for i, c := range contacts {
+		ret[i] = &messages.DHTContact{Name: c.Name, Addr: c.Addr}
+	}
+	return ret
+}
+
+/* ================ LOOKUPS ================ */
+
+/*dhtLookup performs an iterative Kademlia lookup for key. At each step, up to `DHTAlpha` of the
+closest contacts that weren't queried yet are queried in parallel, and the contacts they return
+are merged into the shortlist. The lookup stops when the `dht.BucketSize` closest contacts have all
+been queried or, for a `DHTFindValue` lookup, as soon as providers are found.
+
+The function returns the providers found (only for `DHTFindValue`) and the closest contacts.*/
+func dhtLookup(gossiper *entities.Gossiper, key dht.Key, kind uint32) ([]*messages.DHTProvider, []*dht.Contact) {
+
+	shortlist := gossiper.DHTTable.ClosestContacts(key, dht.BucketSize)
+	seen := make(map[string]bool)
+	queried := make(map[string]bool)
+	for _, c := range shortlist {
+		seen[c.Name] = true
+	}
+
+	found := make(map[string]*messages.DHTProvider)
+
+	for {
+		// Pick the closest contacts that we haven't queried yet
+		batch := make([]*dht.Contact, 0, DHTAlpha)
+		for _, c := range shortlist {
+			if !queried[c.Name] {
+				batch = append(batch, c)
+				queried[c.Name] = true
+				if len(batch) == DHTAlpha {
+					break
+				}
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		// Query them in parallel
+		replies := make(chan *messages.DHTMessage, len(batch))
+		var wg sync.WaitGroup
+		for _, c := range batch {
+			wg.Add(1)
+			go func(c *dht.Contact) {
+				defer wg.Done()
+				target := peers.StringToUDPAddress(c.Addr)
+				if target == nil {
+					return
+				}
+				if reply := dhtCall(gossiper, kind, key, target); reply != nil {
+					replies <- reply
+				} else {
+					// The contact failed to answer
+					gossiper.DHTTable.Remove(c.Name)
+				}
+			}(c)
+		}
+		wg.Wait()
+		close(replies)
+
+		// Merge the replies
+		for reply := range replies {
+			for _, provider := range reply.Providers {
+				found[provider.Origin+":"+files.ToHex(provider.MetafileHash)] = provider
+			}
+			for _, c := range reply.Contacts {
+				if c.Name != gossiper.Args.Name && !seen[c.Name] {
+					seen[c.Name] = true
+					shortlist = append(shortlist, dht.NewContact(c.Name, c.Addr))
+				}
+			}
+		}
+		dht.SortByDistance(shortlist, key)
+		if len(shortlist) > dht.BucketSize {
+			shortlist = shortlist[:dht.BucketSize]
+		}
+
+		if kind == messages.DHTFindValue && len(found) > 0 {
+			break
+		}
+	}
+
+	providers := make([]*messages.DHTProvider, 0, len(found))
+	for _, provider := range found {
+		providers = append(providers, provider)
+	}
+	return providers, shortlist
+}
+
+// OnBootstrapDHT populates the k-buckets by asking our neighbors for the nodes closest to us.
+func OnBootstrapDHT(gossiper *entities.Gossiper) {
+
+	self := gossiper.DHTTable.Self()
+
+	// We only know our neighbors by address: their replies tell us their names
+	for _, target := range gossiper.PeerIndex.GetAllPeers() {
+		if !gossiper.Capabilities.Supports(target, messages.CapDHT) {
+			continue
+		}
+		if reply := dhtCall(gossiper, messages.DHTFindNode, self, target); reply != nil {
+			for _, c := range reply.Contacts {
+				gossiper.DHTTable.Update(c.Name, c.Addr)
+			}
+		}
+	}
+
+	// Look ourselves up to fill the buckets close to us
+	dhtLookup(gossiper, self, messages.DHTFindNode)
+}
+
+/* ================ PROVIDER RECORDS ================ */
+
+// publishProviderDHT stores a provider record under the file's metahash and under each of its keywords.
+func publishProviderDHT(gossiper *entities.Gossiper, provider *messages.DHTProvider) {
+
+	keys := make([]dht.Key, 0)
+	if key, ok := dht.BytesToKey(provider.MetafileHash); ok {
+		keys = append(keys, key)
+	}
+	for _, keyword := range dht.FilenameToKeywords(provider.Filename) {
+		keys = append(keys, dht.KeywordToKey(keyword))
+	}
+
+	for _, key := range keys {
+
+		// Keep a copy locally in case we are among the closest nodes
+		gossiper.DHTProviders.AddProviders(key, []*messages.DHTProvider{provider}, "")
+
+		// Store on the closest nodes
+		_, closest := dhtLookup(gossiper, key, messages.DHTFindNode)
+		store := &messages.DHTMessage{
+			Origin:    gossiper.Args.Name,
+			Kind:      messages.DHTStore,
+			Key:       key[:],
+			Providers: []*messages.DHTProvider{provider},
+		}
+		for _, c := range closest {
+			if target := peers.StringToUDPAddress(c.Addr); target != nil {
+				OnSendDHTMessage(gossiper.GossipChannel, store, target)
+			}
+		}
+	}
+}
+
+// OnPublishLocalFileDHT publishes a newly indexed local file in the DHT.
+func OnPublishLocalFileDHT(gossiper *entities.Gossiper, file *messages.File) {
+	publishProviderDHT(gossiper, &messages.DHTProvider{
+		Origin:       gossiper.Args.Name,
+		Addr:         gossiper.Args.GossipAddr,
+		Filename:     file.Name,
+		MetafileHash: file.MetafileHash,
+		ChunkCount:   files.GetChunksNumberFromRawFile(int(file.Size)),
+	})
+}
+
+// OnRepublishDHT refreshes the provider records of every file available locally.
+func OnRepublishDHT(gossiper *entities.Gossiper) {
+	for _, result := range gossiper.FileIndex.GetProvidedFiles() {
+		publishProviderDHT(gossiper, &messages.DHTProvider{
+			Origin:       gossiper.Args.Name,
+			Addr:         gossiper.Args.GossipAddr,
+			Filename:     result.Filename,
+			MetafileHash: result.MetafileHash,
+			ChunkCount:   result.ChunkCount,
+		})
+	}
+}
+
+/* ================ SEARCH ================ */
+
+/*OnInitiateDHTSearch looks up the providers of each keyword in the DHT. Keywords are matched
+against the lowercase alphanumeric tokens of published filenames (exact match). Found providers
+are handled exactly like `SearchResult`'s received in a `SearchReply`.*/
+func OnInitiateDHTSearch(gossiper *entities.Gossiper, keywords []string) {
+
+	for _, keyword := range keywords {
+		for _, token := range dht.FilenameToKeywords(keyword) {
+			providers, _ := dhtLookup(gossiper, dht.KeywordToKey(token), messages.DHTFindValue)
+
+			for _, provider := range providers {
+				if provider.Origin == gossiper.Args.Name {
+					continue
+				}
+
+				// Provider records are not authenticated: routes to the provider are only learnt from DSDV
+				handleSearchResult(gossiper, provider.ToSearchResult(), provider.Origin)
+			}
+		}
+	}
+}
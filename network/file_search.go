@@ -2,9 +2,10 @@ package network
 
 import (
 	"Peerster/entities"
-	"Peerster/fail"
 	"Peerster/files"
+	"Peerster/logger"
 	"Peerster/messages"
+	"Peerster/transport"
 	"net"
 	"sort"
 	"strconv"
@@ -18,10 +19,12 @@ const (
 	InitialBudget = uint64(2)
 	// MaximumBudget represents the maximum budget any SearchRequest can reach
 	MaximumBudget = uint64(32)
-	// SearchRepeatIntervalSec represents the interval of time between two consecutive SearchRequest's
+	// SearchRepeatIntervalSec represents the default interval of time between two consecutive SearchRequest's
 	SearchRepeatIntervalSec = 1
 	// ThresholdTotalMatches represents the number of total matches required to stop a SearchRequest
 	ThresholdTotalMatches = 2
+	// SearchReplyHopLimit represents the default hop limit of a SearchReply
+	SearchReplyHopLimit = 10
 )
 
 /* ================ SEARCH REQUEST ================ */
@@ -41,6 +44,9 @@ func OnInitiateFileSearch(gossiper *entities.Gossiper, defaultBudget uint64, key
 		initBudget = defaultBudget
 	}
 
+	// Look the keywords up in the DHT alongside the expanding-ring search
+	go OnInitiateDHTSearch(gossiper, keywords)
+
 	// Create a SearchRequest
 	search := &messages.SearchRequest{
 		Origin:   gossiper.Args.Name,
@@ -80,9 +86,9 @@ func OnInitiateFileSearch(gossiper *entities.Gossiper, defaultBudget uint64, key
 			}
 
 			// Wait some time and check the number of total matches
-			time.Sleep(SearchRepeatIntervalSec * time.Second)
+			time.Sleep(time.Duration(gossiper.Args.SearchInterval) * time.Second)
 			if gossiper.SReqTotalMatch.CheckThresholdAndDelete(search, ThresholdTotalMatches) {
-				fail.LeveledPrint(0, "", "SEARCH FINISHED")
+				logger.Search.Protocol("SEARCH FINISHED")
 				return
 			}
 
@@ -104,7 +110,7 @@ func OnInitiateFileSearch(gossiper *entities.Gossiper, defaultBudget uint64, key
 }
 
 // OnSendSearchRequest sends a SearchRequest on the network.
-func OnSendSearchRequest(channel *net.UDPConn, search *messages.SearchRequest, target *net.UDPAddr) {
+func OnSendSearchRequest(channel transport.Transport, search *messages.SearchRequest, target *net.UDPAddr) {
 
 	// Create the packet
 	pkt := messages.GossipPacket{SearchRequest: search}
@@ -114,7 +120,7 @@ func OnSendSearchRequest(channel *net.UDPConn, search *messages.SearchRequest, t
 	}
 
 	// Send the packet
-	channel.WriteToUDP(buf, target)
+	channel.Send(buf, target)
 
 }
 
@@ -165,7 +171,7 @@ func OnReceiveSearchRequest(gossiper *entities.Gossiper, search *messages.Search
 	reply := &messages.SearchReply{
 		Origin:      gossiper.Args.Name,
 		Destination: search.Origin,
-		HopLimit:    10,
+		HopLimit:    gossiper.Args.SearchHopLimit,
 		Results:     gossiper.FileIndex.HandleSearchRequest(search),
 	}
 
@@ -176,15 +182,39 @@ func OnReceiveSearchRequest(gossiper *entities.Gossiper, search *messages.Search
 
 	// Set up timeout for particular request and delete it after 0.5 second
 	if gossiper.TOSearchRequest.AddSearchRequest(search) {
-		time.Sleep(500 * time.Millisecond)
-		gossiper.TOSearchRequest.RemoveSearchRequest(search)
+		time.AfterFunc(500*time.Millisecond, func() { gossiper.TOSearchRequest.RemoveSearchRequest(search) })
 	}
 }
 
 /* ================ SEARCH REPLY ================ */
 
+// handleSearchResult prints a SearchResult and updates the file index with its chunk mappings.
+func handleSearchResult(gossiper *entities.Gossiper, result *messages.SearchResult, origin string) {
+
+	// Create sorted list of chunk indices
+	sort.Slice(result.ChunkMap, func(i, j int) bool { return result.ChunkMap[i] < result.ChunkMap[j] })
+	strChunkMap := ""
+	for _, index := range result.ChunkMap {
+		strChunkMap += strconv.FormatUint(index, 10) + ","
+	}
+	if len(strChunkMap) > 0 {
+		strChunkMap = strChunkMap[:len(strChunkMap)-1]
+	}
+
+	// Print to the console
+	logger.Search.Protocol("FOUND match %s at %s metafile=%s chunks=%s",
+		result.Filename, origin, files.ToHex(result.MetafileHash[:]), strChunkMap)
+
+	// Handle the SearchResult, and record it for the searches looking for it
+	gossiper.SearchMatches.AddResult(result.Filename, files.ToHex(result.MetafileHash[:]))
+	if gossiper.FileIndex.HandleSearchResult(result, origin) {
+		// We just had a total match
+		gossiper.SReqTotalMatch.UpdateIndexOnTotalMatch(result.Filename)
+	}
+}
+
 // OnSendSearchReply sends a SearchReply on the network.
-func OnSendSearchReply(channel *net.UDPConn, reply *messages.SearchReply, target *net.UDPAddr) {
+func OnSendSearchReply(channel transport.Transport, reply *messages.SearchReply, target *net.UDPAddr) {
 
 	// Create the packet
 	pkt := messages.GossipPacket{SearchReply: reply}
@@ -194,7 +224,7 @@ func OnSendSearchReply(channel *net.UDPConn, reply *messages.SearchReply, target
 	}
 
 	// Send the packet
-	channel.WriteToUDP(buf, target)
+	channel.Send(buf, target)
 
 }
 
@@ -208,26 +238,7 @@ func OnReceiveSearchReply(gossiper *entities.Gossiper, reply *messages.SearchRep
 
 	if gossiper.Args.Name == reply.Destination { // Message is for me
 		for _, result := range reply.Results { // For each result
-
-			// Create sorted list of chunk indices
-			sort.Slice(result.ChunkMap, func(i, j int) bool { return result.ChunkMap[i] < result.ChunkMap[j] })
-			strChunkMap := ""
-			for _, index := range result.ChunkMap {
-				strChunkMap += strconv.FormatUint(index, 10) + ","
-			}
-			if len(strChunkMap) > 0 {
-				strChunkMap = strChunkMap[:len(strChunkMap)-1]
-			}
-
-			// Print to the console
-			fail.LeveledPrint(0, "", "FOUND match %s at %s metafile=%s chunks=%s",
-				result.Filename, reply.Origin, files.ToHex(result.MetafileHash[:]), strChunkMap)
-
-			// Handle the SearchResult
-			if gossiper.FileIndex.HandleSearchResult(result, reply.Origin) {
-				// We just had a total match
-				gossiper.SReqTotalMatch.UpdateIndexOnTotalMatch(result.Filename)
-			}
+			handleSearchResult(gossiper, result, reply.Origin)
 		}
 
 	} else { // Message is for someone else
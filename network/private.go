@@ -2,13 +2,17 @@ package network
 
 import (
 	"Peerster/entities"
-	"Peerster/fail"
+	"Peerster/logger"
 	"Peerster/messages"
 	"net"
 
 	"github.com/dedis/protobuf"
 )
 
+// DefaultHopLimit is the default hop limit of the messages routed to a single peer (private messages, data
+// requests and replies, NAT traversal messages)
+const DefaultHopLimit = 16
+
 // OnSendPrivate - Sends a private message
 func OnSendPrivate(g *entities.Gossiper, private *messages.PrivateMessage, target *net.UDPAddr) {
 
@@ -20,7 +24,7 @@ func OnSendPrivate(g *entities.Gossiper, private *messages.PrivateMessage, targe
 	}
 
 	// Send the packet
-	g.GossipChannel.WriteToUDP(buf, target)
+	g.GossipChannel.Send(buf, target)
 }
 
 // OnReceiveClientPrivate - Called when a private message is received from the client
@@ -29,7 +33,7 @@ func OnReceiveClientPrivate(g *entities.Gossiper, private *messages.PrivateMessa
 	// Fill in remaining fields
 	private.Origin = g.Args.Name
 	private.ID = 0
-	private.HopLimit = 16
+	private.HopLimit = g.Args.HopLimit
 
 	// Add the message
 	g.NameIndex.AddPrivateMessage(private)
@@ -51,8 +55,13 @@ func OnReceivePrivate(g *entities.Gossiper, private *messages.PrivateMessage, se
 
 	// Check if the message is for me
 	if g.Args.Name == private.Destination {
-		fail.LeveledPrint(0, "", private.PrivateMessageToString())
+		logger.Gossip.Protocol("%s", private.PrivateMessageToString())
 		g.NameIndex.AddPrivateMessage(private)
+
+		// Invitations to a channel
+		if private.Channel != "" {
+			onReceiveChannelInvite(g, private)
+		}
 		return
 	}
 
@@ -0,0 +1,174 @@
+package network
+
+import (
+	"Peerster/entities"
+	"Peerster/fail"
+	"Peerster/logger"
+	"Peerster/messages"
+	"Peerster/peers"
+	"net"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+const (
+	// PunchPingCount is the number of pings sent to a candidate address during hole punching
+	PunchPingCount = 5
+	// PunchPingIntervalMs is the interval between two pings sent during hole punching
+	PunchPingIntervalMs = 200
+)
+
+// OnSendPunch - Sends a NAT traversal message
+func OnSendPunch(g *entities.Gossiper, punch *messages.PunchMessage, target *net.UDPAddr) error {
+
+	// Create the packet
+	pkt := messages.GossipPacket{Punch: punch}
+	buf, err := protobuf.Encode(&pkt)
+	if err != nil {
+		return &fail.CustomError{Fun: "OnSendPunch", Desc: "failed to encode PunchMessage"}
+	}
+
+	// Send the packet
+	if err := g.GossipChannel.Send(buf, target); err != nil {
+		return &fail.CustomError{Fun: "OnSendPunch", Desc: "failed to send PunchMessage"}
+	}
+	return nil
+}
+
+// getPublicAddr - Returns our public address as observed by our neighbors, or our local one if unknown
+func getPublicAddr(g *entities.Gossiper) string {
+	if observed := g.DirectLinks.GetObservedSelf(); observed != "" {
+		return observed
+	}
+	return g.Args.GossipAddr
+}
+
+// getTransferTarget - Returns the direct address of a peer if we have a live direct link with it, or
+// the next hop towards it otherwise
+func getTransferTarget(g *entities.Gossiper, name string) *net.UDPAddr {
+	if target := g.DirectLinks.GetDirectTarget(name); target != nil {
+		return target
+	}
+	return g.Router.GetTarget(name)
+}
+
+// OnInitiateDirectConnection - Attempts to open a direct connection with a distant peer, so that heavy
+// flows don't load the relays. The request is routed, the punching itself is done by both ends.
+func OnInitiateDirectConnection(g *entities.Gossiper, name string) {
+
+	// Neighbors are already reached directly
+	target := g.Router.GetTarget(name)
+	if target == nil || g.Router.GetHopCount(name) == 1 || !g.Capabilities.Supports(target, messages.CapPunch) ||
+		!g.DirectLinks.ShouldAttempt(name) {
+		return
+	}
+
+	request := &messages.PunchMessage{
+		Origin:      g.Args.Name,
+		Destination: name,
+		HopLimit:    g.Args.HopLimit,
+		Kind:        messages.PunchRequest,
+		Addr:        getPublicAddr(g),
+	}
+	logger.Transport.Info("OnInitiateDirectConnection", "PUNCH REQUEST to %s from %s", name, request.Addr)
+	OnSendPunch(g, request, target)
+}
+
+// punchRoutine - Pings a candidate address of a distant peer until the direct link is established
+func punchRoutine(g *entities.Gossiper, name string, candidate *net.UDPAddr) {
+
+	nonce := g.DirectLinks.AddCandidate(name, candidate)
+	ping := &messages.PunchMessage{Origin: g.Args.Name, Destination: name, Kind: messages.PunchPing, Nonce: nonce}
+	for i := 0; i < PunchPingCount; i++ {
+		if g.DirectLinks.GetDirectTarget(name) != nil {
+			return
+		}
+		OnSendPunch(g, ping, candidate)
+		time.Sleep(PunchPingIntervalMs * time.Millisecond)
+	}
+}
+
+// OnReceivePunch - Called when a NAT traversal message is received
+func OnReceivePunch(g *entities.Gossiper, punch *messages.PunchMessage, sender *net.UDPAddr) {
+
+	logger.Transport.Info("OnReceivePunch", "%s", punch.PunchMessageToString(peers.UDPAddressToString(sender)))
+
+	if punch.Origin == g.Args.Name {
+		return
+	}
+
+	switch punch.Kind {
+	case messages.PunchPing, messages.PunchPong:
+		// Direct messages: ignore them if they were misdelivered
+		if punch.Destination != g.Args.Name {
+			return
+		}
+
+		if punch.Kind == messages.PunchPing {
+			pong := &messages.PunchMessage{Origin: g.Args.Name, Destination: punch.Origin, Kind: messages.PunchPong,
+				Nonce: punch.Nonce}
+			OnSendPunch(g, pong, sender)
+		} else {
+			// The path works both ways, but only pongs to our own pings count (forged ones are dropped)
+			wasDirect := g.DirectLinks.GetDirectTarget(punch.Origin) != nil
+			if !g.DirectLinks.ConfirmPong(punch.Origin, punch.Nonce, sender) {
+				logger.Transport.Debug("OnReceivePunch", "UNEXPECTED PONG from %s for %s", peers.UDPAddressToString(sender), punch.Origin)
+				return
+			}
+			if !wasDirect {
+				logger.Transport.Protocol("DIRECT LINK %s %s", punch.Origin, peers.UDPAddressToString(sender))
+			}
+		}
+
+	case messages.PunchRequest, messages.PunchReply:
+		// Routed messages
+		route := g.Router.GetTarget(punch.Origin)
+		g.Router.AddContactIfAbsent(punch.Origin, sender)
+
+		if punch.Destination != g.Args.Name {
+			// Decrement hop limit and relay if not exhausted
+			punch.HopLimit--
+			if punch.HopLimit != 0 {
+				target := g.Router.GetTarget(punch.Destination)
+				if target != nil && g.Capabilities.Supports(target, messages.CapPunch) {
+					OnSendPunch(g, punch, target)
+				}
+			}
+			return
+		}
+
+		candidate := peers.StringToUDPAddress(punch.Addr)
+		if candidate == nil {
+			return
+		}
+
+		// Nothing authenticates the origin: only the route we already have towards it may carry its
+		// requests, and its addresses are pinged at most once in a while (so that we don't reflect floods)
+		if route == nil || !peers.CompareUDPAddress(route, sender) {
+			logger.Transport.Debug("OnReceivePunch", "PUNCH from %s not on the route to %s", peers.UDPAddressToString(sender), punch.Origin)
+			return
+		}
+		if !g.DirectLinks.AllowPunch(punch.Origin) {
+			logger.Transport.Debug("OnReceivePunch", "PUNCH from %s rate limited", punch.Origin)
+			return
+		}
+
+		if punch.Kind == messages.PunchRequest {
+			// Accept the request and advertise our own address
+			if g.Capabilities.Supports(route, messages.CapPunch) {
+				reply := &messages.PunchMessage{
+					Origin:      g.Args.Name,
+					Destination: punch.Origin,
+					HopLimit:    g.Args.HopLimit,
+					Kind:        messages.PunchReply,
+					Addr:        getPublicAddr(g),
+				}
+				OnSendPunch(g, reply, route)
+			}
+		}
+
+		// Both ends ping each other to open their NAT mappings (in the background, the pings are spaced)
+		go punchRoutine(g, punch.Origin, candidate)
+	}
+}
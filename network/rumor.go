@@ -3,9 +3,10 @@ package network
 import (
 	"Peerster/entities"
 	"Peerster/fail"
+	"Peerster/frontend"
+	"Peerster/logger"
 	"Peerster/messages"
 	"Peerster/peers"
-	"fmt"
 	"math/rand"
 	"net"
 	"time"
@@ -30,20 +31,32 @@ func OnSendRouteRumor(g *entities.Gossiper, threadID uint32) {
 	}
 }
 
+// advertiseRumor - Returns a copy of a rumor advertising our own distance to its origin (the rumor itself
+// may be shared with other threads)
+func advertiseRumor(g *entities.Gossiper, rumor *messages.RumorMessage) *messages.RumorMessage {
+	advertised := *rumor
+	if rumor.Origin == g.Args.Name {
+		advertised.HopCount = 0
+	} else {
+		advertised.HopCount = g.Router.GetHopCount(rumor.Origin)
+	}
+	return &advertised
+}
+
 // OnSendRumor - Sends a rumor
 func OnSendRumor(g *entities.Gossiper, rumor *messages.RumorMessage, target *net.UDPAddr, threadID uint32) error {
 
 	// Create the packet
-	pkt := messages.GossipPacket{Rumor: rumor}
+	pkt := messages.GossipPacket{Rumor: advertiseRumor(g, rumor)}
 	buf, err := protobuf.Encode(&pkt)
 	if err != nil {
 		return &fail.CustomError{Fun: "OnSendRumor", Desc: "failed to encode RumorMessage"}
 	}
 
 	// Send the packet
-	fail.LeveledPrint(0, "", "MONGERING with %s", fmt.Sprintf("%s", target))
-	if _, err = g.GossipChannel.WriteToUDP(buf, target); err != nil {
-		g.Timeouts.DeleteTimeoutHandler(threadID)
+	logger.Gossip.Protocol("MONGERING with %s", target)
+	if err = g.GossipChannel.Send(buf, target); err != nil {
+		// The timeout handler isn't allocated yet: the thread simply stops
 		return &fail.CustomError{Fun: "OnSendRumor", Desc: "failed to send RumorMessage"}
 	}
 
@@ -53,47 +66,74 @@ func OnSendRumor(g *entities.Gossiper, rumor *messages.RumorMessage, target *net
 	to forward us the StatusPacket response */
 	g.Timeouts.AddTimeoutHandler(threadID, target)
 
-	// Create a timeout timer
-	timer := time.NewTicker(time.Second)
+	// Pick up the response when the timeout expires (the caller, e.g. a worker, isn't kept waiting)
+	time.AfterFunc(time.Second, func() { onRumorTimeout(g, rumor, target, threadID) })
 
-	// Wait for the timeout
-	select {
-	case <-timer.C: // Timeout expired
-	}
+	return nil
+}
 
-	// Stop the timer
-	timer.Stop()
+// onRumorTimeout - Called when the timeout of a sent rumor expires: goes on with the status response, or
+// flips a coin to spread the rumor to someone else
+func onRumorTimeout(g *entities.Gossiper, rumor *messages.RumorMessage, target *net.UDPAddr, threadID uint32) {
 
-	response := g.Timeouts.DeleteTimeoutHandler(threadID)
+	response, rtt := g.Timeouts.DeleteTimeoutHandler(threadID)
 	if response == nil { // The response did not arrive on time
 
 		if rand.Int()%2 == 0 { // Flip a coin
-			return nil // Stop the thread
+			return // Stop the thread
 		}
 
 		// Spread the rumor to someone else
 
 		if newTarget := g.PeerIndex.GetRandomPeer(target); newTarget != nil {
-			fail.LeveledPrint(0, "", "FLIPPED COIN sending rumor to %s", peers.UDPAddressToString(newTarget))
+			logger.Gossip.Protocol("FLIPPED COIN sending rumor to %s", peers.UDPAddressToString(newTarget))
 			OnSendRumor(g, rumor, newTarget, threadID)
 		}
 
 	} else { // We received a status response
+		g.PeerIndex.RecordRTT(target, rtt)
 		OnReceiveStatus(g, response, target, threadID)
 	}
-
-	return nil
 }
 
 // OnReceiveClientRumor - Called when a rumor is received from the client
 func OnReceiveClientRumor(g *entities.Gossiper, rumor *messages.RumorMessage, threadID uint32) {
+	if err := PostClientRumor(g, rumor); err != nil {
+		logger.Gossip.Error("OnReceiveClientRumor", "%s", err.Error())
+		return
+	}
+	SpreadClientRumor(g, rumor, threadID)
+}
+
+// PostClientRumor - Stores a rumor from the client, filling in its origin and ID
+func PostClientRumor(g *entities.Gossiper, rumor *messages.RumorMessage) error {
+	if rumor.Text == "" {
+		// An empty rumor would be taken for a route rumor
+		return &fail.CustomError{Fun: "PostClientRumor", Desc: "empty message"}
+	}
+
+	// Channel messages are only posted in joined channels, encrypted if needed
+	plaintext := rumor.Text
+	if rumor.Channel != "" {
+		if err := sealChannelRumor(g, rumor); err != nil {
+			return err
+		}
+	}
 
 	// Print to console
-	fail.LeveledPrint(0, "", "CLIENT MESSAGE %s", rumor.Text)
-	fail.LeveledPrint(0, "", g.PeerIndex.PeersToString())
+	logger.Gossip.Protocol("CLIENT MESSAGE %s", plaintext)
+	logger.Gossip.Protocol("%s", g.PeerIndex.PeersToString())
 
 	// Store the new message
 	g.NameIndex.FillInRumorAndSave(rumor, g.Args.Name)
+	if rumor.Channel != "" {
+		frontend.FBuffer.AddFrontendChannelMessage(rumor.Channel, g.Args.Name, plaintext)
+	}
+	return nil
+}
+
+// SpreadClientRumor - Starts mongering a rumor stored by PostClientRumor
+func SpreadClientRumor(g *entities.Gossiper, rumor *messages.RumorMessage, threadID uint32) {
 
 	// There is no risk to propagate back to ourself
 	target := g.PeerIndex.GetRandomPeer(nil)
@@ -112,22 +152,19 @@ func OnReceiveRumor(g *entities.Gossiper, rumor *messages.RumorMessage, sender *
 	// Is the message a RouteRumor ?
 	isRouteRumor := (rumor.Text == "")
 
-	if !isRouteRumor {
-		fail.LeveledPrint(0, "", rumor.RumorMessageToString(peers.UDPAddressToString(sender)))
-		fail.LeveledPrint(0, "", g.PeerIndex.PeersToString())
+	if !isRouteRumor && rumor.Channel == "" {
+		logger.Gossip.Protocol("%s", rumor.RumorMessageToString(peers.UDPAddressToString(sender)))
+		logger.Gossip.Protocol("%s", g.PeerIndex.PeersToString())
 	}
 
-	// Update the routing table for private messages
-	if rumor.Origin != g.Args.Name {
-		g.Router.UpdateTableAndPrint(rumor.Origin, sender, rumor.ID)
+	// Update the routing table and store the new message (channel messages are surfaced if joined)
+	if storeRumor(g, rumor, sender) && rumor.Channel != "" {
+		surfaceChannelRumor(g, rumor, sender)
 	}
 
-	// Store the new message
-	g.NameIndex.AddMessageIfNext(rumor)
-
 	// Reply with status message
 	vectorClock := g.NameIndex.GetVectorClock()
-	OnSendStatus(vectorClock, g.GossipChannel, sender)
+	OnSendStatus(g, vectorClock, sender)
 
 	// Prevent the sender from being selected
 	target := g.PeerIndex.GetRandomPeer(sender)
@@ -139,3 +176,64 @@ func OnReceiveRumor(g *entities.Gossiper, rumor *messages.RumorMessage, sender *
 	// Propagate rumor
 	OnSendRumor(g, rumor, target, threadID)
 }
+
+// storeRumor - Updates the routing table with a received rumor and stores it if it is the next one
+func storeRumor(g *entities.Gossiper, rumor *messages.RumorMessage, sender *net.UDPAddr) bool {
+
+	// Update the routing table for private messages (the sender is one hop further from the origin)
+	if rumor.Origin != g.Args.Name {
+		hopCount := rumor.HopCount + 1
+		if !g.Capabilities.Supports(sender, messages.CapHopCount) {
+			// Legacy relayers don't fill the hop count in
+			hopCount = peers.LegacyHopCount
+		}
+		g.Router.UpdateTableAndPrint(rumor.Origin, sender, rumor.ID, hopCount)
+	}
+
+	// Store the new message
+	return g.NameIndex.AddMessageIfNext(rumor)
+}
+
+// OnSendRumorBatch - Sends several rumors to a peer at once
+func OnSendRumorBatch(g *entities.Gossiper, rumors []*messages.RumorMessage, target *net.UDPAddr) error {
+
+	batch := &messages.RumorBatch{Rumors: make([]*messages.RumorMessage, len(rumors))}
+	for i, rumor := range rumors {
+		batch.Rumors[i] = advertiseRumor(g, rumor)
+	}
+
+	// Create the packet
+	pkt := messages.GossipPacket{Batch: batch}
+	buf, err := protobuf.Encode(&pkt)
+	if err != nil {
+		return &fail.CustomError{Fun: "OnSendRumorBatch", Desc: "failed to encode RumorBatch"}
+	}
+
+	// Send the packet
+	logger.Gossip.Info("OnSendRumorBatch", "BATCH of %d rumors to %s", len(rumors), peers.UDPAddressToString(target))
+	if err = g.GossipChannel.Send(buf, target); err != nil {
+		return &fail.CustomError{Fun: "OnSendRumorBatch", Desc: "failed to send RumorBatch"}
+	}
+	return nil
+}
+
+// OnReceiveRumorBatch - Called when a batch of rumors is received. The rumors aren't mongered further:
+// they are old news that anti-entropy will keep spreading.
+func OnReceiveRumorBatch(g *entities.Gossiper, batch *messages.RumorBatch, sender *net.UDPAddr) {
+
+	for _, rumor := range batch.Rumors {
+		if rumor == nil {
+			continue
+		}
+		if rumor.Text != "" && rumor.Channel == "" {
+			logger.Gossip.Protocol("%s", rumor.RumorMessageToString(peers.UDPAddressToString(sender)))
+		}
+		if storeRumor(g, rumor, sender) && rumor.Channel != "" {
+			surfaceChannelRumor(g, rumor, sender)
+		}
+	}
+	logger.Gossip.Protocol("%s", g.PeerIndex.PeersToString())
+
+	// Reply with status message, the sender will send the next batch if needed
+	OnSendStatus(g, g.NameIndex.GetVectorClock(), sender)
+}
@@ -0,0 +1,57 @@
+package network
+
+import (
+	"Peerster/blockchain"
+	"Peerster/entities"
+	"Peerster/files"
+	"Peerster/logger"
+	"Peerster/messages"
+)
+
+/*OnIndexLocalFile indexes a file of the shared folder, signs and broadcasts its claim transaction (with the
+given hop limit) and advertises it in the DHT. The function returns nil if the file can't be read or is
+already indexed.*/
+func OnIndexLocalFile(gossiper *entities.Gossiper, filename string, hopLimit uint32) *messages.File {
+	file := gossiper.FileIndex.AddLocalFile(filename)
+	if file == nil {
+		return nil
+	}
+
+	// Sign the claim, broadcast the transaction and publish to the blockchain
+	if tx := blockchain.FileToNewTx(file, gossiper.Keys); tx != nil {
+		OnReceiveTransaction(gossiper, tx.ToTxPublish(hopLimit), nil)
+	}
+
+	// Advertise the file in the DHT
+	go OnPublishLocalFileDHT(gossiper, file)
+	return file
+}
+
+/*OnSharedFolderEvents keeps the file index in sync with the changes detected in the shared folder: new
+files are indexed, modified files are indexed again (with a new metahash and a new claim) and deleted
+files are unindexed.*/
+func OnSharedFolderEvents(gossiper *entities.Gossiper, events []files.FolderEvent) {
+	for _, event := range events {
+		switch event.Kind {
+		case files.FileAdded:
+			// Files uploaded through the webserver are already indexed
+			if _, ok := gossiper.FileIndex.GetIndexedLocalFile(event.Filename); ok {
+				continue
+			}
+		case files.FileModified, files.FileRemoved:
+			gossiper.FileIndex.RemoveLocalFile(event.Filename)
+		}
+
+		if event.Kind == files.FileRemoved {
+			logger.Files.Protocol("SHARED FOLDER %s %s", event.Kind, event.Filename)
+			continue
+		}
+		if file := OnIndexLocalFile(gossiper, event.Filename, gossiper.Args.TxHopLimit+1); file != nil {
+			logger.Files.Protocol("SHARED FOLDER %s %s metahash %s", event.Kind, event.Filename,
+				files.ToHex(file.MetafileHash))
+		} else {
+			logger.Files.Protocol("SHARED FOLDER %s %s not indexed (too big or duplicate)", event.Kind,
+				event.Filename)
+		}
+	}
+}
@@ -3,15 +3,34 @@ package network
 import (
 	"Peerster/entities"
 	"Peerster/fail"
+	"Peerster/logger"
 	"Peerster/messages"
 	"Peerster/peers"
+	"bytes"
 	"net"
 
 	"github.com/dedis/protobuf"
 )
 
-// OnSendStatus - Sends a status
-func OnSendStatus(vectorClock *messages.StatusPacket, channel *net.UDPConn, target *net.UDPAddr) error {
+const (
+	// MaxBatchRumors is the maximum number of rumors sent in a single batch
+	MaxBatchRumors = 256
+	// MaxBatchBytes is the approximate maximum amount of text sent in a single batch
+	MaxBatchBytes = 256 * 1024
+)
+
+// OnSendStatus - Sends a status (with our membership information piggybacked)
+func OnSendStatus(g *entities.Gossiper, vectorClock *messages.StatusPacket, target *net.UDPAddr) error {
+
+	// Piggyback our heartbeat and a sample of our neighbors
+	g.PeerIndex.FillMembership(vectorClock, target)
+
+	// Tell the target how we see it (NAT traversal)
+	vectorClock.Observed = peers.UDPAddressToString(target)
+
+	// Advertise our protocol version and features
+	vectorClock.Version = messages.ProtocolVersion
+	vectorClock.Capabilities = messages.LocalCapabilities(g.SecureLinks != nil && g.SecureLinks.CanBeSecure(vectorClock.Observed))
 
 	// Create the packet
 	pkt := messages.GossipPacket{Status: vectorClock}
@@ -21,28 +40,72 @@ func OnSendStatus(vectorClock *messages.StatusPacket, channel *net.UDPConn, targ
 	}
 
 	// Send the packet
-	if _, err = channel.WriteToUDP(buf, target); err != nil {
+	if err = g.GossipChannel.Send(buf, target); err != nil {
 		return &fail.CustomError{Fun: "OnSendStatus", Desc: "failed to send StatusPacket"}
 	}
 	return nil
 }
 
+// OnSendDigest - Sends the digest of our vector clock (anti-entropy). Neighbors that aren't known to
+// understand digests get the whole vector clock.
+func OnSendDigest(g *entities.Gossiper, target *net.UDPAddr) error {
+	vectorClock := g.NameIndex.GetVectorClock()
+	if g.Capabilities.Supports(target, messages.CapDigest) {
+		vectorClock = &messages.StatusPacket{Digest: vectorClock.Digest}
+	}
+	return OnSendStatus(g, vectorClock, target)
+}
+
+// OnProbePeer - Sends a liveness probe to a suspected peer
+func OnProbePeer(g *entities.Gossiper, target *net.UDPAddr) {
+	vectorClock := g.NameIndex.GetVectorClock()
+	vectorClock.Probe = true
+	OnSendStatus(g, vectorClock, target)
+}
+
 // OnReceiveStatus - Called when a status is received
 func OnReceiveStatus(g *entities.Gossiper, status *messages.StatusPacket, sender *net.UDPAddr, threadID uint32) {
 
+	// Only exchange vector clocks if the digests differ
+	if status.IsDigestOnly() {
+		vectorClock := g.NameIndex.GetVectorClock()
+		if bytes.Equal(status.Digest, vectorClock.Digest) {
+			logger.Gossip.Info("OnReceiveStatus", "IN SYNC WITH %s (digest)", peers.UDPAddressToString(sender))
+		}
+		if status.Probe || !bytes.Equal(status.Digest, vectorClock.Digest) {
+			OnSendStatus(g, vectorClock, sender)
+		}
+		return
+	}
+
 	// Print to the console
-	fail.LeveledPrint(0, "", status.StatusPacketToString(peers.UDPAddressToString(sender)))
-	fail.LeveledPrint(0, "", g.PeerIndex.PeersToString())
+	logger.Gossip.Protocol("%s", status.StatusPacketToString(peers.UDPAddressToString(sender)))
+	logger.Gossip.Protocol("%s", g.PeerIndex.PeersToString())
+
+	// Answer liveness probes
+	replied := false
+	if status.Probe {
+		OnSendStatus(g, g.NameIndex.GetVectorClock(), sender)
+		replied = true
+	}
+
+	// Send everything the sender misses at once if it supports it
+	if g.Capabilities.Supports(sender, messages.CapBatch) {
+		if missing := g.NameIndex.GetMissingRumors(status, MaxBatchRumors, MaxBatchBytes); len(missing) > 0 {
+			OnSendRumorBatch(g, missing, sender)
+			return
+		}
+	}
 
 	// See if we must propagate a rumor
 	rumorToPropagate := g.NameIndex.GetUnknownMessageTarget(status)
 
 	if rumorToPropagate == nil { // We don't have anything to propagate
 		if g.NameIndex.IsLocalStatusComplete(status) { // We are in sync with the other
-			fail.LeveledPrint(0, "", "IN SYNC WITH %s", peers.UDPAddressToString(sender))
-		} else { // We must send back our own Status
+			logger.Gossip.Protocol("IN SYNC WITH %s", peers.UDPAddressToString(sender))
+		} else if !replied { // We must send back our own Status
 			vectorClock := g.NameIndex.GetVectorClock()
-			OnSendStatus(vectorClock, g.GossipChannel, sender)
+			OnSendStatus(g, vectorClock, sender)
 		}
 	} else { // We must propagate a rumor to the sender
 		OnSendRumor(g, rumorToPropagate, sender, threadID)
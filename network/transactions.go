@@ -3,18 +3,18 @@ package network
 import (
 	"Peerster/blockchain"
 	"Peerster/entities"
+	"Peerster/logger"
 	"Peerster/messages"
 	"Peerster/utils"
-	"fmt"
 	"net"
 
 	"github.com/dedis/protobuf"
 )
 
-// TransactionHopLimit is the hop limit for TxPublish
+// TransactionHopLimit is the default hop limit for TxPublish
 const TransactionHopLimit = 10
 
-// BlockHopLimit is the hop limit for BlockPublish and BlockReply
+// BlockHopLimit is the default hop limit for BlockPublish and BlockReply
 const BlockHopLimit = 20
 
 // BlockRequestBudget is the default budget assigned to look for a block
@@ -29,7 +29,7 @@ func OnBroadcastTransaction(gossiper *entities.Gossiper, tx *messages.TxPublish)
 	pkt := messages.GossipPacket{TxPublish: tx}
 	buf, err := protobuf.Encode(&pkt)
 	if err != nil {
-		fmt.Println(err)
+		logger.Chain.Error("OnBroadcastTransaction", "%s", err.Error())
 		return
 	}
 
@@ -62,14 +62,14 @@ func OnBroadcastBlock(gossiper *entities.Gossiper, block *messages.Block) {
 	// Create a BlockPublish
 	publish := &messages.BlockPublish{
 		Block:    block,
-		HopLimit: BlockHopLimit,
+		HopLimit: gossiper.Args.BlockHopLimit,
 	}
 
 	// Create the packet
 	pkt := messages.GossipPacket{BlockPublish: publish}
 	buf, err := protobuf.Encode(&pkt)
 	if err != nil {
-		fmt.Println(err)
+		logger.Chain.Error("OnBroadcastBlock", "%s", err.Error())
 		return
 	}
 
@@ -123,7 +123,7 @@ func OnReceiveBlockRequest(gossiper *entities.Gossiper, request *messages.BlockR
 	// Therefore we will just send the latest block mined
 	if len(request.BlockHash) == 0 && gossiper.Blockchain.Head != nil && gossiper.Blockchain.Head.Previous != nil {
 
-		fmt.Printf("RECEIVED CHAIN REQUEST from %s\n", request.Origin)
+		logger.Chain.Info("OnReceiveBlockRequest", "RECEIVED CHAIN REQUEST from %s", request.Origin)
 
 		blocksFound = append(blocksFound, gossiper.Blockchain.GetBlock(gossiper.Blockchain.Head.Previous.Hash).Block)
 
@@ -131,7 +131,7 @@ func OnReceiveBlockRequest(gossiper *entities.Gossiper, request *messages.BlockR
 		reply := &messages.BlockReply{
 			Destination: request.Origin,
 			Block:       blocksFound,
-			HopLimit:    BlockHopLimit,
+			HopLimit:    gossiper.Args.BlockHopLimit,
 		}
 
 		OnReceiveBlockReply(gossiper, reply, sender)
@@ -140,7 +140,7 @@ func OnReceiveBlockRequest(gossiper *entities.Gossiper, request *messages.BlockR
 		return
 	}
 
-	fmt.Printf("RECEIVED BLOCK REQUEST from %s asking for %d blocks\n", request.Origin, len(request.BlockHash))
+	logger.Chain.Info("OnReceiveBlockRequest", "RECEIVED BLOCK REQUEST from %s asking for %d blocks", request.Origin, len(request.BlockHash))
 
 	// Holds the hashes of the blocks to broadcast (the ones we don't have)
 	var newRequest [][32]byte
@@ -164,7 +164,7 @@ func OnReceiveBlockRequest(gossiper *entities.Gossiper, request *messages.BlockR
 		reply := &messages.BlockReply{
 			Destination: request.Origin,
 			Block:       blocksFound,
-			HopLimit:    BlockHopLimit,
+			HopLimit:    gossiper.Args.BlockHopLimit,
 		}
 
 		OnReceiveBlockReply(gossiper, reply, sender)
@@ -184,7 +184,7 @@ func OnReceiveBlockReply(gossiper *entities.Gossiper, reply *messages.BlockReply
 	// Otherwise we have to forward the reply
 	if reply.Destination == gossiper.Args.Name {
 
-		fmt.Printf("RECEIVED BLOCK REPLY from %s\n", sender.String())
+		logger.Chain.Info("OnReceiveBlockReply", "RECEIVED BLOCK REPLY from %s", sender.String())
 
 		for _, block := range reply.Block {
 			myBlock := gossiper.Blockchain.GetBlock(block.Hash())
@@ -226,7 +226,7 @@ func OnReceiveBlockReply(gossiper *entities.Gossiper, reply *messages.BlockReply
 		pkt := messages.GossipPacket{BlockReply: reply}
 		buf, err := protobuf.Encode(&pkt)
 		if err != nil {
-			fmt.Println(err)
+			logger.Chain.Error("OnReceiveBlockReply", "%s", err.Error())
 			return
 		}
 
@@ -234,9 +234,9 @@ func OnReceiveBlockReply(gossiper *entities.Gossiper, reply *messages.BlockReply
 		target := gossiper.Router.GetTarget(reply.Destination)
 
 		// Send the packet
-		fmt.Printf("FORWARDING BLOCK REPLY to %s via %s\n", reply.Destination, target.String())
-		gossiper.GossipChannel.WriteToUDP(buf, target)
+		logger.Chain.Info("OnReceiveBlockReply", "FORWARDING BLOCK REPLY to %s via %s", reply.Destination, target.String())
+		gossiper.GossipChannel.Send(buf, target)
 	} else {
-		fmt.Printf("HOPLIMIT for BLOCK REPLY is 0\n")
+		logger.Chain.Info("OnReceiveBlockReply", "HOPLIMIT for BLOCK REPLY is 0")
 	}
 }
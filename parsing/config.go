@@ -0,0 +1,57 @@
+package parsing
+
+import (
+	"Peerster/fail"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// setting - The value of an option read from a configuration file
+type setting struct {
+	name  string // The option's name
+	value string // The option's value, as it would be given on the command line
+}
+
+// loadConfigFile - Reads a JSON configuration file whose keys are the names of the command line options
+// (e.g. {"name": "Alice", "peers": ["127.0.0.1:5001"], "simple": true}) and returns its settings sorted
+// by name
+func loadConfigFile(path string) ([]setting, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "loadConfigFile", Desc: "unable to read " + path}
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, &fail.CustomError{Fun: "loadConfigFile", Desc: "invalid JSON in " + path + ": " + err.Error()}
+	}
+
+	settings := make([]setting, 0, len(values))
+	for name, value := range values {
+		switch v := value.(type) {
+		case string:
+			settings = append(settings, setting{name, v})
+		case float64:
+			settings = append(settings, setting{name, strconv.FormatFloat(v, 'f', -1, 64)})
+		case bool:
+			settings = append(settings, setting{name, strconv.FormatBool(v)})
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, &fail.CustomError{Fun: "loadConfigFile", Desc: name + " must be a list of strings"}
+				}
+				list = append(list, s)
+			}
+			settings = append(settings, setting{name, strings.Join(list, ",")})
+		default:
+			return nil, &fail.CustomError{Fun: "loadConfigFile", Desc: "unsupported value for " + name}
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].name < settings[j].name })
+	return settings, nil
+}
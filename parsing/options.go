@@ -0,0 +1,123 @@
+package parsing
+
+import (
+	"Peerster/fail"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables setting options (e.g. PEERSTER_GOSSIP_ADDR for
+// -gossipAddr)
+const EnvPrefix = "PEERSTER_"
+
+// newFlagSet - Creates a set of options whose parsing errors are returned rather than printed
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.Usage = func() {}
+	return fs
+}
+
+// EnvName - Returns the name of the environment variable setting an option
+func EnvName(option string) string {
+	var name []rune
+	var previous rune
+	for _, r := range option {
+		if r == '-' {
+			r = '_'
+		} else if unicode.IsUpper(r) && unicode.IsLower(previous) {
+			name = append(name, '_')
+		}
+		name = append(name, unicode.ToUpper(r))
+		previous = r
+	}
+	return EnvPrefix + string(name)
+}
+
+// printUsage - Prints the help of a set of options
+func printUsage(fs *flag.FlagSet, usage string) {
+	fs.SetOutput(os.Stdout)
+	defer fs.SetOutput(ioutil.Discard)
+
+	fmt.Println(strings.TrimSpace(usage))
+	if hasOptions(fs) {
+		fmt.Println("\nOptions:")
+		fs.PrintDefaults()
+	}
+}
+
+// hasOptions - Checks whether a set has at least one option
+func hasOptions(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// parseCommandLine - Parses command line arguments with a set of options. Returns flag.ErrHelp (after
+// printing the usage) if -help was given.
+func parseCommandLine(fs *flag.FlagSet, arguments []string, usage string) error {
+	if err := fs.Parse(arguments); err == flag.ErrHelp {
+		printUsage(fs, usage)
+		return err
+	} else if err != nil {
+		return &fail.CustomError{Fun: "parseCommandLine", Desc: err.Error() + " (see -help)"}
+	}
+	return nil
+}
+
+// parseOptions - Parses command line arguments with a set of options. The options that are not on the
+// command line are read from the environment (see EnvName), then from the JSON file named by the "config"
+// option if the set has one. Returns flag.ErrHelp (after printing the usage) if -help was given.
+func parseOptions(fs *flag.FlagSet, arguments []string, usage string) error {
+
+	if err := parseCommandLine(fs, arguments, usage); err != nil {
+		return err
+	}
+
+	// Options given on the command line
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	// Environment variables
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(EnvName(f.Name)); ok && !set[f.Name] && err == nil {
+			if e := fs.Set(f.Name, value); e != nil {
+				err = &fail.CustomError{Fun: "parseOptions", Desc: fmt.Sprintf("invalid value %q for %s: %s",
+					value, EnvName(f.Name), e.Error())}
+			}
+			set[f.Name] = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// Configuration file
+	config := fs.Lookup("config")
+	if config == nil || config.Value.String() == "" {
+		return nil
+	}
+	settings, err := loadConfigFile(config.Value.String())
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		if fs.Lookup(setting.name) == nil {
+			return &fail.CustomError{Fun: "parseOptions", Desc: fmt.Sprintf("unknown option %q in %s",
+				setting.name, config.Value.String())}
+		}
+		if set[setting.name] {
+			continue
+		}
+		if err := fs.Set(setting.name, setting.value); err != nil {
+			return &fail.CustomError{Fun: "parseOptions", Desc: fmt.Sprintf("invalid value %q for %s in %s: %s",
+				setting.value, setting.name, config.Value.String(), err.Error())}
+		}
+	}
+	return nil
+}
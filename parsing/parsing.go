@@ -36,7 +36,6 @@ func parseIPPortPair(s string) error {
 
 	for _, x := range slicesIP {
 		if n, err := strconv.ParseInt(x, 10, 32); err != nil || n > 255 || n < 0 {
-			fmt.Println(n)
 			return &fail.CustomError{Fun: "checkIPPortPair", Desc: "IP component not in range [0, 256)"}
 		}
 	}
@@ -51,8 +50,7 @@ func parsePeers(peers *[]string, s string) error {
 
 		// Check for correct <ip:port>
 		if err := parseIPPortPair(rawAddr); err != nil {
-			fmt.Println(err)
-			return &fail.CustomError{Fun: "parsePeers", Desc: "failed to parse <ip:port>"}
+			return &fail.CustomError{Fun: "parsePeers", Desc: "failed to parse <ip:port> " + rawAddr}
 		}
 
 		// Append to list
@@ -60,3 +58,11 @@ func parsePeers(peers *[]string, s string) error {
 	}
 	return nil
 }
+
+// checkRange - Checks that the value of an option is in the range [min, max]
+func checkRange(option string, value, min, max uint64) error {
+	if value < min || value > max {
+		return &fail.CustomError{Fun: "checkRange", Desc: fmt.Sprintf("-%s must be in [%d, %d], got %d", option, min, max, value)}
+	}
+	return nil
+}
@@ -4,137 +4,301 @@ import (
 	"Peerster/entities"
 	"Peerster/fail"
 	"encoding/hex"
+	"flag"
 	"fmt"
 	"net"
 	"os"
-	"strconv"
 	"strings"
 )
 
+// DefaultClientTimeoutSec is the default time the client waits for a reply of the node
+const DefaultClientTimeoutSec = 10
+
+// clientCommand - A subcommand of the client
+type clientCommand struct {
+	name     string // The subcommand's name
+	synopsis string // Its options and arguments
+	desc     string // What it does
+}
+
+// clientCommands - The subcommands of the client, in the order of the help
+var clientCommands = []clientCommand{
+	{"msg", "[-channel=NAME] TEXT", "post a rumor, or a message in a joined channel"},
+	{"private", "-dest=NAME TEXT", "send a private message"},
+	{"index", "FILE", "index a file of the node's shared folder"},
+	{"download", "-hash=METAHASH [-from=NAME] FILE", "download a file from a peer, or from the peers found by a search"},
+	{"search", "[-budget=N] KEYWORD...", "search files on the network"},
+	{"publish-art", "-name=NAME -desc=TEXT FILE", "publish an artwork of the node's shared folder"},
+	{"subscribe", "SIGNATURE", "subscribe to an artist"},
+	{"join", "[-encrypted] CHANNEL", "join (or create) a channel"},
+	{"leave", "CHANNEL", "leave a channel"},
+	{"invite", "-dest=NAME CHANNEL", "invite a peer to a joined channel"},
+}
+
+// legacyOptions - The options of the client before it had subcommands (still accepted)
+var legacyOptions = map[string]bool{
+	"msg": true, "dest": true, "file": true, "request": true, "keywords": true, "budget": true,
+	"name": true, "desc": true, "channel": true, "join": true, "leave": true, "encrypted": true,
+}
+
+// clientUsage - Help of the client
+func clientUsage() string {
+	var usage strings.Builder
+	usage.WriteString("Usage: client [-UIPort=PORT] [-timeout=SECONDS] [-nowait] COMMAND [options] [arguments]\n\n")
+	usage.WriteString("Sends a command to the local Peerster node and prints its outcome (the options must come before\n" +
+		"the arguments). The exit status is 0 if the command succeeded and 1 otherwise.\n")
+	usage.WriteString("Run \"client COMMAND -help\" for the options of a command. The UI port can also be set by " +
+		EnvName("UIPort") + ".\n\nCommands:\n")
+	for _, command := range clientCommands {
+		fmt.Fprintf(&usage, "  %s %s\n        %s\n", command.name, command.synopsis, command.desc)
+	}
+	return usage.String()
+}
+
+// commandUsage - Help of a subcommand of the client
+func commandUsage(command clientCommand) string {
+	return fmt.Sprintf("Usage: client %s %s\n\nTo %s.", command.name, command.synopsis, command.desc)
+}
+
 // ParseArgumentsClient - Parses the arguments for the client
 func ParseArgumentsClient() (*entities.Client, error) {
 
+	arguments := os.Args[1:]
+	if isLegacyClient(arguments) {
+		return parseLegacyClient(arguments)
+	}
+
 	var client entities.Client
-	var uiPortDone, msgDone, destDone, fileDone, reqDone, keyDone, budgetDone bool
-	var artNameDone, artDescDone bool
-
-	for _, arg := range os.Args[1:] {
-		switch {
-		case strings.HasPrefix(arg, "-UIPort="):
-			if uiPortDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "UIPort defined twice"}
-			}
-			if err := parsePort(arg[8:]); err != nil {
-				fmt.Println(err)
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "unable to parse UIPort"}
-			}
+	fs := newFlagSet("client")
+	uiPort := fs.String("UIPort", "8080", "`port` of the node's client interface (on 127.0.0.1)")
+	fs.BoolVar(&client.NoWait, "nowait", false, "exit once the command is sent, without waiting for its outcome")
+	fs.UintVar(&client.Timeout, "timeout", DefaultClientTimeoutSec, "give up after this many `seconds` without reply from the node")
+	if err := parseOptions(fs, arguments, clientUsage()); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "missing command (see -help)"}
+	}
 
-			// Resolve the address
-			udpAddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("127.0.0.1:%s", arg[8:]))
-			if err != nil {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "cannot resolve UDP address"}
-			}
+	addr, err := clientAddr(*uiPort)
+	if err != nil {
+		return nil, err
+	}
+	client.Addr = addr
+	client.Command = fs.Arg(0)
+	if err := checkRange("timeout", uint64(client.Timeout), 1, 3600); err != nil {
+		return nil, err
+	}
 
-			// Validate
-			client.Addr = udpAddr
-			uiPortDone = true
+	if err := parseClientCommand(&client, fs.Args()[1:]); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
 
-		case strings.HasPrefix(arg, "-msg="):
-			if msgDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "msg defined twice"}
-			}
+// parseClientCommand - Parses the options and arguments of a subcommand of the client
+func parseClientCommand(client *entities.Client, arguments []string) error {
 
-			// Validate
-			client.Msg = arg[5:]
-			msgDone = true
-		case strings.HasPrefix(arg, "-dest="):
-			if destDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "msg defined twice"}
-			}
+	var command *clientCommand
+	for i := range clientCommands {
+		if clientCommands[i].name == client.Command {
+			command = &clientCommands[i]
+		}
+	}
+	if command == nil {
+		return &fail.CustomError{Fun: "parseClientCommand", Desc: fmt.Sprintf("unknown command %q (see -help)", client.Command)}
+	}
 
-			// Validate
-			client.Dst = arg[6:]
-			destDone = true
-		case strings.HasPrefix(arg, "-file="):
-			if fileDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "file defined twice"}
-			}
+	// Options
+	var hash string
+	fs := newFlagSet("client " + command.name)
+	switch command.name {
+	case "msg":
+		fs.StringVar(&client.Channel, "channel", "", "post in a joined `channel` instead of the global chat")
+	case "private":
+		fs.StringVar(&client.Dst, "dest", "", "`name` of the destination (required)")
+	case "download":
+		fs.StringVar(&hash, "hash", "", "hex-encoded `metahash` of the file (required)")
+		fs.StringVar(&client.Dst, "from", "", "`name` of the peer to download from (default: the peers found by a search)")
+	case "search":
+		fs.Uint64Var(&client.Budget, "budget", 0, "initial budget of the search (0 to double it until enough matches are found)")
+	case "publish-art":
+		fs.StringVar(&client.ArtName, "name", "", "`name` of the artwork (required)")
+		fs.StringVar(&client.ArtDesc, "desc", "", "`description` of the artwork (required)")
+	case "join":
+		fs.BoolVar(&client.Encrypted, "encrypted", false, "create an encrypted channel if it doesn't exist yet")
+	case "invite":
+		fs.StringVar(&client.Dst, "dest", "", "`name` of the invited peer (required)")
+	}
+	// The options of a command are only read from the command line
+	if err := parseCommandLine(fs, arguments, commandUsage(*command)); err != nil {
+		return err
+	}
 
-			// Validate
-			client.Filename = arg[6:]
-			fileDone = true
-		case strings.HasPrefix(arg, "-request="):
-			if reqDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "request defined twice"}
-			}
+	invalid := func(desc string) error {
+		return &fail.CustomError{Fun: "parseClientCommand", Desc: command.name + ": " + desc + " (usage: client " +
+			command.name + " " + command.synopsis + ")"}
+	}
+	positional := fs.Args()
 
-			// Validate
-			if decoded, err := hex.DecodeString(arg[9:]); err == nil && len(decoded) == 32 {
-				client.Request = decoded
-			} else {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "hash isn't 32 bytes long"}
-			}
-			reqDone = true
-		case strings.HasPrefix(arg, "-keywords="):
-			if keyDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "keywords defined twice"}
+	// Arguments
+	switch command.name {
+	case "msg", "private":
+		if len(positional) == 0 {
+			return invalid("missing TEXT")
+		}
+		client.Msg = strings.Join(positional, " ")
+		if client.Msg == "" {
+			return invalid("empty TEXT")
+		}
+	case "search":
+		for _, arg := range positional {
+			for _, keyword := range strings.Split(arg, ",") {
+				if keyword != "" {
+					client.Keywords = append(client.Keywords, keyword)
+				}
 			}
+		}
+		if len(client.Keywords) == 0 {
+			return invalid("missing KEYWORD")
+		}
+	default:
+		if len(positional) != 1 {
+			return invalid(fmt.Sprintf("expected 1 argument, got %d", len(positional)))
+		}
+		switch command.name {
+		case "index", "download", "publish-art":
+			client.Filename = positional[0]
+		case "subscribe":
+			client.Signature = positional[0]
+		case "join":
+			client.Join = positional[0]
+		case "leave":
+			client.Leave = positional[0]
+		case "invite":
+			client.Channel = positional[0]
+		}
+	}
 
-			// Validate
-			client.Keywords = strings.Split(arg[10:], ",")
-			keyDone = true
-		case strings.HasPrefix(arg, "-budget="):
-			if budgetDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "budget defined twice"}
-			}
+	// Required options
+	switch {
+	case (command.name == "private" || command.name == "invite") && client.Dst == "":
+		return invalid("-dest is required")
+	case command.name == "publish-art" && (client.ArtName == "" || client.ArtDesc == ""):
+		return invalid("-name and -desc are required")
+	case command.name == "download":
+		decoded, err := hex.DecodeString(hash)
+		if err != nil || len(decoded) != 32 {
+			return invalid("-hash must be a hex-encoded 32 bytes metahash")
+		}
+		client.Request = decoded
+	}
+	return nil
+}
 
-			// Validate
-			if parsed, err := strconv.ParseInt(arg[8:], 10, 32); err == nil {
-				client.Budget = uint64(parsed)
-			} else {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "cannot parsed budget"}
-			}
-			budgetDone = true
-		case strings.HasPrefix(arg, "-name="):
-			if artNameDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "name defined twice"}
-			}
+// isLegacyClient - Checks whether the client is used with the options it had before subcommands
+func isLegacyClient(arguments []string) bool {
+	for _, arg := range arguments {
+		if !strings.HasPrefix(arg, "-") {
+			// A subcommand
+			return false
+		}
+		if legacyOptions[strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]] {
+			return true
+		}
+	}
+	return false
+}
 
-			// Validate
-			client.ArtName = arg[6:]
-			artNameDone = true
-		case strings.HasPrefix(arg, "-desc="):
-			if artDescDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "desc defined twice"}
-			}
+// parseLegacyClient - Parses the options of the client before it had subcommands (the client then exits
+// without waiting for replies, as it used to)
+func parseLegacyClient(arguments []string) (*entities.Client, error) {
 
-			// Validate
-			client.ArtDesc = arg[6:]
-			artDescDone = true
-		default:
-			return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "unknown argument"}
-		}
+	client := entities.Client{NoWait: true}
+	var request, keywords string
+
+	// Only the UI port can also come from the environment
+	defaultPort := "8080"
+	if port, ok := os.LookupEnv(EnvName("UIPort")); ok {
+		defaultPort = port
 	}
 
-	// The client must have a message
-	if !msgDone && !fileDone && !keyDone {
-		return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "the client has nothing to do"}
+	fs := newFlagSet("client")
+	uiPort := fs.String("UIPort", defaultPort, "port of the node's client interface")
+	fs.StringVar(&client.Msg, "msg", "", "message")
+	fs.StringVar(&client.Dst, "dest", "", "destination")
+	fs.StringVar(&client.Filename, "file", "", "file")
+	fs.StringVar(&request, "request", "", "metahash")
+	fs.StringVar(&keywords, "keywords", "", "keywords")
+	fs.Uint64Var(&client.Budget, "budget", ^uint64(0), "budget")
+	fs.StringVar(&client.ArtName, "name", "", "artwork's name")
+	fs.StringVar(&client.ArtDesc, "desc", "", "artwork's description")
+	fs.StringVar(&client.Channel, "channel", "", "channel")
+	fs.StringVar(&client.Join, "join", "", "channel to join")
+	fs.StringVar(&client.Leave, "leave", "", "channel to leave")
+	fs.BoolVar(&client.Encrypted, "encrypted", false, "encrypted channel")
+	if err := parseCommandLine(fs, arguments, clientUsage()); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: fmt.Sprintf("unexpected argument %q (see -help)", fs.Arg(0))}
 	}
 
-	// Create default values for missing parameters
-	if !uiPortDone {
-		udpAddr, err := net.ResolveUDPAddr("udp4", "127.0.0.1:8080")
-		if err != nil {
-			return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "cannot resolve UDP address"}
-		}
-		client.Addr = udpAddr
+	addr, err := clientAddr(*uiPort)
+	if err != nil {
+		return nil, err
 	}
-	if !reqDone {
-		client.Request = nil
+	client.Addr = addr
+	if request != "" {
+		if decoded, err := hex.DecodeString(request); err == nil && len(decoded) == 32 {
+			client.Request = decoded
+		} else {
+			return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "hash isn't 32 bytes long"}
+		}
 	}
-	if !budgetDone {
-		client.Budget = ^uint64(0)
+	if keywords != "" {
+		client.Keywords = strings.Split(keywords, ",")
 	}
 
+	// Deduce the command
+	switch {
+	case client.Keywords != nil:
+		client.Command = "search"
+	case client.Filename != "" && client.ArtName != "" && client.ArtDesc != "":
+		client.Command = "publish-art"
+	case client.Filename != "" && client.Request != nil:
+		client.Command = "download"
+	case client.Filename != "":
+		client.Command = "index"
+	case client.Join != "":
+		client.Command = "join"
+	case client.Leave != "":
+		client.Command = "leave"
+	case client.Channel != "" && client.Dst != "" && client.Msg == "":
+		client.Command = "invite"
+	case client.Dst != "" && client.Msg != "" && client.Channel == "":
+		client.Command = "private"
+	case client.Msg != "":
+		client.Command = "msg"
+	default:
+		return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "the client has nothing to do (see -help)"}
+	}
 	return &client, nil
 }
+
+// clientAddr - Resolves the address of the node's client interface
+func clientAddr(port string) (*net.UDPAddr, error) {
+	if err := parsePort(port); err != nil {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: fmt.Sprintf("-UIPort must be a port number in [1024, 65535], got %q", port)}
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp4", fmt.Sprintf("127.0.0.1:%s", port))
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsClient", Desc: "cannot resolve UDP address"}
+	}
+	return udpAddr, nil
+}
+
+// IsHelp - Checks whether the parsing of the arguments stopped because the help was printed
+func IsHelp(err error) bool {
+	return err == flag.ErrHelp
+}
@@ -3,133 +3,183 @@ package parsing
 import (
 	"Peerster/entities"
 	"Peerster/fail"
+	"Peerster/files"
+	"Peerster/logger"
+	"Peerster/network"
+	"Peerster/peers"
 	"fmt"
+	"net"
 	"os"
-	"strconv"
-	"strings"
 )
 
+// gossiperUsage - Help of the gossiper
+const gossiperUsage = `
+Usage: Peerster -name=NAME [options]
+
+Runs a Peerster node. Every option can also be set by an environment variable named after it (e.g.
+PEERSTER_GOSSIP_ADDR for -gossipAddr) or in the JSON file given by -config, the command line taking
+precedence over the environment, and the environment over the file.`
+
 // ParseArgumentsGossiper - Parses the arguments for the gossiper
 func ParseArgumentsGossiper() (*entities.CLArgsGossiper, error) {
 
 	var args entities.CLArgsGossiper
+	var uiPort, peerList, plainPeerList, config string
+	var maxFileSize uint64
+	var hopLimit, searchHopLimit, txHopLimit, blockHopLimit, artHopLimit uint
+	var debug uint
+	var logLevels string
+
+	fs := newFlagSet("Peerster")
+	fs.StringVar(&config, "config", "", "JSON `file` setting options (keys are the options' names)")
+
+	// Identity and addresses
+	fs.StringVar(&args.Name, "name", "", "name of the node (required)")
+	fs.StringVar(&uiPort, "UIPort", "8080", "`port` on which the client talks to the node (on 127.0.0.1)")
+	fs.StringVar(&args.GossipAddr, "gossipAddr", "127.0.0.1:5000", "`ip:port` on which to talk to other nodes")
+	fs.StringVar(&peerList, "peers", "", "comma-separated list of `ip:port` of the first neighbors")
+
+	// Gossip
+	fs.BoolVar(&args.SimpleMode, "simple", false, "broadcast simple messages instead of gossiping rumors")
+	fs.UintVar(&args.RTimer, "rtimer", 0, "interval between route rumors, in `seconds` (0 to disable)")
+	fs.UintVar(&args.AntiEntropy, "antiEntropy", peers.DefaultAntiEntropySec, "interval between anti-entropy exchanges, in `seconds` (0 to disable)")
+	fs.UintVar(&args.MaxRumors, "maxRumors", peers.DefaultMaxRumors, "maximum number of messages kept in memory per origin (0 for unlimited)")
+	fs.UintVar(&args.RumorAge, "rumorAge", 0, "maximum age of the messages kept in memory, in `seconds` (0 for unlimited)")
+	fs.StringVar(&args.ArchiveDir, "archiveDir", peers.PathToArchive, "`folder` archiving the messages dropped from memory (empty to discard them)")
+	fs.UintVar(&args.MaxPeers, "maxPeers", peers.DefaultMaxPeers, "maximum number of neighbors (0 for unlimited)")
+	fs.StringVar(&args.PeerSelection, "peerSelection", peers.UniformSelection, "`strategy` used to pick neighbors: uniform, rtt or lrc")
+	fs.BoolVar(&args.Insecure, "insecure", false, "don't encrypt the links with the neighbors by default")
+	fs.StringVar(&plainPeerList, "plainPeers", "", "comma-separated list of `ip:port` of neighbors with plaintext links")
+
+	// Files
+	fs.StringVar(&args.SharedDir, "sharedDir", files.PathToSharedFiles, "`folder` of the shared files")
+	fs.StringVar(&args.DownloadDir, "downloadDir", files.PathToDownloadedFiles, "`folder` where the downloaded files are written")
+	fs.UintVar(&args.WatchInterval, "watchSec", files.DefaultWatchIntervalSec, "interval between two scans of the shared folder, in `seconds` (0 to disable)")
+	fs.Uint64Var(&maxFileSize, "maxFileSize", files.MaxFileSizeBytes, "maximum size of a shared file, in `bytes`")
+	fs.UintVar(&args.DataRequestInterval, "dataRequestSec", network.DataRequestRepeatIntervalSec, "time after which an unanswered data request is sent again, in `seconds`")
+	fs.UintVar(&args.SearchInterval, "searchSec", network.SearchRepeatIntervalSec, "interval between two rounds of a search, in `seconds`")
+
+	// Hop limits
+	fs.UintVar(&hopLimit, "hopLimit", network.DefaultHopLimit, "hop limit of the messages routed to a single peer")
+	fs.UintVar(&searchHopLimit, "searchHopLimit", network.SearchReplyHopLimit, "hop limit of the search replies")
+	fs.UintVar(&txHopLimit, "txHopLimit", network.TransactionHopLimit, "hop limit of the blockchain's transactions")
+	fs.UintVar(&blockHopLimit, "blockHopLimit", network.BlockHopLimit, "hop limit of the blockchain's blocks")
+	fs.UintVar(&artHopLimit, "artHopLimit", network.ArtHopLimit, "hop limit of the published artworks")
+
+	// Webserver
+	fs.StringVar(&args.ServerPort, "GUIPort", "8080", "`port` of the webserver")
+	fs.StringVar(&args.GUIAddr, "guiAddr", "127.0.0.1", "`ip` on which the webserver listens (non-loopback addresses require TLS)")
+	fs.StringVar(&args.TLSCert, "tlsCert", "", "certificate `file` of the webserver (enables HTTPS)")
+	fs.StringVar(&args.TLSKey, "tlsKey", "", "private key `file` of the webserver's certificate")
+	fs.StringVar(&args.FrontendDir, "frontendDir", entities.PathToFrontend, "`folder` of the GUI's files")
+	fs.StringVar(&args.DataDir, "dataDir", entities.PathToData, "`folder` of the node's private data (e.g. the API token)")
+
+	// Logs
+	fs.StringVar(&logLevels, "logLevel", "", "`levels` of the logs: error, info, debug or trace, then per subsystem (e.g. info,files=debug)")
+	fs.UintVar(&debug, "debug", uint(logger.DefaultLevel), "verbosity `level` of the logs when -logLevel is not set (0: error to 3: trace, higher is trace)")
+	fs.StringVar(&args.Log.Format, "logFormat", logger.FormatText, "`format` of the logs: text or json")
+	fs.StringVar(&args.Log.File, "logFile", "", "`file` receiving the logs instead of the standard output (rotated when too big)")
+	fs.Int64Var(&args.Log.MaxSize, "logMaxSize", logger.DefaultMaxSize, "size of the log file after which it is rotated, in `bytes`")
+	fs.IntVar(&args.Log.MaxFiles, "logMaxFiles", logger.DefaultMaxFiles, "`number` of rotated log files kept")
+	fs.BoolVar(&args.Log.Protocol, "protocolLog", true, "print the protocol lines (e.g. DSDV, FOUND match, CHAIN) on the standard output")
+
+	if err := parseOptions(fs, os.Args[1:], gossiperUsage); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: fmt.Sprintf("unexpected argument %q (see -help)", fs.Arg(0))}
+	}
 
-	var uiPortDone, guiPortDone, gossipAddrDone, nameDone, peersDone, simpleDone, rTimerDone bool
-
-	for _, arg := range os.Args[1:] {
-		switch {
-		case strings.HasPrefix(arg, "-UIPort="):
-			if uiPortDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "UIPort defined twice"}
-			}
-			if err := parsePort(arg[8:]); err != nil {
-				fmt.Println(err)
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "unable to parse UIPort"}
-			}
-
-			// Validate
-			args.ClientAddr = fmt.Sprintf("127.0.0.1:%s", arg[8:])
-			uiPortDone = true
-
-		case strings.HasPrefix(arg, "-GUIPort="):
-			if guiPortDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "GUIPort defined twice"}
-			}
-			if err := parsePort(arg[9:]); err != nil {
-				fmt.Println(err)
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "unable to parse GUIPort"}
-			}
-
-			// Validate
-			args.ServerPort = arg[9:]
-			guiPortDone = true
-
-		case strings.HasPrefix(arg, "-gossipAddr="):
-			if gossipAddrDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "gossipAddr defined twice"}
-			}
-			if err := parseIPPortPair(arg[12:]); err != nil {
-				fmt.Println(err)
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "unable to parse gossipAddr"}
-			}
-
-			// Validate
-			args.GossipAddr = arg[12:]
-			gossipAddrDone = true
-
-		case strings.HasPrefix(arg, "-name="):
-			if nameDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "name defined twice"}
-			}
-			if len(arg) == 6 {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "name is empty"}
-			}
-
-			// Validate
-			args.Name = arg[6:]
-			nameDone = true
-
-		case strings.HasPrefix(arg, "-peers="):
-			if peersDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "peers defined twice"}
-			}
-			if err := parsePeers(&args.Peers, arg[7:]); err != nil {
-				fmt.Println(err)
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "unable to parse peers"}
-			}
-
-			// Validate
-			peersDone = true
-
-		case strings.HasPrefix(arg, "-simple"):
-			if simpleDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "simple flag defined twice"}
-			}
-
-			// Validate
-			args.SimpleMode = true
-			simpleDone = true
-		case strings.HasPrefix(arg, "-rtimer="):
-			if rTimerDone {
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "rTimer defined twice"}
-			}
-
-			timer, err := strconv.ParseInt(arg[8:], 10, 32)
-			if err != nil || timer < 0 {
-				fmt.Println(err)
-				return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "rTimer invalid"}
-			}
-
-			// Validate
-			args.RTimer = uint(timer)
-			rTimerDone = true
-		case strings.HasPrefix(arg, "-debug="):
-			// Set global print level
-			if parsed, err := strconv.ParseInt(arg[7:], 10, 32); err == nil {
-				fail.GlobalPrintLevel = int(parsed)
-			}
-		default:
-			return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "unknown argument"}
+	// Validate
+	invalid := func(desc string) (*entities.CLArgsGossiper, error) {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: desc}
+	}
+	if args.Name == "" {
+		return invalid("the gossiper has no name (-name is required)")
+	}
+	if err := parsePort(uiPort); err != nil {
+		return invalid(fmt.Sprintf("-UIPort must be a port number in [1024, 65535], got %q", uiPort))
+	}
+	args.ClientAddr = fmt.Sprintf("127.0.0.1:%s", uiPort)
+	if err := parsePort(args.ServerPort); err != nil {
+		return invalid(fmt.Sprintf("-GUIPort must be a port number in [1024, 65535], got %q", args.ServerPort))
+	}
+	if err := parseIPPortPair(args.GossipAddr); err != nil {
+		return invalid(fmt.Sprintf("-gossipAddr must be an ip:port pair, got %q", args.GossipAddr))
+	}
+	if peerList != "" {
+		if err := parsePeers(&args.Peers, peerList); err != nil {
+			return invalid(fmt.Sprintf("-peers must be a comma-separated list of ip:port, got %q", peerList))
 		}
 	}
-
-	// The gossiper must have a name
-	if !nameDone {
-		return nil, &fail.CustomError{Fun: "ParseArgumentsGossiper", Desc: "the gossiper has no name"}
+	if plainPeerList != "" {
+		if err := parsePeers(&args.PlainPeers, plainPeerList); err != nil {
+			return invalid(fmt.Sprintf("-plainPeers must be a comma-separated list of ip:port, got %q", plainPeerList))
+		}
+	}
+	if peers.NewPeerSelector(args.PeerSelection) == nil {
+		return invalid(fmt.Sprintf("-peerSelection must be uniform, rtt or lrc, got %q", args.PeerSelection))
+	}
+	for option, dir := range map[string]string{"sharedDir": args.SharedDir, "downloadDir": args.DownloadDir,
+		"frontendDir": args.FrontendDir, "dataDir": args.DataDir} {
+		if dir == "" {
+			return invalid(fmt.Sprintf("-%s can't be empty", option))
+		}
 	}
 
-	// Create default values for missing parameters
-	if !uiPortDone {
-		args.ClientAddr = "127.0.0.1:8080"
+	// Limits
+	if err := checkRange("maxFileSize", maxFileSize, 1, files.MaxFileSizeBytes); err != nil {
+		return nil, err
+	}
+	if err := checkRange("dataRequestSec", uint64(args.DataRequestInterval), 1, 3600); err != nil {
+		return nil, err
+	}
+	if err := checkRange("searchSec", uint64(args.SearchInterval), 1, 3600); err != nil {
+		return nil, err
+	}
+	for option, limit := range map[string]uint{"hopLimit": hopLimit, "searchHopLimit": searchHopLimit,
+		"txHopLimit": txHopLimit, "blockHopLimit": blockHopLimit, "artHopLimit": artHopLimit} {
+		if err := checkRange(option, uint64(limit), 1, 255); err != nil {
+			return nil, err
+		}
+	}
+	args.MaxFileSize = int64(maxFileSize)
+	args.HopLimit, args.SearchHopLimit = uint32(hopLimit), uint32(searchHopLimit)
+	args.TxHopLimit, args.BlockHopLimit = uint32(txHopLimit), uint32(blockHopLimit)
+	args.ArtHopLimit = uint32(artHopLimit)
+
+	// Logs
+	if debug > uint(logger.LevelTrace) {
+		debug = uint(logger.LevelTrace) // Higher levels used to be accepted, they all mean the most verbose logs
 	}
-	if !guiPortDone {
-		args.ServerPort = "8080"
+	args.Log.Level = logger.Level(debug)
+	if logLevels != "" {
+		level, tags, err := logger.ParseLevels(logLevels)
+		if err != nil {
+			return invalid(fmt.Sprintf("-logLevel: %s", err.Error()))
+		}
+		args.Log.Level, args.Log.Tags = level, tags
+	}
+	if args.Log.Format != logger.FormatText && args.Log.Format != logger.FormatJSON {
+		return invalid(fmt.Sprintf("-logFormat must be text or json, got %q", args.Log.Format))
+	}
+	if args.Log.MaxSize < 1024 {
+		return invalid(fmt.Sprintf("-logMaxSize must be at least 1024 bytes, got %d", args.Log.MaxSize))
+	}
+	if args.Log.MaxFiles < 0 {
+		return invalid(fmt.Sprintf("-logMaxFiles can't be negative, got %d", args.Log.MaxFiles))
+	}
+
+	// The GUI is only exposed beyond the machine over TLS
+	ip := net.ParseIP(args.GUIAddr)
+	if ip == nil {
+		return invalid(fmt.Sprintf("-guiAddr must be an IP address, got %q", args.GUIAddr))
 	}
-	if !gossipAddrDone {
-		args.GossipAddr = "127.0.0.1:5000"
+	if (args.TLSCert == "") != (args.TLSKey == "") {
+		return invalid("-tlsCert and -tlsKey go together")
 	}
-	if !rTimerDone {
-		args.RTimer = 0
+	if !ip.IsLoopback() && args.TLSCert == "" {
+		return invalid("-guiAddr must be a loopback address without TLS (-tlsCert and -tlsKey)")
 	}
 
 	return &args, nil
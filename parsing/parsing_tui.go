@@ -0,0 +1,52 @@
+package parsing
+
+import (
+	"Peerster/entities"
+	"Peerster/fail"
+	"fmt"
+	"net"
+	"os"
+)
+
+// tuiUsage - Help of the terminal client
+const tuiUsage = `
+Usage: tui -name=NAME [options]
+
+Opens an interactive terminal on a running Peerster node: messages, peers and contacts, files, searches and
+artists. It talks to the node's webserver with the node's API token, read from its data folder (or given by
+-token). Type /help once it is running for the commands. Every option can also be set by an environment
+variable (e.g. PEERSTER_NAME for -name).`
+
+// ParseArgumentsTUI - Parses the arguments for the terminal client
+func ParseArgumentsTUI() (*entities.TUIClient, error) {
+
+	var args entities.TUIClient
+	var guiAddr, guiPort string
+
+	fs := newFlagSet("tui")
+	fs.StringVar(&args.Name, "name", "", "name of the node (locates its API token)")
+	fs.StringVar(&guiAddr, "guiAddr", "127.0.0.1", "`ip` of the node's webserver")
+	fs.StringVar(&guiPort, "GUIPort", "8080", "`port` of the node's webserver")
+	fs.StringVar(&args.DataDir, "dataDir", entities.PathToData, "`folder` of the node's private data")
+	fs.StringVar(&args.Token, "token", "", "API `token` of the node (default: read from its data folder)")
+	fs.StringVar(&args.TLSCert, "tlsCert", "", "certificate `file` of the node's webserver (enables HTTPS)")
+	if err := parseOptions(fs, os.Args[1:], tuiUsage); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsTUI", Desc: fmt.Sprintf("unexpected argument %q (see -help)", fs.Arg(0))}
+	}
+
+	// Validate
+	if args.Name == "" && args.Token == "" {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsTUI", Desc: "-name (or -token) is required"}
+	}
+	if net.ParseIP(guiAddr) == nil {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsTUI", Desc: fmt.Sprintf("-guiAddr must be an IP address, got %q", guiAddr)}
+	}
+	if err := parsePort(guiPort); err != nil {
+		return nil, &fail.CustomError{Fun: "ParseArgumentsTUI", Desc: fmt.Sprintf("-GUIPort must be a port number in [1024, 65535], got %q", guiPort)}
+	}
+	args.ServerAddr = net.JoinHostPort(guiAddr, guiPort)
+	return &args, nil
+}
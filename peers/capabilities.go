@@ -0,0 +1,119 @@
+package peers
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PeerCapabilities - Represents the protocol version and features advertised by the neighbors
+type PeerCapabilities struct {
+	peers map[string]*PeerFeatures // A mapping from neighbor <ip:port> to its advertised features
+	mux   sync.Mutex               // Mutex to manipulate the structure from different threads
+}
+
+// PeerFeatures - Represents what a neighbor advertised in its last StatusPacket
+type PeerFeatures struct {
+	Addr         string          `json:"addr"`         // The neighbor's <ip:port>
+	Version      uint32          `json:"version"`      // Its protocol version (0 for legacy nodes)
+	Capabilities []string        `json:"capabilities"` // The features it supports
+	supported    map[string]bool // Set view of Capabilities
+}
+
+// NewPeerCapabilities - Creates a new instance of PeerCapabilities
+func NewPeerCapabilities() *PeerCapabilities {
+	var peerCapabilities PeerCapabilities
+	peerCapabilities.peers = make(map[string]*PeerFeatures)
+	return &peerCapabilities
+}
+
+// Record - Records the version and features advertised by a neighbor. The features are returned if they
+// changed, nil otherwise.
+func (peerCapabilities *PeerCapabilities) Record(sender *net.UDPAddr, version uint32, capabilities []string) *PeerFeatures {
+	peerCapabilities.mux.Lock()
+	defer peerCapabilities.mux.Unlock()
+
+	addr := UDPAddressToString(sender)
+	supported := make(map[string]bool, len(capabilities))
+	for _, capability := range capabilities {
+		supported[capability] = true
+	}
+
+	previous, ok := peerCapabilities.peers[addr]
+	changed := !ok || previous.Version != version || len(previous.supported) != len(supported)
+	if ok && !changed {
+		for capability := range supported {
+			if !previous.supported[capability] {
+				changed = true
+				break
+			}
+		}
+	}
+
+	features := &PeerFeatures{
+		Addr:         addr,
+		Version:      version,
+		Capabilities: append([]string(nil), capabilities...),
+		supported:    supported,
+	}
+	peerCapabilities.peers[addr] = features
+
+	if !changed {
+		return nil
+	}
+	copied := *features
+	return &copied
+}
+
+// Supports - Checks whether a neighbor supports a feature. Neighbors we haven't heard a StatusPacket from
+// yet don't support any: optional features are only used once advertised.
+func (peerCapabilities *PeerCapabilities) Supports(target *net.UDPAddr, capability string) bool {
+	return peerCapabilities.SupportsAddr(UDPAddressToString(target), capability)
+}
+
+// SupportsAddr - Checks whether a neighbor, given by its <ip:port>, supports a feature (see Supports)
+func (peerCapabilities *PeerCapabilities) SupportsAddr(addr, capability string) bool {
+	peerCapabilities.mux.Lock()
+	defer peerCapabilities.mux.Unlock()
+
+	features, ok := peerCapabilities.peers[addr]
+	return ok && features.supported[capability]
+}
+
+// IsKnown - Checks whether a neighbor advertised its features (even none)
+func (peerCapabilities *PeerCapabilities) IsKnown(target *net.UDPAddr) bool {
+	peerCapabilities.mux.Lock()
+	defer peerCapabilities.mux.Unlock()
+
+	_, ok := peerCapabilities.peers[UDPAddressToString(target)]
+	return ok
+}
+
+// Forget - Forgets the features of a neighbor (e.g. when it is evicted)
+func (peerCapabilities *PeerCapabilities) Forget(addr string) {
+	peerCapabilities.mux.Lock()
+	defer peerCapabilities.mux.Unlock()
+
+	delete(peerCapabilities.peers, addr)
+}
+
+// GetAll - Returns the features of all the neighbors, sorted by address
+func (peerCapabilities *PeerCapabilities) GetAll() []PeerFeatures {
+	peerCapabilities.mux.Lock()
+	defer peerCapabilities.mux.Unlock()
+
+	all := make([]PeerFeatures, 0, len(peerCapabilities.peers))
+	for _, features := range peerCapabilities.peers {
+		all = append(all, *features)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Addr < all[j].Addr })
+	return all
+}
+
+// FeaturesToString - Returns a textual representation of a neighbor's features
+func (features *PeerFeatures) FeaturesToString() string {
+	return fmt.Sprintf("PEER %s VERSION %d CAPABILITIES %s",
+		features.Addr, features.Version, strings.Join(features.Capabilities, ","))
+}
@@ -0,0 +1,245 @@
+package peers
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DirectLinkTimeoutSec is the silence duration after which a direct link is considered broken
+	DirectLinkTimeoutSec = 30
+	// PunchRetryIntervalSec is the minimum duration between two direct connection attempts to the same peer
+	PunchRetryIntervalSec = 30
+	// PunchAttemptTimeoutSec is the duration after which the pongs of an attempt are no longer accepted
+	PunchAttemptTimeoutSec = 10
+	// MinPunchIntervalSec is the minimum duration between two rounds of pings to the addresses given by a peer
+	MinPunchIntervalSec = 10
+	// MaxPunchCandidates is the maximum number of candidate addresses pinged during an attempt
+	MaxPunchCandidates = 4
+	// ObservedQuorum is the number of distinct neighbors that must report the same public address for us
+	ObservedQuorum = 2
+	// MaxObservers is the maximum number of neighbors whose report of our public address is kept
+	MaxObservers = 64
+)
+
+// DirectLinks - Represents the direct (non-routed) connections established with distant peers
+type DirectLinks struct {
+	links     map[string]*DirectLink   // A mapping from peer name to direct link
+	attempts  map[string]*punchAttempt // A mapping from peer name to outstanding attempt
+	observers map[string]string        // A mapping from neighbor <ip:port> to our public <ip:port> as it sees it
+	observed  string                   // Our own public <ip:port>, as reported by a quorum of neighbors
+	mux       sync.Mutex               // Mutex to manipulate the structure from different threads
+}
+
+// punchAttempt - An outstanding direct connection attempt: only pongs echoing its nonce and coming from one
+// of its candidate addresses establish the link
+type punchAttempt struct {
+	nonce      uint64         // The random value sent in our pings
+	candidates []*net.UDPAddr // The addresses pinged
+	expiry     time.Time      // The time after which pongs are no longer accepted
+}
+
+// DirectLink - Represents a direct connection with a distant peer
+type DirectLink struct {
+	udpAddr     *net.UDPAddr // The peer's public address
+	established bool         // Indicates whether the path was proven to work both ways
+	lastSeen    time.Time    // The last time we received something from the peer on this link
+	lastAttempt time.Time    // The last time we tried to establish the link
+	lastPunch   time.Time    // The last time we pinged an address given by the peer
+}
+
+// NewDirectLinks - Creates a new instance of DirectLinks
+func NewDirectLinks() *DirectLinks {
+	var directLinks DirectLinks
+	directLinks.links = make(map[string]*DirectLink)
+	directLinks.attempts = make(map[string]*punchAttempt)
+	directLinks.observers = make(map[string]string)
+	return &directLinks
+}
+
+// SetObservedSelf - Records our own public address as observed by a neighbor. It is only used once
+// ObservedQuorum distinct neighbors report the same address, so that a single host can't redirect it.
+func (directLinks *DirectLinks) SetObservedSelf(observer, addr string) {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	if StringToUDPAddress(addr) == nil {
+		return
+	}
+	if _, ok := directLinks.observers[observer]; !ok && len(directLinks.observers) >= MaxObservers {
+		return
+	}
+	directLinks.observers[observer] = addr
+
+	// The address reported by most neighbors wins if enough of them agree
+	counts := make(map[string]int)
+	best := 0
+	for _, reported := range directLinks.observers {
+		counts[reported]++
+		if counts[reported] > best {
+			best = counts[reported]
+		}
+	}
+	if counts[directLinks.observed] == best {
+		return // Keep the current address on ties
+	}
+	for reported, count := range counts {
+		if count == best && count >= ObservedQuorum {
+			directLinks.observed = reported
+		}
+	}
+}
+
+// GetObservedSelf - Returns our own public address as observed by our neighbors ("" if unknown)
+func (directLinks *DirectLinks) GetObservedSelf() string {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	return directLinks.observed
+}
+
+// ShouldAttempt - Checks whether a direct connection attempt to a peer should be made, and records it
+func (directLinks *DirectLinks) ShouldAttempt(name string) bool {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	link := directLinks.getOrCreateUnsafe(name)
+	if directLinks.isAliveUnsafe(link) || time.Since(link.lastAttempt) < PunchRetryIntervalSec*time.Second {
+		return false
+	}
+
+	link.lastAttempt = time.Now()
+	return true
+}
+
+// AllowPunch - Checks whether an address given by a peer can be pinged (at most once every
+// MinPunchIntervalSec, so that the pings can't be used to flood a host), and records it
+func (directLinks *DirectLinks) AllowPunch(name string) bool {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	link := directLinks.getOrCreateUnsafe(name)
+	if time.Since(link.lastPunch) < MinPunchIntervalSec*time.Second {
+		return false
+	}
+	link.lastPunch = time.Now()
+	return true
+}
+
+// AddCandidate - Registers a candidate address of a peer to ping, in the outstanding attempt with that peer
+// (started if needed). Returns the nonce to send in the pings.
+func (directLinks *DirectLinks) AddCandidate(name string, candidate *net.UDPAddr) uint64 {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	attempt, ok := directLinks.attempts[name]
+	if !ok || time.Now().After(attempt.expiry) {
+		var nonce [8]byte
+		rand.Read(nonce[:])
+		attempt = &punchAttempt{nonce: binary.BigEndian.Uint64(nonce[:])}
+		directLinks.attempts[name] = attempt
+	}
+	attempt.expiry = time.Now().Add(PunchAttemptTimeoutSec * time.Second)
+
+	known := false
+	for _, addr := range attempt.candidates {
+		known = known || CompareUDPAddress(addr, candidate)
+	}
+	if !known && len(attempt.candidates) < MaxPunchCandidates {
+		attempt.candidates = append(attempt.candidates, candidate)
+	}
+	return attempt.nonce
+}
+
+// ConfirmPong - Establishes the direct link with a peer if a pong matches the outstanding attempt with it
+// (same nonce, sent from a candidate address). Returns false, and changes nothing, otherwise.
+func (directLinks *DirectLinks) ConfirmPong(name string, nonce uint64, sender *net.UDPAddr) bool {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	attempt, ok := directLinks.attempts[name]
+	if !ok || time.Now().After(attempt.expiry) || attempt.nonce != nonce {
+		return false
+	}
+	for _, candidate := range attempt.candidates {
+		if CompareUDPAddress(candidate, sender) {
+			delete(directLinks.attempts, name)
+			directLinks.markEstablishedUnsafe(name, sender)
+			return true
+		}
+	}
+	return false
+}
+
+// MarkEstablished - Marks the direct link with a peer as working both ways
+func (directLinks *DirectLinks) MarkEstablished(name string, udpAddr *net.UDPAddr) {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+	directLinks.markEstablishedUnsafe(name, udpAddr)
+}
+
+// markEstablishedUnsafe - Marks the direct link with a peer as working both ways (the mutex must be held)
+func (directLinks *DirectLinks) markEstablishedUnsafe(name string, udpAddr *net.UDPAddr) {
+	link := directLinks.getOrCreateUnsafe(name)
+	link.udpAddr = udpAddr
+	link.established = true
+	link.lastSeen = time.Now()
+}
+
+// Touch - Refreshes the direct link with a peer if a packet was received from its address
+func (directLinks *DirectLinks) Touch(name string, sender *net.UDPAddr) {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	if link, ok := directLinks.links[name]; ok && link.established && CompareUDPAddress(link.udpAddr, sender) {
+		link.lastSeen = time.Now()
+	}
+}
+
+// Invalidate - Breaks the direct link with a peer (routed delivery is used instead)
+func (directLinks *DirectLinks) Invalidate(name string) {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	if link, ok := directLinks.links[name]; ok {
+		link.established = false
+	}
+}
+
+// GetDirectTarget - Returns the address of a peer if a live direct link exists, nil otherwise
+func (directLinks *DirectLinks) GetDirectTarget(name string) *net.UDPAddr {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	if link, ok := directLinks.links[name]; ok && directLinks.isAliveUnsafe(link) {
+		return link.udpAddr
+	}
+	return nil
+}
+
+// IsDirectTarget - Checks whether an address is the one of the live direct link with a peer
+func (directLinks *DirectLinks) IsDirectTarget(name string, target *net.UDPAddr) bool {
+	directLinks.mux.Lock()
+	defer directLinks.mux.Unlock()
+
+	link, ok := directLinks.links[name]
+	return ok && directLinks.isAliveUnsafe(link) && CompareUDPAddress(link.udpAddr, target)
+}
+
+// getOrCreateUnsafe - Returns the link with a peer, creating it if needed
+func (directLinks *DirectLinks) getOrCreateUnsafe(name string) *DirectLink {
+	link, ok := directLinks.links[name]
+	if !ok {
+		link = &DirectLink{}
+		directLinks.links[name] = link
+	}
+	return link
+}
+
+// isAliveUnsafe - Checks whether a link is established and was recently used
+func (directLinks *DirectLinks) isAliveUnsafe(link *DirectLink) bool {
+	return link.established && time.Since(link.lastSeen) < DirectLinkTimeoutSec*time.Second
+}
@@ -0,0 +1,125 @@
+package peers
+
+import (
+	"Peerster/frontend"
+	"Peerster/messages"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxPeers is the default maximum number of neighbors
+	DefaultMaxPeers = 32
+	// SuspectTimeoutSec is the silence duration after which a peer is suspected to be dead
+	SuspectTimeoutSec = 10
+	// EvictTimeoutSec is the silence duration after which a peer is considered dead and evicted
+	EvictTimeoutSec = 30
+	// PeerExchangeSize is the maximum number of neighbors advertised in a StatusPacket
+	PeerExchangeSize = 5
+)
+
+// IncrementHeartbeat increments our own heartbeat counter and returns its new value
+func (peerIndex *PeerIndex) IncrementHeartbeat() uint64 {
+	peerIndex.mux.Lock()
+	defer peerIndex.mux.Unlock()
+
+	peerIndex.heartbeat++
+	return peerIndex.heartbeat
+}
+
+// FillMembership piggybacks our heartbeat and a random sample of live neighbors (excluding target)
+// on a StatusPacket
+func (peerIndex *PeerIndex) FillMembership(status *messages.StatusPacket, target *net.UDPAddr) {
+	peerIndex.mux.Lock()
+	defer peerIndex.mux.Unlock()
+
+	status.Heartbeat = peerIndex.heartbeat
+
+	targetStr := ""
+	if target != nil {
+		targetStr = UDPAddressToString(target)
+	}
+
+	candidates := make([]messages.PeerHeartbeat, 0, len(peerIndex.index))
+	for addr, peer := range peerIndex.index {
+		if addr != targetStr && !peer.suspected {
+			candidates = append(candidates, messages.PeerHeartbeat{Addr: addr, Heartbeat: peer.heartbeat})
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > PeerExchangeSize {
+		candidates = candidates[:PeerExchangeSize]
+	}
+	status.Peers = candidates
+}
+
+// HandleMembership takes into account the membership information piggybacked on a StatusPacket:
+// the sender's heartbeat and the heartbeats of its neighbors. A neighbor whose heartbeat increased
+// is alive (indirect evidence), and unknown neighbors are added if there is room left. selfAddr is
+// our own <ip:port>, which is never added. The function returns the list of newly learned peers.
+func (peerIndex *PeerIndex) HandleMembership(sender *net.UDPAddr, status *messages.StatusPacket, selfAddr string) []string {
+	peerIndex.mux.Lock()
+	defer peerIndex.mux.Unlock()
+
+	now := time.Now()
+
+	// Direct evidence
+	if peer, ok := peerIndex.index[UDPAddressToString(sender)]; ok && status.Heartbeat > peer.heartbeat {
+		peer.heartbeat = status.Heartbeat
+	}
+
+	// Peer exchange
+	learned := make([]string, 0)
+	for _, entry := range status.Peers {
+		if entry.Addr == selfAddr {
+			continue
+		}
+
+		if peer, ok := peerIndex.index[entry.Addr]; ok { // We know this peer
+			if entry.Heartbeat > peer.heartbeat { // Someone heard from it recently
+				peer.heartbeat = entry.Heartbeat
+				peer.lastSeen = now
+				peer.suspected = false
+			}
+		} else if udpAddr := StringToUDPAddress(entry.Addr); udpAddr != nil {
+			if peer := peerIndex.addPeerUnsafe(entry.Addr, udpAddr); peer != nil {
+				peer.heartbeat = entry.Heartbeat
+				learned = append(learned, entry.Addr)
+			}
+		}
+	}
+
+	return learned
+}
+
+// CheckLiveness marks peers silent for more than SuspectTimeoutSec as suspected and evicts peers
+// silent for more than EvictTimeoutSec. The function returns the addresses of the currently suspected
+// peers (which should be probed) and the addresses of the evicted ones.
+func (peerIndex *PeerIndex) CheckLiveness() ([]*net.UDPAddr, []string) {
+	peerIndex.mux.Lock()
+	defer peerIndex.mux.Unlock()
+
+	suspects := make([]*net.UDPAddr, 0)
+	evicted := make([]string, 0)
+
+	for addr, peer := range peerIndex.index {
+		silence := time.Since(peer.lastSeen)
+		if silence > EvictTimeoutSec*time.Second {
+			delete(peerIndex.index, addr)
+			evicted = append(evicted, addr)
+
+			// Remove the peer from the server
+			slices := strings.Split(addr, ":")
+			frontend.FBuffer.AddFrontendRemovedPeer(slices[0], slices[1])
+
+		} else if silence > SuspectTimeoutSec*time.Second {
+			peer.suspected = true
+			udpAddr := peer.udpAddr
+			suspects = append(suspects, &udpAddr)
+		}
+	}
+
+	return suspects, evicted
+}
@@ -3,20 +3,50 @@ package peers
 import (
 	"Peerster/fail"
 	"Peerster/frontend"
+	"Peerster/logger"
 	"Peerster/messages"
+	"sort"
 	"sync"
+	"time"
+)
+
+const (
+	// DefaultAntiEntropySec is the default interval between two anti-entropy exchanges, in seconds
+	DefaultAntiEntropySec = 1
+	// DefaultMaxRumors is the default maximum number of messages kept in memory for each origin
+	DefaultMaxRumors = 1000
+	// RetentionCheckSec is the interval between two applications of the age limit of the retention policy
+	RetentionCheckSec = 10
 )
 
 // NameIndex - Represents a dictionnary between peer names and received messages
 type NameIndex struct {
-	index map[string]*Messages // A mapping from peer name to messages
-	mux   sync.Mutex           // Mutex to manipulate the structure from different threads
+	index     map[string]*Messages // A mapping from peer name to messages
+	retention RetentionPolicy      // Limits on the messages kept in memory
+	mux       sync.Mutex           // Mutex to manipulate the structure from different threads
+}
+
+// RetentionPolicy - Represents the limits on the messages kept in memory. The vector clock is not
+// affected: it still counts the dropped messages.
+type RetentionPolicy struct {
+	MaxMessages int           // Maximum number of public (or private) messages per origin (0 for unlimited)
+	MaxAge      time.Duration // Maximum age of public messages (0 for unlimited)
+	Archive     *RumorArchive // Where dropped public messages are archived (nil to discard them)
 }
 
 // Messages - Represents the list of public and private messages received by a peer
 type Messages struct {
-	public  []string // A list of public messages
-	private []string // A list of (unordered) private messages
+	public  []StoredRumor   // A list of public messages (IDs base+1 to base+len(public))
+	base    uint32          // The number of older public messages dropped from memory
+	private []StoredPrivate // A list of private messages, in reception order
+}
+
+// StoredPrivate - A private message sent by a peer (or by us)
+type StoredPrivate struct {
+	Origin      string    `json:"origin"`      // The message's origin
+	Destination string    `json:"destination"` // The message's destination
+	Text        string    `json:"text"`        // The message's content
+	Time        time.Time `json:"time"`        // The time we received (or sent) the message
 }
 
 // NewNameIndex - Creates a new instance of NameIndex
@@ -29,10 +59,23 @@ func NewNameIndex() *NameIndex {
 // NewMessages - Creates a new instance of Messages
 func NewMessages() *Messages {
 	var messages Messages
-	messages.public = make([]string, 0)
+	messages.public = make([]StoredRumor, 0)
 	return &messages
 }
 
+// SetRetention - Sets the limits on the messages kept in memory
+func (nameIndex *NameIndex) SetRetention(retention RetentionPolicy) {
+	nameIndex.mux.Lock()
+	defer nameIndex.mux.Unlock()
+
+	nameIndex.retention = retention
+}
+
+// nextID - Returns the ID of the next public message expected from the peer
+func (msgs *Messages) nextID() uint32 {
+	return msgs.base + uint32(len(msgs.public)) + 1
+}
+
 // AddName - Adds a named peer to the index (thread-safe)
 func (nameIndex *NameIndex) AddName(name string) {
 	nameIndex.mux.Lock()
@@ -55,13 +98,20 @@ func (nameIndex *NameIndex) AddPrivateMessage(private *messages.PrivateMessage)
 	nameIndex.mux.Lock()
 	defer nameIndex.mux.Unlock()
 
-	if messages, ok := nameIndex.index[private.Origin]; ok { // We know this name
-		messages.private = append(messages.private, private.Text)
-
-	} else { // We don't know this name
+	if _, ok := nameIndex.index[private.Origin]; !ok { // We don't know this name
 		nameIndex.addNameUnsafe(private.Origin)
-		messages := nameIndex.index[private.Origin]
-		messages.private = append(messages.private, private.Text)
+	}
+	messages := nameIndex.index[private.Origin]
+	messages.private = append(messages.private, StoredPrivate{
+		Origin:      private.Origin,
+		Destination: private.Destination,
+		Text:        private.Text,
+		Time:        time.Now(),
+	})
+
+	// Only keep the most recent ones
+	if max := nameIndex.retention.MaxMessages; max > 0 && len(messages.private) > max {
+		messages.private = append([]StoredPrivate(nil), messages.private[len(messages.private)-max:]...)
 	}
 
 	// Forward to frontend
@@ -73,15 +123,15 @@ func (nameIndex *NameIndex) AddMessageIfNext(rumor *messages.RumorMessage) bool
 	nameIndex.mux.Lock()
 	defer nameIndex.mux.Unlock()
 
-	// Is the message a RouteRumor ?
-	isRouteRumor := (rumor.Text == "")
+	// Is the message a RouteRumor or a channel message (surfaced by the caller if the channel is joined)?
+	isSurfaced := (rumor.Text != "" && rumor.Channel == "")
 
 	if messages, ok := nameIndex.index[rumor.Origin]; ok { // We know this name
-		if uint32(len(messages.public))+1 == rumor.ID { // Ensure message ordering
-			messages.public = append(messages.public, rumor.Text)
+		if messages.nextID() == rumor.ID { // Ensure message ordering
+			nameIndex.appendUnsafe(rumor.Origin, messages, rumor)
 
 			// Don't forward route rumors to the server
-			if !isRouteRumor {
+			if isSurfaced {
 				frontend.FBuffer.AddFrontendRumor(rumor.Origin, rumor.Text)
 			}
 
@@ -90,11 +140,10 @@ func (nameIndex *NameIndex) AddMessageIfNext(rumor *messages.RumorMessage) bool
 	} else { // We don't know this name
 		if rumor.ID == 1 { // Must be the first message
 			nameIndex.addNameUnsafe(rumor.Origin)
-			messages := nameIndex.index[rumor.Origin]
-			messages.public = append(messages.public, rumor.Text)
+			nameIndex.appendUnsafe(rumor.Origin, nameIndex.index[rumor.Origin], rumor)
 
 			// Don't forward route rumors to the server
-			if !isRouteRumor {
+			if isSurfaced {
 				frontend.FBuffer.AddFrontendRumor(rumor.Origin, rumor.Text)
 			}
 
@@ -109,18 +158,18 @@ func (nameIndex *NameIndex) FillInRumorAndSave(rumor *messages.RumorMessage, ori
 	nameIndex.mux.Lock()
 	defer nameIndex.mux.Unlock()
 
-	// Is the message a RouteRumor ?
-	isRouteRumor := (rumor.Text == "")
+	// Is the message a RouteRumor or a channel message (surfaced by the caller)?
+	isSurfaced := (rumor.Text != "" && rumor.Channel == "")
 
 	if messages, ok := nameIndex.index[origin]; ok { // We know this name
 		// Fill in the rumor
 		rumor.Origin = origin
-		rumor.ID = uint32(len(messages.public)) + 1
+		rumor.ID = messages.nextID()
 		// Store it
-		messages.public = append(messages.public, rumor.Text)
+		nameIndex.appendUnsafe(origin, messages, rumor)
 
 		// Don't forward route rumors to the server
-		if !isRouteRumor {
+		if isSurfaced {
 			frontend.FBuffer.AddFrontendRumor(rumor.Origin, rumor.Text)
 		}
 
@@ -136,27 +185,56 @@ func (nameIndex *NameIndex) GetUnknownMessageTarget(targetStatus *messages.Statu
 	nameIndex.mux.Lock()
 	defer nameIndex.mux.Unlock()
 
+	wanted := wantedIDs(targetStatus)
 	for localName, msgs := range nameIndex.index {
+		nextIDWanted, ok := wanted[localName]
+		if !ok { // The other doesn't know the peer
+			nextIDWanted = 1
+		}
+		if nextIDWanted < msgs.nextID() { // We have something the other doesn't have
+			return nameIndex.getRumorsUnsafe(localName, msgs, nextIDWanted, nextIDWanted+1)[0].ToRumor()
+		}
+	}
+	return nil
+}
+
+// GetMissingRumors - Returns the messages that we have but that the other doesn't (at most maxCount
+// messages and about maxBytes of text), in increasing ID order for each origin
+func (nameIndex *NameIndex) GetMissingRumors(targetStatus *messages.StatusPacket, maxCount int, maxBytes int) []*messages.RumorMessage {
+	nameIndex.mux.Lock()
+	defer nameIndex.mux.Unlock()
 
-		// Look for name in status
-		indexPeer := -1
-		for i, x := range targetStatus.Want {
-			if x.Identifier == localName {
-				indexPeer = i
-				break
+	wanted := wantedIDs(targetStatus)
+	missing := make([]*messages.RumorMessage, 0)
+	size := 0
+	for localName, msgs := range nameIndex.index {
+		nextIDWanted, ok := wanted[localName]
+		if !ok { // The other doesn't know the peer
+			nextIDWanted = 1
+		}
+		if nextIDWanted >= msgs.nextID() {
+			continue
+		}
+		for _, stored := range nameIndex.getRumorsUnsafe(localName, msgs, nextIDWanted, msgs.nextID()) {
+			if len(missing) >= maxCount || size >= maxBytes {
+				return missing
 			}
+			missing = append(missing, stored.ToRumor())
+			size += len(stored.Text)
 		}
+	}
+	return missing
+}
 
-		if indexPeer != -1 { // We both now the peer
-			nextIDWanted := targetStatus.Want[indexPeer].NextID
-			if 0 < nextIDWanted && nextIDWanted < uint32(len(msgs.public))+1 { // We have something the other doesn't have
-				return &messages.RumorMessage{Origin: localName, ID: nextIDWanted, Text: msgs.public[nextIDWanted-1]}
-			}
-		} else if len(msgs.public) > 0 { // The other doesn't know the peer, we have at least one message from him
-			return &messages.RumorMessage{Origin: localName, ID: 1, Text: msgs.public[0]}
+// wantedIDs - Returns the next ID wanted by a status for each name it knows
+func wantedIDs(status *messages.StatusPacket) map[string]uint32 {
+	wanted := make(map[string]uint32, len(status.Want))
+	for _, peer := range status.Want {
+		if peer.NextID > 0 {
+			wanted[peer.Identifier] = peer.NextID
 		}
 	}
-	return nil
+	return wanted
 }
 
 // IsLocalStatusComplete - Checks whether we are not aware of some message that was received by the other
@@ -167,8 +245,7 @@ func (nameIndex *NameIndex) IsLocalStatusComplete(status *messages.StatusPacket)
 	for _, distantPeer := range status.Want {
 
 		if messages, ok := nameIndex.index[distantPeer.Identifier]; ok { // We know this name
-			nextIDWanted := uint32(len(messages.public)) + 1
-			if nextIDWanted < distantPeer.NextID { // The other has something we don't have
+			if messages.nextID() < distantPeer.NextID { // The other has something we don't have
 				return false
 			}
 		} else { // We don't know the peer
@@ -193,9 +270,190 @@ func (nameIndex *NameIndex) GetVectorClock() *messages.StatusPacket {
 	for name, msgs := range nameIndex.index {
 		status.Want[i] = messages.PeerStatus{
 			Identifier: name,
-			NextID:     uint32(len(msgs.public)) + 1}
+			NextID:     msgs.nextID()}
 		i++
 	}
+	status.Digest = messages.VectorClockDigest(status.Want)
 
 	return &status
 }
+
+// appendUnsafe - Stores the next public message of a peer, dropping the oldest ones if there are too many
+func (nameIndex *NameIndex) appendUnsafe(origin string, msgs *Messages, rumor *messages.RumorMessage) {
+	msgs.public = append(msgs.public, StoredRumor{
+		Origin:  origin,
+		ID:      msgs.nextID(),
+		Text:    rumor.Text,
+		Channel: rumor.Channel,
+		Sealed:  rumor.Sealed,
+		Time:    time.Now(),
+	})
+
+	if max := nameIndex.retention.MaxMessages; max > 0 && len(msgs.public) > max {
+		nameIndex.dropOldestUnsafe(origin, msgs, len(msgs.public)-max)
+	}
+}
+
+// dropOldestUnsafe - Drops the count oldest public messages of a peer from memory, archiving them
+func (nameIndex *NameIndex) dropOldestUnsafe(origin string, msgs *Messages, count int) {
+
+	// Route rumors are archived too (empty), so that the archive holds every ID in order
+	if archive := nameIndex.retention.Archive; archive != nil {
+		if err := archive.Append(origin, msgs.public[:count]); err != nil {
+			logger.Gossip.Error("NameIndex.dropOldestUnsafe", "%s", err.Error())
+		}
+	}
+
+	// Copy to release the memory of the dropped messages
+	msgs.public = append([]StoredRumor(nil), msgs.public[count:]...)
+	msgs.base += uint32(count)
+}
+
+// ApplyRetention - Drops the public messages older than the maximum age, returns the number of dropped ones
+func (nameIndex *NameIndex) ApplyRetention() int {
+	nameIndex.mux.Lock()
+	defer nameIndex.mux.Unlock()
+
+	if nameIndex.retention.MaxAge == 0 {
+		return 0
+	}
+
+	dropped := 0
+	for origin, msgs := range nameIndex.index {
+		count := 0
+		for count < len(msgs.public) && time.Since(msgs.public[count].Time) > nameIndex.retention.MaxAge {
+			count++
+		}
+		if count > 0 {
+			nameIndex.dropOldestUnsafe(origin, msgs, count)
+			dropped += count
+		}
+	}
+	return dropped
+}
+
+// getRumorsUnsafe - Returns the public messages of a peer with IDs in [fromID, toID). Messages dropped from
+// memory are read from the archive; the ones that can't be found there are replaced by empty messages,
+// which peers handle like route rumors: their vector clock still advances.
+func (nameIndex *NameIndex) getRumorsUnsafe(origin string, msgs *Messages, fromID, toID uint32) []StoredRumor {
+	rumors := make([]StoredRumor, toID-fromID)
+	for id := fromID; id < toID; id++ {
+		if id > msgs.base {
+			rumors[id-fromID] = msgs.public[id-msgs.base-1]
+		} else {
+			rumors[id-fromID] = StoredRumor{Origin: origin, ID: id}
+		}
+	}
+
+	if fromID <= msgs.base && nameIndex.retention.Archive != nil {
+		archived, err := nameIndex.retention.Archive.Read(origin, fromID, msgs.base+1)
+		if err != nil {
+			logger.Gossip.Error("NameIndex.getRumorsUnsafe", "%s", err.Error())
+		}
+		for _, stored := range archived {
+			if stored.ID < toID {
+				rumors[stored.ID-fromID] = stored
+			}
+		}
+	}
+	return rumors
+}
+
+// GetHistory - Returns a page of the (non-empty) public messages of a peer with an ID smaller than before
+// (0 for the most recent ones) and accepted by the filter (nil to accept all), most recent first. The
+// second value is the before to use for the next page, 0 if there is none.
+func (nameIndex *NameIndex) GetHistory(origin string, before uint32, limit int, filter func(*StoredRumor) bool) ([]StoredRumor, uint32) {
+	nameIndex.mux.Lock()
+	defer nameIndex.mux.Unlock()
+
+	page := make([]StoredRumor, 0)
+	msgs, ok := nameIndex.index[origin]
+	if !ok || limit <= 0 {
+		return page, 0
+	}
+	if before == 0 || before > msgs.nextID() {
+		before = msgs.nextID()
+	}
+	accept := func(stored *StoredRumor) bool {
+		return stored.Text != "" && (filter == nil || filter(stored))
+	}
+
+	// Most recent messages first: from memory...
+	id := before - 1
+	for ; id > msgs.base && len(page) < limit; id-- {
+		if stored := msgs.public[id-msgs.base-1]; accept(&stored) {
+			page = append(page, stored)
+		}
+	}
+
+	// ... then from the archive, a page at a time
+	for id > 0 && len(page) < limit && nameIndex.retention.Archive != nil {
+		from := uint32(1)
+		if id > uint32(limit) {
+			from = id - uint32(limit) + 1
+		}
+		archived, err := nameIndex.retention.Archive.Read(origin, from, id+1)
+		if err != nil {
+			logger.Gossip.Error("NameIndex.GetHistory", "%s", err.Error())
+			break
+		}
+		for i := len(archived) - 1; i >= 0 && len(page) < limit; i-- {
+			if accept(&archived[i]) {
+				page = append(page, archived[i])
+			}
+		}
+		id = from - 1
+	}
+
+	if len(page) < limit || page[len(page)-1].ID == 1 {
+		return page, 0
+	}
+	return page, page[len(page)-1].ID
+}
+
+// GetRecentRumors - Returns the (at most limit) most recent non-empty public messages kept in memory and
+// accepted by the filter (nil to accept all), across all origins, the oldest first
+func (nameIndex *NameIndex) GetRecentRumors(limit int, filter func(*StoredRumor) bool) []StoredRumor {
+	nameIndex.mux.Lock()
+	defer nameIndex.mux.Unlock()
+
+	recent := make([]StoredRumor, 0)
+	for _, msgs := range nameIndex.index {
+		// At most limit messages from each origin
+		for i, count := len(msgs.public)-1, 0; i >= 0 && count < limit; i-- {
+			if stored := msgs.public[i]; stored.Text != "" && (filter == nil || filter(&stored)) {
+				recent = append(recent, stored)
+				count++
+			}
+		}
+	}
+
+	sort.Slice(recent, func(i, j int) bool { return recent[i].Time.Before(recent[j].Time) })
+	if len(recent) > limit {
+		recent = recent[len(recent)-limit:]
+	}
+	return recent
+}
+
+// GetConversations - Returns the private messages kept in memory, grouped by the other peer of the
+// conversation (self is our own name), the oldest first
+func (nameIndex *NameIndex) GetConversations(self string) map[string][]StoredPrivate {
+	nameIndex.mux.Lock()
+	defer nameIndex.mux.Unlock()
+
+	conversations := make(map[string][]StoredPrivate)
+	for origin, msgs := range nameIndex.index {
+		for _, stored := range msgs.private {
+			contact := origin
+			if origin == self {
+				contact = stored.Destination
+			}
+			conversations[contact] = append(conversations[contact], stored)
+		}
+	}
+
+	for _, conversation := range conversations {
+		sort.SliceStable(conversation, func(i, j int) bool { return conversation[i].Time.Before(conversation[j].Time) })
+	}
+	return conversations
+}
@@ -2,17 +2,24 @@ package peers
 
 import (
 	"net"
+	"time"
 )
 
 // Peer - Represents a peer
 type Peer struct {
-	rawAddr string      // The peer's raw address <ip:port>
-	udpAddr net.UDPAddr // The peer's UDP address
+	rawAddr   string      // The peer's raw address <ip:port>
+	udpAddr   net.UDPAddr // The peer's UDP address
+	lastSeen  time.Time   // The last time we got (direct or indirect) evidence that the peer is alive
+	heartbeat uint64      // The highest heartbeat counter we know for this peer
+	suspected bool        // Indicates whether the peer has been silent for too long
+
+	rtt           time.Duration // Smoothed round-trip time (0 if never measured)
+	lastContacted time.Time     // The last time the peer was selected as a target
 }
 
 // NewPeer - Creates a new instance of Peer
 func NewPeer(rawAddr string, udpAddr *net.UDPAddr) *Peer {
-	return &Peer{rawAddr: rawAddr, udpAddr: *udpAddr}
+	return &Peer{rawAddr: rawAddr, udpAddr: *udpAddr, lastSeen: time.Now()}
 }
 
 // PeerToString - Returns the textual representation of a Peer
@@ -2,43 +2,49 @@ package peers
 
 import (
 	"Peerster/frontend"
+	"Peerster/logger"
 	"Peerster/messages"
-	"fmt"
-	"math/rand"
+	"Peerster/transport"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dedis/protobuf"
 )
 
 // PeerIndex represents a dictionnary between <ip:port> and peer addresses
 type PeerIndex struct {
-	index map[string]*Peer // A mapping from peer <ip:port> to Peer
-	mux   sync.Mutex       // Mutex to manipulate the structure from different threads
+	index     map[string]*Peer // A mapping from peer <ip:port> to Peer
+	maxPeers  int              // The maximum number of neighbors (0 for unlimited)
+	heartbeat uint64           // Our own heartbeat counter, piggybacked on StatusPacket's
+	selector  PeerSelector     // The strategy used to pick neighbors
+	mux       sync.Mutex       // Mutex to manipulate the structure from different threads
 }
 
-// NewPeerIndex creates a new instance of PeerIndex
-func NewPeerIndex() *PeerIndex {
+// NewPeerIndex creates a new instance of PeerIndex holding at most maxPeers neighbors (0 for unlimited)
+func NewPeerIndex(maxPeers int) *PeerIndex {
 	var peerIndex PeerIndex
 	peerIndex.index = make(map[string]*Peer)
+	peerIndex.maxPeers = maxPeers
+	peerIndex.selector = &UniformSelector{}
 	return &peerIndex
 }
 
 // Broadcast sends a packet to every neighbor, possible exluding one
-func (peerIndex *PeerIndex) Broadcast(channel *net.UDPConn, buf []byte, excludeMe string) {
+func (peerIndex *PeerIndex) Broadcast(channel transport.Transport, buf []byte, excludeMe string) {
 	peerIndex.mux.Lock()
 	defer peerIndex.mux.Unlock()
 
 	for addr, peer := range peerIndex.index {
 		if addr != excludeMe {
-			channel.WriteToUDP(buf, &peer.udpAddr)
+			channel.Send(buf, &peer.udpAddr)
 		}
 	}
 }
 
 // BroadcastBlockRequest will broadcast the block request to neighbours excluding excludeMe (set excludeMe to "" to avoid exclusion)
-func (peerIndex *PeerIndex) BroadcastBlockRequest(channel *net.UDPConn, request *messages.BlockRequest, excludeMe string) {
+func (peerIndex *PeerIndex) BroadcastBlockRequest(channel transport.Transport, request *messages.BlockRequest, excludeMe string) {
 	peerIndex.mux.Lock()
 	defer peerIndex.mux.Unlock()
 
@@ -47,6 +53,9 @@ func (peerIndex *PeerIndex) BroadcastBlockRequest(channel *net.UDPConn, request
 	if excludePeer {
 		nbPeers--
 	}
+	if nbPeers == 0 {
+		return
+	}
 
 	// If we have enough budget for all peers
 	if request.Budget > nbPeers {
@@ -66,9 +75,9 @@ func (peerIndex *PeerIndex) BroadcastBlockRequest(channel *net.UDPConn, request
 					return
 				}
 
-				fmt.Printf("FORWARDING BLOCK REQUEST to %s with BUDGET %d\n", addr, request.Budget)
+				logger.Chain.Info("PeerIndex.BroadcastBlockRequest", "FORWARDING BLOCK REQUEST to %s with BUDGET %d", addr, request.Budget)
 
-				channel.WriteToUDP(buf, &peer.udpAddr)
+				channel.Send(buf, &peer.udpAddr)
 			}
 		}
 
@@ -84,26 +93,44 @@ func (peerIndex *PeerIndex) BroadcastBlockRequest(channel *net.UDPConn, request
 				if err != nil {
 					return
 				}
-				channel.WriteToUDP(buf, &peer.udpAddr)
+				channel.Send(buf, &peer.udpAddr)
 			}
 		}
 	}
 }
 
-// AddPeerIfAbsent adds a peer to the index if it doesn't exist yet
-func (peerIndex *PeerIndex) AddPeerIfAbsent(newPeerAddr *net.UDPAddr) {
+// AddPeerIfAbsent adds a peer to the index if it doesn't exist yet and there is room left for it.
+// If the peer already exists it is marked as alive. The function returns true if the peer is in the
+// index after the call.
+func (peerIndex *PeerIndex) AddPeerIfAbsent(newPeerAddr *net.UDPAddr) bool {
 	peerIndex.mux.Lock()
 	defer peerIndex.mux.Unlock()
 
 	addrStr := UDPAddressToString(newPeerAddr)
 
-	if _, ok := peerIndex.index[addrStr]; !ok { // We don't know this peer
-		peerIndex.index[addrStr] = NewPeer(addrStr, newPeerAddr)
+	if peer, ok := peerIndex.index[addrStr]; ok { // We know this peer
+		peer.lastSeen = time.Now()
+		peer.suspected = false
+		return true
+	}
+
+	return peerIndex.addPeerUnsafe(addrStr, newPeerAddr) != nil
+}
 
-		// Add new peer to server buffer
-		slices := strings.Split(addrStr, ":")
-		frontend.FBuffer.AddFrontendPeer(slices[0], slices[1])
+// addPeerUnsafe adds a new peer to the index if the maximum number of neighbors isn't reached (not thread-safe)
+func (peerIndex *PeerIndex) addPeerUnsafe(addrStr string, newPeerAddr *net.UDPAddr) *Peer {
+	if peerIndex.maxPeers > 0 && len(peerIndex.index) >= peerIndex.maxPeers {
+		return nil
 	}
+
+	peer := NewPeer(addrStr, newPeerAddr)
+	peerIndex.index[addrStr] = peer
+
+	// Add new peer to server buffer
+	slices := strings.Split(addrStr, ":")
+	frontend.FBuffer.AddFrontendPeer(slices[0], slices[1])
+
+	return peer
 }
 
 // GetRandomPeer gets a random neighbor from the index, possibly excluding one
@@ -114,13 +141,13 @@ func (peerIndex *PeerIndex) GetRandomPeer(excludeMe *net.UDPAddr) *net.UDPAddr {
 	return nil
 }
 
-// GetRandomNeighbors returns a maximum of nb randomly picked neighbors among the current list,
-// possibly exluding one if excludeMe represents a valid UDP address. If there aren't any neighbors
-// the function returns nil. If nb is bigger that the number of neighbors all neighbors except the
-// excludeMe one are returned.
+// GetRandomNeighbors returns a maximum of nbMax neighbors picked among the current list according
+// to the index's PeerSelector, possibly exluding one if excludeMe represents a valid UDP address.
+// Suspected peers are never picked. If there aren't any neighbors the function returns nil. If nbMax
+// is bigger that the number of neighbors all neighbors except the excludeMe one are returned.
 func (peerIndex *PeerIndex) GetRandomNeighbors(nbMax int, excludeMe *net.UDPAddr) []*net.UDPAddr {
 
-	if nbMax == 0 {
+	if nbMax <= 0 {
 		return nil
 	}
 
@@ -128,61 +155,64 @@ func (peerIndex *PeerIndex) GetRandomNeighbors(nbMax int, excludeMe *net.UDPAddr
 	peerIndex.mux.Lock()
 	defer peerIndex.mux.Unlock()
 
-	// Get current number of peers
-	nbPeers := len(peerIndex.index)
-	if nbPeers == 0 {
-		return nil
-	}
-
-	// Create temporary list of peers
-	peersList := make([]*net.UDPAddr, 0)
-	i := 0
+	// Create temporary list of candidates
 	excludeStr := ""
 	if excludeMe != nil {
 		excludeStr = UDPAddressToString(excludeMe)
 	}
+	candidates := make([]*PeerCandidate, 0, len(peerIndex.index))
 	for addr, peer := range peerIndex.index {
-		if addr != excludeStr {
-			peersList = append(peersList, &peer.udpAddr)
-			i++
+		if addr != excludeStr && !peer.suspected { // Don't disseminate to peers that may be dead
+			candidates = append(candidates, &PeerCandidate{
+				Addr:          &peer.udpAddr,
+				RTT:           peer.rtt,
+				LastContacted: peer.lastContacted,
+			})
 		}
 	}
 
 	// Check if the list is empty
-	if len(peersList) == 0 {
+	if len(candidates) == 0 {
 		return nil
 	}
 
-	// If the list is smaller than the required number return everything
-	if nbMax >= len(peersList) {
-		return peersList
+	// Pick nbMax neighbors, or everyone if the list is smaller than the required number
+	selected := candidates
+	if nbMax < len(candidates) {
+		selected = peerIndex.selector.Select(candidates, nbMax)
 	}
 
-	// Pick nbMax neighbors randomly
-	retList := make([]*net.UDPAddr, 0)
-	pickedNeighbors := make(map[int]bool, nbMax)
-	for i := 0; i < nbMax; i++ {
-		for {
-			rNumber := rand.Intn(nbMax)
-			if _, ok := pickedNeighbors[rNumber]; !ok { // We never picked this one
-				retList = append(retList, peersList[rNumber])
-				pickedNeighbors[rNumber] = true
-				break
-			}
-		}
+	now := time.Now()
+	retList := make([]*net.UDPAddr, len(selected))
+	for i, c := range selected {
+		retList[i] = c.Addr
+		peerIndex.index[UDPAddressToString(c.Addr)].lastContacted = now
 	}
 
 	return retList
 }
 
+// GetAllPeers returns the addresses of all neighbors
+func (peerIndex *PeerIndex) GetAllPeers() []*net.UDPAddr {
+	peerIndex.mux.Lock()
+	defer peerIndex.mux.Unlock()
+
+	peersList := make([]*net.UDPAddr, 0, len(peerIndex.index))
+	for _, peer := range peerIndex.index {
+		addr := peer.udpAddr
+		peersList = append(peersList, &addr)
+	}
+	return peersList
+}
+
 // PeersToString returns a textual representation of a peer index
 func (peerIndex *PeerIndex) PeersToString() string {
 	peerIndex.mux.Lock()
 	defer peerIndex.mux.Unlock()
 
-	s := "PEERS "
+	addrs := make([]string, 0, len(peerIndex.index))
 	for addr := range peerIndex.index {
-		s = s + fmt.Sprintf("%s,", addr)
+		addrs = append(addrs, addr)
 	}
-	return s[:len(s)-1]
+	return "PEERS " + strings.Join(addrs, ",")
 }
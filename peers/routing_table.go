@@ -3,80 +3,218 @@ package peers
 import (
 	"Peerster/fail"
 	"Peerster/frontend"
+	"Peerster/logger"
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"sync"
+	"time"
 )
 
-// RoutingTable - Represents a routing table between peers name and next hop <ip:port>
+const (
+	// MaxHopCount is the hop count considered as infinity: longer routes are ignored (count-to-infinity bound)
+	MaxHopCount = 16
+	// UnknownHopCount is the hop count of routes learned from relayed packets, for which the distance is unknown
+	UnknownHopCount = MaxHopCount
+	// LegacyHopCount is the hop count of routes advertised by nodes that don't advertise hop counts: the
+	// longest accepted one, so that they only win with fresher sequence numbers (original behavior)
+	LegacyHopCount = MaxHopCount - 1
+	// RouteExpiryFactor is the number of route rumor periods after which a route that wasn't refreshed expires
+	RouteExpiryFactor = 3
+)
+
+// RoutingTable - Represents a DSDV routing table between peers name and next hop <ip:port>
 type RoutingTable struct {
-	table map[string]*NextHop // A mapping from peer name to <ip:port>
-	mux   sync.Mutex          // Mutex to manipulate the structure from different threads
+	table  map[string]*NextHop // A mapping from peer name to <ip:port>
+	expiry time.Duration       // Duration after which a route that wasn't refreshed expires (0 for never)
+	mux    sync.Mutex          // Mutex to manipulate the structure from different threads
 }
 
 // NextHop - Represents a next hop along a route
 type NextHop struct {
-	nextPeer     *Peer  // The next peer along the route
-	lastUpdateID uint32 // The last ID used to update the route
+	nextPeer     *Peer     // The next peer along the route
+	lastUpdateID uint32    // The last ID used to update the route (DSDV sequence number)
+	hopCount     uint32    // The number of hops to reach the destination along the route
+	lastUpdate   time.Time // The last time the route was refreshed
+}
+
+// RouteEntry - Represents a snapshot of a route, used to expose the routing table
+type RouteEntry struct {
+	Destination string `json:"destination"` // The destination's name
+	NextHop     string `json:"nextHop"`     // The next hop's <ip:port>
+	HopCount    int    `json:"hopCount"`    // The number of hops to the destination (-1 if unknown)
+	SequenceID  uint32 `json:"sequenceID"`  // The DSDV sequence number of the route
+	AgeSec      int    `json:"ageSec"`      // The number of seconds since the route was last refreshed
+}
+
+// RouteExpiry - Returns the route expiry duration for a given route rumor period (0 disables expiry)
+func RouteExpiry(rtimer uint) time.Duration {
+	return time.Duration(RouteExpiryFactor*rtimer) * time.Second
 }
 
 // NewRoutingTable - Creates a new instance of RoutingTable
-func NewRoutingTable() *RoutingTable {
+func NewRoutingTable(expiry time.Duration) *RoutingTable {
 	var routing RoutingTable
 	routing.table = make(map[string]*NextHop)
+	routing.expiry = expiry
 	return &routing
 }
 
 // NewNextHop - Creates a new instance of NextHop
-func NewNextHop(rawAddr string, udpAddr *net.UDPAddr, updateID uint32) *NextHop {
+func NewNextHop(rawAddr string, udpAddr *net.UDPAddr, updateID uint32, hopCount uint32) *NextHop {
 	var nextHop NextHop
 	nextHop.nextPeer = NewPeer(rawAddr, udpAddr)
 	nextHop.lastUpdateID = updateID
+	nextHop.hopCount = hopCount
+	nextHop.lastUpdate = time.Now()
 	return &nextHop
 }
 
-// AddContactIfAbsent - Adds a new contact to the routing table if it doesn't exist yet
+// AddContactIfAbsent - Adds a new contact to the routing table if it doesn't exist yet. Such a route
+// (learned from a relayed packet) has an unknown hop count and is replaced by any DSDV update.
 func (routing *RoutingTable) AddContactIfAbsent(name string, sender *net.UDPAddr) {
-	routing.UpdateTableAndPrint(name, sender, 0)
+	routing.mux.Lock()
+	defer routing.mux.Unlock()
+
+	if nextHop, ok := routing.table[name]; ok && !routing.isExpiredUnsafe(nextHop) {
+		return
+	}
+
+	routing.setRouteUnsafe(name, sender, 0, UnknownHopCount)
 }
 
-// UpdateTableAndPrint - Updates the table with a new/updated record and prints it
-func (routing *RoutingTable) UpdateTableAndPrint(name string, sender *net.UDPAddr, updateID uint32) {
+// UpdateTableAndPrint - Updates the table with a DSDV route advertisement and prints it if the next hop
+// changed. An advertisement is accepted if its sequence number is fresher than ours, or if it is as fresh
+// and shorter. The function returns true if the advertisement was accepted.
+func (routing *RoutingTable) UpdateTableAndPrint(name string, sender *net.UDPAddr, updateID uint32, hopCount uint32) bool {
 	routing.mux.Lock()
 	defer routing.mux.Unlock()
 
-	addrStr := UDPAddressToString(sender)
+	// Ignore routes that are too long
+	if hopCount >= MaxHopCount {
+		return false
+	}
+
+	nextHop, ok := routing.table[name]
+	if ok && !routing.isExpiredUnsafe(nextHop) {
+		isFresher := updateID > nextHop.lastUpdateID
+		isShorter := updateID == nextHop.lastUpdateID && hopCount < nextHop.hopCount
+		if !isFresher && !isShorter {
+			return false
+		}
+	}
 
-	if nextHop, ok := routing.table[name]; !ok { // We don't know the sender
-		routing.table[name] = NewNextHop(addrStr, sender, updateID)
-		fail.LeveledPrint(0, "", routing.RouterEntryToStringUnsafe(name))
+	routing.setRouteUnsafe(name, sender, updateID, hopCount)
+	return true
+}
 
-		// Send the new name to the server
-		frontend.FBuffer.AddFrontendPrivateContact(name)
+// setRouteUnsafe - Installs a route, printing it and notifying the server if the next hop changed
+func (routing *RoutingTable) setRouteUnsafe(name string, sender *net.UDPAddr, updateID uint32, hopCount uint32) {
 
-	} else { // We know the sender
+	addrStr := UDPAddressToString(sender)
+	previous, known := routing.table[name]
 
-		// Update the route if the sequence ID is higher or equal
-		if updateID >= nextHop.lastUpdateID && nextHop.nextPeer.rawAddr != addrStr {
-			routing.table[name] = NewNextHop(addrStr, sender, updateID)
-			fail.LeveledPrint(0, "", routing.RouterEntryToStringUnsafe(name))
-		}
+	routing.table[name] = NewNextHop(addrStr, sender, updateID, hopCount)
 
+	if !known {
+		// Send the new name to the server
+		frontend.FBuffer.AddFrontendPrivateContact(name)
 	}
+	if !known || previous.nextPeer.rawAddr != addrStr {
+		logger.Routing.Protocol("%s", routing.RouterEntryToStringUnsafe(name))
+	}
+}
 
+// isExpiredUnsafe - Checks whether a route wasn't refreshed for too long
+func (routing *RoutingTable) isExpiredUnsafe(nextHop *NextHop) bool {
+	return routing.expiry != 0 && time.Since(nextHop.lastUpdate) > routing.expiry
 }
 
 // GetTarget - Get the next-hop target in the routing table for a particular destination
 func (routing *RoutingTable) GetTarget(name string) *net.UDPAddr {
+	routing.mux.Lock()
+	defer routing.mux.Unlock()
 
-	if nextHop, ok := routing.table[name]; ok { // We have a next-hop
-		return &nextHop.nextPeer.udpAddr
+	if nextHop, ok := routing.table[name]; ok && !routing.isExpiredUnsafe(nextHop) { // We have a next-hop
+		udpAddr := nextHop.nextPeer.udpAddr
+		return &udpAddr
 	}
 
 	return nil
 }
 
+// GetHopCount - Get the number of hops to a destination (UnknownHopCount if there is no valid route)
+func (routing *RoutingTable) GetHopCount(name string) uint32 {
+	routing.mux.Lock()
+	defer routing.mux.Unlock()
+
+	if nextHop, ok := routing.table[name]; ok && !routing.isExpiredUnsafe(nextHop) {
+		return nextHop.hopCount
+	}
+
+	return UnknownHopCount
+}
+
+// ExpireRoutes - Removes the routes that weren't refreshed for too long and returns their destinations
+func (routing *RoutingTable) ExpireRoutes() []string {
+	routing.mux.Lock()
+	defer routing.mux.Unlock()
+
+	expired := make([]string, 0)
+	for name, nextHop := range routing.table {
+		if routing.isExpiredUnsafe(nextHop) {
+			delete(routing.table, name)
+			expired = append(expired, name)
+		}
+	}
+	return expired
+}
+
+// RemoveRoutesVia - Removes the routes going through a given neighbor and returns their destinations
+func (routing *RoutingTable) RemoveRoutesVia(addr string) []string {
+	routing.mux.Lock()
+	defer routing.mux.Unlock()
+
+	removed := make([]string, 0)
+	for name, nextHop := range routing.table {
+		if nextHop.nextPeer.rawAddr == addr {
+			delete(routing.table, name)
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+// GetRoutes - Returns a snapshot of the valid routes, sorted by destination
+func (routing *RoutingTable) GetRoutes() []RouteEntry {
+	routing.mux.Lock()
+	defer routing.mux.Unlock()
+
+	routes := make([]RouteEntry, 0, len(routing.table))
+	for name, nextHop := range routing.table {
+		if routing.isExpiredUnsafe(nextHop) {
+			continue
+		}
+
+		hopCount := int(nextHop.hopCount)
+		if nextHop.hopCount == UnknownHopCount {
+			hopCount = -1
+		}
+
+		routes = append(routes, RouteEntry{
+			Destination: name,
+			NextHop:     nextHop.nextPeer.rawAddr,
+			HopCount:    hopCount,
+			SequenceID:  nextHop.lastUpdateID,
+			AgeSec:      int(time.Since(nextHop.lastUpdate).Seconds()),
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Destination < routes[j].Destination })
+	return routes
+}
+
 // RouterEntryToStringUnsafe - Returns the textual representation of a router entry
 func (routing *RoutingTable) RouterEntryToStringUnsafe(name string) string {
 
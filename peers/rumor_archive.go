@@ -0,0 +1,146 @@
+package peers
+
+import (
+	"Peerster/fail"
+	"Peerster/messages"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PathToArchive is the default path to the folder where rumors dropped from memory are archived
+const PathToArchive = "_Archive/"
+
+// StoredRumor - Represents a stored rumor with its reception time (also archive entries and history pages)
+type StoredRumor struct {
+	Origin  string    `json:"origin"`            // The rumor's origin
+	ID      uint32    `json:"id"`                // The rumor's ID
+	Text    string    `json:"text"`              // The rumor's content
+	Channel string    `json:"channel,omitempty"` // The rumor's channel ("" for the global feed)
+	Sealed  bool      `json:"sealed,omitempty"`  // Indicates whether Text is encrypted with the channel's key
+	Time    time.Time `json:"time"`              // The time we received the rumor
+}
+
+// ToRumor - Returns the RumorMessage corresponding to a stored rumor
+func (stored *StoredRumor) ToRumor() *messages.RumorMessage {
+	return &messages.RumorMessage{
+		Origin:  stored.Origin,
+		ID:      stored.ID,
+		Text:    stored.Text,
+		Channel: stored.Channel,
+		Sealed:  stored.Sealed,
+	}
+}
+
+// RumorArchive - Represents the on-disk archive of the rumors dropped from memory, one file per origin.
+// Rumors are archived in ID order (route rumors as empty entries), so the offsets of the entries are kept
+// in memory and reads only decode the requested range.
+type RumorArchive struct {
+	dir  string             // The folder containing the archive files
+	ends map[string][]int64 // For each origin, the end offset of each entry (the one of ID i at i-1)
+	mux  sync.Mutex         // Mutex to manipulate the structure from different threads
+}
+
+// NewRumorArchive - Creates a new instance of RumorArchive, creating its folder if needed. The archive
+// of a previous run is removed: rumor IDs restart with the node.
+func NewRumorArchive(dir string) (*RumorArchive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, &fail.CustomError{Fun: "NewRumorArchive", Desc: "cannot create archive folder " + dir}
+	}
+	previous, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	for _, path := range previous {
+		if err := os.Remove(path); err != nil {
+			return nil, &fail.CustomError{Fun: "NewRumorArchive", Desc: "cannot remove previous archive " + path}
+		}
+	}
+	return &RumorArchive{dir: dir, ends: make(map[string][]int64)}, nil
+}
+
+// path - Returns the path of the archive file of an origin (names are hex-encoded to be safe file names)
+func (archive *RumorArchive) path(origin string) string {
+	return filepath.Join(archive.dir, hex.EncodeToString([]byte(origin))+".jsonl")
+}
+
+// Append - Appends rumors to the archive file of an origin. The rumors must follow the ones already
+// archived (IDs 1, 2...).
+func (archive *RumorArchive) Append(origin string, rumors []StoredRumor) error {
+	archive.mux.Lock()
+	defer archive.mux.Unlock()
+
+	ends := archive.ends[origin]
+	offset := int64(0)
+	if len(ends) > 0 {
+		offset = ends[len(ends)-1]
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	newEnds := make([]int64, 0, len(rumors))
+	for i := range rumors {
+		if rumors[i].ID != uint32(len(ends)+len(newEnds)+1) {
+			return &fail.CustomError{Fun: "RumorArchive.Append", Desc: "rumor archived out of order for " + origin}
+		}
+		if err := encoder.Encode(&rumors[i]); err != nil {
+			return &fail.CustomError{Fun: "RumorArchive.Append", Desc: "cannot encode rumor"}
+		}
+		newEnds = append(newEnds, offset+int64(buf.Len()))
+	}
+
+	file, err := os.OpenFile(archive.path(origin), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return &fail.CustomError{Fun: "RumorArchive.Append", Desc: "cannot open archive of " + origin}
+	}
+	defer file.Close()
+
+	// Write after the last complete entry (a failed write is overwritten by the next one)
+	if _, err := file.WriteAt(buf.Bytes(), offset); err != nil {
+		return &fail.CustomError{Fun: "RumorArchive.Append", Desc: "cannot write archive of " + origin}
+	}
+	archive.ends[origin] = append(ends, newEnds...)
+	return nil
+}
+
+// Read - Returns the archived rumors of an origin whose ID is in [fromID, toID), in increasing ID order
+func (archive *RumorArchive) Read(origin string, fromID, toID uint32) ([]StoredRumor, error) {
+	archive.mux.Lock()
+	defer archive.mux.Unlock()
+
+	rumors := make([]StoredRumor, 0)
+	ends := archive.ends[origin]
+	if fromID == 0 {
+		fromID = 1
+	}
+	if toID > uint32(len(ends))+1 {
+		toID = uint32(len(ends)) + 1
+	}
+	if fromID >= toID {
+		return rumors, nil
+	}
+
+	file, err := os.Open(archive.path(origin))
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "RumorArchive.Read", Desc: "cannot open archive of " + origin}
+	}
+	defer file.Close()
+
+	// Only decode the entries of the range
+	start := int64(0)
+	if fromID > 1 {
+		start = ends[fromID-2]
+	}
+	decoder := json.NewDecoder(bufio.NewReader(io.NewSectionReader(file, start, ends[toID-2]-start)))
+	for id := fromID; id < toID; id++ {
+		var rumor StoredRumor
+		if err := decoder.Decode(&rumor); err != nil || rumor.ID != id {
+			return nil, &fail.CustomError{Fun: "RumorArchive.Read", Desc: "corrupted archive of " + origin}
+		}
+		rumors = append(rumors, rumor)
+	}
+	return rumors, nil
+}
@@ -0,0 +1,139 @@
+package peers
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	// UniformSelection picks neighbors uniformly at random
+	UniformSelection = "uniform"
+	// RTTWeightedSelection favors neighbors with a small round-trip time
+	RTTWeightedSelection = "rtt"
+	// LeastRecentlyContactedSelection favors neighbors we haven't talked to for the longest time
+	LeastRecentlyContactedSelection = "lrc"
+
+	// DefaultRTT is the round-trip time assumed for neighbors that were never measured
+	DefaultRTT = 100 * time.Millisecond
+	// rttSmoothing is the weight given to a new sample in the RTT's exponential moving average
+	rttSmoothing = 0.125
+)
+
+// PeerCandidate represents a neighbor eligible for selection along with its statistics
+type PeerCandidate struct {
+	Addr          *net.UDPAddr  // The neighbor's address
+	RTT           time.Duration // The neighbor's smoothed round-trip time (0 if unknown)
+	LastContacted time.Time     // The last time the neighbor was selected (zero if never)
+}
+
+// PeerSelector represents a strategy to pick neighbors for rumor mongering, anti-entropy and search
+type PeerSelector interface {
+	// Select returns exactly nb distinct candidates (0 < nb < len(candidates))
+	Select(candidates []*PeerCandidate, nb int) []*PeerCandidate
+}
+
+// NewPeerSelector returns the strategy corresponding to a name, or nil if the name is unknown
+func NewPeerSelector(name string) PeerSelector {
+	switch name {
+	case UniformSelection:
+		return &UniformSelector{}
+	case RTTWeightedSelection:
+		return &RTTWeightedSelector{}
+	case LeastRecentlyContactedSelection:
+		return &LeastRecentlyContactedSelector{}
+	default:
+		return nil
+	}
+}
+
+// UniformSelector picks neighbors uniformly at random
+type UniformSelector struct{}
+
+// Select picks nb candidates uniformly at random (partial Fisher-Yates shuffle)
+func (selector *UniformSelector) Select(candidates []*PeerCandidate, nb int) []*PeerCandidate {
+	shuffled := make([]*PeerCandidate, len(candidates))
+	copy(shuffled, candidates)
+	for i := 0; i < nb; i++ {
+		j := i + rand.Intn(len(shuffled)-i)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled[:nb]
+}
+
+// RTTWeightedSelector picks neighbors at random with a probability inversely proportional to their RTT
+type RTTWeightedSelector struct{}
+
+// Select picks nb candidates without replacement, each draw being weighted by 1/RTT
+func (selector *RTTWeightedSelector) Select(candidates []*PeerCandidate, nb int) []*PeerCandidate {
+	remaining := make([]*PeerCandidate, len(candidates))
+	copy(remaining, candidates)
+
+	weight := func(c *PeerCandidate) float64 {
+		rtt := c.RTT
+		if rtt <= 0 {
+			rtt = DefaultRTT
+		}
+		return 1 / rtt.Seconds()
+	}
+
+	selected := make([]*PeerCandidate, 0, nb)
+	for len(selected) < nb {
+		total := 0.0
+		for _, c := range remaining {
+			total += weight(c)
+		}
+
+		// Draw one candidate
+		draw := rand.Float64() * total
+		index := len(remaining) - 1
+		for i, c := range remaining {
+			draw -= weight(c)
+			if draw < 0 {
+				index = i
+				break
+			}
+		}
+
+		selected = append(selected, remaining[index])
+		remaining = append(remaining[:index], remaining[index+1:]...)
+	}
+	return selected
+}
+
+// LeastRecentlyContactedSelector picks the neighbors that were selected the longest time ago
+type LeastRecentlyContactedSelector struct{}
+
+// Select picks the nb candidates with the oldest contact time (ties are broken randomly)
+func (selector *LeastRecentlyContactedSelector) Select(candidates []*PeerCandidate, nb int) []*PeerCandidate {
+	sorted := make([]*PeerCandidate, len(candidates))
+	copy(sorted, candidates)
+	rand.Shuffle(len(sorted), func(i, j int) { sorted[i], sorted[j] = sorted[j], sorted[i] })
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].LastContacted.Before(sorted[j].LastContacted)
+	})
+	return sorted[:nb]
+}
+
+// SetSelector changes the strategy used to pick neighbors
+func (peerIndex *PeerIndex) SetSelector(selector PeerSelector) {
+	peerIndex.mux.Lock()
+	defer peerIndex.mux.Unlock()
+
+	peerIndex.selector = selector
+}
+
+// RecordRTT updates the smoothed round-trip time of a neighbor with a new sample
+func (peerIndex *PeerIndex) RecordRTT(addr *net.UDPAddr, sample time.Duration) {
+	peerIndex.mux.Lock()
+	defer peerIndex.mux.Unlock()
+
+	if peer, ok := peerIndex.index[UDPAddressToString(addr)]; ok {
+		if peer.rtt == 0 {
+			peer.rtt = sample
+		} else {
+			peer.rtt = time.Duration((1-rttSmoothing)*float64(peer.rtt) + rttSmoothing*float64(sample))
+		}
+	}
+}
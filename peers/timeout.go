@@ -5,6 +5,7 @@ import (
 	"Peerster/messages"
 	"net"
 	"sync"
+	"time"
 )
 
 // StatusResponseForwarder - Represents the set of pending timeouts
@@ -18,6 +19,8 @@ type TimeoutHandler struct {
 	addr net.UDPAddr                 // A peer's address
 	com  chan *messages.StatusPacket // A channel to communicate the status answer between threads
 	done bool                        // Indicated whether a packet was already forwarded using this handler
+	sent time.Time                   // The time at which the handler was created (i.e. the rumor was sent)
+	rtt  time.Duration               // The time elapsed between sending the rumor and receiving the answer
 }
 
 // NewStatusResponseForwarder - Creates a new instance of StatusResponseForwarder
@@ -32,6 +35,7 @@ func NewTimeoutHandler(udpAddr *net.UDPAddr) *TimeoutHandler {
 	var handler TimeoutHandler
 	handler.addr = *udpAddr
 	handler.com = make(chan *messages.StatusPacket, 1)
+	handler.sent = time.Now()
 	return &handler
 }
 
@@ -48,8 +52,9 @@ func (forwarder *StatusResponseForwarder) AddTimeoutHandler(threadID uint32, sen
 	}
 }
 
-// DeleteTimeoutHandler - Deletes a timeout handler from the forwarder (last chance pickup)
-func (forwarder *StatusResponseForwarder) DeleteTimeoutHandler(threadID uint32) *messages.StatusPacket {
+// DeleteTimeoutHandler - Deletes a timeout handler from the forwarder (last chance pickup). The function
+// returns the received status (or nil) and the measured round-trip time (or 0)
+func (forwarder *StatusResponseForwarder) DeleteTimeoutHandler(threadID uint32) (*messages.StatusPacket, time.Duration) {
 	forwarder.mux.Lock()
 	defer forwarder.mux.Unlock()
 
@@ -65,11 +70,14 @@ func (forwarder *StatusResponseForwarder) DeleteTimeoutHandler(threadID uint32)
 
 		close(handler.com)
 		delete(forwarder.responses, threadID)
-		return status
+		if status == nil {
+			return nil, 0
+		}
+		return status, handler.rtt
 	}
 
 	fail.CustomPanic("StatusResponseForwarder.DeleteTimeoutHandler", "Trying to delete non-existing rumor handler with threadID %d.", threadID)
-	return nil
+	return nil, 0
 }
 
 // SearchAndForward - Searches the list of handlers for a given sender address. Forwards the packet on match
@@ -91,6 +99,7 @@ func (forwarder *StatusResponseForwarder) SearchAndForward(sender *net.UDPAddr,
 		handler := forwarder.responses[minThreadID]
 		handler.com <- status
 		handler.done = true
+		handler.rtt = time.Since(handler.sent)
 		return true
 	}
 
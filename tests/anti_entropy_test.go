@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"Peerster/messages"
+	"Peerster/peers"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newNameIndexWith creates a name index holding count messages from each origin
+func newNameIndexWith(counts map[string]int) *peers.NameIndex {
+	nameIndex := peers.NewNameIndex()
+	for origin, count := range counts {
+		for id := 1; id <= count; id++ {
+			nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: origin, ID: uint32(id), Text: "text"})
+		}
+	}
+	return nameIndex
+}
+
+func TestVectorClockDigest(t *testing.T) {
+
+	a := []messages.PeerStatus{{Identifier: "Alice", NextID: 3}, {Identifier: "Bob", NextID: 2}}
+	b := []messages.PeerStatus{{Identifier: "Bob", NextID: 2}, {Identifier: "Alice", NextID: 3}, {Identifier: "Carol", NextID: 1}}
+	c := []messages.PeerStatus{{Identifier: "Alice", NextID: 3}, {Identifier: "Bob", NextID: 3}}
+
+	// The order and the empty entries don't matter, the IDs do
+	assert.Equal(t, messages.VectorClockDigest(a), messages.VectorClockDigest(b))
+	assert.NotEqual(t, messages.VectorClockDigest(a), messages.VectorClockDigest(c))
+
+	status := newNameIndexWith(map[string]int{"Alice": 2, "Bob": 1}).GetVectorClock()
+	assert.Equal(t, messages.VectorClockDigest(a), status.Digest)
+	assert.False(t, status.IsDigestOnly())
+	assert.True(t, (&messages.StatusPacket{Digest: status.Digest}).IsDigestOnly())
+}
+
+func TestGetMissingRumors(t *testing.T) {
+
+	local := newNameIndexWith(map[string]int{"Alice": 10, "Bob": 3})
+	distant := &messages.StatusPacket{Want: []messages.PeerStatus{{Identifier: "Alice", NextID: 4}}}
+
+	// Everything missing is sent at once, in order for each origin
+	missing := local.GetMissingRumors(distant, 100, 1<<20)
+	assert.Len(t, missing, 10)
+	nextID := map[string]uint32{"Alice": 4, "Bob": 1}
+	for _, rumor := range missing {
+		assert.Equal(t, nextID[rumor.Origin], rumor.ID)
+		nextID[rumor.Origin]++
+	}
+
+	// Batches are bounded
+	assert.Len(t, local.GetMissingRumors(distant, 5, 1<<20), 5)
+	assert.Len(t, local.GetMissingRumors(distant, 100, 8), 2)
+
+	// Nothing is missing once in sync
+	assert.Len(t, local.GetMissingRumors(local.GetVectorClock(), 100, 1<<20), 0)
+	assert.Nil(t, local.GetUnknownMessageTarget(local.GetVectorClock()))
+	assert.NotNil(t, local.GetUnknownMessageTarget(distant))
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"Peerster/api"
+	"Peerster/backend"
+	"Peerster/entities"
+	"Peerster/files"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStatusNames(t *testing.T) {
+	assert.Equal(t, "partial-match", files.UncompleteMatch.String())
+	assert.Equal(t, "complete-match", files.CompleteMatch.String())
+	assert.Equal(t, "requesting-metafile", files.NoMetafileMonoSource.String())
+	assert.Equal(t, "requesting-metafile", files.NoMetafileMultiSource.String())
+	assert.Equal(t, "downloading", files.MissingChunks.String())
+	assert.Equal(t, "complete", files.Reconstructed.String())
+}
+
+func TestOpenAPIDescription(t *testing.T) {
+
+	data, err := ioutil.ReadFile("../api/openapi.json")
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(data, api.OpenAPI))
+
+	// The embedded description is served, whatever the working directory
+	router := backend.NewRouter(entities.NewGossiper(&entities.CLArgsGossiper{Name: "Alice", HopLimit: 10}))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, bytes.Equal(data, rec.Body.Bytes()))
+
+	var doc struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	// Every route of the API is described
+	routes := map[string][]string{
+		"/node":                    {"get"},
+		"/peers":                   {"get", "post"},
+		"/routes":                  {"get"},
+		"/rumors":                  {"get", "post"},
+		"/private":                 {"post"},
+		"/channels":                {"get", "post"},
+		"/channels/{name}":         {"delete"},
+		"/channels/{name}/invites": {"post"},
+		"/files":                   {"get", "post"},
+		"/files/{filename}":        {"put"},
+		"/downloads":               {"post"},
+		"/downloads/{id}":          {"get"},
+		"/searches":                {"post"},
+		"/searches/{id}":           {"get"},
+		"/subscriptions":           {"post"},
+		"/logs/levels":             {"get", "put"},
+	}
+	for path, methods := range routes {
+		for _, method := range methods {
+			_, ok := doc.Paths[path][method]
+			assert.True(t, ok, method+" "+path)
+		}
+	}
+}
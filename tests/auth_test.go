@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"Peerster/backend"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPITokenFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "peerster_data")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	token, err := backend.NewAPIToken(filepath.Join(dir, "Alice"))
+	assert.NoError(t, err)
+	assert.Len(t, token, 2*backend.TokenBytes)
+
+	// Stored for the user only
+	file := filepath.Join(dir, "Alice", backend.TokenFile)
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	data, _ := ioutil.ReadFile(file)
+	assert.Equal(t, token, strings.TrimSpace(string(data)))
+
+	// A new token at each start
+	other, err := backend.NewAPIToken(filepath.Join(dir, "Alice"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestGuard(t *testing.T) {
+
+	token := "secret"
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := backend.Guard(token, backend.LoopbackHosts("8080"), "../frontend/")(ok)
+
+	send := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://127.0.0.1:8080"+target, nil)
+		req.RemoteAddr = "127.0.0.1:40000"
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The token is required, from a header or the cookie
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/api/v1/node", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/api/v1/node", map[string]string{backend.TokenHeader: "wrong"}).Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/node", map[string]string{backend.TokenHeader: token}).Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/api/v1/node", map[string]string{"Authorization": "Bearer " + token}).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/rumor", map[string]string{"Cookie": backend.TokenCookie + "=" + token}).Code)
+
+	// The index page is public and hands the cookie to local browsers
+	rec := send("GET", "/", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	cookie := rec.Header().Get("Set-Cookie")
+	assert.Contains(t, cookie, backend.TokenCookie+"="+token)
+	assert.Contains(t, cookie, "HttpOnly")
+	assert.Contains(t, cookie, "SameSite=Strict")
+
+	// Other origins and hosts are rejected, even with the token
+	assert.Equal(t, http.StatusForbidden, send("POST", "/rumor", map[string]string{
+		"Cookie": backend.TokenCookie + "=" + token,
+		"Origin": "http://evil.example",
+	}).Code)
+	assert.Equal(t, http.StatusForbidden, send("GET", "/id", map[string]string{
+		backend.TokenHeader: token,
+		"Sec-Fetch-Site":    "cross-site",
+	}).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/rumor", map[string]string{
+		backend.TokenHeader: token,
+		"Origin":            "http://127.0.0.1:8080",
+	}).Code)
+
+	req := httptest.NewRequest("GET", "http://evil.example:8080/id", nil)
+	req.Header.Set(backend.TokenHeader, token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"Peerster/messages"
+	"Peerster/peers"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerCapabilities(t *testing.T) {
+
+	capabilities := peers.NewPeerCapabilities()
+	modern := peers.StringToUDPAddress("127.0.0.1:5001")
+	legacy := peers.StringToUDPAddress("127.0.0.1:5002")
+
+	// Neighbors we know nothing about don't support any optional feature
+	assert.False(t, capabilities.Supports(modern, messages.CapDHT))
+	assert.False(t, capabilities.IsKnown(modern))
+
+	features := capabilities.Record(modern, messages.ProtocolVersion, messages.LocalCapabilities(false))
+	assert.NotNil(t, features)
+	assert.Equal(t, uint32(messages.ProtocolVersion), features.Version)
+	assert.True(t, capabilities.Supports(modern, messages.CapDHT))
+	assert.True(t, capabilities.SupportsAddr("127.0.0.1:5001", messages.CapDHT))
+	assert.False(t, capabilities.Supports(modern, messages.CapSecure))
+
+	// Only changes are reported
+	assert.Nil(t, capabilities.Record(modern, messages.ProtocolVersion, messages.LocalCapabilities(false)))
+	assert.NotNil(t, capabilities.Record(modern, messages.ProtocolVersion, messages.LocalCapabilities(true)))
+	assert.True(t, capabilities.Supports(modern, messages.CapSecure))
+
+	// Legacy nodes don't advertise anything
+	assert.NotNil(t, capabilities.Record(legacy, 0, nil))
+	assert.False(t, capabilities.Supports(legacy, messages.CapHopCount))
+	assert.Len(t, capabilities.GetAll(), 2)
+
+	capabilities.Forget("127.0.0.1:5002")
+	assert.False(t, capabilities.Supports(legacy, messages.CapHopCount))
+	assert.False(t, capabilities.IsKnown(legacy))
+	assert.Len(t, capabilities.GetAll(), 1)
+}
+
+func TestLegacyHopCount(t *testing.T) {
+
+	router := peers.NewRoutingTable(0)
+	legacy := peers.StringToUDPAddress("127.0.0.1:5002")
+	modern := peers.StringToUDPAddress("127.0.0.1:5001")
+
+	// Routes advertised by legacy nodes are accepted, but lose against shorter ones for the same sequence
+	assert.True(t, router.UpdateTableAndPrint("Alice", legacy, 3, peers.LegacyHopCount))
+	assert.True(t, router.UpdateTableAndPrint("Alice", modern, 3, 2))
+	assert.Equal(t, "127.0.0.1:5001", router.GetTarget("Alice").String())
+
+	// ... and still win with fresher sequence numbers
+	assert.True(t, router.UpdateTableAndPrint("Alice", legacy, 4, peers.LegacyHopCount))
+	assert.Equal(t, "127.0.0.1:5002", router.GetTarget("Alice").String())
+}
@@ -0,0 +1,252 @@
+package tests
+
+import (
+	"Peerster/channels"
+	"Peerster/crypto_rsa"
+	"Peerster/entities"
+	"Peerster/messages"
+	"Peerster/network"
+	"Peerster/peers"
+	"Peerster/transport"
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelIndex(t *testing.T) {
+
+	// Names
+	assert.True(t, channels.IsValidName("dev-team_1.0"))
+	assert.False(t, channels.IsValidName(""))
+	assert.False(t, channels.IsValidName("global"))
+	assert.False(t, channels.IsValidName("with space"))
+	assert.False(t, channels.IsValidName("0123456789012345678901234567890123"))
+
+	channelIndex := channels.NewChannelIndex()
+	key, err := channels.NewKey()
+	assert.NoError(t, err)
+
+	// Join
+	assert.True(t, channelIndex.Join("plain", nil, "Alice"))
+	assert.True(t, channelIndex.Join("secret", key, "Alice"))
+	assert.False(t, channelIndex.Join("secret", nil, "Alice"))
+	channelIndex.AddMember("secret", "Bob")
+
+	got, joined := channelIndex.GetKey("secret")
+	assert.True(t, joined)
+	assert.Equal(t, key, got)
+	got, joined = channelIndex.GetKey("plain")
+	assert.True(t, joined)
+	assert.Nil(t, got)
+
+	infos := channelIndex.GetChannels()
+	assert.Len(t, infos, 2)
+	assert.Equal(t, "plain", infos[0].Name)
+	assert.False(t, infos[0].Encrypted)
+	assert.True(t, infos[1].Encrypted)
+	assert.Equal(t, []string{"Alice", "Bob"}, infos[1].Members)
+
+	// Leave
+	assert.True(t, channelIndex.Leave("secret"))
+	assert.False(t, channelIndex.Leave("secret"))
+	assert.False(t, channelIndex.IsJoined("secret"))
+	_, joined = channelIndex.GetKey("secret")
+	assert.False(t, joined)
+}
+
+func TestChannelCrypto(t *testing.T) {
+
+	key, err := channels.NewKey()
+	assert.NoError(t, err)
+	assert.Len(t, key, channels.KeySize)
+
+	sealed, err := channels.Seal(key, "secret", "Alice", "hello")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "hello", sealed)
+
+	text, err := channels.Open(key, "secret", "Alice", sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", text)
+
+	// The ciphertext is bound to its channel and origin
+	_, err = channels.Open(key, "secret", "Mallory", sealed)
+	assert.Error(t, err)
+	_, err = channels.Open(key, "other", "Alice", sealed)
+	assert.Error(t, err)
+
+	// Wrong key
+	otherKey, _ := channels.NewKey()
+	_, err = channels.Open(otherKey, "secret", "Alice", sealed)
+	assert.Error(t, err)
+}
+
+func TestChannelInvites(t *testing.T) {
+
+	channelIndex := channels.NewChannelIndex()
+	assert.True(t, channelIndex.Join("dev", nil, "Alice"))
+
+	// Invitations are kept until accepted, not for joined channels
+	assert.False(t, channelIndex.AddInvite(channels.Invite{Channel: "dev", From: "Bob"}))
+	assert.True(t, channelIndex.AddInvite(channels.Invite{Channel: "secret", From: "Bob", Encrypted: true}))
+	assert.False(t, channelIndex.IsJoined("secret"))
+	assert.Equal(t, []channels.Invite{{Channel: "secret", From: "Bob", Encrypted: true}}, channelIndex.GetInvites())
+
+	// The key is only taken from the inviter, once accepted
+	assert.False(t, channelIndex.TakeAcceptedInvite("secret", "Bob"))
+	invite, ok := channelIndex.AcceptInvite("secret")
+	assert.True(t, ok)
+	assert.True(t, invite.Accepted)
+	assert.False(t, channelIndex.AddInvite(channels.Invite{Channel: "secret", From: "Mallory"}))
+	assert.False(t, channelIndex.TakeAcceptedInvite("secret", "Mallory"))
+	assert.True(t, channelIndex.TakeAcceptedInvite("secret", "Bob"))
+	assert.Len(t, channelIndex.GetInvites(), 0)
+
+	// Joining a channel drops its invitation
+	assert.True(t, channelIndex.AddInvite(channels.Invite{Channel: "ops", From: "Bob"}))
+	assert.True(t, channelIndex.Join("ops", nil, "Alice"))
+	assert.False(t, channelIndex.HasInvite("ops"))
+
+	// Invited peers
+	channelIndex.AddInvited("dev", "Carol")
+	assert.False(t, channelIndex.TakeInvited("dev", "Mallory"))
+	assert.True(t, channelIndex.TakeInvited("dev", "Carol"))
+	assert.False(t, channelIndex.TakeInvited("dev", "Carol"))
+
+	// Bounded
+	for i := 0; i < channels.MaxPendingInvites; i++ {
+		channelIndex.AddInvite(channels.Invite{Channel: string(rune('a'+i%26)) + string(rune('a'+i/26)), From: "Bob"})
+	}
+	assert.False(t, channelIndex.AddInvite(channels.Invite{Channel: "full", From: "Bob"}))
+}
+
+func TestChannelKeyCrypto(t *testing.T) {
+
+	privateKey := crypto_rsa.GeneratePrivateKey()
+	key, _ := channels.NewKey()
+
+	sealed, err := channels.SealKey(key, "secret", &privateKey.PublicKey)
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(sealed, key))
+
+	opened, err := channels.OpenKey(sealed, "secret", privateKey)
+	assert.NoError(t, err)
+	assert.Equal(t, key, opened)
+
+	// Bound to the channel and to the invitee
+	_, err = channels.OpenKey(sealed, "other", privateKey)
+	assert.Error(t, err)
+	_, err = channels.OpenKey(sealed, "secret", crypto_rsa.GeneratePrivateKey())
+	assert.Error(t, err)
+}
+
+// newInviteGossiper creates a gossiper whose private messages are recorded, to be delivered by the test
+func newInviteGossiper(t *testing.T, name string, addr string) (*entities.Gossiper, *recordingTransport) {
+	udp, err := transport.NewUDPTransport(addr)
+	assert.NoError(t, err)
+	rec := &recordingTransport{Transport: udp}
+
+	g := entities.NewGossiper(&entities.CLArgsGossiper{Name: name, HopLimit: 10})
+	g.GossipChannel = rec
+	g.Keys = crypto_rsa.GeneratePrivateKey()
+	return g, rec
+}
+
+// deliverPrivate delivers the last private message sent by a gossiper, returning it
+func deliverPrivate(t *testing.T, rec *recordingTransport, from *net.UDPAddr, to *entities.Gossiper) *messages.PrivateMessage {
+	rec.mux.Lock()
+	buf := rec.sent[len(rec.sent)-1]
+	rec.mux.Unlock()
+
+	var pkt messages.GossipPacket
+	assert.NoError(t, protobuf.Decode(buf, &pkt))
+	assert.NotNil(t, pkt.Private)
+	network.OnReceivePrivate(to, pkt.Private, from)
+	return pkt.Private
+}
+
+func TestChannelInviteExchange(t *testing.T) {
+
+	aliceAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 47022}
+	bobAddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 47023}
+	alice, recAlice := newInviteGossiper(t, "Alice", aliceAddr.String())
+	defer recAlice.Close()
+	bob, recBob := newInviteGossiper(t, "Bob", bobAddr.String())
+	defer recBob.Close()
+	alice.Router.AddContactIfAbsent("Bob", bobAddr)
+	bob.Router.AddContactIfAbsent("Alice", aliceAddr)
+
+	// Encrypted channel: the offer doesn't carry the key, and isn't joined until accepted
+	assert.NoError(t, network.OnJoinChannel(alice, "secret", true))
+	assert.NoError(t, network.OnInviteChannel(alice, "secret", "Bob"))
+	offer := deliverPrivate(t, recAlice, aliceAddr, bob)
+	assert.Len(t, offer.ChannelKey, 0)
+	assert.True(t, offer.Encrypted)
+	assert.False(t, bob.Channels.IsJoined("secret"))
+	assert.Len(t, bob.Channels.GetInvites(), 1)
+
+	// Accepting sends Bob's public key, the key is sent back encrypted with it
+	assert.NoError(t, network.OnJoinChannel(bob, "secret", false))
+	assert.False(t, bob.Channels.IsJoined("secret"))
+	accept := deliverPrivate(t, recBob, bobAddr, alice)
+	assert.True(t, len(accept.PublicKey) > 0)
+	keyMessage := deliverPrivate(t, recAlice, aliceAddr, bob)
+	key, _ := alice.Channels.GetKey("secret")
+	assert.False(t, bytes.Contains(keyMessage.ChannelKey, key))
+
+	got, joined := bob.Channels.GetKey("secret")
+	assert.True(t, joined)
+	assert.Equal(t, key, got)
+	assert.Equal(t, []string{"Alice", "Bob"}, alice.Channels.GetChannels()[0].Members)
+
+	// A replayed key message is ignored
+	network.OnLeaveChannel(bob, "secret")
+	network.OnReceivePrivate(bob, keyMessage, aliceAddr)
+	assert.False(t, bob.Channels.IsJoined("secret"))
+
+	// An acceptance without invitation gets no key
+	sent := len(recAlice.sent)
+	network.OnReceivePrivate(alice, accept, bobAddr)
+	assert.Len(t, recAlice.sent, sent)
+
+	// Plain channel: joined when accepted
+	assert.NoError(t, network.OnJoinChannel(alice, "dev", false))
+	assert.NoError(t, network.OnInviteChannel(alice, "dev", "Bob"))
+	deliverPrivate(t, recAlice, aliceAddr, bob)
+	assert.False(t, bob.Channels.IsJoined("dev"))
+	assert.NoError(t, network.OnJoinChannel(bob, "dev", false))
+	assert.True(t, bob.Channels.IsJoined("dev"))
+	deliverPrivate(t, recBob, bobAddr, alice)
+	assert.Equal(t, []string{"Alice", "Bob"}, alice.Channels.GetChannels()[0].Members)
+}
+
+func TestChannelHistory(t *testing.T) {
+
+	nameIndex := peers.NewNameIndex()
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 1, Text: "global"})
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 2, Text: "dev", Channel: "dev"})
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 3, Text: "xyz", Channel: "secret", Sealed: true})
+
+	inChannel := func(channel string) func(*peers.StoredRumor) bool {
+		return func(stored *peers.StoredRumor) bool { return stored.Channel == channel }
+	}
+
+	// Every rumor is stored (and relayed), the feeds are filtered
+	all, _ := nameIndex.GetHistory("Alice", 0, 10, nil)
+	assert.Len(t, all, 3)
+
+	global, _ := nameIndex.GetHistory("Alice", 0, 10, inChannel(""))
+	assert.Len(t, global, 1)
+	assert.Equal(t, "global", global[0].Text)
+
+	secret, _ := nameIndex.GetHistory("Alice", 0, 10, inChannel("secret"))
+	assert.Len(t, secret, 1)
+	assert.True(t, secret[0].Sealed)
+
+	// Channel rumors are relayed unchanged
+	rumor := secret[0].ToRumor()
+	assert.Equal(t, "secret", rumor.Channel)
+	assert.True(t, rumor.Sealed)
+}
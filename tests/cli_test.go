@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"Peerster/logger"
+	"Peerster/parsing"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "PEERSTER_GOSSIP_ADDR", parsing.EnvName("gossipAddr"))
+	assert.Equal(t, "PEERSTER_UIPORT", parsing.EnvName("UIPort"))
+	assert.Equal(t, "PEERSTER_NAME", parsing.EnvName("name"))
+}
+
+func TestGossiperOptions(t *testing.T) {
+
+	saved := os.Args
+	defer func() { os.Args = saved }()
+
+	// The environment sets the options missing from the command line
+	os.Setenv("PEERSTER_GOSSIP_ADDR", "127.0.0.1:5005")
+	os.Setenv("PEERSTER_NAME", "Bob")
+	defer os.Unsetenv("PEERSTER_GOSSIP_ADDR")
+	defer os.Unsetenv("PEERSTER_NAME")
+	os.Args = []string{"Peerster", "-name=Alice", "-UIPort=8085"}
+	args, err := parsing.ParseArgumentsGossiper()
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", args.Name)
+	assert.Equal(t, "127.0.0.1:5005", args.GossipAddr)
+	assert.Equal(t, "127.0.0.1:8085", args.ClientAddr)
+	assert.Equal(t, logger.LevelInfo, args.Log.Level)
+
+	// -debug above trace is clamped to trace
+	os.Args = []string{"Peerster", "-debug=5"}
+	args, err = parsing.ParseArgumentsGossiper()
+	assert.NoError(t, err)
+	assert.Equal(t, logger.LevelTrace, args.Log.Level)
+
+	// -logLevel takes precedence over -debug
+	os.Args = []string{"Peerster", "-debug=0", "-logLevel=debug,chain=trace", "-logFormat=json"}
+	args, err = parsing.ParseArgumentsGossiper()
+	assert.NoError(t, err)
+	assert.Equal(t, logger.LevelDebug, args.Log.Level)
+	assert.Equal(t, map[string]logger.Level{logger.TagChain: logger.LevelTrace}, args.Log.Tags)
+	assert.Equal(t, logger.FormatJSON, args.Log.Format)
+
+	// Invalid values are explained
+	for _, arguments := range [][]string{
+		{"-UIPort=80"},
+		{"-gossipAddr=localhost"},
+		{"-peerSelection=random"},
+		{"-hopLimit=300"},
+		{"-logLevel=files=loud"},
+		{"-logFormat=xml"},
+		{"-unknown"},
+		{"extra"},
+	} {
+		os.Args = append([]string{"Peerster"}, arguments...)
+		_, err := parsing.ParseArgumentsGossiper()
+		assert.Error(t, err, strings.Join(arguments, " "))
+	}
+}
+
+func TestClientCommands(t *testing.T) {
+
+	saved := os.Args
+	defer func() { os.Args = saved }()
+	parse := func(arguments ...string) error {
+		os.Args = append([]string{"client"}, arguments...)
+		_, err := parsing.ParseArgumentsClient()
+		return err
+	}
+
+	hash := strings.Repeat("ab", 32)
+
+	os.Args = []string{"client", "-UIPort=8081", "private", "-dest=Bob", "hello", "Bob"}
+	client, err := parsing.ParseArgumentsClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "private", client.Command)
+	assert.Equal(t, "Bob", client.Dst)
+	assert.Equal(t, "hello Bob", client.Msg)
+	assert.Equal(t, 8081, client.Addr.Port)
+	assert.False(t, client.NoWait)
+	assert.Equal(t, uint(parsing.DefaultClientTimeoutSec), client.Timeout)
+
+	os.Args = []string{"client", "download", "-hash=" + hash, "cat.jpg"}
+	client, err = parsing.ParseArgumentsClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "download", client.Command)
+	assert.Equal(t, "cat.jpg", client.Filename)
+	assert.Len(t, client.Request, 32)
+	assert.Equal(t, "", client.Dst)
+
+	os.Args = []string{"client", "search", "cat,dog", "bird"}
+	client, err = parsing.ParseArgumentsClient()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cat", "dog", "bird"}, client.Keywords)
+	assert.Equal(t, uint64(0), client.Budget)
+
+	os.Args = []string{"client", "subscribe", "c0ffee"}
+	client, err = parsing.ParseArgumentsClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "c0ffee", client.Signature)
+
+	os.Args = []string{"client", "-nowait", "-timeout=60", "index", "cat.jpg"}
+	client, err = parsing.ParseArgumentsClient()
+	assert.NoError(t, err)
+	assert.True(t, client.NoWait)
+	assert.Equal(t, uint(60), client.Timeout)
+
+	// The former options still work
+	os.Args = []string{"client", "-UIPort=8081", "-file=cat.jpg", "-name=Cat", "-desc=A cat"}
+	client, err = parsing.ParseArgumentsClient()
+	assert.NoError(t, err)
+	assert.Equal(t, "publish-art", client.Command)
+	assert.Equal(t, "Cat", client.ArtName)
+	assert.True(t, client.NoWait)
+
+	// Invalid commands are explained
+	assert.Error(t, parse())
+	assert.Error(t, parse("dance"))
+	assert.Error(t, parse("private", "hello"))
+	assert.Error(t, parse("msg", ""))
+	assert.Error(t, parse("private", "-dest=Bob", ""))
+	assert.Error(t, parse("download", "-hash=abcd", "cat.jpg"))
+	assert.Error(t, parse("publish-art", "-name=Cat", "cat.jpg"))
+	assert.Error(t, parse("index", "a.txt", "b.txt"))
+	assert.Error(t, parse("-UIPort=99999", "msg", "hello"))
+	assert.Error(t, parse("-timeout=0", "msg", "hello"))
+	assert.Error(t, parse("-msg=hello", "-UIPort=abc"))
+}
+
+func TestTUIOptions(t *testing.T) {
+
+	saved := os.Args
+	defer func() { os.Args = saved }()
+
+	os.Args = []string{"tui", "-name=Alice", "-GUIPort=8081"}
+	args, err := parsing.ParseArgumentsTUI()
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", args.Name)
+	assert.Equal(t, "127.0.0.1:8081", args.ServerAddr)
+
+	os.Args = []string{"tui", "-token=secret", "-guiAddr=::1"}
+	args, err = parsing.ParseArgumentsTUI()
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", args.Token)
+	assert.Equal(t, "[::1]:8080", args.ServerAddr)
+
+	for _, arguments := range [][]string{
+		{},
+		{"-name=Alice", "-guiAddr=localhost"},
+		{"-name=Alice", "-GUIPort=80"},
+		{"-name=Alice", "extra"},
+	} {
+		os.Args = append([]string{"tui"}, arguments...)
+		_, err := parsing.ParseArgumentsTUI()
+		assert.Error(t, err, strings.Join(arguments, " "))
+	}
+}
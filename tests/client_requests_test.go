@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"Peerster/entities"
+	"Peerster/files"
+	"Peerster/messages"
+	"Peerster/network"
+	"Peerster/transport"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dedis/protobuf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientReplies(t *testing.T) {
+	assert.False(t, (&messages.ClientReply{Kind: messages.ReplyEvent}).IsFinal())
+	assert.False(t, (&messages.ClientReply{Kind: messages.ReplyProgress}).IsFinal())
+	assert.True(t, (&messages.ClientReply{Kind: messages.ReplyDone}).IsFinal())
+	assert.True(t, (&messages.ClientReply{Kind: messages.ReplyError}).IsFinal())
+
+	request := messages.GossipPacket{Request: &messages.ClientRequest{ID: 7, Packet: &messages.GossipPacket{
+		SearchRequest: &messages.SearchRequest{Keywords: []string{"cat"}},
+	}}}
+	assert.Equal(t, "request", request.PacketType())
+	assert.Equal(t, "reply", (&messages.GossipPacket{Reply: &messages.ClientReply{ID: 7}}).PacketType())
+}
+
+func TestFileProgressAndMatches(t *testing.T) {
+
+	assert.NoError(t, os.MkdirAll(files.PathToSharedFiles, 0755))
+	defer os.RemoveAll(files.PathToSharedFiles)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(files.PathToSharedFiles, "cat.txt"), []byte("meow"), 0644))
+
+	// An indexed file has all its chunks
+	index := files.NewFileIndex()
+	file := index.AddLocalFile("cat.txt")
+	assert.NotNil(t, file)
+	summary, ok := index.GetFile(files.ToHex(file.MetafileHash))
+	assert.True(t, ok)
+	assert.Equal(t, files.Reconstructed, summary.Status)
+	assert.Equal(t, uint64(1), summary.ChunkCount)
+	assert.Equal(t, summary.ChunkCount, summary.DownloadedChunks)
+
+	// A file found by a search has none
+	metahash := make([]byte, files.HashSizeBytes)
+	metahash[0] = 2
+	index.HandleSearchResult(&messages.SearchResult{Filename: "black_cat.jpg", MetafileHash: metahash,
+		ChunkMap: []uint64{1, 2}, ChunkCount: 3}, "Bob")
+	summary, ok = index.GetFile(files.ToHex(metahash))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), summary.DownloadedChunks)
+	assert.Equal(t, uint64(3), summary.ChunkCount)
+	assert.Equal(t, "black_cat.jpg", summary.Filename)
+	assert.Equal(t, files.UncompleteMatch, summary.Status)
+
+	_, ok = index.GetFile("00" + files.ToHex(metahash)[2:])
+	assert.False(t, ok)
+}
+
+func TestSearchMatches(t *testing.T) {
+
+	searchMatches := files.NewSearchMatches()
+	cats := searchMatches.Register([]string{"cat"})
+	dogs := searchMatches.Register([]string{"dog", "Puppy"})
+
+	// Results are recorded for the running searches whose keywords match
+	searchMatches.AddResult("black_cat.jpg", "01")
+	searchMatches.AddResult("cat_and_dog.jpg", "02")
+	searchMatches.AddResult("puppy.png", "03")
+	searchMatches.AddResult("black_cat.jpg", "01")
+
+	matches, ok := searchMatches.GetMatches(cats)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"01", "02"}, matches)
+	matches, _ = searchMatches.GetMatches(dogs)
+	assert.Equal(t, []string{"02", "03"}, matches)
+
+	// A later search with the same keywords doesn't see them, nor do finished searches see its results
+	searchMatches.Finish(cats)
+	again := searchMatches.Register([]string{"cat"})
+	searchMatches.AddResult("cat.gif", "04")
+	matches, _ = searchMatches.GetMatches(again)
+	assert.Equal(t, []string{"04"}, matches)
+	matches, _ = searchMatches.GetMatches(cats)
+	assert.Len(t, matches, 2)
+
+	searchMatches.Forget(cats)
+	_, ok = searchMatches.GetMatches(cats)
+	assert.False(t, ok)
+}
+
+// clientRequester sends requests to a gossiper's client interface over loopback UDP and collects the replies
+type clientRequester struct {
+	t      *testing.T
+	g      *entities.Gossiper
+	client *net.UDPConn
+	nextID uint64
+}
+
+// run sends a command and returns the replies received until the final one
+func (requester *clientRequester) run(pkt *messages.GossipPacket) []*messages.ClientReply {
+	requester.nextID++
+	request := &messages.ClientRequest{ID: requester.nextID, Packet: pkt}
+	go network.OnReceiveClientRequest(requester.g, request, requester.client.LocalAddr().(*net.UDPAddr), 0)
+
+	var replies []*messages.ClientReply
+	buf := make([]byte, 64*1024)
+	requester.client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		n, _, err := requester.client.ReadFromUDP(buf)
+		if err != nil {
+			requester.t.Error("no final reply: ", err)
+			return replies
+		}
+		var reply messages.GossipPacket
+		assert.NoError(requester.t, protobuf.Decode(buf[:n], &reply))
+		assert.Equal(requester.t, request.ID, reply.Reply.ID)
+		replies = append(replies, reply.Reply)
+		if reply.Reply.IsFinal() {
+			return replies
+		}
+	}
+}
+
+// final returns the final reply to a command
+func (requester *clientRequester) final(pkt *messages.GossipPacket) *messages.ClientReply {
+	replies := requester.run(pkt)
+	if len(replies) == 0 {
+		return &messages.ClientReply{}
+	}
+	return replies[len(replies)-1]
+}
+
+func newClientRequester(t *testing.T) *clientRequester {
+	node, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	channel, err := transport.NewUDPTransport("127.0.0.1:0")
+	assert.NoError(t, err)
+
+	g := entities.NewGossiper(&entities.CLArgsGossiper{Name: "Alice", HopLimit: 10, SearchInterval: 1})
+	g.NameIndex.AddName(g.Args.Name)
+	g.ClientChannel = node
+	g.GossipChannel = channel
+	return &clientRequester{t: t, g: g, client: client}
+}
+
+func (requester *clientRequester) close() {
+	requester.g.ClientChannel.Close()
+	requester.g.GossipChannel.Close()
+	requester.client.Close()
+}
+
+func TestClientRequestReplies(t *testing.T) {
+
+	requester := newClientRequester(t)
+	defer requester.close()
+
+	// Done
+	reply := requester.final(&messages.GossipPacket{SimpleMsg: &messages.SimpleMessage{Contents: "hello"}})
+	assert.Equal(t, uint32(messages.ReplyDone), reply.Kind)
+	assert.Equal(t, "RUMOR origin Alice ID 1", reply.Text)
+
+	// Errors
+	reply = requester.final(&messages.GossipPacket{SimpleMsg: &messages.SimpleMessage{Contents: ""}})
+	assert.Equal(t, uint32(messages.ReplyError), reply.Kind)
+	assert.Equal(t, "empty message", reply.Text)
+
+	reply = requester.final(&messages.GossipPacket{Private: &messages.PrivateMessage{Destination: "Bob", Text: "hi"}})
+	assert.Equal(t, uint32(messages.ReplyError), reply.Kind)
+	assert.Equal(t, "no route to Bob", reply.Text)
+
+	reply = requester.final(&messages.GossipPacket{Subscribe: &messages.ArtistInfo{Signature: "c0ffee"}})
+	assert.Equal(t, uint32(messages.ReplyError), reply.Kind)
+	assert.Equal(t, "unknown artist c0ffee", reply.Text)
+
+	reply = requester.final(&messages.GossipPacket{DataRequest: &messages.DataRequest{Origin: "../x"}})
+	assert.Equal(t, uint32(messages.ReplyError), reply.Kind)
+	assert.True(t, strings.HasPrefix(reply.Text, "invalid filename"))
+}
+
+func TestClientRequestSearch(t *testing.T) {
+
+	requester := newClientRequester(t)
+	defer requester.close()
+	g := requester.g
+
+	// A neighbor, so that the search waits for replies
+	neighbor, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer neighbor.Close()
+	g.PeerIndex.AddPeerIfAbsent(neighbor.LocalAddr().(*net.UDPAddr))
+
+	// A file found by an earlier search isn't reported
+	result := func(filename string, id byte) *messages.SearchResult {
+		metahash := make([]byte, files.HashSizeBytes)
+		metahash[0] = id
+		return &messages.SearchResult{Filename: filename, MetafileHash: metahash, ChunkMap: []uint64{1}, ChunkCount: 2}
+	}
+	g.FileIndex.HandleSearchResult(result("old_cat.jpg", 1), "Carol")
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		network.OnReceiveSearchReply(g, &messages.SearchReply{Origin: "Bob", Destination: "Alice", HopLimit: 10,
+			Results: []*messages.SearchResult{result("black_cat.jpg", 2), result("dog.jpg", 3)}},
+			neighbor.LocalAddr().(*net.UDPAddr))
+	}()
+	replies := requester.run(&messages.GossipPacket{SearchRequest: &messages.SearchRequest{Keywords: []string{"cat"}, Budget: 2}})
+
+	var found []string
+	for _, reply := range replies {
+		if reply.Kind == messages.ReplyEvent {
+			found = append(found, reply.Text)
+		}
+	}
+	assert.Len(t, found, 1)
+	if len(found) == 1 {
+		assert.True(t, strings.HasPrefix(found[0], "FOUND black_cat.jpg"))
+	}
+	assert.Equal(t, "SEARCH FINISHED with 1 matches", replies[len(replies)-1].Text)
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"Peerster/files"
+	"Peerster/network"
+	"Peerster/parsing"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "peerster_config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "alice.json")
+	assert.NoError(t, ioutil.WriteFile(config, []byte(`{
+		"name": "Alice",
+		"peers": ["127.0.0.1:5001", "127.0.0.1:5002"],
+		"simple": true,
+		"sharedDir": "alice/shared",
+		"downloadDir": "alice/downloads",
+		"searchSec": 3,
+		"hopLimit": 8
+	}`), 0644))
+
+	saved := os.Args
+	defer func() { os.Args = saved }()
+
+	// The command line overrides the file
+	os.Args = []string{"Peerster", "-config=" + config, "-hopLimit=12"}
+	args, err := parsing.ParseArgumentsGossiper()
+	assert.NoError(t, err)
+	assert.Equal(t, "Alice", args.Name)
+	assert.Equal(t, []string{"127.0.0.1:5001", "127.0.0.1:5002"}, args.Peers)
+	assert.True(t, args.SimpleMode)
+	assert.Equal(t, "alice/shared", args.SharedDir)
+	assert.Equal(t, "alice/downloads", args.DownloadDir)
+	assert.Equal(t, uint(3), args.SearchInterval)
+	assert.Equal(t, uint32(12), args.HopLimit)
+
+	// Defaults
+	assert.Equal(t, uint(network.DataRequestRepeatIntervalSec), args.DataRequestInterval)
+	assert.Equal(t, uint32(network.TransactionHopLimit), args.TxHopLimit)
+	assert.Equal(t, uint32(network.SearchReplyHopLimit), args.SearchHopLimit)
+	assert.Equal(t, uint32(network.ArtHopLimit), args.ArtHopLimit)
+	assert.Equal(t, int64(files.MaxFileSizeBytes), args.MaxFileSize)
+
+	// Invalid settings are refused
+	os.Args = []string{"Peerster", "-config=" + config, "-maxFileSize=0"}
+	_, err = parsing.ParseArgumentsGossiper()
+	assert.Error(t, err)
+	os.Args = []string{"Peerster", "-config=" + filepath.Join(dir, "missing.json")}
+	_, err = parsing.ParseArgumentsGossiper()
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"Peerster/dht"
+	"Peerster/messages"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyDistance(t *testing.T) {
+
+	a := dht.NameToKey("Alice")
+	b := dht.NameToKey("Bob")
+
+	assert.Equal(t, dht.Key{}, a.Distance(a), "distance to itself should be zero")
+	assert.Equal(t, a.Distance(b), b.Distance(a), "distance should be symmetric")
+	assert.Equal(t, -1, a.BucketIndex(a), "a key has no bucket relatively to itself")
+
+	var zero, one, high dht.Key
+	one[dht.KeySizeBytes-1] = 1
+	high[0] = 0x80
+	assert.Equal(t, dht.KeySizeBits-1, zero.BucketIndex(one))
+	assert.Equal(t, 0, zero.BucketIndex(high))
+	assert.True(t, one.CloserTo(zero, high))
+	assert.False(t, high.CloserTo(zero, one))
+}
+
+func TestFilenameToKeywords(t *testing.T) {
+
+	values := []struct {
+		filename string
+		keywords []string
+	}{
+		{"", []string{}},
+		{"cat.jpg", []string{"cat", "jpg"}},
+		{"My_Holiday-photo.JPG", []string{"my", "holiday", "photo", "jpg"}},
+		{"a.a.a", []string{"a"}},
+	}
+
+	for _, val := range values {
+		assert.Equal(t, val.keywords, dht.FilenameToKeywords(val.filename), "filename %s", val.filename)
+	}
+}
+
+func TestRoutingTableClosest(t *testing.T) {
+
+	table := dht.NewRoutingTable("Alice")
+	assert.False(t, table.Update("Alice", "127.0.0.1:5000"), "we should not add ourselves")
+
+	for i := 0; i < 50; i++ {
+		table.Update(fmt.Sprintf("node%d", i), fmt.Sprintf("127.0.0.1:%d", 6000+i))
+	}
+	assert.True(t, table.Size() <= 50)
+
+	target := dht.NameToKey("node7")
+	closest := table.ClosestContacts(target, dht.BucketSize)
+	assert.True(t, len(closest) <= dht.BucketSize)
+	assert.True(t, len(closest) > 0)
+	assert.Equal(t, "node7", closest[0].Name, "a node should be the closest to its own key")
+	for i := 1; i < len(closest); i++ {
+		assert.False(t, closest[i].ID.CloserTo(target, closest[i-1].ID), "contacts should be sorted by distance")
+	}
+
+	table.Remove("node7")
+	closest = table.ClosestContacts(target, dht.BucketSize)
+	assert.NotEqual(t, "node7", closest[0].Name, "removed contact should not be returned")
+}
+
+func TestProviderStore(t *testing.T) {
+
+	store := dht.NewProviderStore()
+	key := dht.KeywordToKey("cat")
+
+	assert.Nil(t, store.GetProviders(key))
+
+	provider := &messages.DHTProvider{Origin: "Bob", Filename: "cat.jpg", MetafileHash: []byte{1, 2}, ChunkCount: 3}
+	store.AddProviders(key, []*messages.DHTProvider{provider, provider, nil}, "127.0.0.1:5001")
+
+	providers := store.GetProviders(key)
+	assert.Equal(t, 1, len(providers), "duplicate records should be merged")
+
+	result := providers[0].ToSearchResult()
+	assert.Equal(t, []uint64{1, 2, 3}, result.ChunkMap)
+	assert.Equal(t, uint64(3), result.ChunkCount)
+}
+
+func TestProviderStoreLimits(t *testing.T) {
+
+	store := dht.NewProviderStore()
+	key := dht.KeywordToKey("cat")
+
+	// Providers beyond the limit of a key are dropped, known ones are still refreshed
+	var providers []*messages.DHTProvider
+	for i := 0; i < dht.MaxProvidersPerKey+5; i++ {
+		providers = append(providers, &messages.DHTProvider{Origin: fmt.Sprintf("node%d", i), MetafileHash: []byte{1}})
+	}
+	assert.Equal(t, dht.MaxProvidersPerKey, store.AddProviders(key, providers, "127.0.0.1:5001"))
+	assert.Equal(t, 1, store.AddProviders(key, providers[:1], "127.0.0.1:5002"))
+	assert.Equal(t, dht.MaxProvidersPerKey, len(store.GetProviders(key)))
+
+	// A sender can only store under a limited number of keys, others (and ourselves) are not affected
+	provider := &messages.DHTProvider{Origin: "Eve", MetafileHash: []byte{2}}
+	for i := 0; i < dht.MaxKeysPerSender; i++ {
+		assert.Equal(t, 1, store.AddProviders(dht.KeywordToKey(fmt.Sprintf("spam%d", i)), []*messages.DHTProvider{provider}, "127.0.0.1:6666"))
+	}
+	assert.Equal(t, 0, store.AddProviders(dht.KeywordToKey("onemore"), []*messages.DHTProvider{provider}, "127.0.0.1:6666"))
+	assert.Nil(t, store.GetProviders(dht.KeywordToKey("onemore")))
+	assert.Equal(t, 1, store.AddProviders(dht.KeywordToKey("onemore"), []*messages.DHTProvider{provider}, "127.0.0.1:5001"))
+	assert.Equal(t, 1, store.AddProviders(dht.KeywordToKey("dog"), []*messages.DHTProvider{provider}, ""))
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"Peerster/messages"
+	"Peerster/network"
+	"Peerster/peers"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dedis/protobuf"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectLinks(t *testing.T) {
+
+	links := peers.NewDirectLinks()
+	public := peers.StringToUDPAddress("1.2.3.4:5000")
+	other := peers.StringToUDPAddress("1.2.3.4:5001")
+
+	assert.Nil(t, links.GetDirectTarget("Bob"))
+	assert.True(t, links.ShouldAttempt("Bob"))
+	assert.False(t, links.ShouldAttempt("Bob"), "attempts should be rate limited")
+	assert.True(t, links.AllowPunch("Bob"), "punches are limited apart from our own attempts")
+	assert.False(t, links.AllowPunch("Bob"), "punches should be rate limited")
+
+	links.MarkEstablished("Bob", public)
+	assert.True(t, peers.CompareUDPAddress(public, links.GetDirectTarget("Bob")))
+	assert.True(t, links.IsDirectTarget("Bob", public))
+	assert.False(t, links.IsDirectTarget("Bob", other))
+
+	links.Invalidate("Bob")
+	assert.Nil(t, links.GetDirectTarget("Bob"), "invalidated links should fall back to routing")
+	assert.False(t, links.IsDirectTarget("Bob", public))
+}
+
+func TestObservedSelf(t *testing.T) {
+
+	links := peers.NewDirectLinks()
+	assert.Equal(t, "", links.GetObservedSelf())
+
+	links.SetObservedSelf("10.0.0.1:5000", "not an address")
+	assert.Equal(t, "", links.GetObservedSelf())
+
+	// A single neighbor isn't trusted, a quorum is
+	links.SetObservedSelf("10.0.0.1:5000", "1.2.3.4:5000")
+	assert.Equal(t, "", links.GetObservedSelf())
+	links.SetObservedSelf("10.0.0.2:5000", "1.2.3.4:5000")
+	assert.Equal(t, "1.2.3.4:5000", links.GetObservedSelf())
+
+	// Other reports only change the address once they outnumber the current one
+	links.SetObservedSelf("10.0.0.3:5000", "6.6.6.6:5000")
+	assert.Equal(t, "1.2.3.4:5000", links.GetObservedSelf())
+	links.SetObservedSelf("10.0.0.4:5000", "6.6.6.6:5000")
+	assert.Equal(t, "1.2.3.4:5000", links.GetObservedSelf(), "ties should keep the current address")
+	links.SetObservedSelf("10.0.0.1:5000", "6.6.6.6:5000")
+	assert.Equal(t, "6.6.6.6:5000", links.GetObservedSelf())
+}
+
+func TestPunchPongs(t *testing.T) {
+
+	links := peers.NewDirectLinks()
+	candidate := peers.StringToUDPAddress("1.2.3.4:5000")
+	attacker := peers.StringToUDPAddress("6.6.6.6:5000")
+
+	// Pongs without an outstanding attempt are dropped
+	assert.False(t, links.ConfirmPong("Bob", 0, candidate))
+	assert.Nil(t, links.GetDirectTarget("Bob"))
+
+	nonce := links.AddCandidate("Bob", candidate)
+	assert.Equal(t, nonce, links.AddCandidate("Bob", candidate), "an attempt should keep its nonce")
+
+	// Pongs with another nonce, or from an address that wasn't pinged, are dropped
+	assert.False(t, links.ConfirmPong("Bob", nonce+1, candidate))
+	assert.False(t, links.ConfirmPong("Bob", nonce, attacker))
+	assert.False(t, links.ConfirmPong("Alice", nonce, candidate))
+	assert.Nil(t, links.GetDirectTarget("Bob"))
+
+	assert.True(t, links.ConfirmPong("Bob", nonce, candidate))
+	assert.True(t, links.IsDirectTarget("Bob", candidate))
+	assert.False(t, links.ConfirmPong("Bob", nonce, candidate), "an attempt should only be confirmed once")
+}
+
+func TestPunchRequestRoute(t *testing.T) {
+
+	g, rec := newInviteGossiper(t, "Alice", "127.0.0.1:47024")
+	defer rec.Close()
+	relay := peers.StringToUDPAddress("127.0.0.1:47025")
+	attacker := peers.StringToUDPAddress("127.0.0.1:47026")
+	g.Router.AddContactIfAbsent("Bob", relay)
+
+	// pings counts the pings sent so far
+	pings := func() int {
+		time.Sleep(50 * time.Millisecond)
+		rec.mux.Lock()
+		defer rec.mux.Unlock()
+		count := 0
+		for _, buf := range rec.sent {
+			var pkt messages.GossipPacket
+			if protobuf.Decode(buf, &pkt) == nil && pkt.Punch != nil && pkt.Punch.Kind == messages.PunchPing {
+				count++
+			}
+		}
+		return count
+	}
+	request := func(origin string, sender *net.UDPAddr) {
+		network.OnReceivePunch(g, &messages.PunchMessage{Origin: origin, Destination: "Alice", HopLimit: 10,
+			Kind: messages.PunchRequest, Addr: "127.0.0.1:47027"}, sender)
+	}
+
+	// Requests of unknown origins, or not coming from the route to their origin, are ignored
+	request("Carol", attacker)
+	request("Bob", attacker)
+	assert.Equal(t, 0, pings())
+	assert.Nil(t, g.DirectLinks.GetDirectTarget("Carol"))
+
+	// Requests on the route are punched, once in a while only
+	request("Bob", relay)
+	assert.Equal(t, 1, pings())
+	request("Bob", relay)
+	assert.Equal(t, 1, pings())
+}
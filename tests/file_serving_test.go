@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"Peerster/backend"
+	"Peerster/entities"
+	"Peerster/files"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidFilenames(t *testing.T) {
+	assert.True(t, files.IsValidFilename("cat.jpg"))
+	assert.True(t, files.IsValidFilename("..cat.jpg"))
+	assert.False(t, files.IsValidFilename(""))
+	assert.False(t, files.IsValidFilename(".."))
+	assert.False(t, files.IsValidFilename("../main.go"))
+	assert.False(t, files.IsValidFilename("dir/cat.jpg"))
+	assert.False(t, files.IsValidFilename(`..\cat.jpg`))
+}
+
+func TestGetLocalFile(t *testing.T) {
+
+	// A local file is complete
+	assert.NoError(t, os.MkdirAll(files.PathToSharedFiles, 0755))
+	defer os.RemoveAll(files.PathToSharedFiles)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(files.PathToSharedFiles, "hello.txt"), []byte("hello"), 0644))
+
+	index := files.NewFileIndex()
+	file := index.AddLocalFile("hello.txt")
+	assert.NotNil(t, file)
+	metahash := files.ToHex(file.MetafileHash)
+
+	path, filename, status, ok := index.GetLocalFile(metahash)
+	assert.True(t, ok)
+	assert.Equal(t, "hello.txt", filename)
+	assert.Equal(t, files.Reconstructed, status)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	// Unknown file
+	_, _, _, ok = index.GetLocalFile("00" + metahash[2:])
+	assert.False(t, ok)
+
+	// A file being downloaded is not complete, and a name escaping its folder has no path
+	hash := make([]byte, files.HashSizeBytes)
+	hash[0] = 1
+	index.AddMonoSourceFile("../../main.go", hash, false, nil)
+	path, _, status, ok = index.GetLocalFile(files.ToHex(hash))
+	assert.True(t, ok)
+	assert.NotEqual(t, files.Reconstructed, status)
+	assert.Equal(t, "", path)
+}
+
+func TestFileRequestFilenames(t *testing.T) {
+
+	router := backend.NewRouter(entities.NewGossiper(&entities.CLArgsGossiper{Name: "Alice", HopLimit: 10}))
+	post := func(path, body string) int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	// Downloads requested by the GUI can't be written outside the downloads folder
+	for _, path := range []string{"/fileRequest", "/fileRequestNetwork"} {
+		assert.Equal(t, http.StatusBadRequest, post(path, `{"filename": "../evil", "metahash": "00", "destination": "Bob"}`), path)
+		assert.Equal(t, http.StatusOK, post(path, `{"filename": "cat.jpg", "metahash": "00", "destination": "Bob"}`), path)
+		assert.Equal(t, http.StatusOK, post(path, `not json`), path)
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"Peerster/crypto_rsa"
+	"Peerster/entities"
+	"Peerster/files"
+	"Peerster/network"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFolderWatcher(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "peerster_shared")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	watcher := files.NewFolderWatcher(dir)
+
+	write := func(name, content string, modTime time.Time) {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		assert.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+	start := time.Now().Add(-time.Hour)
+
+	// New files are reported once they are stable, hidden files are ignored
+	write("a.txt", "a", start)
+	write(".upload-123", "tmp", start)
+	assert.Len(t, watcher.Scan(), 0)
+	assert.Equal(t, []files.FolderEvent{{Kind: files.FileAdded, Filename: "a.txt"}}, watcher.Scan())
+	assert.Len(t, watcher.Scan(), 0)
+
+	// A file still being written is reported when it stops changing
+	write("a.txt", "ab", start.Add(time.Second))
+	assert.Len(t, watcher.Scan(), 0)
+	write("a.txt", "abc", start.Add(2*time.Second))
+	assert.Len(t, watcher.Scan(), 0)
+	assert.Equal(t, []files.FolderEvent{{Kind: files.FileModified, Filename: "a.txt"}}, watcher.Scan())
+
+	// Deleted files are reported at once
+	assert.NoError(t, os.Remove(filepath.Join(dir, "a.txt")))
+	assert.Equal(t, []files.FolderEvent{{Kind: files.FileRemoved, Filename: "a.txt"}}, watcher.Scan())
+	assert.Len(t, watcher.Scan(), 0)
+}
+
+func TestRemoveLocalFile(t *testing.T) {
+
+	assert.NoError(t, os.MkdirAll(files.PathToSharedFiles, 0755))
+	defer os.RemoveAll(files.PathToSharedFiles)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(files.PathToSharedFiles, "doc.txt"), []byte("v1"), 0644))
+
+	index := files.NewFileIndex()
+	file := index.AddLocalFile("doc.txt")
+	assert.NotNil(t, file)
+	metahash, ok := index.GetIndexedLocalFile("doc.txt")
+	assert.True(t, ok)
+	assert.Equal(t, files.ToHex(file.MetafileHash), metahash)
+
+	// Unindexed files are no longer served
+	removed, ok := index.RemoveLocalFile("doc.txt")
+	assert.True(t, ok)
+	assert.Equal(t, metahash, removed)
+	assert.Nil(t, index.CheckHashPresent(file.MetafileHash))
+	_, ok = index.GetIndexedLocalFile("doc.txt")
+	assert.False(t, ok)
+
+	// A new version gets a new metahash
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(files.PathToSharedFiles, "doc.txt"), []byte("v2"), 0644))
+	other := index.AddLocalFile("doc.txt")
+	assert.NotNil(t, other)
+	assert.NotEqual(t, metahash, files.ToHex(other.MetafileHash))
+}
+
+func TestModifiedFileClaim(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "peerster_shared")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sharedDir := files.SharedFilesDir
+	files.SharedFilesDir = dir + "/"
+	defer func() { files.SharedFilesDir = sharedDir }()
+
+	g := entities.NewGossiper(&entities.CLArgsGossiper{Name: "Alice", HopLimit: 10})
+	g.Keys = crypto_rsa.GeneratePrivateKey()
+
+	// The file is claimed when added, and claimed again with its new metahash when modified
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("first"), 0644))
+	network.OnSharedFolderEvents(g, []files.FolderEvent{{Kind: files.FileAdded, Filename: "a.txt"}})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("second"), 0644))
+	network.OnSharedFolderEvents(g, []files.FolderEvent{{Kind: files.FileModified, Filename: "a.txt"}})
+
+	metahash, ok := g.FileIndex.GetIndexedLocalFile("a.txt")
+	assert.True(t, ok)
+	head := g.Blockchain.GetHead()
+	assert.Equal(t, 2, len(head.Transactions))
+	assert.Equal(t, metahash, files.ToHex(head.Claims["a.txt"].File.MetafileHash))
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"Peerster/frontend"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrontendLogCursors(t *testing.T) {
+
+	buffer := frontend.NewFrontendBuffer()
+	epoch := buffer.GetEpoch()
+	buffer.AddFrontendPeer("127.0.0.1", "5000")
+	buffer.AddFrontendRumor("Alice", "hello")
+	assert.Equal(t, uint64(2), buffer.GetLastSeq())
+
+	// Subscribers don't consume the log
+	first, reset := buffer.GetUpdatesSince("", 0)
+	assert.False(t, reset)
+	assert.Len(t, first, 2)
+	assert.Equal(t, uint64(1), first[0].Seq)
+	second, _ := buffer.GetUpdatesSince("", 0)
+	assert.Len(t, second, 2)
+
+	// Resume from a cursor
+	updates, reset := buffer.GetUpdatesSince(epoch, 1)
+	assert.False(t, reset)
+	assert.Len(t, updates, 1)
+	assert.Equal(t, "hello", updates[0].Rumor.Msg)
+	updates, _ = buffer.GetUpdatesSince(epoch, 2)
+	assert.Len(t, updates, 0)
+
+	// A cursor from a previous run resets the subscriber, even if the new log didn't reach it yet
+	updates, reset = buffer.GetUpdatesSince(epoch, 42)
+	assert.True(t, reset)
+	assert.Len(t, updates, 2)
+	previous := frontend.NewFrontendBuffer().GetEpoch()
+	assert.NotEqual(t, epoch, previous)
+	updates, reset = buffer.GetUpdatesSince(previous, 1)
+	assert.True(t, reset)
+	assert.Len(t, updates, 2)
+	updates, reset = buffer.GetUpdatesSince("", 1)
+	assert.True(t, reset)
+	assert.Len(t, updates, 2)
+}
+
+func TestFrontendLogEpochCursor(t *testing.T) {
+
+	buffer := frontend.NewFrontendBuffer()
+	buffer.AddFrontendRumor("Alice", "hello")
+	updates, _ := buffer.GetUpdatesSince("", 0)
+	assert.Equal(t, buffer.GetEpoch(), updates[0].Epoch)
+
+	epoch, seq, err := frontend.ParseCursor(frontend.FormatCursor(updates[0].Epoch, updates[0].Seq))
+	assert.NoError(t, err)
+	assert.Equal(t, buffer.GetEpoch(), epoch)
+	assert.Equal(t, uint64(1), seq)
+
+	// Bare sequence numbers have no epoch
+	epoch, seq, err = frontend.ParseCursor("7")
+	assert.NoError(t, err)
+	assert.Equal(t, "", epoch)
+	assert.Equal(t, uint64(7), seq)
+	_, _, err = frontend.ParseCursor("abc-x")
+	assert.Error(t, err)
+}
+
+func TestFrontendLogOverflow(t *testing.T) {
+
+	buffer := frontend.NewFrontendBuffer()
+	epoch := buffer.GetEpoch()
+	for i := 0; i < frontend.MaxFrontendUpdates+5; i++ {
+		buffer.AddFrontendPrivateContact("Bob")
+	}
+
+	// The subscriber missed the 5 oldest updates
+	updates, reset := buffer.GetUpdatesSince(epoch, 3)
+	assert.True(t, reset)
+	assert.Len(t, updates, frontend.MaxFrontendUpdates)
+	assert.Equal(t, uint64(6), updates[0].Seq)
+
+	updates, reset = buffer.GetUpdatesSince(epoch, 6)
+	assert.False(t, reset)
+	assert.Len(t, updates, frontend.MaxFrontendUpdates-1)
+}
+
+func TestFrontendLogWait(t *testing.T) {
+
+	buffer := frontend.NewFrontendBuffer()
+	wait := buffer.Wait()
+
+	select {
+	case <-wait:
+		t.Fatal("woken up without update")
+	default:
+	}
+
+	go buffer.AddFrontendPrivateContact("Bob")
+	select {
+	case <-wait:
+	case <-time.After(time.Second):
+		t.Fatal("not woken up by an update")
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"Peerster/entities"
+	"Peerster/guard"
+	"Peerster/messages"
+	"Peerster/network"
+	"Peerster/transport"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+
+	bucket := guard.NewTokenBucket(10, 3)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, bucket.Allow(now), "the burst should be allowed")
+	}
+	assert.False(t, bucket.Allow(now), "the bucket should be empty")
+	assert.True(t, bucket.Allow(now.Add(150*time.Millisecond)), "one token should be refilled")
+	assert.False(t, bucket.Allow(now.Add(150*time.Millisecond)))
+}
+
+func TestRateLimiter(t *testing.T) {
+
+	limiter := guard.NewRateLimiter(guard.Quota{Rate: 1, Burst: 5}, map[string]guard.Quota{"search": {Rate: 1, Burst: 2}})
+
+	ok, _ := limiter.Allow("127.0.0.1:6000", "search")
+	assert.True(t, ok)
+	ok, _ = limiter.Allow("127.0.0.1:6000", "search")
+	assert.True(t, ok)
+	ok, reason := limiter.Allow("127.0.0.1:6000", "search")
+	assert.False(t, ok)
+	assert.Equal(t, "quota:search", reason)
+
+	ok, _ = limiter.Allow("127.0.0.1:6001", "search")
+	assert.True(t, ok, "sources should be limited independently")
+
+	ok, _ = limiter.Allow("127.0.0.1:6000", "rumor")
+	assert.True(t, ok, "types should be limited independently")
+	ok, _ = limiter.Allow("127.0.0.1:6000", "rumor")
+	assert.True(t, ok)
+	ok, reason = limiter.Allow("127.0.0.1:6000", "rumor")
+	assert.False(t, ok)
+	assert.Equal(t, "rate", reason)
+}
+
+func TestBlacklist(t *testing.T) {
+
+	blacklist := guard.NewBlacklist()
+	source := "127.0.0.1:6000"
+
+	for i := 1; i < guard.BlacklistStrikes; i++ {
+		assert.False(t, blacklist.Strike(source))
+	}
+	assert.False(t, blacklist.IsBlacklisted(source))
+	assert.True(t, blacklist.Strike(source))
+	assert.True(t, blacklist.IsBlacklisted(source))
+	assert.False(t, blacklist.IsBlacklisted("127.0.0.1:6001"))
+	assert.Equal(t, []string{source}, blacklist.GetBlacklisted())
+
+	// Sources that stopped sending invalid packets are forgotten, then the blacklisted ones once released
+	assert.False(t, blacklist.Strike("127.0.0.1:6001"))
+	now := time.Now()
+	assert.Equal(t, 0, blacklist.Expire(now))
+	assert.Equal(t, 1, blacklist.Expire(now.Add((guard.StrikeWindowSec+1)*time.Second)))
+	assert.Equal(t, []string{source}, blacklist.GetBlacklisted())
+	assert.Equal(t, 1, blacklist.Expire(now.Add((guard.BlacklistDurationSec+1)*time.Second)))
+	assert.Equal(t, 0, blacklist.Expire(now.Add((guard.BlacklistDurationSec+1)*time.Second)))
+}
+
+func TestWorkerPool(t *testing.T) {
+
+	pool := guard.NewWorkerPool(2, 1)
+	drops := guard.NewDropCounters()
+
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	// Two tasks occupy the workers, one waits in the queue, the others are dropped
+	for i := 0; i < 5; i++ {
+		if !pool.Submit(func() { <-release; wg.Done() }) {
+			drops.Increment("overload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, map[string]uint64{"overload": 2}, drops.Snapshot(), fmt.Sprint(drops.Snapshot()))
+
+	close(release)
+	wg.Wait()
+}
+
+func TestWorkerPoolSlowHandlers(t *testing.T) {
+
+	// Two neighbors, so that received rumors are mongered to the other one
+	var neighbors []*net.UDPAddr
+	for i := 0; i < 2; i++ {
+		conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		assert.NoError(t, err)
+		defer conn.Close()
+		neighbors = append(neighbors, conn.LocalAddr().(*net.UDPAddr))
+	}
+	channel, err := transport.NewUDPTransport("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer channel.Close()
+
+	g := entities.NewGossiper(&entities.CLArgsGossiper{Name: "Alice", HopLimit: 10})
+	g.GossipChannel = channel
+	g.Workers = guard.NewWorkerPool(2, 16)
+	for _, neighbor := range neighbors {
+		g.PeerIndex.AddPeerIfAbsent(neighbor)
+	}
+
+	// Mongering waits a second for each rumor's acknowledgement: the workers mustn't
+	for i := uint32(1); i <= 8; i++ {
+		rumor := &messages.RumorMessage{Origin: "Bob", ID: i, Text: fmt.Sprint("hello ", i)}
+		threadID := i
+		assert.True(t, g.Workers.Submit(func() { network.OnReceiveRumor(g, rumor, neighbors[0], threadID) }))
+	}
+
+	// A status packet queued behind them is still handled right away
+	done := make(chan struct{})
+	status := &messages.StatusPacket{Probe: true}
+	assert.True(t, g.Workers.Submit(func() { network.OnReceiveStatus(g, status, neighbors[1], 100); close(done) }))
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Error("status packet not handled while the rumors are mongered")
+	}
+}
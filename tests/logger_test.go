@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"Peerster/logger"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevels(t *testing.T) {
+
+	level, tags, err := logger.ParseLevels("debug,files=trace, chain=error")
+	assert.NoError(t, err)
+	assert.Equal(t, logger.LevelDebug, level)
+	assert.Equal(t, map[string]logger.Level{logger.TagFiles: logger.LevelTrace, logger.TagChain: logger.LevelError}, tags)
+	assert.Equal(t, "debug,chain=error,files=trace", logger.FormatLevels(level, tags))
+
+	for _, spec := range []string{"verbose", "files=loud", "disk=info"} {
+		_, _, err := logger.ParseLevels(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "peerster_logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer logger.Configure(logger.Config{Level: logger.DefaultLevel, Format: logger.FormatText, Protocol: true})
+
+	// Records are filtered by the level of their subsystem, protocol lines are always kept
+	file := filepath.Join(dir, "node.log")
+	assert.NoError(t, logger.Configure(logger.Config{Level: logger.LevelInfo, Tags: map[string]logger.Level{logger.TagFiles: logger.LevelDebug},
+		Format: logger.FormatJSON, File: file, MaxSize: 1024, MaxFiles: 2}))
+	logger.Files.Debug("TestLogFile", "chunk %d", 1)
+	logger.Chain.Debug("TestLogFile", "not written")
+	logger.Routing.Protocol("DSDV %s %s", "Bob", "127.0.0.1:5001")
+	assert.NoError(t, logger.SetLevel(logger.TagChain, logger.LevelTrace))
+	logger.Chain.Trace("TestLogFile", "written")
+
+	data, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 3)
+	var records []map[string]string
+	for _, line := range lines {
+		var record map[string]string
+		assert.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	assert.Equal(t, "files", records[0]["tag"])
+	assert.Equal(t, "chunk 1", records[0]["msg"])
+	assert.Equal(t, "protocol", records[1]["level"])
+	assert.Equal(t, "DSDV Bob 127.0.0.1:5001", records[1]["msg"])
+	assert.Equal(t, "trace", records[2]["level"])
+
+	// The file is rotated when it grows too big, the oldest files being dropped
+	for i := 0; i < 100; i++ {
+		logger.Files.Info("TestLogFile", "record %d", i)
+	}
+	for _, name := range []string{"node.log", "node.log.1", "node.log.2"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if assert.NoError(t, err, name) {
+			assert.True(t, info.Size() <= 1024, name)
+		}
+	}
+	_, err = os.Stat(filepath.Join(dir, "node.log.3"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Error(t, logger.SetLevel("disk", logger.LevelDebug))
+	assert.Error(t, logger.Configure(logger.Config{Format: "xml"}))
+}
@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"Peerster/messages"
+	"Peerster/peers"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxPeers(t *testing.T) {
+
+	peerIndex := peers.NewPeerIndex(2)
+
+	assert.True(t, peerIndex.AddPeerIfAbsent(peers.StringToUDPAddress("127.0.0.1:6000")))
+	assert.True(t, peerIndex.AddPeerIfAbsent(peers.StringToUDPAddress("127.0.0.1:6001")))
+	assert.False(t, peerIndex.AddPeerIfAbsent(peers.StringToUDPAddress("127.0.0.1:6002")), "index should be full")
+	assert.True(t, peerIndex.AddPeerIfAbsent(peers.StringToUDPAddress("127.0.0.1:6001")), "known peers are still accepted")
+	assert.Equal(t, 2, len(peerIndex.GetAllPeers()))
+}
+
+func TestEmptyPeerIndex(t *testing.T) {
+
+	peerIndex := peers.NewPeerIndex(0)
+	assert.Equal(t, "PEERS ", peerIndex.PeersToString())
+
+	// Only the sender of the request is known: nothing to forward to
+	assert.True(t, peerIndex.AddPeerIfAbsent(peers.StringToUDPAddress("127.0.0.1:6000")))
+	assert.Equal(t, "PEERS 127.0.0.1:6000", peerIndex.PeersToString())
+	peerIndex.BroadcastBlockRequest(nil, &messages.BlockRequest{Budget: 4}, "127.0.0.1:6000")
+}
+
+func TestPeerExchange(t *testing.T) {
+
+	self := "127.0.0.1:5000"
+	sender := peers.StringToUDPAddress("127.0.0.1:6000")
+
+	peerIndex := peers.NewPeerIndex(3)
+	peerIndex.AddPeerIfAbsent(sender)
+
+	status := &messages.StatusPacket{
+		Heartbeat: 4,
+		Peers: []messages.PeerHeartbeat{
+			{Addr: self, Heartbeat: 1},
+			{Addr: "127.0.0.1:6000", Heartbeat: 4},
+			{Addr: "127.0.0.1:6001", Heartbeat: 2},
+			{Addr: "127.0.0.1:6002", Heartbeat: 2},
+			{Addr: "127.0.0.1:6003", Heartbeat: 2},
+		},
+	}
+
+	learned := peerIndex.HandleMembership(sender, status, self)
+	assert.Equal(t, []string{"127.0.0.1:6001", "127.0.0.1:6002"}, learned, "only unknown peers are learned, up to the limit")
+	assert.Equal(t, 3, len(peerIndex.GetAllPeers()))
+}
+
+func TestFillMembership(t *testing.T) {
+
+	peerIndex := peers.NewPeerIndex(0)
+	for i := 0; i < 2*peers.PeerExchangeSize; i++ {
+		peerIndex.AddPeerIfAbsent(peers.StringToUDPAddress(fmt.Sprintf("127.0.0.1:%d", 6000+i)))
+	}
+	assert.Equal(t, uint64(1), peerIndex.IncrementHeartbeat())
+	assert.Equal(t, uint64(2), peerIndex.IncrementHeartbeat())
+
+	target := peers.StringToUDPAddress("127.0.0.1:6000")
+	status := &messages.StatusPacket{}
+	peerIndex.FillMembership(status, target)
+
+	assert.Equal(t, uint64(2), status.Heartbeat)
+	assert.Equal(t, peers.PeerExchangeSize, len(status.Peers))
+	for _, entry := range status.Peers {
+		assert.NotEqual(t, "127.0.0.1:6000", entry.Addr, "the target should not be advertised to itself")
+	}
+}
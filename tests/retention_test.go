@@ -0,0 +1,126 @@
+package tests
+
+import (
+	"Peerster/messages"
+	"Peerster/peers"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// addRumors adds count messages from an origin to a name index, with a route rumor every 5 messages
+func addRumors(nameIndex *peers.NameIndex, origin string, count int) {
+	for id := 1; id <= count; id++ {
+		text := fmt.Sprintf("message %d", id)
+		if id%5 == 0 {
+			text = ""
+		}
+		nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: origin, ID: uint32(id), Text: text})
+	}
+}
+
+func TestRetentionWithArchive(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	archive, err := peers.NewRumorArchive(dir)
+	assert.NoError(t, err)
+
+	nameIndex := peers.NewNameIndex()
+	nameIndex.SetRetention(peers.RetentionPolicy{MaxMessages: 3, Archive: archive})
+	addRumors(nameIndex, "Alice", 12)
+
+	// The vector clock still counts the dropped messages
+	assert.Equal(t, uint32(13), nameIndex.GetVectorClock().Want[0].NextID)
+
+	// Peers behind the retention horizon get the archived messages
+	missing := nameIndex.GetMissingRumors(&messages.StatusPacket{}, 100, 1<<20)
+	assert.Len(t, missing, 12)
+	assert.Equal(t, "message 1", missing[0].Text)
+	assert.Equal(t, "", missing[4].Text)
+	assert.Equal(t, "message 11", missing[10].Text)
+
+	// The history skips route rumors and goes through memory, then the archive
+	page, before := nameIndex.GetHistory("Alice", 0, 4, nil)
+	assert.Len(t, page, 4)
+	assert.Equal(t, uint32(12), page[0].ID)
+	assert.Equal(t, uint32(8), page[3].ID)
+	assert.Equal(t, uint32(8), before)
+
+	page, before = nameIndex.GetHistory("Alice", before, 10, nil)
+	assert.Len(t, page, 6)
+	assert.Equal(t, uint32(7), page[0].ID)
+	assert.Equal(t, "message 1", page[5].Text)
+	assert.Equal(t, uint32(0), before)
+}
+
+func TestRetentionWithoutArchive(t *testing.T) {
+
+	nameIndex := peers.NewNameIndex()
+	nameIndex.SetRetention(peers.RetentionPolicy{MaxAge: 50 * time.Millisecond})
+	addRumors(nameIndex, "Bob", 3)
+
+	time.Sleep(100 * time.Millisecond)
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Bob", ID: 4, Text: "recent"})
+	assert.Equal(t, 3, nameIndex.ApplyRetention())
+
+	// Dropped messages are replaced by empty ones so that peers can still catch up
+	missing := nameIndex.GetMissingRumors(&messages.StatusPacket{}, 100, 1<<20)
+	assert.Len(t, missing, 4)
+	assert.Equal(t, "", missing[0].Text)
+	assert.Equal(t, "recent", missing[3].Text)
+
+	page, _ := nameIndex.GetHistory("Bob", 0, 10, nil)
+	assert.Len(t, page, 1)
+	assert.Equal(t, uint32(5), nameIndex.GetVectorClock().Want[0].NextID)
+}
+
+func TestRumorArchive(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	archive, err := peers.NewRumorArchive(dir)
+	assert.NoError(t, err)
+
+	// Route rumors are archived as empty entries, so every ID can be read back
+	nameIndex := peers.NewNameIndex()
+	nameIndex.SetRetention(peers.RetentionPolicy{MaxMessages: 2, Archive: archive})
+	addRumors(nameIndex, "Alice", 12)
+	archived, err := archive.Read("Alice", 4, 7)
+	assert.NoError(t, err)
+	assert.Len(t, archived, 3)
+	assert.Equal(t, uint32(4), archived[0].ID)
+	assert.Equal(t, "", archived[1].Text)
+	assert.Equal(t, "message 6", archived[2].Text)
+
+	// Reads stop at the last archived ID
+	archived, err = archive.Read("Alice", 9, 20)
+	assert.NoError(t, err)
+	assert.Len(t, archived, 2)
+	archived, err = archive.Read("Bob", 1, 20)
+	assert.NoError(t, err)
+	assert.Len(t, archived, 0)
+
+	// Rumors must follow the archived ones
+	assert.Error(t, archive.Append("Alice", []peers.StoredRumor{{Origin: "Alice", ID: 20}}))
+
+	// A new run starts a new archive: IDs restart with the node
+	archive, err = peers.NewRumorArchive(dir)
+	assert.NoError(t, err)
+	archived, err = archive.Read("Alice", 1, 20)
+	assert.NoError(t, err)
+	assert.Len(t, archived, 0)
+	nameIndex = peers.NewNameIndex()
+	nameIndex.SetRetention(peers.RetentionPolicy{MaxMessages: 2, Archive: archive})
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 1, Text: "new run"})
+	addRumors(nameIndex, "Alice", 4)
+	archived, err = archive.Read("Alice", 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "new run", archived[0].Text)
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"Peerster/peers"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingDSDV(t *testing.T) {
+
+	routing := peers.NewRoutingTable(0)
+	a := peers.StringToUDPAddress("127.0.0.1:6000")
+	b := peers.StringToUDPAddress("127.0.0.1:6001")
+
+	assert.True(t, routing.UpdateTableAndPrint("Alice", a, 3, 2))
+	assert.Equal(t, uint32(2), routing.GetHopCount("Alice"))
+
+	assert.False(t, routing.UpdateTableAndPrint("Alice", b, 2, 1), "stale sequence numbers should be ignored")
+	assert.False(t, routing.UpdateTableAndPrint("Alice", b, 3, 2), "equally long routes should be ignored")
+	assert.True(t, routing.UpdateTableAndPrint("Alice", b, 3, 1), "shorter routes should be accepted")
+	assert.True(t, peers.CompareUDPAddress(b, routing.GetTarget("Alice")))
+
+	assert.True(t, routing.UpdateTableAndPrint("Alice", a, 4, 5), "fresher routes should be accepted")
+	assert.True(t, peers.CompareUDPAddress(a, routing.GetTarget("Alice")))
+
+	assert.False(t, routing.UpdateTableAndPrint("Bob", a, 1, peers.MaxHopCount), "too long routes should be ignored")
+	assert.Nil(t, routing.GetTarget("Bob"))
+}
+
+func TestRoutingRelayedContacts(t *testing.T) {
+
+	routing := peers.NewRoutingTable(0)
+	a := peers.StringToUDPAddress("127.0.0.1:6000")
+	b := peers.StringToUDPAddress("127.0.0.1:6001")
+
+	routing.AddContactIfAbsent("Alice", a)
+	assert.Equal(t, uint32(peers.UnknownHopCount), routing.GetHopCount("Alice"))
+
+	routing.AddContactIfAbsent("Alice", b)
+	assert.True(t, peers.CompareUDPAddress(a, routing.GetTarget("Alice")), "relayed packets should not override routes")
+
+	assert.True(t, routing.UpdateTableAndPrint("Alice", b, 1, 3), "any advertisement should replace a relayed contact")
+	routing.AddContactIfAbsent("Alice", a)
+	assert.True(t, peers.CompareUDPAddress(b, routing.GetTarget("Alice")))
+
+	routes := routing.GetRoutes()
+	assert.Equal(t, 1, len(routes))
+	assert.Equal(t, 3, routes[0].HopCount)
+	assert.Equal(t, "127.0.0.1:6001", routes[0].NextHop)
+
+	assert.Equal(t, []string{"Alice"}, routing.RemoveRoutesVia("127.0.0.1:6001"))
+	assert.Nil(t, routing.GetTarget("Alice"))
+}
+
+func TestRoutingExpiry(t *testing.T) {
+
+	routing := peers.NewRoutingTable(50 * time.Millisecond)
+	a := peers.StringToUDPAddress("127.0.0.1:6000")
+	b := peers.StringToUDPAddress("127.0.0.1:6001")
+
+	routing.UpdateTableAndPrint("Alice", a, 5, 1)
+	assert.NotNil(t, routing.GetTarget("Alice"))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, routing.GetTarget("Alice"), "expired routes should not be used")
+	assert.Equal(t, 0, len(routing.GetRoutes()))
+
+	assert.True(t, routing.UpdateTableAndPrint("Alice", b, 1, 2), "an expired route can be replaced by any advertisement")
+	assert.Equal(t, 0, len(routing.ExpireRoutes()))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, []string{"Alice"}, routing.ExpireRoutes())
+}
@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"Peerster/crypto_rsa"
+	"Peerster/messages"
+	"Peerster/peers"
+	"Peerster/transport"
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiveLoop hands the messages received on a transport to a channel
+func receiveLoop(tr transport.Transport) chan string {
+	received := make(chan string, 16)
+	go func() {
+		for {
+			buf, _, err := tr.Receive()
+			if err != nil {
+				return
+			}
+			received <- string(buf)
+		}
+	}()
+	return received
+}
+
+// expectMessage waits for a message on a channel, returning "" after a timeout
+func expectMessage(received chan string, timeout time.Duration) string {
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(timeout):
+		return ""
+	}
+}
+
+// recordingTransport records the messages sent through a transport, so that they can be replayed
+type recordingTransport struct {
+	transport.Transport
+	sent [][]byte
+	mux  sync.Mutex
+}
+
+func (rec *recordingTransport) Send(buf []byte, target *net.UDPAddr) error {
+	rec.mux.Lock()
+	rec.sent = append(rec.sent, append([]byte(nil), buf...))
+	rec.mux.Unlock()
+	return rec.Transport.Send(buf, target)
+}
+
+// lastSent returns the last message sent of a kind of the secure channel (nil if none)
+func (rec *recordingTransport) lastSent(kind byte) []byte {
+	rec.mux.Lock()
+	defer rec.mux.Unlock()
+	for i := len(rec.sent) - 1; i >= 0; i-- {
+		if bytes.HasPrefix(rec.sent[i], []byte{0xFE, 'S', 'E', 'C', kind}) {
+			return rec.sent[i]
+		}
+	}
+	return nil
+}
+
+func TestSecureTransport(t *testing.T) {
+
+	key := crypto_rsa.GeneratePrivateKey()
+
+	innerA, err := transport.NewUDPTransport("127.0.0.1:47011")
+	assert.NoError(t, err)
+	a := transport.NewSecureTransport(innerA, key, true)
+	defer a.Close()
+	innerB, err := transport.NewUDPTransport("127.0.0.1:47012")
+	assert.NoError(t, err)
+	b := transport.NewSecureTransport(innerB, crypto_rsa.GeneratePrivateKey(), true)
+	defer b.Close()
+
+	receivedA := receiveLoop(a)
+	receivedB := receiveLoop(b)
+	addrA := peers.StringToUDPAddress("127.0.0.1:47011")
+	addrB := peers.StringToUDPAddress("127.0.0.1:47012")
+
+	// The first message is queued until the handshake completes
+	assert.NoError(t, a.Send([]byte("hello"), addrB))
+	assert.Equal(t, "hello", expectMessage(receivedB, time.Second))
+	assert.True(t, a.IsEstablished("127.0.0.1:47012"))
+	assert.True(t, b.IsEstablished("127.0.0.1:47011"))
+
+	assert.NoError(t, b.Send([]byte("world"), addrA))
+	assert.Equal(t, "world", expectMessage(receivedA, time.Second))
+
+	// Plaintext packets are rejected on secure links
+	innerC, err := transport.NewUDPTransport("127.0.0.1:47013")
+	assert.NoError(t, err)
+	defer innerC.Close()
+	assert.NoError(t, innerC.Send([]byte("forged"), addrB))
+	assert.Equal(t, "", expectMessage(receivedB, 200*time.Millisecond))
+
+	// ... but accepted on plaintext links
+	b.SetPeerMode("127.0.0.1:47013", false)
+	assert.NoError(t, innerC.Send([]byte("plain"), addrB))
+	assert.Equal(t, "plain", expectMessage(receivedB, time.Second))
+}
+
+func TestSecureTransportNegotiation(t *testing.T) {
+
+	innerA, err := transport.NewUDPTransport("127.0.0.1:47018")
+	assert.NoError(t, err)
+	a := transport.NewSecureTransport(innerA, crypto_rsa.GeneratePrivateKey(), true)
+	defer a.Close()
+	udpB, err := transport.NewUDPTransport("127.0.0.1:47019")
+	assert.NoError(t, err)
+	b := transport.NewSecureTransport(udpB, crypto_rsa.GeneratePrivateKey(), true)
+	defer b.Close()
+
+	// Neither neighbor advertised its features yet
+	var mux sync.Mutex
+	advertised := map[string]bool{}
+	a.SetSupports(func(addr, feature string) bool {
+		mux.Lock()
+		defer mux.Unlock()
+		return advertised[addr] && feature == messages.CapSecure
+	})
+	b.SetSupports(func(addr, feature string) bool { return false })
+
+	receiveLoop(a)
+	receivedB := receiveLoop(b)
+	addrB := peers.StringToUDPAddress("127.0.0.1:47019")
+
+	// Links stay in plaintext with neighbors that don't advertise the secure channel
+	assert.True(t, a.CanBeSecure("127.0.0.1:47019"))
+	assert.False(t, a.IsSecure("127.0.0.1:47019"))
+	assert.NoError(t, a.Send([]byte("plain"), addrB))
+	assert.Equal(t, "plain", expectMessage(receivedB, time.Second))
+
+	// Once advertised, the link becomes secure: the handshake tells the other end it is supported
+	mux.Lock()
+	advertised["127.0.0.1:47019"] = true
+	mux.Unlock()
+	assert.NoError(t, a.Send([]byte("sealed"), addrB))
+	assert.Equal(t, "sealed", expectMessage(receivedB, time.Second))
+	assert.True(t, b.IsSecure("127.0.0.1:47018"))
+	assert.True(t, b.IsEstablished("127.0.0.1:47018"))
+
+	// Plaintext isn't accepted anymore
+	assert.NoError(t, innerA.Send([]byte("downgraded"), addrB))
+	assert.Equal(t, "", expectMessage(receivedB, 200*time.Millisecond))
+
+	// Links configured in plaintext never become secure
+	a.SetPeerMode("127.0.0.1:47020", false)
+	assert.False(t, a.CanBeSecure("127.0.0.1:47020"))
+}
+
+func TestSecureTransportKeyPinning(t *testing.T) {
+
+	innerA, err := transport.NewUDPTransport("127.0.0.1:47014")
+	assert.NoError(t, err)
+	a := transport.NewSecureTransport(innerA, crypto_rsa.GeneratePrivateKey(), true)
+	innerB, err := transport.NewUDPTransport("127.0.0.1:47015")
+	assert.NoError(t, err)
+	b := transport.NewSecureTransport(innerB, crypto_rsa.GeneratePrivateKey(), true)
+	defer b.Close()
+
+	receiveLoop(a)
+	receivedB := receiveLoop(b)
+	addrB := peers.StringToUDPAddress("127.0.0.1:47015")
+
+	assert.NoError(t, a.Send([]byte("hello"), addrB))
+	assert.Equal(t, "hello", expectMessage(receivedB, time.Second))
+	a.Close()
+
+	// The same address now presents a different key
+	innerA, err = transport.NewUDPTransport("127.0.0.1:47014")
+	assert.NoError(t, err)
+	impostor := transport.NewSecureTransport(innerA, crypto_rsa.GeneratePrivateKey(), true)
+	defer impostor.Close()
+	receiveLoop(impostor)
+
+	assert.NoError(t, impostor.Send([]byte("forged"), addrB))
+	assert.Equal(t, "", expectMessage(receivedB, 500*time.Millisecond))
+
+	// Once the pinned key is forgotten (e.g. the peer restarted), the new key is accepted
+	b.Forget("127.0.0.1:47014")
+	time.Sleep(transport.HandshakeTimeoutSec * time.Second)
+	assert.NoError(t, impostor.Send([]byte("restarted"), addrB))
+	msg := expectMessage(receivedB, time.Second)
+	for msg != "" && msg != "restarted" {
+		msg = expectMessage(receivedB, time.Second)
+	}
+	assert.Equal(t, "restarted", msg)
+}
+
+func TestSecureTransportReplay(t *testing.T) {
+
+	udpA, err := transport.NewUDPTransport("127.0.0.1:47016")
+	assert.NoError(t, err)
+	innerA := &recordingTransport{Transport: udpA}
+	a := transport.NewSecureTransport(innerA, crypto_rsa.GeneratePrivateKey(), true)
+	defer a.Close()
+	innerB, err := transport.NewUDPTransport("127.0.0.1:47017")
+	assert.NoError(t, err)
+	b := transport.NewSecureTransport(innerB, crypto_rsa.GeneratePrivateKey(), true)
+	defer b.Close()
+
+	receivedA := receiveLoop(a)
+	receivedB := receiveLoop(b)
+	addrA := peers.StringToUDPAddress("127.0.0.1:47016")
+	addrB := peers.StringToUDPAddress("127.0.0.1:47017")
+
+	assert.NoError(t, a.Send([]byte("hello"), addrB))
+	assert.Equal(t, "hello", expectMessage(receivedB, time.Second))
+
+	// A replayed message is dropped
+	assert.NoError(t, udpA.Send(innerA.lastSent(3), addrB))
+	assert.Equal(t, "", expectMessage(receivedB, 200*time.Millisecond))
+
+	// A replayed handshake is ignored: the link keeps its key
+	assert.NoError(t, udpA.Send(innerA.lastSent(1), addrB))
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, a.Send([]byte("still there"), addrB))
+	assert.Equal(t, "still there", expectMessage(receivedB, time.Second))
+
+	// Messages that can't be opened in a row make the receiver renegotiate the keys
+	for i := 0; i < transport.MaxOpenFailures; i++ {
+		assert.NoError(t, udpA.Send(append([]byte{0xFE, 'S', 'E', 'C', 3}, bytes.Repeat([]byte{1}, 40)...), addrB))
+	}
+	time.Sleep(200 * time.Millisecond)
+	assert.NotNil(t, innerA.lastSent(2))
+	assert.NoError(t, b.Send([]byte("rekeyed"), addrA))
+	assert.Equal(t, "rekeyed", expectMessage(receivedA, time.Second))
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"Peerster/peers"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const nbSelectionPeers = 10
+
+func newCandidates() []*peers.PeerCandidate {
+	candidates := make([]*peers.PeerCandidate, nbSelectionPeers)
+	for i := range candidates {
+		candidates[i] = &peers.PeerCandidate{
+			Addr: peers.StringToUDPAddress(fmt.Sprintf("127.0.0.1:%d", 6000+i)),
+		}
+	}
+	return candidates
+}
+
+func TestGetRandomNeighborsCoversAllPeers(t *testing.T) {
+
+	peerIndex := peers.NewPeerIndex(0)
+	for i := 0; i < nbSelectionPeers; i++ {
+		peerIndex.AddPeerIfAbsent(peers.StringToUDPAddress(fmt.Sprintf("127.0.0.1:%d", 6000+i)))
+	}
+
+	picked := make(map[string]bool)
+	for i := 0; i < 500; i++ {
+		neighbors := peerIndex.GetRandomNeighbors(2, nil)
+		assert.Equal(t, 2, len(neighbors))
+		assert.False(t, peers.CompareUDPAddress(neighbors[0], neighbors[1]), "neighbors should be distinct")
+		for _, n := range neighbors {
+			picked[peers.UDPAddressToString(n)] = true
+		}
+	}
+	assert.Equal(t, nbSelectionPeers, len(picked), "every peer should eventually be picked")
+
+	assert.Equal(t, nbSelectionPeers, len(peerIndex.GetRandomNeighbors(2*nbSelectionPeers, nil)))
+	assert.Equal(t, nbSelectionPeers-1, len(peerIndex.GetRandomNeighbors(nbSelectionPeers, peers.StringToUDPAddress("127.0.0.1:6000"))))
+	assert.Nil(t, peerIndex.GetRandomNeighbors(0, nil))
+}
+
+func TestNewPeerSelector(t *testing.T) {
+	assert.NotNil(t, peers.NewPeerSelector(peers.UniformSelection))
+	assert.NotNil(t, peers.NewPeerSelector(peers.RTTWeightedSelection))
+	assert.NotNil(t, peers.NewPeerSelector(peers.LeastRecentlyContactedSelection))
+	assert.Nil(t, peers.NewPeerSelector("random"))
+}
+
+func TestRTTWeightedSelector(t *testing.T) {
+
+	candidates := newCandidates()
+	for i, c := range candidates {
+		c.RTT = time.Second
+		if i == 0 {
+			c.RTT = time.Millisecond
+		}
+	}
+
+	selector := &peers.RTTWeightedSelector{}
+	fastPicked := 0
+	for i := 0; i < 200; i++ {
+		selected := selector.Select(candidates, 1)
+		assert.Equal(t, 1, len(selected))
+		if selected[0] == candidates[0] {
+			fastPicked++
+		}
+	}
+	assert.True(t, fastPicked > 150, "the fastest peer should be picked most of the time (%d/200)", fastPicked)
+}
+
+func TestLeastRecentlyContactedSelector(t *testing.T) {
+
+	candidates := newCandidates()
+	now := time.Now()
+	for i, c := range candidates {
+		c.LastContacted = now.Add(time.Duration(-i) * time.Second)
+	}
+
+	selected := (&peers.LeastRecentlyContactedSelector{}).Select(candidates, 3)
+	assert.Equal(t, []*peers.PeerCandidate{candidates[9], candidates[8], candidates[7]}, selected)
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"Peerster/app"
+	"Peerster/messages"
+	"Peerster/peers"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentRumors(t *testing.T) {
+
+	nameIndex := peers.NewNameIndex()
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 1, Text: "a1"})
+	time.Sleep(time.Millisecond)
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Bob", ID: 1, Text: "b1"})
+	time.Sleep(time.Millisecond)
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 2, Text: ""})
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 3, Text: "dev", Channel: "dev"})
+	time.Sleep(time.Millisecond)
+	nameIndex.AddMessageIfNext(&messages.RumorMessage{Origin: "Alice", ID: 4, Text: "a4"})
+
+	// Route rumors are skipped, all origins are merged in reception order
+	recent := nameIndex.GetRecentRumors(10, func(stored *peers.StoredRumor) bool { return stored.Channel == "" })
+	assert.Len(t, recent, 3)
+	assert.Equal(t, "a1", recent[0].Text)
+	assert.Equal(t, "b1", recent[1].Text)
+	assert.Equal(t, "a4", recent[2].Text)
+
+	// Only the most recent ones
+	recent = nameIndex.GetRecentRumors(2, nil)
+	assert.Len(t, recent, 2)
+	assert.Equal(t, "dev", recent[0].Text)
+	assert.Equal(t, "a4", recent[1].Text)
+}
+
+func TestConversations(t *testing.T) {
+
+	nameIndex := peers.NewNameIndex()
+	nameIndex.AddPrivateMessage(&messages.PrivateMessage{Origin: "Me", Destination: "Bob", Text: "hi Bob"})
+	time.Sleep(time.Millisecond)
+	nameIndex.AddPrivateMessage(&messages.PrivateMessage{Origin: "Bob", Destination: "Me", Text: "hi"})
+	nameIndex.AddPrivateMessage(&messages.PrivateMessage{Origin: "Carol", Destination: "Me", Text: "hello"})
+
+	conversations := nameIndex.GetConversations("Me")
+	assert.Len(t, conversations, 2)
+	assert.Len(t, conversations["Bob"], 2)
+	assert.Equal(t, "hi Bob", conversations["Bob"][0].Text)
+	assert.Equal(t, "Bob", conversations["Bob"][1].Origin)
+	assert.Len(t, conversations["Carol"], 1)
+}
+
+func TestArtistsSnapshot(t *testing.T) {
+
+	art := app.NewArtSystem()
+	art.AddArtist(&messages.ArtistInfo{Name: "Zoe", Signature: "z"})
+	art.AddArtist(&messages.ArtistInfo{Name: "Alice", Signature: "a"})
+	art.Subscribe("z")
+
+	artists, subscribed := art.GetArtists()
+	assert.Len(t, artists, 2)
+	assert.Equal(t, "Alice", artists[0].Name)
+	assert.Equal(t, []bool{false, true}, subscribed)
+}
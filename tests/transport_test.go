@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"Peerster/messages"
+	"Peerster/peers"
+	"Peerster/transport"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiveWithTimeout waits for a message on a transport, failing after one second
+func receiveWithTimeout(t *testing.T, tr transport.Transport) ([]byte, string) {
+	type result struct {
+		buf    []byte
+		sender string
+	}
+	results := make(chan result, 1)
+	go func() {
+		buf, sender, err := tr.Receive()
+		if err == nil {
+			results <- result{buf, peers.UDPAddressToString(sender)}
+		}
+	}()
+
+	select {
+	case r := <-results:
+		return r.buf, r.sender
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+		return nil, ""
+	}
+}
+
+func TestHybridTransport(t *testing.T) {
+
+	a, err := transport.NewHybridTransport("127.0.0.1:47001")
+	assert.NoError(t, err)
+	defer a.Close()
+	b, err := transport.NewHybridTransport("127.0.0.1:47002")
+	assert.NoError(t, err)
+	defer b.Close()
+
+	target := peers.StringToUDPAddress("127.0.0.1:47002")
+
+	// Small messages go in a datagram
+	assert.NoError(t, a.Send([]byte("hello"), target))
+	buf, sender := receiveWithTimeout(t, b)
+	assert.Equal(t, []byte("hello"), buf)
+	assert.Equal(t, "127.0.0.1:47001", sender)
+
+	// Oversized messages go on a stream, and are attributed to the sender's gossip address
+	large := bytes.Repeat([]byte{42}, 4*transport.MaxDatagramSize)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, a.Send(large, target))
+		buf, sender = receiveWithTimeout(t, b)
+		assert.Equal(t, len(large), len(buf))
+		assert.True(t, bytes.Equal(large, buf))
+		assert.Equal(t, "127.0.0.1:47001", sender)
+	}
+}
+
+func TestUDPTransportTooLarge(t *testing.T) {
+
+	udp, err := transport.NewUDPTransport("127.0.0.1:47003")
+	assert.NoError(t, err)
+	defer udp.Close()
+
+	large := make([]byte, transport.MaxDatagramSize+1)
+	assert.Error(t, udp.Send(large, peers.StringToUDPAddress("127.0.0.1:47004")))
+}
+
+func TestFragmentingTransport(t *testing.T) {
+
+	udpA, err := transport.NewUDPTransport("127.0.0.1:47005")
+	assert.NoError(t, err)
+	a := transport.NewFragmentingTransport(udpA)
+	defer a.Close()
+	udpB, err := transport.NewUDPTransport("127.0.0.1:47006")
+	assert.NoError(t, err)
+	b := transport.NewFragmentingTransport(udpB)
+	defer b.Close()
+
+	target := peers.StringToUDPAddress("127.0.0.1:47006")
+
+	// Small messages are not fragmented
+	assert.NoError(t, a.Send([]byte("hello"), target))
+	buf, sender := receiveWithTimeout(t, b)
+	assert.Equal(t, []byte("hello"), buf)
+	assert.Equal(t, "127.0.0.1:47005", sender)
+
+	// Oversized messages are fragmented and reassembled
+	large := make([]byte, 5*transport.MaxFragmentSize+123)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	assert.NoError(t, a.Send(large, target))
+	buf, sender = receiveWithTimeout(t, b)
+	assert.True(t, bytes.Equal(large, buf))
+	assert.Equal(t, "127.0.0.1:47005", sender)
+
+	assert.Error(t, a.Send(make([]byte, transport.MaxFragmentedMessageSize+1), target))
+}
+
+// datagramQueue is a transport receiving the datagrams pushed to it
+type datagramQueue struct {
+	transport.Transport
+	datagrams chan []byte
+	senders   chan *net.UDPAddr
+}
+
+func (queue *datagramQueue) Receive() ([]byte, *net.UDPAddr, error) {
+	return <-queue.datagrams, <-queue.senders, nil
+}
+
+func (queue *datagramQueue) push(datagram []byte, sender string) {
+	queue.datagrams <- datagram
+	queue.senders <- peers.StringToUDPAddress(sender)
+}
+
+// fragment builds the fragment of a message filled with a byte
+func fragment(id uint64, index, size int, fill byte) []byte {
+	payloadSize := transport.MaxFragmentSize - 24
+	count := (size + payloadSize - 1) / payloadSize
+	header := make([]byte, 24)
+	copy(header, []byte{0xFF, 'F', 'R', 'G'})
+	binary.BigEndian.PutUint64(header[4:], id)
+	binary.BigEndian.PutUint32(header[12:], uint32(index))
+	binary.BigEndian.PutUint32(header[16:], uint32(count))
+	binary.BigEndian.PutUint32(header[20:], uint32(size))
+	length := payloadSize
+	if index == count-1 {
+		length = size - index*payloadSize
+	}
+	return append(header, bytes.Repeat([]byte{fill}, length)...)
+}
+
+func TestFragmentingTransportBudget(t *testing.T) {
+
+	queue := &datagramQueue{datagrams: make(chan []byte, 100), senders: make(chan *net.UDPAddr, 100)}
+	frag := transport.NewFragmentingTransport(queue)
+	size := 2 * (transport.MaxFragmentSize - 24)
+
+	// A sender claiming huge messages doesn't block the others: only the bytes received are counted
+	for id := uint64(1); id <= 10; id++ {
+		queue.push(fragment(id, 0, transport.MaxFragmentedMessageSize, 0), "127.0.0.1:1")
+	}
+	queue.push(fragment(1, 0, size, 7), "127.0.0.1:2")
+	queue.push(fragment(1, 1, size, 7), "127.0.0.1:2")
+	buf, sender := receiveWithTimeout(t, frag)
+	assert.Equal(t, "127.0.0.1:2", sender)
+	assert.True(t, bytes.Equal(bytes.Repeat([]byte{7}, size), buf))
+
+	// A sender with too many messages in flight loses its oldest ones first
+	for id := uint64(1); id <= transport.MaxReassemblyMessagesPerSender+1; id++ {
+		queue.push(fragment(id, 0, size, byte(id)), "127.0.0.1:3")
+	}
+	queue.push(fragment(1, 1, size, 1), "127.0.0.1:3")
+	queue.push(fragment(transport.MaxReassemblyMessagesPerSender+1, 1, size, 9), "127.0.0.1:3")
+	buf, _ = receiveWithTimeout(t, frag)
+	assert.Equal(t, byte(transport.MaxReassemblyMessagesPerSender+1), buf[0])
+	assert.Equal(t, byte(9), buf[size-1])
+}
+
+func TestHybridTransportFallback(t *testing.T) {
+
+	a, err := transport.NewHybridTransport("127.0.0.1:47007")
+	assert.NoError(t, err)
+	defer a.Close()
+
+	// The target doesn't accept streams
+	udpB, err := transport.NewUDPTransport("127.0.0.1:47008")
+	assert.NoError(t, err)
+	b := transport.NewFragmentingTransport(udpB)
+	defer b.Close()
+
+	large := bytes.Repeat([]byte{7}, 3*transport.MaxDatagramSize)
+	assert.NoError(t, a.Send(large, peers.StringToUDPAddress("127.0.0.1:47008")))
+	buf, sender := receiveWithTimeout(t, b)
+	assert.True(t, bytes.Equal(large, buf))
+	assert.Equal(t, "127.0.0.1:47007", sender)
+
+	// Oversized messages are only sent to targets that advertised fragments or streams
+	advertised := map[string]bool{}
+	a.SetSupports(func(addr, feature string) bool { return advertised[feature] })
+	assert.Error(t, a.Send(large, peers.StringToUDPAddress("127.0.0.1:47008")))
+	assert.NoError(t, a.Send([]byte("small"), peers.StringToUDPAddress("127.0.0.1:47008")))
+	buf, _ = receiveWithTimeout(t, b)
+	assert.Equal(t, []byte("small"), buf)
+	advertised[messages.CapFragments] = true
+	assert.NoError(t, a.Send(large, peers.StringToUDPAddress("127.0.0.1:47008")))
+	buf, _ = receiveWithTimeout(t, b)
+	assert.True(t, bytes.Equal(large, buf))
+}
+
+func TestStreamTransportLimits(t *testing.T) {
+
+	stream, err := transport.NewStreamTransport("127.0.0.1:47009")
+	assert.NoError(t, err)
+
+	// Streams beyond the limit are refused, the others stay open
+	var conns []net.Conn
+	for i := 0; i < transport.MaxInboundStreams+1; i++ {
+		conn, err := net.Dial("tcp4", "127.0.0.1:47009")
+		assert.NoError(t, err)
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	refused := conns[len(conns)-1]
+	refused.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = refused.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err, "the stream beyond the limit should be closed")
+	conns[0].SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = conns[0].Read(make([]byte, 1))
+	if netErr, ok := err.(net.Error); assert.True(t, ok) {
+		assert.True(t, netErr.Timeout(), "streams within the limit should stay open")
+	}
+
+	// Once closed, Receive fails instead of blocking, and open streams are closed
+	assert.NoError(t, stream.Close())
+	_, _, err = stream.Receive()
+	assert.True(t, transport.IsClosed(err))
+	conns[0].SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conns[0].Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestHybridTransportClose(t *testing.T) {
+
+	hybrid, err := transport.NewHybridTransport("127.0.0.1:47010")
+	assert.NoError(t, err)
+	assert.NoError(t, hybrid.Close())
+
+	_, _, err = hybrid.Receive()
+	assert.True(t, transport.IsClosed(err))
+}
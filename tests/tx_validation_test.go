@@ -88,6 +88,36 @@ func TestTryAddSecondTx(t *testing.T) {
 	assert.Equal(t, 1, len(fbb.Filenames))
 }
 
+func TestUpdateOwnFile(t *testing.T) {
+	ownerKey, tx := newTx()
+	fbb := createFBB(t, tx)
+
+	// The owner of a filename claims the new hash of its modified file
+	someBytes := utils.Random32Bytes()
+	modified := &messages.File{Name: tx.File.Name, Size: 64, MetafileHash: someBytes[:]}
+	assert.True(t, fbb.AddTxIfValid(fileToNewTx(modified, ownerKey)))
+	assert.Equal(t, 1, len(fbb.Transactions))
+	assert.Equal(t, 1, len(fbb.Filenames))
+
+	// Then again, in the same block and in the next one
+	someBytes = utils.Random32Bytes()
+	again := &messages.File{Name: tx.File.Name, Size: 96, MetafileHash: someBytes[:]}
+	assert.True(t, fbb.AddTxIfValid(fileToNewTx(again, ownerKey)))
+	next := mineAndGetNextBlock(fbb)
+	someBytes = utils.Random32Bytes()
+	last := &messages.File{Name: tx.File.Name, Size: 128, MetafileHash: someBytes[:]}
+	assert.True(t, next.AddTxIfValid(fileToNewTx(last, ownerKey)))
+
+	// Others can't, even with the owner's public key
+	otherKey := crypto_rsa.GeneratePrivateKey()
+	someBytes = utils.Random32Bytes()
+	stolen := &messages.File{Name: tx.File.Name, Size: 32, MetafileHash: someBytes[:]}
+	assert.False(t, next.AddTxIfValid(fileToNewTx(stolen, otherKey)))
+	forged := fileToNewTx(stolen, otherKey)
+	forged.PublicKey = &ownerKey.PublicKey
+	assert.False(t, next.AddTxIfValid(forged))
+}
+
 // private functions
 
 func createFBB(t *testing.T, tx *blockchain.Tx) *blockchain.FileBlockBuilder {
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"Peerster/backend"
+	"Peerster/crypto_rsa"
+	"Peerster/entities"
+	"Peerster/files"
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadHandlers(t *testing.T) {
+
+	// A shared folder inside a temporary directory, with small files
+	root, err := ioutil.TempDir("", "upload")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	sharedDir, maxSize := files.SharedFilesDir, files.MaxFileSize
+	files.SharedFilesDir, files.MaxFileSize = filepath.Join(root, "shared")+"/", 16
+	defer func() { files.SharedFilesDir, files.MaxFileSize = sharedDir, maxSize }()
+
+	g := entities.NewGossiper(&entities.CLArgsGossiper{Name: "Alice", HopLimit: 10})
+	g.Keys = crypto_rsa.GeneratePrivateKey()
+	router := backend.NewRouter(g)
+
+	put := func(filename, content string) int {
+		req := httptest.NewRequest("PUT", "/api/v1/files/"+filename, strings.NewReader(content))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	upload := func(filename, content string) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", filename)
+		part.Write([]byte(content))
+		form.Close()
+		req := httptest.NewRequest("POST", "/upload", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	stored := func(filename string) string {
+		data, _ := ioutil.ReadFile(filepath.Join(files.SharedFilesDir, filename))
+		return string(data)
+	}
+
+	// Uploads are stored in the shared folder and indexed
+	assert.Equal(t, http.StatusCreated, put("a.txt", "first"))
+	assert.Equal(t, "first", stored("a.txt"))
+	assert.Equal(t, http.StatusCreated, upload("b.txt", "second"))
+	assert.Equal(t, "second", stored("b.txt"))
+	_, ok := g.FileIndex.GetIndexedLocalFile("b.txt")
+	assert.True(t, ok)
+
+	// Duplicate names are rejected without replacing the file
+	assert.Equal(t, http.StatusConflict, put("a.txt", "other"))
+	assert.Equal(t, http.StatusConflict, upload("a.txt", "other"))
+	assert.Equal(t, "first", stored("a.txt"))
+
+	// Size limit
+	assert.Equal(t, http.StatusRequestEntityTooLarge, put("big.txt", strings.Repeat("x", 17)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload("big.txt", strings.Repeat("x", 17)))
+	assert.Equal(t, http.StatusBadRequest, put("empty.txt", ""))
+	_, err = os.Stat(filepath.Join(files.SharedFilesDir, "big.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Nothing is written outside of the shared folder
+	assert.NotEqual(t, http.StatusCreated, put("..%2Fx", "escape"))
+	upload("../y", "escape")
+	for _, name := range []string{"x", "y"} {
+		_, err = os.Stat(filepath.Join(root, name))
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// No temporary file is left behind
+	entries, _ := ioutil.ReadDir(files.SharedFilesDir)
+	for _, entry := range entries {
+		assert.False(t, strings.HasPrefix(entry.Name(), ".upload-"))
+	}
+}
@@ -0,0 +1,257 @@
+package transport
+
+import (
+	"Peerster/fail"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxFragmentSize is the maximum size of a fragment datagram (header included)
+	MaxFragmentSize = 8192
+	// MaxFragmentedMessageSize is the maximum size of a message sent in fragments
+	MaxFragmentedMessageSize = 16 * 1024 * 1024
+	// MaxReassemblyBytes is the maximum amount of memory used by messages being reassembled
+	MaxReassemblyBytes = 64 * 1024 * 1024
+	// MaxReassemblyBytesPerSender is the maximum amount of memory used by the messages of a sender
+	MaxReassemblyBytesPerSender = MaxFragmentedMessageSize
+	// MaxReassemblyMessagesPerSender is the maximum number of messages of a sender being reassembled
+	MaxReassemblyMessagesPerSender = 4
+	// ReassemblyTimeoutSec is the duration after which an incomplete message is dropped
+	ReassemblyTimeoutSec = 5
+
+	// fragmentHeaderSize is the size of the header prepended to each fragment:
+	// magic (4) | message ID (8) | fragment index (4) | fragment count (4) | message size (4)
+	fragmentHeaderSize = 24
+	// maxFragmentPayload is the number of message bytes carried by a fragment
+	maxFragmentPayload = MaxFragmentSize - fragmentHeaderSize
+)
+
+// fragmentMagic starts every fragment. 0xFF can't start a protobuf-encoded message (wire type 7 doesn't
+// exist), so fragments are never mistaken for whole GossipPackets.
+var fragmentMagic = []byte{0xFF, 'F', 'R', 'G'}
+
+// FragmentingTransport represents a datagram transport splitting messages too large for a datagram into
+// fragments, and reassembling the fragments it receives
+type FragmentingTransport struct {
+	inner     Transport                    // The datagram transport used to send messages and fragments
+	nextID    uint64                       // The ID of the next fragmented message we send
+	buffers   map[string]*reassemblyBuffer // Messages being reassembled, indexed by sender and message ID
+	senders   map[string]*reassemblyUsage  // The memory and messages used by each sender
+	usedBytes int                          // The memory used by the messages being reassembled
+	nextOrder uint64                       // The order of the next message whose reassembly starts
+	mux       sync.Mutex                   // Mutex to manipulate the structure from different threads
+}
+
+// reassemblyBuffer represents a message being reassembled
+type reassemblyBuffer struct {
+	sender    string    // The sender of the message
+	fragments [][]byte  // The fragments received so far (nil if missing)
+	received  int       // The number of fragments received so far
+	bytes     int       // The number of bytes received so far
+	size      int       // The size of the complete message
+	created   time.Time // The time the first fragment was received
+	order     uint64    // The order in which the reassembly started, to find the oldest messages
+}
+
+// reassemblyUsage represents what a sender uses for the messages it has being reassembled
+type reassemblyUsage struct {
+	bytes    int // The bytes received so far
+	messages int // The number of messages
+}
+
+// NewFragmentingTransport creates a new instance of FragmentingTransport on top of a datagram transport
+func NewFragmentingTransport(inner Transport) *FragmentingTransport {
+	return &FragmentingTransport{
+		inner:   inner,
+		nextID:  uint64(time.Now().UnixNano()), // Avoid reusing IDs after a restart
+		buffers: make(map[string]*reassemblyBuffer),
+		senders: make(map[string]*reassemblyUsage),
+	}
+}
+
+// Send sends a message in a single datagram if it fits, or in fragments otherwise
+func (frag *FragmentingTransport) Send(buf []byte, target *net.UDPAddr) error {
+	if len(buf) <= MaxDatagramSize {
+		return frag.inner.Send(buf, target)
+	}
+	if len(buf) > MaxFragmentedMessageSize {
+		return &fail.CustomError{Fun: "FragmentingTransport.Send", Desc: "message too large"}
+	}
+
+	frag.mux.Lock()
+	id := frag.nextID
+	frag.nextID++
+	frag.mux.Unlock()
+
+	count := (len(buf) + maxFragmentPayload - 1) / maxFragmentPayload
+	for i := 0; i < count; i++ {
+		end := (i + 1) * maxFragmentPayload
+		if end > len(buf) {
+			end = len(buf)
+		}
+		fragment := encodeFragment(id, i, count, len(buf), buf[i*maxFragmentPayload:end])
+		if err := frag.inner.Send(fragment, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive blocks until a complete message (whole datagram or reassembled fragments) is received
+func (frag *FragmentingTransport) Receive() ([]byte, *net.UDPAddr, error) {
+	for {
+		buf, sender, err := frag.inner.Receive()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !bytes.HasPrefix(buf, fragmentMagic) {
+			return buf, sender, nil
+		}
+
+		if msg := frag.addFragment(buf, sender); msg != nil {
+			return msg, sender, nil
+		}
+	}
+}
+
+// Close closes the underlying transport
+func (frag *FragmentingTransport) Close() error {
+	return frag.inner.Close()
+}
+
+// encodeFragment builds a fragment datagram
+func encodeFragment(id uint64, index, count, size int, payload []byte) []byte {
+	fragment := make([]byte, fragmentHeaderSize, fragmentHeaderSize+len(payload))
+	copy(fragment, fragmentMagic)
+	binary.BigEndian.PutUint64(fragment[4:], id)
+	binary.BigEndian.PutUint32(fragment[12:], uint32(index))
+	binary.BigEndian.PutUint32(fragment[16:], uint32(count))
+	binary.BigEndian.PutUint32(fragment[20:], uint32(size))
+	return append(fragment, payload...)
+}
+
+// addFragment stores a fragment and returns the complete message if it was the last missing one
+func (frag *FragmentingTransport) addFragment(fragment []byte, sender *net.UDPAddr) []byte {
+	frag.mux.Lock()
+	defer frag.mux.Unlock()
+
+	frag.expireUnsafe()
+
+	// Parse and check the header
+	if len(fragment) < fragmentHeaderSize {
+		return nil
+	}
+	id := binary.BigEndian.Uint64(fragment[4:])
+	index := int(binary.BigEndian.Uint32(fragment[12:]))
+	count := int(binary.BigEndian.Uint32(fragment[16:]))
+	size := int(binary.BigEndian.Uint32(fragment[20:]))
+	payload := fragment[fragmentHeaderSize:]
+
+	if size > MaxFragmentedMessageSize || count != (size+maxFragmentPayload-1)/maxFragmentPayload ||
+		index >= count || len(payload) > maxFragmentPayload {
+		return nil
+	}
+
+	source := sender.String()
+	key := fmt.Sprintf("%s/%d", source, id)
+	buffer, ok := frag.buffers[key]
+	if !ok {
+		buffer = &reassemblyBuffer{sender: source, fragments: make([][]byte, count), size: size,
+			created: time.Now(), order: frag.nextOrder}
+		frag.nextOrder++
+		frag.buffers[key] = buffer
+		if _, ok := frag.senders[source]; !ok {
+			frag.senders[source] = &reassemblyUsage{}
+		}
+		frag.senders[source].messages++
+	} else if buffer.size != size {
+		return nil
+	}
+
+	// Ignore duplicates
+	if buffer.fragments[index] != nil {
+		return nil
+	}
+
+	// Only the bytes actually received are counted. A sender over its budget loses its oldest messages first.
+	usage := frag.senders[source]
+	for usage.messages > MaxReassemblyMessagesPerSender || usage.bytes+len(payload) > MaxReassemblyBytesPerSender {
+		if !frag.dropOldestUnsafe(source, key) {
+			frag.dropUnsafe(key)
+			return nil
+		}
+	}
+	if frag.usedBytes+len(payload) > MaxReassemblyBytes {
+		frag.dropUnsafe(key)
+		return nil
+	}
+	buffer.fragments[index] = append([]byte(nil), payload...)
+	buffer.received++
+	buffer.bytes += len(payload)
+	usage.bytes += len(payload)
+	frag.usedBytes += len(payload)
+
+	if buffer.received < len(buffer.fragments) {
+		return nil
+	}
+
+	// The message is complete
+	frag.dropUnsafe(key)
+
+	msg := make([]byte, 0, buffer.size)
+	for _, f := range buffer.fragments {
+		msg = append(msg, f...)
+	}
+	if len(msg) != buffer.size {
+		return nil
+	}
+	return msg
+}
+
+// expireUnsafe drops the messages that weren't completed on time
+func (frag *FragmentingTransport) expireUnsafe() {
+	for key, buffer := range frag.buffers {
+		if time.Since(buffer.created) > ReassemblyTimeoutSec*time.Second {
+			frag.dropUnsafe(key)
+		}
+	}
+}
+
+// dropOldestUnsafe drops the oldest message of a sender being reassembled, other than the one given.
+// Returns false if there is none.
+func (frag *FragmentingTransport) dropOldestUnsafe(sender, except string) bool {
+	oldest := ""
+	for key, buffer := range frag.buffers {
+		if buffer.sender == sender && key != except &&
+			(oldest == "" || buffer.order < frag.buffers[oldest].order) {
+			oldest = key
+		}
+	}
+	if oldest == "" {
+		return false
+	}
+	frag.dropUnsafe(oldest)
+	return true
+}
+
+// dropUnsafe forgets a message being reassembled and releases the memory it used
+func (frag *FragmentingTransport) dropUnsafe(key string) {
+	buffer, ok := frag.buffers[key]
+	if !ok {
+		return
+	}
+	delete(frag.buffers, key)
+	frag.usedBytes -= buffer.bytes
+	usage := frag.senders[buffer.sender]
+	usage.bytes -= buffer.bytes
+	usage.messages--
+	if usage.messages == 0 {
+		delete(frag.senders, buffer.sender)
+	}
+}
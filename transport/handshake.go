@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"Peerster/crypto_rsa"
+	"Peerster/fail"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"time"
+)
+
+// handshakeMessage represents one of the two messages of the handshake between neighbors: an ephemeral
+// ECDH public key, authenticated by the sender's RSA key
+type handshakeMessage struct {
+	Ephemeral []byte // The sender's ephemeral P-256 public key
+	PublicKey []byte // The sender's RSA public key
+	Timestamp int64  // The time the message was built, in Unix seconds (old handshakes can't be replayed)
+	Signature []byte // RSA signature of the ephemeral keys and the timestamp (see signedContent)
+}
+
+// ephemeralKey represents an ephemeral ECDH key pair
+type ephemeralKey struct {
+	private []byte // The private scalar
+	public  []byte // The marshalled public point
+}
+
+// newEphemeralKey generates a new ephemeral P-256 key pair
+func newEphemeralKey() (*ephemeralKey, error) {
+	private, x, y, err := elliptic.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "newEphemeralKey", Desc: "cannot generate ECDH key"}
+	}
+	return &ephemeralKey{private: private, public: elliptic.Marshal(elliptic.P256(), x, y)}, nil
+}
+
+// signedContent returns what the sender of a handshake message signs: the initiator signs its own
+// ephemeral key, the responder signs both (binding its answer to the initiator's key), each with the
+// timestamp of its message
+func signedContent(initEphemeral, respEphemeral []byte, timestamp int64) []byte {
+	content := append(append([]byte("peerster-handshake"), initEphemeral...), respEphemeral...)
+	var encoded [8]byte
+	binary.BigEndian.PutUint64(encoded[:], uint64(timestamp))
+	return append(content, encoded[:]...)
+}
+
+// newHandshakeMessage builds and signs a handshake message
+func newHandshakeMessage(key *rsa.PrivateKey, ephemeral *ephemeralKey, initEphemeral, respEphemeral []byte) (*handshakeMessage, error) {
+
+	publicKey, err := crypto_rsa.PublicKeyToBytes(&key.PublicKey)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "newHandshakeMessage", Desc: "cannot encode RSA public key"}
+	}
+
+	timestamp := time.Now().Unix()
+	signature, err := crypto_rsa.Sign(signedContent(initEphemeral, respEphemeral, timestamp), key)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "newHandshakeMessage", Desc: "cannot sign ephemeral key"}
+	}
+
+	return &handshakeMessage{Ephemeral: ephemeral.public, PublicKey: publicKey, Timestamp: timestamp,
+		Signature: signature[:]}, nil
+}
+
+// verify checks the signature of a handshake message and returns the sender's RSA public key
+func (msg *handshakeMessage) verify(initEphemeral, respEphemeral []byte) (*rsa.PublicKey, error) {
+
+	publicKey, err := crypto_rsa.BytesToPublicKey(msg.PublicKey)
+	if err != nil || publicKey.N == nil {
+		return nil, &fail.CustomError{Fun: "handshakeMessage.verify", Desc: "invalid RSA public key"}
+	}
+
+	var signature [256]byte
+	if len(msg.Signature) != len(signature) {
+		return nil, &fail.CustomError{Fun: "handshakeMessage.verify", Desc: "invalid signature size"}
+	}
+	copy(signature[:], msg.Signature)
+
+	if crypto_rsa.Verify(signedContent(initEphemeral, respEphemeral, msg.Timestamp), signature, publicKey) != nil {
+		return nil, &fail.CustomError{Fun: "handshakeMessage.verify", Desc: "invalid signature"}
+	}
+	return publicKey, nil
+}
+
+// deriveLinkCipher computes the ECDH shared secret and derives the link's AEAD from it
+func deriveLinkCipher(own *ephemeralKey, peerEphemeral, initEphemeral, respEphemeral []byte) (cipher.AEAD, error) {
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), peerEphemeral)
+	if x == nil {
+		return nil, &fail.CustomError{Fun: "deriveLinkCipher", Desc: "invalid ephemeral key"}
+	}
+	sharedX, _ := elliptic.P256().ScalarMult(x, y, own.private)
+
+	// Derive the symmetric key from the shared secret and the transcript
+	h := sha256.New()
+	h.Write([]byte("peerster-link"))
+	h.Write(padTo32(sharedX))
+	h.Write(initEphemeral)
+	h.Write(respEphemeral)
+	key := h.Sum(nil)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "deriveLinkCipher", Desc: "cannot create AES cipher"}
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "deriveLinkCipher", Desc: "cannot create GCM"}
+	}
+	return aead, nil
+}
+
+// padTo32 returns the big-endian representation of a coordinate on exactly 32 bytes
+func padTo32(n *big.Int) []byte {
+	buf := make([]byte, 32)
+	b := n.Bytes()
+	copy(buf[32-len(b):], b)
+	return buf
+}
+
+// keyFingerprint returns a short identifier of an RSA public key
+func keyFingerprint(key *rsa.PublicKey) [32]byte {
+	return sha256.Sum256(append(key.N.Bytes(), big.NewInt(int64(key.E)).Bytes()...))
+}
+
+// ephemeralLess compares two ephemeral keys (tie-breaker for simultaneous handshakes)
+func ephemeralLess(a, b []byte) bool {
+	return bytes.Compare(a, b) < 0
+}
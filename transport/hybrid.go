@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"Peerster/fail"
+	"Peerster/logger"
+	"Peerster/messages"
+	"net"
+)
+
+// HybridTransport represents a transport sending messages over UDP, and automatically switching to a
+// stream for messages too large to fit in a datagram (or to fragments if the stream is unavailable)
+type HybridTransport struct {
+	datagram *FragmentingTransport // Transport for regular messages, and fragmented oversized messages
+	stream   *StreamTransport      // Transport for oversized messages (nil if unavailable)
+	packets  chan *packet          // Messages received on both transports
+	done     chan struct{}         // Closed when the transport is closed
+	supports SupportsFunc          // The features of the neighbors (nil if they all support streams and fragments)
+}
+
+// NewHybridTransport creates a new instance of HybridTransport listening on an <ip:port> (UDP and TCP).
+// If the TCP port cannot be opened, oversized messages are fragmented.
+func NewHybridTransport(addr string) (*HybridTransport, error) {
+
+	udp, err := NewUDPTransport(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	hybrid := &HybridTransport{
+		datagram: NewFragmentingTransport(udp),
+		packets:  make(chan *packet, 64),
+		done:     make(chan struct{}),
+	}
+	go hybrid.pumpRoutine(hybrid.datagram)
+
+	if stream, err := NewStreamTransport(addr); err == nil {
+		hybrid.stream = stream
+		go hybrid.pumpRoutine(stream)
+	} else {
+		logger.Transport.Info("NewHybridTransport", "streams disabled: %s", err.Error())
+	}
+
+	return hybrid, nil
+}
+
+// pumpRoutine forwards the messages received on a transport to the shared queue, until it is closed
+func (hybrid *HybridTransport) pumpRoutine(t Transport) {
+	for {
+		buf, sender, err := t.Receive()
+		if err != nil {
+			if IsClosed(err) {
+				return
+			}
+			select {
+			case <-hybrid.done: // The transport was closed
+				return
+			default: // Error: ignore the message
+				continue
+			}
+		}
+		select {
+		case hybrid.packets <- &packet{buf: buf, sender: sender}:
+		case <-hybrid.done:
+			return
+		}
+	}
+}
+
+// SetSupports sets how the features of the neighbors are known (before the transport is used)
+func (hybrid *HybridTransport) SetSupports(supports SupportsFunc) {
+	hybrid.supports = supports
+}
+
+// isSupported checks whether a neighbor supports a feature
+func (hybrid *HybridTransport) isSupported(target *net.UDPAddr, feature string) bool {
+	return hybrid.supports == nil || hybrid.supports(target.String(), feature)
+}
+
+// Send sends a message in a datagram if it fits, or on a stream otherwise. If the stream can't be used
+// (e.g. the target doesn't accept streams), the message is fragmented. Oversized messages are only sent
+// to targets that advertised streams or fragments.
+func (hybrid *HybridTransport) Send(buf []byte, target *net.UDPAddr) error {
+	if len(buf) <= MaxDatagramSize {
+		return hybrid.datagram.Send(buf, target)
+	}
+	if hybrid.stream != nil && hybrid.isSupported(target, messages.CapStream) {
+		if err := hybrid.stream.Send(buf, target); err == nil {
+			return nil
+		}
+	}
+	if !hybrid.isSupported(target, messages.CapFragments) {
+		return &fail.CustomError{Fun: "HybridTransport.Send", Desc: "message too large for " + target.String()}
+	}
+	return hybrid.datagram.Send(buf, target)
+}
+
+// Receive blocks until a message is received on any of the transports
+func (hybrid *HybridTransport) Receive() ([]byte, *net.UDPAddr, error) {
+	select {
+	case pkt := <-hybrid.packets:
+		return pkt.buf, pkt.sender, nil
+	case <-hybrid.done:
+		return nil, nil, ErrClosed
+	}
+}
+
+// Close closes both transports
+func (hybrid *HybridTransport) Close() error {
+	close(hybrid.done)
+	if hybrid.stream != nil {
+		hybrid.stream.Close()
+	}
+	return hybrid.datagram.Close()
+}
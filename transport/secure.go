@@ -0,0 +1,566 @@
+package transport
+
+import (
+	"Peerster/logger"
+	"Peerster/messages"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dedis/protobuf"
+)
+
+const (
+	// HandshakeTimeoutSec is the duration after which an unanswered handshake is restarted
+	HandshakeTimeoutSec = 2
+	// SessionLifetimeSec is the duration after which the keys of a link are renegotiated
+	SessionLifetimeSec = 3600
+	// MaxQueuedMessages is the number of messages kept for a neighbor while the handshake is in progress
+	MaxQueuedMessages = 64
+	// HandshakeMaxSkewSec is the maximum age (or advance) of the timestamp of an accepted handshake
+	HandshakeMaxSkewSec = 60
+	// ReplayWindowSize is the number of recent message counters remembered to reject replayed messages
+	ReplayWindowSize = 64
+	// MaxOpenFailures is the number of consecutive messages that can't be opened after which the keys of a
+	// link are renegotiated
+	MaxOpenFailures = 8
+
+	// Kinds of secure messages (byte following secureMagic)
+	secureInit     = byte(1)
+	secureResponse = byte(2)
+	secureData     = byte(3)
+
+	// Directions of the sealed messages (first byte of their nonce), so that both ends never use the same
+	// nonce with the link's key
+	directionInitiator = byte(1)
+	directionResponder = byte(2)
+)
+
+// secureMagic starts every message of the secure channel. 0xFE can't start a protobuf-encoded message
+// (wire type 6 doesn't exist), so secure messages are never mistaken for plaintext GossipPackets.
+var secureMagic = []byte{0xFE, 'S', 'E', 'C'}
+
+// SecureTransport represents a transport authenticating and encrypting the messages exchanged with
+// neighbors. A handshake (ephemeral ECDH authenticated by RSA keys) establishes a symmetric key per
+// link, then each message is sealed with AES-GCM. The RSA key of a neighbor is pinned the first time
+// we see it (trust on first use). Links stay in plaintext with neighbors that don't advertise the secure
+// channel (or initiate a handshake), and can be configured to.
+type SecureTransport struct {
+	inner         Transport              // The underlying transport
+	key           *rsa.PrivateKey        // Our RSA key, authenticating our handshakes
+	defaultSecure bool                   // Whether links with neighbors without explicit setting may be secure
+	modes         map[string]bool        // Explicit per-neighbor setting (true for secure)
+	supports      SupportsFunc           // The features of the neighbors (nil if they all support the secure channel)
+	links         map[string]*secureLink // Link state, indexed by neighbor <ip:port>
+	pinned        map[string][32]byte    // Fingerprint of the RSA key of each neighbor
+	seenInits     map[[32]byte]time.Time // Ephemeral keys of the recent handshakes answered, with their time
+	mux           sync.Mutex             // Mutex to manipulate the structure from different threads
+}
+
+// secureLink represents the state of the secure channel with a neighbor
+type secureLink struct {
+	aead        cipher.AEAD   // The link's cipher (nil until the handshake completes)
+	established time.Time     // The time the handshake completed
+	initiator   bool          // Whether we initiated the handshake that established the key
+	sent        uint64        // Counter of the last message sealed with the key
+	window      replayWindow  // Counters of the messages opened with the key
+	failures    int           // Number of consecutive messages that couldn't be opened
+	pending     *ephemeralKey // Our ephemeral key if we initiated a handshake
+	initiated   time.Time     // The time we initiated the handshake
+	queue       [][]byte      // Messages waiting for the handshake to complete
+}
+
+// replayWindow represents the counters of the last messages received on a link
+type replayWindow struct {
+	last   uint64 // The greatest counter received
+	bitmap uint64 // Bit i is set if counter last-i was received
+}
+
+// accept checks that a counter wasn't received yet and isn't too old, and records it
+func (window *replayWindow) accept(counter uint64) bool {
+	if counter == 0 {
+		return false
+	}
+	if counter > window.last {
+		if shift := counter - window.last; shift < ReplayWindowSize {
+			window.bitmap = window.bitmap<<shift | 1
+		} else {
+			window.bitmap = 1
+		}
+		window.last = counter
+		return true
+	}
+	offset := window.last - counter
+	if offset >= ReplayWindowSize || window.bitmap&(1<<offset) != 0 {
+		return false
+	}
+	window.bitmap |= 1 << offset
+	return true
+}
+
+// NewSecureTransport creates a new instance of SecureTransport on top of another transport
+func NewSecureTransport(inner Transport, key *rsa.PrivateKey, defaultSecure bool) *SecureTransport {
+	return &SecureTransport{
+		inner:         inner,
+		key:           key,
+		defaultSecure: defaultSecure,
+		modes:         make(map[string]bool),
+		links:         make(map[string]*secureLink),
+		pinned:        make(map[string][32]byte),
+		seenInits:     make(map[[32]byte]time.Time),
+	}
+}
+
+// SetPeerMode configures whether the link with a neighbor is secure
+func (secure *SecureTransport) SetPeerMode(addr string, isSecure bool) {
+	secure.mux.Lock()
+	defer secure.mux.Unlock()
+
+	secure.modes[addr] = isSecure
+}
+
+// SetSupports sets how the features of the neighbors are known (before the transport is used)
+func (secure *SecureTransport) SetSupports(supports SupportsFunc) {
+	secure.supports = supports
+}
+
+// CanBeSecure checks whether the link with a neighbor becomes secure if the neighbor supports it (we then
+// advertise the secure channel to it)
+func (secure *SecureTransport) CanBeSecure(addr string) bool {
+	secure.mux.Lock()
+	defer secure.mux.Unlock()
+
+	return secure.canBeSecureUnsafe(addr)
+}
+
+// IsSecure checks whether the link with a neighbor is secure
+func (secure *SecureTransport) IsSecure(addr string) bool {
+	secure.mux.Lock()
+	defer secure.mux.Unlock()
+
+	return secure.isSecureUnsafe(addr)
+}
+
+// IsEstablished checks whether the secure channel with a neighbor is ready
+func (secure *SecureTransport) IsEstablished(addr string) bool {
+	secure.mux.Lock()
+	defer secure.mux.Unlock()
+
+	link, ok := secure.links[addr]
+	return ok && secure.isLiveUnsafe(link)
+}
+
+// Forget drops the link state and the pinned key of a neighbor (e.g. once it is considered dead, as its
+// keys change when it restarts)
+func (secure *SecureTransport) Forget(addr string) {
+	secure.mux.Lock()
+	defer secure.mux.Unlock()
+
+	delete(secure.links, addr)
+	delete(secure.pinned, addr)
+}
+
+// canBeSecureUnsafe checks whether the link with a neighbor becomes secure if the neighbor supports it
+func (secure *SecureTransport) canBeSecureUnsafe(addr string) bool {
+	if isSecure, ok := secure.modes[addr]; ok {
+		return isSecure
+	}
+	return secure.defaultSecure
+}
+
+// isSecureUnsafe checks whether the link with a neighbor is secure: it can be, and the neighbor advertised
+// the secure channel or a handshake took place
+func (secure *SecureTransport) isSecureUnsafe(addr string) bool {
+	if !secure.canBeSecureUnsafe(addr) {
+		return false
+	}
+	if _, ok := secure.modes[addr]; ok {
+		return true
+	}
+	if _, ok := secure.links[addr]; ok {
+		return true
+	}
+	return secure.supports == nil || secure.supports(addr, messages.CapSecure)
+}
+
+// isLiveUnsafe checks whether a link has a usable key
+func (secure *SecureTransport) isLiveUnsafe(link *secureLink) bool {
+	return link.aead != nil && time.Since(link.established) < SessionLifetimeSec*time.Second
+}
+
+// getLinkUnsafe returns the state of the link with a neighbor, creating it if needed
+func (secure *SecureTransport) getLinkUnsafe(addr string) *secureLink {
+	link, ok := secure.links[addr]
+	if !ok {
+		link = &secureLink{}
+		secure.links[addr] = link
+	}
+	return link
+}
+
+// establishUnsafe installs the key negotiated by a handshake and returns the queued messages, sealed
+func (link *secureLink) establishUnsafe(aead cipher.AEAD, initiator bool) [][]byte {
+	link.pending = nil
+	link.aead = aead
+	link.established = time.Now()
+	link.initiator = initiator
+	link.sent = 0
+	link.window = replayWindow{}
+	link.failures = 0
+
+	sealed := make([][]byte, 0, len(link.queue))
+	for _, buf := range link.queue {
+		sealed = append(sealed, link.sealUnsafe(buf))
+	}
+	link.queue = nil
+	return sealed
+}
+
+// sealUnsafe seals a message with the link's key and the next counter
+func (link *secureLink) sealUnsafe(buf []byte) []byte {
+	link.sent++
+	return seal(link.aead, sendDirection(link.initiator), link.sent, buf)
+}
+
+// Send sends a message, sealed if the link is secure. If the handshake isn't complete yet, the message
+// is queued and sent once it is.
+func (secure *SecureTransport) Send(buf []byte, target *net.UDPAddr) error {
+	addr := target.String()
+
+	secure.mux.Lock()
+	if !secure.isSecureUnsafe(addr) {
+		secure.mux.Unlock()
+		return secure.inner.Send(buf, target)
+	}
+
+	link := secure.getLinkUnsafe(addr)
+	if secure.isLiveUnsafe(link) {
+		sealed := link.sealUnsafe(buf)
+		secure.mux.Unlock()
+		return secure.inner.Send(sealed, target)
+	}
+
+	// Queue the message until the handshake completes
+	if len(link.queue) < MaxQueuedMessages {
+		link.queue = append(link.queue, append([]byte(nil), buf...))
+	}
+	init := secure.initiateUnsafe(link)
+	secure.mux.Unlock()
+
+	if init != nil {
+		return secure.inner.Send(init, target)
+	}
+	return nil
+}
+
+// initiateUnsafe starts a handshake with a neighbor (if none is in progress) and returns the message to
+// send (nil if there is nothing to send)
+func (secure *SecureTransport) initiateUnsafe(link *secureLink) []byte {
+	if link.pending != nil && time.Since(link.initiated) < HandshakeTimeoutSec*time.Second {
+		return nil
+	}
+
+	ephemeral, err := newEphemeralKey()
+	if err != nil {
+		return nil
+	}
+	msg, err := newHandshakeMessage(secure.key, ephemeral, ephemeral.public, nil)
+	if err != nil {
+		return nil
+	}
+	encoded, err := protobuf.Encode(msg)
+	if err != nil {
+		return nil
+	}
+
+	link.pending = ephemeral
+	link.initiated = time.Now()
+	return frame(secureInit, encoded)
+}
+
+// Receive blocks until a message is received: plaintext messages from neighbors with a plaintext link,
+// or opened sealed messages from neighbors with a secure link. Handshakes are handled transparently.
+func (secure *SecureTransport) Receive() ([]byte, *net.UDPAddr, error) {
+	for {
+		buf, sender, err := secure.inner.Receive()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if msg := secure.handle(buf, sender); msg != nil {
+			return msg, sender, nil
+		}
+	}
+}
+
+// handle processes a received message and returns the plaintext to hand to the caller (nil if none)
+func (secure *SecureTransport) handle(buf []byte, sender *net.UDPAddr) []byte {
+	addr := sender.String()
+
+	if !bytes.HasPrefix(buf, secureMagic) || len(buf) <= len(secureMagic) {
+		// Plaintext: only accepted on plaintext links
+		if secure.IsSecure(addr) {
+			return nil
+		}
+		return buf
+	}
+
+	kind := buf[len(secureMagic)]
+	payload := buf[len(secureMagic)+1:]
+
+	switch kind {
+	case secureInit:
+		secure.onInit(payload, sender)
+	case secureResponse:
+		secure.onResponse(payload, sender)
+	case secureData:
+		return secure.onData(payload, sender)
+	}
+	return nil
+}
+
+// pinUnsafe checks that the RSA key of a neighbor is the one we saw the first time, pinning it otherwise
+func (secure *SecureTransport) pinUnsafe(addr string, key *rsa.PublicKey) bool {
+	fingerprint := keyFingerprint(key)
+	if pinned, ok := secure.pinned[addr]; ok && pinned != fingerprint {
+		logger.Transport.Info("SecureTransport.pinUnsafe", "KEY MISMATCH for %s, rejecting handshake", addr)
+		return false
+	}
+	secure.pinned[addr] = fingerprint
+	return true
+}
+
+// onInit answers a handshake initiated by a neighbor
+func (secure *SecureTransport) onInit(payload []byte, sender *net.UDPAddr) {
+	addr := sender.String()
+
+	var init handshakeMessage
+	if err := protobuf.Decode(payload, &init); err != nil {
+		return
+	}
+	peerKey, err := init.verify(init.Ephemeral, nil)
+	if err != nil {
+		return
+	}
+
+	// Reject replayed handshakes: stale ones, and the ones already answered
+	if age := time.Since(time.Unix(init.Timestamp, 0)); age > HandshakeMaxSkewSec*time.Second ||
+		age < -HandshakeMaxSkewSec*time.Second {
+		logger.Transport.Debug("SecureTransport.onInit", "STALE HANDSHAKE from %s", addr)
+		return
+	}
+	if !secure.markInitSeen(init.Ephemeral) {
+		logger.Transport.Debug("SecureTransport.onInit", "REPLAYED HANDSHAKE from %s", addr)
+		return
+	}
+
+	ephemeral, err := newEphemeralKey()
+	if err != nil {
+		return
+	}
+	aead, err := deriveLinkCipher(ephemeral, init.Ephemeral, init.Ephemeral, ephemeral.public)
+	if err != nil {
+		return
+	}
+	response, err := newHandshakeMessage(secure.key, ephemeral, init.Ephemeral, ephemeral.public)
+	if err != nil {
+		return
+	}
+	encoded, err := protobuf.Encode(response)
+	if err != nil {
+		return
+	}
+
+	// A neighbor initiating a handshake supports the secure channel, even if we didn't hear its features yet
+	secure.mux.Lock()
+	if !secure.canBeSecureUnsafe(addr) || !secure.pinUnsafe(addr, peerKey) {
+		secure.mux.Unlock()
+		return
+	}
+	link := secure.getLinkUnsafe(addr)
+
+	// Simultaneous handshakes: the one with the smallest ephemeral key wins
+	if link.pending != nil && ephemeralLess(link.pending.public, init.Ephemeral) {
+		secure.mux.Unlock()
+		return
+	}
+
+	queue := link.establishUnsafe(aead, false)
+	secure.mux.Unlock()
+
+	secure.inner.Send(frame(secureResponse, encoded), sender)
+	secure.flush(queue, sender)
+}
+
+// markInitSeen records the ephemeral key of a handshake initiated by a neighbor, returning false if it was
+// already answered. Keys are forgotten once their handshake would be rejected as stale anyway.
+func (secure *SecureTransport) markInitSeen(ephemeral []byte) bool {
+	secure.mux.Lock()
+	defer secure.mux.Unlock()
+
+	now := time.Now()
+	for seen, answered := range secure.seenInits {
+		if now.Sub(answered) > 2*HandshakeMaxSkewSec*time.Second {
+			delete(secure.seenInits, seen)
+		}
+	}
+
+	fingerprint := sha256.Sum256(ephemeral)
+	if _, ok := secure.seenInits[fingerprint]; ok {
+		return false
+	}
+	secure.seenInits[fingerprint] = now
+	return true
+}
+
+// onResponse completes a handshake we initiated
+func (secure *SecureTransport) onResponse(payload []byte, sender *net.UDPAddr) {
+	addr := sender.String()
+
+	var response handshakeMessage
+	if err := protobuf.Decode(payload, &response); err != nil {
+		return
+	}
+
+	secure.mux.Lock()
+	link, ok := secure.links[addr]
+	if !ok || link.pending == nil {
+		secure.mux.Unlock()
+		return
+	}
+	pending := link.pending
+	secure.mux.Unlock()
+
+	peerKey, err := response.verify(pending.public, response.Ephemeral)
+	if err != nil {
+		return
+	}
+	aead, err := deriveLinkCipher(pending, response.Ephemeral, pending.public, response.Ephemeral)
+	if err != nil {
+		return
+	}
+
+	secure.mux.Lock()
+	if link.pending != pending || !secure.pinUnsafe(addr, peerKey) { // The handshake was superseded
+		secure.mux.Unlock()
+		return
+	}
+	queue := link.establishUnsafe(aead, true)
+	secure.mux.Unlock()
+
+	secure.flush(queue, sender)
+}
+
+// onData opens a sealed message, rejecting replayed ones. If we have no key for the link (e.g. we
+// restarted), or too many messages in a row can't be opened with it, a new handshake is initiated.
+func (secure *SecureTransport) onData(payload []byte, sender *net.UDPAddr) []byte {
+	secure.mux.Lock()
+	if !secure.canBeSecureUnsafe(sender.String()) {
+		secure.mux.Unlock()
+		return nil
+	}
+	link := secure.getLinkUnsafe(sender.String())
+	if !secure.isLiveUnsafe(link) {
+		init := secure.initiateUnsafe(link)
+		secure.mux.Unlock()
+		if init != nil {
+			secure.inner.Send(init, sender)
+		}
+		return nil
+	}
+	aead, direction := link.aead, receiveDirection(link.initiator)
+	secure.mux.Unlock()
+
+	buf, counter := open(aead, direction, payload)
+
+	secure.mux.Lock()
+	if link.aead != aead { // The key was renegotiated meanwhile
+		secure.mux.Unlock()
+		return nil
+	}
+	if buf == nil {
+		var init []byte
+		if link.failures++; link.failures >= MaxOpenFailures {
+			link.aead = nil
+			init = secure.initiateUnsafe(link)
+		}
+		secure.mux.Unlock()
+		if init != nil {
+			logger.Transport.Info("SecureTransport.onData", "CANNOT OPEN messages from %s, renegotiating", sender.String())
+			secure.inner.Send(init, sender)
+		}
+		return nil
+	}
+	link.failures = 0
+	isReplay := !link.window.accept(counter)
+	secure.mux.Unlock()
+
+	if isReplay {
+		logger.Transport.Debug("SecureTransport.onData", "REPLAYED MESSAGE %d from %s", counter, sender.String())
+		return nil
+	}
+	return buf
+}
+
+// flush sends the messages queued during the handshake
+func (secure *SecureTransport) flush(queue [][]byte, target *net.UDPAddr) {
+	for _, sealed := range queue {
+		secure.inner.Send(sealed, target)
+	}
+}
+
+// Close closes the underlying transport
+func (secure *SecureTransport) Close() error {
+	return secure.inner.Close()
+}
+
+// frame prepends the secure channel header to a payload
+func frame(kind byte, payload []byte) []byte {
+	buf := make([]byte, 0, len(secureMagic)+1+len(payload))
+	buf = append(buf, secureMagic...)
+	buf = append(buf, kind)
+	return append(buf, payload...)
+}
+
+// sendDirection returns the direction of the messages we seal on a link
+func sendDirection(initiator bool) byte {
+	if initiator {
+		return directionInitiator
+	}
+	return directionResponder
+}
+
+// receiveDirection returns the direction of the messages we open on a link
+func receiveDirection(initiator bool) byte {
+	return sendDirection(!initiator)
+}
+
+// seal encrypts and authenticates a message: header | nonce | ciphertext. The nonce is made of the
+// direction and the message's counter, so that it is never reused with the link's key.
+func seal(aead cipher.AEAD, direction byte, counter uint64, buf []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	nonce[0] = direction
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	header := frame(secureData, nil)
+	sealed := append(header, nonce...)
+	return aead.Seal(sealed, nonce, buf, header)
+}
+
+// open decrypts and authenticates a sealed message (without its header) sent in a direction, returning
+// the message and its counter (nil if it is invalid)
+func open(aead cipher.AEAD, direction byte, payload []byte) ([]byte, uint64) {
+	if len(payload) < aead.NonceSize() || payload[0] != direction {
+		return nil, 0
+	}
+	nonce := payload[:aead.NonceSize()]
+	buf, err := aead.Open(nil, nonce, payload[aead.NonceSize():], frame(secureData, nil))
+	if err != nil {
+		return nil, 0
+	}
+	return buf, binary.BigEndian.Uint64(nonce[len(nonce)-8:])
+}
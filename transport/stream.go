@@ -0,0 +1,280 @@
+package transport
+
+import (
+	"Peerster/fail"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// StreamDialTimeoutSec is the maximum duration to open a stream with another gossiper
+	StreamDialTimeoutSec = 2
+	// StreamIdleTimeoutSec is the inactivity duration after which a stream is closed
+	StreamIdleTimeoutSec = 60
+	// MaxInboundStreams is the maximum number of incoming streams open at the same time
+	MaxInboundStreams = 32
+	// maxHelloSize is the maximum size of the handshake frame (the sender's gossip address)
+	maxHelloSize = 64
+	// maxAcceptBackoff is the longest wait before accepting streams again after an error
+	maxAcceptBackoff = time.Second
+)
+
+// StreamTransport represents a transport sending length-prefixed messages over TCP connections. Each
+// gossiper listens for streams on the TCP port matching its UDP gossip port, and the first frame of a
+// stream carries the sender's gossip address so that messages can be attributed to it.
+type StreamTransport struct {
+	listener  net.Listener           // The TCP listener accepting incoming streams
+	localAddr string                 // Our gossip <ip:port>, advertised when opening a stream
+	conns     map[string]*streamConn // Outgoing streams, indexed by target <ip:port>
+	inbound   map[net.Conn]bool      // Incoming streams
+	packets   chan *packet           // Messages received on incoming streams
+	done      chan struct{}          // Closed when the transport is closed
+	closed    bool                   // Indicates whether the transport is closed
+	mux       sync.Mutex             // Mutex to manipulate the structure from different threads
+}
+
+// streamConn represents an outgoing stream
+type streamConn struct {
+	conn     net.Conn   // The TCP connection
+	lastUsed time.Time  // The last time a message was written on the stream
+	mux      sync.Mutex // Mutex serializing the writes on the stream
+}
+
+// NewStreamTransport creates a new instance of StreamTransport listening on an <ip:port>
+func NewStreamTransport(addr string) (*StreamTransport, error) {
+
+	listener, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "NewStreamTransport", Desc: "cannot listen on TCP port"}
+	}
+
+	stream := &StreamTransport{
+		listener:  listener,
+		localAddr: addr,
+		conns:     make(map[string]*streamConn),
+		inbound:   make(map[net.Conn]bool),
+		packets:   make(chan *packet, 64),
+		done:      make(chan struct{}),
+	}
+	go stream.acceptRoutine()
+
+	return stream, nil
+}
+
+// writeFrame writes a length-prefixed frame on a connection
+func writeFrame(conn net.Conn, buf []byte) error {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(buf)))
+	if _, err := conn.Write(append(header, buf...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFrame reads a length-prefixed frame of at most maxSize bytes from a connection
+func readFrame(conn net.Conn, maxSize int) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	if int(size) > maxSize {
+		return nil, &fail.CustomError{Fun: "readFrame", Desc: "frame too large"}
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// getConn returns an open stream towards a target, dialing it if needed
+func (stream *StreamTransport) getConn(target *net.UDPAddr) (*streamConn, error) {
+	stream.mux.Lock()
+	defer stream.mux.Unlock()
+
+	key := target.String()
+	if sc, ok := stream.conns[key]; ok {
+		// The other end closes idle streams: don't write on a stream that may already be closed
+		if time.Since(sc.lastUsed) < StreamIdleTimeoutSec/2*time.Second {
+			return sc, nil
+		}
+		sc.conn.Close()
+		delete(stream.conns, key)
+	}
+
+	conn, err := net.DialTimeout("tcp4", key, StreamDialTimeoutSec*time.Second)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "StreamTransport.getConn", Desc: "cannot open stream"}
+	}
+
+	// Handshake: advertise our gossip address
+	if err := writeFrame(conn, []byte(stream.localAddr)); err != nil {
+		conn.Close()
+		return nil, &fail.CustomError{Fun: "StreamTransport.getConn", Desc: "handshake failed"}
+	}
+
+	sc := &streamConn{conn: conn, lastUsed: time.Now()}
+	stream.conns[key] = sc
+	return sc, nil
+}
+
+// dropConn closes and forgets a broken outgoing stream
+func (stream *StreamTransport) dropConn(target *net.UDPAddr, sc *streamConn) {
+	stream.mux.Lock()
+	defer stream.mux.Unlock()
+
+	sc.conn.Close()
+	if stream.conns[target.String()] == sc {
+		delete(stream.conns, target.String())
+	}
+}
+
+// Send sends a message on the stream towards a target, reopening the stream once if it is broken
+func (stream *StreamTransport) Send(buf []byte, target *net.UDPAddr) error {
+	if len(buf) > MaxStreamMessageSize {
+		return &fail.CustomError{Fun: "StreamTransport.Send", Desc: "message too large"}
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		sc, err := stream.getConn(target)
+		if err != nil {
+			return err
+		}
+
+		sc.mux.Lock()
+		err = writeFrame(sc.conn, buf)
+		sc.lastUsed = time.Now()
+		sc.mux.Unlock()
+
+		if err == nil {
+			return nil
+		}
+		stream.dropConn(target, sc)
+	}
+
+	return &fail.CustomError{Fun: "StreamTransport.Send", Desc: "failed to send message"}
+}
+
+// Receive blocks until a message is received on an incoming stream
+func (stream *StreamTransport) Receive() ([]byte, *net.UDPAddr, error) {
+	select {
+	case pkt := <-stream.packets:
+		return pkt.buf, pkt.sender, nil
+	case <-stream.done:
+		return nil, nil, ErrClosed
+	}
+}
+
+// Close stops accepting streams and closes the open ones
+func (stream *StreamTransport) Close() error {
+	stream.mux.Lock()
+	defer stream.mux.Unlock()
+
+	if stream.closed {
+		return nil
+	}
+	stream.closed = true
+	close(stream.done)
+	for key, sc := range stream.conns {
+		sc.conn.Close()
+		delete(stream.conns, key)
+	}
+	for conn := range stream.inbound {
+		conn.Close()
+	}
+	return stream.listener.Close()
+}
+
+// acceptRoutine accepts incoming streams until the transport is closed. Errors (e.g. too many open files)
+// only pause it, and streams beyond MaxInboundStreams are refused.
+func (stream *StreamTransport) acceptRoutine() {
+	var backoff time.Duration
+	for {
+		conn, err := stream.listener.Accept()
+		if err != nil {
+			select {
+			case <-stream.done:
+				return
+			default:
+			}
+			if backoff == 0 {
+				backoff = 5 * time.Millisecond
+			} else if backoff *= 2; backoff > maxAcceptBackoff {
+				backoff = maxAcceptBackoff
+			}
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		if !stream.addInbound(conn) {
+			conn.Close()
+			continue
+		}
+		go stream.readRoutine(conn)
+	}
+}
+
+// addInbound registers an incoming stream, unless there are too many of them or the transport is closed
+func (stream *StreamTransport) addInbound(conn net.Conn) bool {
+	stream.mux.Lock()
+	defer stream.mux.Unlock()
+
+	if stream.closed || len(stream.inbound) >= MaxInboundStreams {
+		return false
+	}
+	stream.inbound[conn] = true
+	return true
+}
+
+// removeInbound closes and forgets an incoming stream
+func (stream *StreamTransport) removeInbound(conn net.Conn) {
+	stream.mux.Lock()
+	defer stream.mux.Unlock()
+
+	conn.Close()
+	delete(stream.inbound, conn)
+}
+
+// readRoutine reads the messages of an incoming stream until it is closed or idle
+func (stream *StreamTransport) readRoutine(conn net.Conn) {
+	defer stream.removeInbound(conn)
+
+	// Handshake: the sender is identified by the IP of the stream and its advertised gossip port
+	conn.SetReadDeadline(time.Now().Add(StreamDialTimeoutSec * time.Second))
+	hello, err := readFrame(conn, maxHelloSize)
+	if err != nil {
+		return
+	}
+	_, port, err := net.SplitHostPort(string(hello))
+	if err != nil {
+		return
+	}
+	portNb, err := strconv.Atoi(port)
+	if err != nil {
+		return
+	}
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return
+	}
+	sender := &net.UDPAddr{IP: tcpAddr.IP, Port: portNb}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(StreamIdleTimeoutSec * time.Second))
+		buf, err := readFrame(conn, MaxStreamMessageSize)
+		if err != nil {
+			return
+		}
+		select {
+		case stream.packets <- &packet{buf: buf, sender: sender}:
+		case <-stream.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"Peerster/fail"
+	"errors"
+	"net"
+)
+
+const (
+	// MaxDatagramSize is the maximum size of a message sent in a single UDP datagram
+	MaxDatagramSize = 16384
+	// MaxStreamMessageSize is the maximum size of a message sent over a stream
+	MaxStreamMessageSize = 1024 * 1024
+)
+
+// ErrClosed is returned by Receive once the transport is closed
+var ErrClosed = &fail.CustomError{Fun: "Transport.Receive", Desc: "transport closed"}
+
+// IsClosed checks whether an error means that a transport is closed for good
+func IsClosed(err error) bool {
+	return err == ErrClosed || errors.Is(err, net.ErrClosed)
+}
+
+// SupportsFunc tells whether a neighbor, given by its <ip:port>, advertised an optional feature of the
+// transports (messages.CapSecure, CapStream or CapFragments). Neighbors that didn't advertise anything yet
+// don't support any.
+type SupportsFunc func(addr, feature string) bool
+
+// Transport represents a way to exchange encoded GossipPackets with other gossipers, identified by
+// their UDP gossip address
+type Transport interface {
+	// Send sends an encoded message to a target
+	Send(buf []byte, target *net.UDPAddr) error
+	// Receive blocks until a complete message is received and returns it along with its sender
+	Receive() ([]byte, *net.UDPAddr, error)
+	// Close releases the underlying resources
+	Close() error
+}
+
+// packet represents a received message waiting to be handed to Receive
+type packet struct {
+	buf    []byte       // The encoded message
+	sender *net.UDPAddr // The sender's gossip address
+}
@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"Peerster/fail"
+	"net"
+)
+
+// udpReadBufferSize is the size of the socket's receive buffer
+const udpReadBufferSize = 4 * 1024 * 1024
+
+// UDPTransport represents a transport sending each message in a single UDP datagram
+type UDPTransport struct {
+	conn *net.UDPConn // The underlying UDP connection (thread-safe)
+}
+
+// NewUDPTransport creates a new instance of UDPTransport listening on an <ip:port>
+func NewUDPTransport(addr string) (*UDPTransport, error) {
+
+	// Resolve the address
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "NewUDPTransport", Desc: "cannot resolve UDP address"}
+	}
+
+	// Open an UDP connection
+	conn, err := net.ListenUDP("udp4", udpAddr)
+	if err != nil {
+		return nil, &fail.CustomError{Fun: "NewUDPTransport", Desc: "cannot listen on UDP channel"}
+	}
+
+	// Leave room for bursts of fragments (best effort)
+	conn.SetReadBuffer(udpReadBufferSize)
+
+	return &UDPTransport{conn: conn}, nil
+}
+
+// Send sends a message in a single datagram, failing if it is too large
+func (udp *UDPTransport) Send(buf []byte, target *net.UDPAddr) error {
+	if len(buf) > MaxDatagramSize {
+		return &fail.CustomError{Fun: "UDPTransport.Send", Desc: "message too large for a datagram"}
+	}
+	if _, err := udp.conn.WriteToUDP(buf, target); err != nil {
+		return &fail.CustomError{Fun: "UDPTransport.Send", Desc: "failed to send datagram"}
+	}
+	return nil
+}
+
+// Receive blocks until a datagram is received
+func (udp *UDPTransport) Receive() ([]byte, *net.UDPAddr, error) {
+	buf := make([]byte, MaxDatagramSize)
+	n, sender, err := udp.conn.ReadFromUDP(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf[:n], sender, nil
+}
+
+// Close closes the UDP connection
+func (udp *UDPTransport) Close() error {
+	return udp.conn.Close()
+}
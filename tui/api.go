@@ -0,0 +1,188 @@
+package main
+
+import (
+	"Peerster/backend"
+	"Peerster/entities"
+	"Peerster/frontend"
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EventRetrySec is the time after which a broken event stream is opened again
+const EventRetrySec = 2
+
+// RequestTimeoutSec is the time after which a request to the API is given up (the UI waits for it)
+const RequestTimeoutSec = 10
+
+// apiClient - Talks to the webserver of a gossiper
+type apiClient struct {
+	baseURL string       // URL of the webserver (e.g. http://127.0.0.1:8080)
+	token   string       // The API token
+	http    *http.Client // The HTTP client for the requests (with a timeout)
+	stream  *http.Client // The HTTP client for the event stream (without timeout)
+}
+
+// newAPIClient - Creates a client for the webserver of a gossiper, reading its API token if needed
+func newAPIClient(args *entities.TUIClient) (*apiClient, error) {
+
+	token := args.Token
+	if token == "" {
+		data, err := ioutil.ReadFile(filepath.Join(args.DataDir, args.Name, backend.TokenFile))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the API token of %s (is the node running with -dataDir=%s?): %s",
+				args.Name, args.DataDir, err.Error())
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	client := &apiClient{
+		baseURL: "http://" + args.ServerAddr,
+		token:   token,
+		http:    &http.Client{Timeout: RequestTimeoutSec * time.Second},
+		stream:  &http.Client{},
+	}
+	if args.TLSCert != "" {
+		pem, err := ioutil.ReadFile(args.TLSCert)
+		if err != nil {
+			return nil, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", args.TLSCert)
+		}
+		client.baseURL = "https://" + args.ServerAddr
+		transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+		client.http.Transport = transport
+		client.stream.Transport = transport
+	}
+	return client, nil
+}
+
+// do - Sends a request with a JSON body (if any) and decodes the JSON response (if any). API errors are
+// returned with their description.
+func (api *apiClient) do(method, path string, body, response interface{}) error {
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, api.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(backend.TokenHeader, api.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := api.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		var apiErr backend.APIError
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s", apiErr.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if response != nil && len(data) > 0 {
+		return json.Unmarshal(data, response)
+	}
+	return nil
+}
+
+// followEvents - Follows the pushed updates of the gossiper, from the snapshot on. The snapshot is fetched
+// again whenever the updates can't be resumed. Never returns.
+func (api *apiClient) followEvents(onSnapshot func(*snapshot), onUpdate func(*frontend.FrontendUpdate),
+	onError func(error)) {
+
+	var cursor string
+	fresh := true
+	for {
+		if fresh {
+			var state snapshot
+			if err := api.do("GET", "/state", nil, &state); err != nil {
+				onError(err)
+				time.Sleep(EventRetrySec * time.Second)
+				continue
+			}
+			cursor = frontend.FormatCursor(state.Epoch, state.Seq)
+			onSnapshot(&state)
+			fresh = false
+		}
+
+		var err error
+		cursor, fresh, err = api.streamEvents(cursor, onUpdate)
+		if err != nil {
+			onError(err)
+			time.Sleep(EventRetrySec * time.Second)
+		}
+	}
+}
+
+// streamEvents - Reads the event stream from a cursor until it breaks. Returns the new cursor, and whether
+// the snapshot must be fetched again (the gossiper restarted or dropped updates we didn't get).
+func (api *apiClient) streamEvents(cursor string, onUpdate func(*frontend.FrontendUpdate)) (string, bool, error) {
+
+	req, err := http.NewRequest("GET", api.baseURL+"/events?since="+cursor, nil)
+	if err != nil {
+		return cursor, false, err
+	}
+	req.Header.Set(backend.TokenHeader, api.token)
+	resp, err := api.stream.Do(req)
+	if err != nil {
+		return cursor, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return cursor, false, fmt.Errorf("event stream: %s", resp.Status)
+	}
+
+	// Events are separated by blank lines, comments start with ':'
+	event := ""
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if event == "reset" {
+				return "", true, nil
+			}
+			var update frontend.FrontendUpdate
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &update); err == nil {
+				cursor = frontend.FormatCursor(update.Epoch, update.Seq)
+				onUpdate(&update)
+			}
+		case line == "":
+			event = ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cursor, false, err
+	}
+	return cursor, false, fmt.Errorf("event stream closed")
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"Peerster/backend"
+	"Peerster/frontend"
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// SidebarWidth is the maximum width of the column listing peers, contacts, channels and artists
+const SidebarWidth = 28
+
+// Views of the main pane
+const (
+	viewChat    = iota // The global chat
+	viewChannel        // A joined channel
+	viewPrivate        // A private conversation
+	viewFiles          // The files
+	viewSearch         // The results of the last search
+	viewArtists        // The artists and artworks
+	viewHelp           // The commands
+)
+
+// viewNames - Names of the views cycled through with Tab
+var viewNames = map[int]string{viewChat: "Chat", viewFiles: "Files", viewSearch: "Search", viewArtists: "Artists"}
+
+// headingMark - Marks the rows of the main pane shown in bold
+const headingMark = "\x00"
+
+// heading - A row of the main pane shown in bold
+func heading(text string) string {
+	return headingMark + text
+}
+
+// app - The interactive terminal client
+type app struct {
+	api    *apiClient // Talks to the gossiper
+	model  *model     // What is known of the gossiper
+	term   *terminal  // The terminal
+	server string     // Address of the gossiper's webserver
+
+	view   int    // The view of the main pane
+	target string // The channel or contact of the view (viewChannel and viewPrivate)
+	input  []rune // The command being typed
+	status string // Outcome of the last command, or the connection's state
+	quit   bool   // Whether the user asked to quit
+
+	redraw chan bool  // Asks for the screen to be drawn again
+	mux    sync.Mutex // Mutex to manipulate the structure from different threads
+}
+
+// run - Runs the client until the user quits
+func (a *app) run() {
+
+	a.redraw = make(chan bool, 1)
+	go a.api.followEvents(
+		func(state *snapshot) { a.model.load(state); a.setStatus("Connected to " + a.server) },
+		func(update *frontend.FrontendUpdate) { a.model.apply(update); a.requestRedraw() },
+		func(err error) { a.setStatus("Connection lost (" + err.Error() + "), retrying...") },
+	)
+
+	// Keys are read in the background, the screen is drawn from here
+	keys := make(chan rune)
+	go readKeys(keys)
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+
+	a.draw()
+	for !a.quit {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return
+			}
+			a.handleKey(key)
+		case <-resized:
+		case <-a.redraw:
+		}
+		a.draw()
+	}
+}
+
+// readKeys - Reads the keys typed in the terminal (escape sequences, such as arrows, are skipped)
+func readKeys(keys chan<- rune) {
+	defer close(keys)
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			return
+		}
+		if r == keyEscape {
+			if next, _, err := reader.ReadRune(); err == nil && (next == '[' || next == 'O') {
+				for {
+					if c, _, err := reader.ReadRune(); err != nil || (c >= '@' && c <= '~') {
+						break
+					}
+				}
+			}
+			continue
+		}
+		keys <- r
+	}
+}
+
+// handleKey - Edits the command line, or runs it on Enter
+func (a *app) handleKey(key rune) {
+	switch key {
+	case keyCtrlC, keyCtrlD:
+		a.quit = true
+	case keyEnter, keyNewline:
+		line := strings.TrimSpace(string(a.input))
+		a.input = nil
+		if line != "" {
+			a.execute(line)
+		}
+	case keyBackspace, keyCtrlH:
+		if len(a.input) > 0 {
+			a.input = a.input[:len(a.input)-1]
+		}
+	case keyCtrlU:
+		a.input = nil
+	case keyCtrlL:
+		fmt.Print("\x1b[2J")
+	case keyTab:
+		a.nextView()
+	default:
+		if key >= ' ' {
+			a.input = append(a.input, key)
+		}
+	}
+}
+
+// nextView - Shows the next view of the main pane (chat, files, search, artists)
+func (a *app) nextView() {
+	switch a.view {
+	case viewChat, viewChannel, viewPrivate, viewHelp:
+		a.view = viewFiles
+	case viewFiles:
+		a.view = viewSearch
+	case viewSearch:
+		a.view = viewArtists
+	default:
+		a.view = viewChat
+	}
+}
+
+// setStatus - Shows a message in the status line
+func (a *app) setStatus(format string, args ...interface{}) {
+	a.mux.Lock()
+	a.status = fmt.Sprintf(format, args...)
+	a.mux.Unlock()
+	a.requestRedraw()
+}
+
+// requestRedraw - Asks for the screen to be drawn again (from any thread)
+func (a *app) requestRedraw() {
+	select {
+	case a.redraw <- true:
+	default:
+	}
+}
+
+/* ================ DRAWING ================ */
+
+// draw - Draws the whole screen: title, sidebar and main pane, status line and command line
+func (a *app) draw() {
+	width, height := a.term.size()
+	if height < 5 {
+		return
+	}
+	sideWidth := SidebarWidth
+	if width/3 < sideWidth {
+		sideWidth = width / 3
+	}
+	mainWidth := width - sideWidth - 1
+	paneHeight := height - 3
+
+	a.model.mux.Lock()
+	sidebar := a.sidebar()
+	pane := a.pane(mainWidth)
+	a.model.mux.Unlock()
+
+	// Only the end of the main pane fits
+	if len(pane) > paneHeight {
+		pane = pane[len(pane)-paneHeight:]
+	}
+
+	rows := make([]string, 0, height)
+	rows = append(rows, reverse(fit(a.title(), width)))
+	for i := 0; i < paneHeight; i++ {
+		left, right := "", ""
+		if i < len(sidebar) {
+			left = sidebar[i]
+		}
+		if i < len(pane) {
+			right = pane[i]
+		}
+		if strings.HasPrefix(right, headingMark) {
+			right = bold(fit(strings.TrimPrefix(right, headingMark), mainWidth))
+		} else {
+			right = fit(right, mainWidth)
+		}
+		rows = append(rows, fit(left, sideWidth)+"│"+right)
+	}
+
+	a.mux.Lock()
+	status := a.status
+	a.mux.Unlock()
+	rows = append(rows, reverse(fit(status, width)))
+
+	// The end of the command line is shown if it is too long
+	prompt := "> " + string(a.input)
+	if count := utf8.RuneCountInString(prompt); count >= width {
+		prompt = string([]rune(prompt)[count-width+1:])
+	}
+	rows = append(rows, prompt)
+	a.term.draw(rows, utf8.RuneCountInString(prompt))
+}
+
+// title - The title bar, which shows the views
+func (a *app) title() string {
+	title := fmt.Sprintf(" Peerster — %s @ %s ", a.model.me, a.server)
+	for _, view := range []int{viewChat, viewFiles, viewSearch, viewArtists} {
+		name := viewNames[view]
+		if view == a.view || (view == viewChat && (a.view == viewChannel || a.view == viewPrivate)) {
+			name = "[" + name + "]"
+		}
+		title += " " + name
+	}
+	return title + "   (Tab: next view, /help: commands)"
+}
+
+// sidebar - The lists of peers, contacts, channels and artists (the model's mutex must be held)
+func (a *app) sidebar() []string {
+	var rows []string
+	section := func(name string, items []string) {
+		rows = append(rows, fmt.Sprintf("%s (%d)", name, len(items)))
+		for _, item := range items {
+			rows = append(rows, " "+item)
+		}
+		rows = append(rows, "")
+	}
+
+	section("Peers", a.model.peers)
+	contacts := append([]string(nil), a.model.contacts...)
+	sort.Strings(contacts)
+	section("Contacts", contacts)
+	var channels []string
+	for _, channel := range a.model.channels {
+		name := "#" + channel.Name
+		if channel.Encrypted {
+			name += " (encrypted)"
+		}
+		channels = append(channels, name)
+	}
+	section("Channels", channels)
+	var artists []string
+	for _, artist := range a.model.artists {
+		name := artist.Info.Name
+		if artist.Subscribed {
+			name += " ✓"
+		}
+		artists = append(artists, name)
+	}
+	section("Artists", artists)
+	return rows
+}
+
+// pane - The content of the main pane, depending on the view (the model's mutex must be held)
+func (a *app) pane(width int) []string {
+	var rows []string
+	add := func(format string, args ...interface{}) {
+		rows = append(rows, wrap(fmt.Sprintf(format, args...), width, 4)...)
+	}
+	conversation := func(title, feed, empty string) {
+		rows = append(rows, heading(title))
+		messages := a.model.feeds[feed]
+		if len(messages) == 0 {
+			add(empty)
+		}
+		for _, message := range messages {
+			add("%s: %s", message.from, message.text)
+		}
+	}
+
+	switch a.view {
+	case viewHelp:
+		rows = append(rows, heading("Commands"))
+		for _, line := range tuiHelp {
+			add("%s", line)
+		}
+	case viewChat:
+		conversation("Chat", chatFeed(), "No message yet: type some text and press Enter to post it.")
+	case viewChannel:
+		conversation("#"+a.target, channelFeed(a.target), "No message yet in #"+a.target+".")
+	case viewPrivate:
+		conversation("Private conversation with "+a.target, privateFeed(a.target), "No message yet with "+a.target+".")
+
+	case viewFiles:
+		files := func(title string, list []file) {
+			rows = append(rows, heading(fmt.Sprintf("%s (%d)", title, len(list))))
+			for _, f := range list {
+				add("  %s  %s", f.filename, f.metahash)
+			}
+			rows = append(rows, "")
+		}
+		files("Indexed and downloaded", a.model.indexed)
+		files("Downloading", a.model.constructing)
+		files("Found by searches", a.model.available)
+
+	case viewSearch:
+		search := a.model.search
+		if search == nil {
+			rows = append(rows, heading("Search"))
+			add("No search yet: /search KEYWORD... starts one, /get N downloads its N-th result.")
+			break
+		}
+		state := "searching..."
+		if search.Done {
+			state = "finished"
+		}
+		rows = append(rows, heading(fmt.Sprintf("Search %s (%s, %d results)", strings.Join(search.Keywords, ","),
+			state, len(search.Results))))
+		for i, result := range search.Results {
+			add("[%d] %s  %s  %s", i+1, result.Filename, result.Status, result.Metahash)
+		}
+
+	case viewArtists:
+		rows = append(rows, heading("Artists"))
+		if len(a.model.artists) == 0 {
+			add("No artist yet.")
+		}
+		for i, artist := range a.model.artists {
+			subscribed := ""
+			if artist.Subscribed {
+				subscribed = " (subscribed)"
+			}
+			add("[%d] %s%s  %s", i+1, artist.Info.Name, subscribed, artist.Info.Signature)
+		}
+		rows = append(rows, "", heading("Artworks"))
+		for _, artwork := range a.model.artworks {
+			add("%s by %s: %s (%s)", artwork.ArtworkInfo.Name, artwork.ArtistInfo.Name,
+				artwork.ArtworkInfo.Description, artwork.Filename)
+		}
+	}
+	return rows
+}
+
+// pollSearch - Follows the results of a search until it is over
+func (a *app) pollSearch(id uint64) {
+	for {
+		time.Sleep(time.Second)
+		var search backend.SearchResponse
+		if err := a.api.do("GET", fmt.Sprintf("/api/v1/searches/%d", id), nil, &search); err != nil {
+			a.setStatus("Search %d: %s", id, err.Error())
+			return
+		}
+		a.model.mux.Lock()
+		current := a.model.search != nil && a.model.search.ID == id
+		a.model.mux.Unlock()
+		if !current {
+			return // Replaced by a newer search
+		}
+		a.model.setSearch(&search)
+		a.requestRedraw()
+		if search.Done {
+			a.setStatus("Search %s finished with %d results", strings.Join(search.Keywords, ","), len(search.Results))
+			return
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"Peerster/backend"
+	"Peerster/channels"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// tuiHelp - The commands of the terminal client
+var tuiHelp = []string{
+	"TEXT                          post in the conversation shown (the global chat otherwise)",
+	"/chat, /files, /search, /artists   show a view (Tab cycles through them)",
+	"/channel NAME                 show a joined channel",
+	"/dm NAME [TEXT]               show the private conversation with NAME (and send TEXT)",
+	"/join [-encrypted] NAME       join (or create) a channel",
+	"/leave NAME                   leave a channel",
+	"/invite NAME PEER             invite a peer to a joined channel",
+	"/peer IP:PORT                 add a neighbor",
+	"/index FILE                   index a file of the node's shared folder",
+	"/search KEYWORD...            search files on the network",
+	"/get N [FILE]                 download the N-th result of the last search",
+	"/download METAHASH FILE [PEER]   download a file (from a peer, or from the peers found by searches)",
+	"/subscribe N|SIGNATURE        subscribe to an artist (N-th of the artists view)",
+	"/quit                         leave (Ctrl-C works too)",
+}
+
+// execute - Runs a command typed by the user
+func (a *app) execute(line string) {
+
+	// Text is posted in the conversation shown
+	if !strings.HasPrefix(line, "/") {
+		a.post(line)
+		return
+	}
+
+	fields := strings.Fields(line)
+	command, args := fields[0], fields[1:]
+
+	var err error
+	switch {
+	case command == "/help":
+		a.view = viewHelp
+	case command == "/quit" || command == "/exit":
+		a.quit = true
+	case command == "/chat":
+		a.view = viewChat
+	case command == "/files":
+		a.view = viewFiles
+	case command == "/artists":
+		a.view = viewArtists
+	case command == "/search" && len(args) == 0:
+		a.view = viewSearch
+
+	case command == "/channel" && len(args) == 1:
+		a.view, a.target = viewChannel, strings.TrimPrefix(args[0], "#")
+	case command == "/dm" && len(args) >= 1:
+		a.view, a.target = viewPrivate, args[0]
+		if len(args) > 1 {
+			a.post(argumentsFrom(line, 1))
+		}
+
+	case command == "/join" && len(args) == 2 && args[0] == "-encrypted",
+		command == "/join" && len(args) == 1:
+		name := strings.TrimPrefix(args[len(args)-1], "#")
+		var channel channels.ChannelInfo
+		if err = a.api.do("POST", "/api/v1/channels", backend.ChannelRequest{Name: name, Encrypted: len(args) == 2}, &channel); err == nil {
+			a.view, a.target = viewChannel, name
+			if channel.Pending {
+				a.setStatus("Accepted invitation to #%s, waiting for its key", name)
+			} else {
+				a.setStatus("Joined #%s", name)
+			}
+		}
+	case command == "/leave" && len(args) == 1:
+		name := strings.TrimPrefix(args[0], "#")
+		if err = a.api.do("DELETE", "/api/v1/channels/"+url.PathEscape(name), nil, nil); err == nil {
+			if a.view == viewChannel && a.target == name {
+				a.view = viewChat
+			}
+			a.setStatus("Left #%s", name)
+		}
+	case command == "/invite" && len(args) == 2:
+		name := strings.TrimPrefix(args[0], "#")
+		if err = a.api.do("POST", "/api/v1/channels/"+url.PathEscape(name)+"/invites", backend.InviteRequest{Destination: args[1]}, nil); err == nil {
+			a.setStatus("Invited %s to #%s", args[1], name)
+		}
+	case command == "/peer" && len(args) == 1:
+		var peer backend.PeerResponse
+		if err = a.api.do("POST", "/api/v1/peers", backend.PeerRequest{Address: args[0]}, &peer); err == nil {
+			a.setStatus("Added neighbor %s", peer.Address)
+		}
+
+	case command == "/index" && len(args) >= 1:
+		var file backend.FileResponse
+		if err = a.api.do("POST", "/api/v1/files", backend.FileRequest{Filename: argumentsFrom(line, 0)}, &file); err == nil {
+			a.setStatus("Indexed %s (metahash %s)", file.Filename, file.Metahash)
+		}
+	case command == "/search":
+		var search backend.SearchResponse
+		if err = a.api.do("POST", "/api/v1/searches", backend.SearchRequest{Keywords: args}, &search); err == nil {
+			a.model.setSearch(&search)
+			a.view = viewSearch
+			a.setStatus("Searching %s...", strings.Join(args, ","))
+			go a.pollSearch(search.ID)
+		}
+	case command == "/get" && (len(args) == 1 || len(args) == 2):
+		err = a.getResult(args)
+	case command == "/download" && (len(args) == 2 || len(args) == 3):
+		request := backend.DownloadRequest{Metahash: args[0], Filename: args[1]}
+		if len(args) == 3 {
+			request.Source = args[2]
+		}
+		err = a.download(request)
+	case command == "/subscribe" && len(args) == 1:
+		err = a.subscribe(args[0])
+
+	default:
+		err = fmt.Errorf("unknown command or wrong arguments: %s (see /help)", line)
+	}
+	if err != nil {
+		a.setStatus("Error: %s", err.Error())
+	}
+}
+
+// post - Posts a message in the conversation shown: a private message, a channel message or a rumor
+func (a *app) post(text string) {
+	var err error
+	switch a.view {
+	case viewPrivate:
+		err = a.api.do("POST", "/api/v1/private", backend.PrivateRequest{Destination: a.target, Text: text}, nil)
+	case viewChannel:
+		err = a.api.do("POST", "/api/v1/rumors", backend.RumorRequest{Text: text, Channel: a.target}, nil)
+	default:
+		a.view = viewChat
+		err = a.api.do("POST", "/api/v1/rumors", backend.RumorRequest{Text: text}, nil)
+	}
+	if err != nil {
+		a.setStatus("Error: %s", err.Error())
+	} else {
+		a.setStatus("")
+	}
+}
+
+// argumentsFrom - Returns the arguments of a command line from the n-th on, as typed (with their spaces)
+func argumentsFrom(line string, n int) string {
+	for i := 0; i <= n; i++ {
+		line = strings.TrimLeft(line, " \t")
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			return ""
+		}
+		line = line[end:]
+	}
+	return strings.TrimSpace(line)
+}
+
+// getResult - Downloads a result of the last search (/get N [FILE])
+func (a *app) getResult(args []string) error {
+	n, err := strconv.Atoi(args[0])
+	a.model.mux.Lock()
+	var result *backend.FileResponse
+	if search := a.model.search; err == nil && search != nil && n >= 1 && n <= len(search.Results) {
+		result = &search.Results[n-1]
+	}
+	a.model.mux.Unlock()
+	if result == nil {
+		return fmt.Errorf("no result %s in the last search", args[0])
+	}
+
+	request := backend.DownloadRequest{Metahash: result.Metahash, Filename: result.Filename}
+	if len(args) == 2 {
+		request.Filename = args[1]
+	}
+	return a.download(request)
+}
+
+// download - Starts a download, which then shows in the files view
+func (a *app) download(request backend.DownloadRequest) error {
+	var download backend.DownloadResponse
+	if err := a.api.do("POST", "/api/v1/downloads", request, &download); err != nil {
+		return err
+	}
+	a.view = viewFiles
+	a.setStatus("Downloading %s", download.Filename)
+	return nil
+}
+
+// subscribe - Subscribes to an artist, given by signature or by number in the artists view
+func (a *app) subscribe(artist string) error {
+	a.model.mux.Lock()
+	if n, err := strconv.Atoi(artist); err == nil && n >= 1 && n <= len(a.model.artists) {
+		artist = a.model.artists[n-1].Info.Signature
+	}
+	a.model.mux.Unlock()
+
+	if err := a.api.do("POST", "/api/v1/subscriptions", backend.SubscriptionRequest{Signature: artist}, nil); err != nil {
+		return err
+	}
+	a.model.setSubscribed(artist)
+	a.view = viewArtists
+	a.setStatus("Subscribed to %s", artist)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"Peerster/backend"
+	"Peerster/parsing"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+
+	// Initialize the client
+	args, err := parsing.ParseArgumentsTUI()
+	if err != nil {
+		if !parsing.IsHelp(err) {
+			exit(err)
+		}
+		return
+	}
+	api, err := newAPIClient(args)
+	if err != nil {
+		exit(err)
+	}
+
+	// The node must be reachable before the terminal is taken over
+	var node backend.NodeResponse
+	if err := api.do("GET", "/api/v1/node", nil, &node); err != nil {
+		exit(fmt.Errorf("cannot reach the node at %s: %s", args.ServerAddr, err.Error()))
+	}
+
+	term, err := openTerminal()
+	if err != nil {
+		exit(err)
+	}
+	defer term.close()
+
+	// The terminal is restored if the client is stopped from outside
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		term.close()
+		os.Exit(1)
+	}()
+
+	a := &app{api: api, model: newModel(node.Name), term: term, server: args.ServerAddr, status: "Connecting..."}
+	a.run()
+}
+
+// exit - Prints an error and stops the client with a failure status
+func exit(err error) {
+	fmt.Println(err)
+	os.Exit(1)
+}
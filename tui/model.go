@@ -0,0 +1,240 @@
+package main
+
+import (
+	"Peerster/backend"
+	"Peerster/frontend"
+	"strings"
+	"sync"
+)
+
+// MaxFeedMessages is the number of messages kept per conversation
+const MaxFeedMessages = 500
+
+// unescape - Restores the characters escaped by the gossiper for the browser GUI
+var unescape = strings.NewReplacer(" &lt ", "<", " &gt ", ">")
+
+// snapshot - The state of the gossiper, as served by the webserver
+type snapshot struct {
+	Epoch           string                              // Epoch of the updates' log
+	Seq             uint64                              // Sequence number of the last update reflected
+	Peers           []frontend.FrontendPeer             // The neighbors
+	Contacts        []frontend.FrontendPrivateContact   // The known origins
+	Channels        []frontend.FrontendChannel          // The joined channels
+	Rumors          []frontend.FrontendRumor            // The recent rumors of the global chat
+	ChannelMessages []frontend.FrontendChannelMessage   // The recent messages of the joined channels
+	PrivateMessages []frontend.FrontendPrivateMessage   // The private conversations
+	Files           backend.FrontendFiles               // The files, by category
+	Artists         []backend.FrontendArtistState       // The known artists
+	Artworks        []frontend.FrontendAvailableArtowrk // The downloaded artworks
+}
+
+// message - A line of a conversation
+type message struct {
+	from string // The sender
+	text string // The content
+}
+
+// file - A file known by the gossiper
+type file struct {
+	filename string // The filename
+	metahash string // The metahash (hex)
+}
+
+// feed names of the conversations
+func chatFeed() string                  { return "" }
+func channelFeed(channel string) string { return "#" + channel }
+func privateFeed(contact string) string { return "@" + contact }
+
+// model - What the terminal client knows of the gossiper, kept up to date by the pushed updates
+type model struct {
+	me           string                              // The gossiper's name
+	peers        []string                            // The neighbors' <ip:port>
+	contacts     []string                            // The known origins
+	channels     []frontend.FrontendChannel          // The joined channels
+	feeds        map[string][]message                // The conversations, by feed name
+	indexed      []file                              // The files available locally
+	constructing []file                              // The files being downloaded
+	available    []file                              // The files found by searches, not requested yet
+	artists      []backend.FrontendArtistState       // The known artists
+	artworks     []frontend.FrontendAvailableArtowrk // The downloaded artworks
+	search       *backend.SearchResponse             // The last search started from the terminal
+	mux          sync.Mutex                          // Mutex to manipulate the structure from different threads
+}
+
+// newModel - Creates an empty model
+func newModel(me string) *model {
+	return &model{me: me, feeds: make(map[string][]message)}
+}
+
+// load - Replaces the model's content by a snapshot
+func (m *model) load(state *snapshot) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.peers, m.contacts, m.channels = nil, nil, nil
+	m.feeds = make(map[string][]message)
+	m.indexed, m.constructing, m.available = nil, nil, nil
+	m.artists, m.artworks = nil, nil
+
+	for i := range state.Peers {
+		m.applyUnsafe(&frontend.FrontendUpdate{Peer: &state.Peers[i]})
+	}
+	for i := range state.Contacts {
+		m.applyUnsafe(&frontend.FrontendUpdate{PrivateContact: &state.Contacts[i]})
+	}
+	for i := range state.Channels {
+		m.applyUnsafe(&frontend.FrontendUpdate{Channel: &state.Channels[i]})
+	}
+	for i := range state.Rumors {
+		m.applyUnsafe(&frontend.FrontendUpdate{Rumor: &state.Rumors[i]})
+	}
+	for i := range state.ChannelMessages {
+		m.applyUnsafe(&frontend.FrontendUpdate{ChannelMessage: &state.ChannelMessages[i]})
+	}
+	for i := range state.PrivateMessages {
+		m.applyUnsafe(&frontend.FrontendUpdate{PrivateMessage: &state.PrivateMessages[i]})
+	}
+	for i := range state.Files.Indexed {
+		m.applyUnsafe(&frontend.FrontendUpdate{IndexedFile: &state.Files.Indexed[i]})
+	}
+	for i := range state.Files.Constructing {
+		m.applyUnsafe(&frontend.FrontendUpdate{ConstructingFile: &state.Files.Constructing[i]})
+	}
+	for i := range state.Files.Available {
+		m.applyUnsafe(&frontend.FrontendUpdate{AvailableFile: &state.Files.Available[i]})
+	}
+	m.artists = append(m.artists, state.Artists...)
+	m.artworks = append(m.artworks, state.Artworks...)
+}
+
+// apply - Takes an update of the gossiper into account
+func (m *model) apply(update *frontend.FrontendUpdate) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.applyUnsafe(update)
+}
+
+// applyUnsafe - Takes an update of the gossiper into account (the mutex must be held)
+func (m *model) applyUnsafe(update *frontend.FrontendUpdate) {
+	switch {
+	case update.Rumor != nil:
+		m.post(chatFeed(), update.Rumor.Name, update.Rumor.Msg)
+	case update.Peer != nil:
+		m.peers = addString(m.peers, update.Peer.IP+":"+update.Peer.Port)
+	case update.RemovedPeer != nil:
+		m.peers = removeString(m.peers, update.RemovedPeer.IP+":"+update.RemovedPeer.Port)
+	case update.PrivateMessage != nil:
+		contact := update.PrivateMessage.Origin
+		if contact == m.me {
+			contact = update.PrivateMessage.Destination
+		}
+		m.post(privateFeed(contact), update.PrivateMessage.Origin, update.PrivateMessage.Msg)
+	case update.PrivateContact != nil:
+		if update.PrivateContact.Name != m.me {
+			m.contacts = addString(m.contacts, update.PrivateContact.Name)
+		}
+	case update.Channel != nil:
+		for i := range m.channels {
+			if m.channels[i].Name == update.Channel.Name {
+				m.channels = append(m.channels[:i:i], m.channels[i+1:]...)
+				break
+			}
+		}
+		if update.Channel.Joined {
+			m.channels = append(m.channels, *update.Channel)
+		}
+	case update.ChannelMessage != nil:
+		m.post(channelFeed(update.ChannelMessage.Channel), update.ChannelMessage.Origin, update.ChannelMessage.Msg)
+	case update.IndexedFile != nil:
+		f := file{update.IndexedFile.Filename, update.IndexedFile.Metahash}
+		m.constructing, m.available = removeFile(m.constructing, f.metahash), removeFile(m.available, f.metahash)
+		m.indexed = append(removeFile(m.indexed, f.metahash), f)
+	case update.RemovedFile != nil:
+		m.indexed = removeFile(m.indexed, update.RemovedFile.Metahash)
+	case update.ConstructingFile != nil:
+		f := file{update.ConstructingFile.Filename, update.ConstructingFile.Metahash}
+		m.available = removeFile(m.available, f.metahash)
+		m.constructing = append(removeFile(m.constructing, f.metahash), f)
+	case update.AvailableFile != nil:
+		f := file{update.AvailableFile.Filename, update.AvailableFile.Metahash}
+		if !hasFile(m.indexed, f.metahash) && !hasFile(m.constructing, f.metahash) {
+			m.available = append(removeFile(m.available, f.metahash), f)
+		}
+	case update.Artist != nil:
+		for _, artist := range m.artists {
+			if artist.Info.Signature == update.Artist.Info.Signature {
+				return
+			}
+		}
+		m.artists = append(m.artists, backend.FrontendArtistState{Info: update.Artist.Info})
+	case update.AvailableArtwork != nil:
+		m.artworks = append(m.artworks, *update.AvailableArtwork)
+	}
+}
+
+// post - Adds a message to a conversation, forgetting the oldest ones
+func (m *model) post(feed, from, text string) {
+	messages := append(m.feeds[feed], message{unescape.Replace(from), unescape.Replace(text)})
+	if len(messages) > MaxFeedMessages {
+		messages = messages[len(messages)-MaxFeedMessages:]
+	}
+	m.feeds[feed] = messages
+}
+
+// setSubscribed - Marks an artist as subscribed to
+func (m *model) setSubscribed(signature string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for i := range m.artists {
+		if m.artists[i].Info.Signature == signature {
+			m.artists[i].Subscribed = true
+		}
+	}
+}
+
+// setSearch - Replaces the state of the last search
+func (m *model) setSearch(search *backend.SearchResponse) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.search = search
+}
+
+// addString - Adds a string to a list if it isn't there yet
+func addString(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// removeString - Removes a string from a list
+func removeString(list []string, s string) []string {
+	for i, item := range list {
+		if item == s {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// hasFile - Checks whether a list of files holds a metahash
+func hasFile(list []file, metahash string) bool {
+	for _, f := range list {
+		if f.metahash == metahash {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFile - Removes a metahash from a list of files
+func removeFile(list []file, metahash string) []file {
+	for i, f := range list {
+		if f.metahash == metahash {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
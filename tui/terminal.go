@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Keys read from the terminal
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyTab       = 9
+	keyEnter     = 13
+	keyNewline   = 10
+	keyCtrlL     = 12
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+	keyCtrlH     = 8
+)
+
+// terminal - The terminal in which the client runs: keys are read one by one and the screen is redrawn
+// with ANSI escape sequences
+type terminal struct {
+	saved string // The settings of the terminal before the client started
+}
+
+// openTerminal - Switches the terminal to reading keys one by one without echoing them (with stty, so
+// that the client has no dependency). Ctrl-C is read as a key rather than raising SIGINT.
+func openTerminal() (*terminal, error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("the terminal client needs an interactive terminal: %s", err.Error())
+	}
+	if _, err := stty("-icanon", "-echo", "-icrnl", "-isig", "min", "1"); err != nil {
+		return nil, err
+	}
+	term := &terminal{saved: strings.TrimSpace(saved)}
+	fmt.Print("\x1b[?1049h\x1b[2J") // Alternate screen, cleared
+	return term, nil
+}
+
+// close - Restores the terminal as it was
+func (term *terminal) close() {
+	fmt.Print("\x1b[?1049l")
+	stty(term.saved)
+}
+
+// size - Returns the width and height of the terminal (80x24 if unknown)
+func (term *terminal) size() (int, int) {
+	out, err := stty("size")
+	if err == nil {
+		if fields := strings.Fields(out); len(fields) == 2 {
+			height, err1 := strconv.Atoi(fields[0])
+			width, err2 := strconv.Atoi(fields[1])
+			if err1 == nil && err2 == nil && width > 0 && height > 0 {
+				return width, height
+			}
+		}
+	}
+	return 80, 24
+}
+
+// draw - Replaces the screen by rows of text and puts the cursor at a column of the last row
+func (term *terminal) draw(rows []string, cursor int) {
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+	for i, row := range rows {
+		if i > 0 {
+			screen.WriteString("\r\n")
+		}
+		screen.WriteString(row)
+		screen.WriteString("\x1b[K")
+	}
+	fmt.Fprintf(&screen, "\x1b[J\x1b[%d;%dH", len(rows), cursor+1)
+	os.Stdout.WriteString(screen.String())
+}
+
+// stty - Runs stty on the terminal of the client
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// fit - Cuts or pads a line to a width (in characters). Control characters are dropped, so that the
+// messages of other peers can't send escape sequences to the terminal.
+func fit(line string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	line = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, line)
+	count := utf8.RuneCountInString(line)
+	if count > width {
+		runes := []rune(line)
+		return string(runes[:width-1]) + "…"
+	}
+	return line + strings.Repeat(" ", width-count)
+}
+
+// wrap - Splits a text into lines of at most a width (in characters), indenting the following lines
+func wrap(text string, width int, indent int) []string {
+	runes := []rune(strings.Replace(text, "\n", " ", -1))
+	if width <= indent+1 {
+		return []string{string(runes)}
+	}
+	var lines []string
+	for first := true; len(runes) > 0; first = false {
+		room := width
+		prefix := ""
+		if !first {
+			room -= indent
+			prefix = strings.Repeat(" ", indent)
+		}
+		if len(runes) <= room {
+			lines = append(lines, prefix+string(runes))
+			break
+		}
+
+		// Cut at the last space if there is one
+		cut := room
+		for i := room; i > room/2; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, prefix+string(runes[:cut]))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return lines
+}
+
+// reverse - Shows a text in reverse video
+func reverse(text string) string {
+	return "\x1b[7m" + text + "\x1b[0m"
+}
+
+// bold - Shows a text in bold
+func bold(text string) string {
+	return "\x1b[1m" + text + "\x1b[0m"
+}
@@ -14,7 +14,7 @@ func HashToHex(hash []byte) string {
 func HexToHash(hexHash string) []byte {
 	hash, err := hex.DecodeString(hexHash)
 	if err != nil {
-		fail.HandleAbort(fmt.Sprint("could not decode hexadecimal string '%s'", hexHash), err)
+		fail.HandleAbort(fmt.Sprintf("could not decode hexadecimal string '%s'", hexHash), err)
 		return nil
 	}
 	return hash